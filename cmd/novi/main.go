@@ -2,6 +2,8 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -15,15 +17,43 @@ import (
 
 var log = logger.GetLogger("main")
 
+// listSwaps prints the swap files that can be recovered using -r
+func listSwaps() {
+	swaps := novi.FindSwapFiles(".", novi.DefaultSwapDir())
+	if len(swaps) == 0 {
+		fmt.Println("No swap files found")
+		return
+	}
+	fmt.Println("Swap files found:")
+	for i, swap := range swaps {
+		running := ""
+		if swap.Running {
+			running = " (STILL RUNNING)"
+		}
+		fmt.Printf("%d. %s\n", i+1, swap.Path)
+		fmt.Printf("    file name: %s\n", swap.File)
+		fmt.Printf("    modified: %s, %d changes\n", swap.ModTime.Format(time.RFC1123), swap.Changes)
+		fmt.Printf("    host name: %s, process ID: %d%s\n", swap.Host, swap.PID, running)
+	}
+}
+
 func start() {
 
 	var sizeFlag string
 	var emuFlag string
+	var recoverFlag bool
+	var view novi.ViewOptions
 	var w, h int
 	var err error
 
 	flag.StringVar(&sizeFlag, "area", "", "Edit area size")
 	flag.StringVar(&emuFlag, "emu", "basic", "Emulation to use")
+	flag.BoolVar(&recoverFlag, "r", false, "List swap files, or recover the given file")
+	flag.IntVar(&view.ScrollOff, "scrolloff", 0, "Lines to keep above and below the cursor")
+	flag.IntVar(&view.SideScrollOff, "sidescrolloff", 0, "Columns to keep left and right of the cursor")
+	flag.BoolVar(&view.Wrap, "wrap", false, "Wrap long lines")
+	flag.BoolVar(&view.LineBreak, "linebreak", false, "Wrap long lines at blanks")
+	flag.StringVar(&view.ShowBreak, "showbreak", "", "Shown at the start of wrapped rows")
 
 	flag.Parse()
 	if sizeFlag != "" {
@@ -46,22 +76,49 @@ func start() {
 	log.Printf("Starting at %s\n", time.Now())
 	defer logger.CloseLog()
 
-	editor := novi.NewEditor()
-	ui := termui.NewTermUI(editor)
-	ui.SetSize(w, h)
-	defer novi.RecoverFromPanic(func() {
-		ui.Finish()
-	})
-
 	fileName := ""
 
 	if len(flag.Args()) > 0 {
 		fileName = flag.Args()[0]
 	}
 
-	editor.LoadFile(fileName)
+	if recoverFlag && fileName == "" {
+		listSwaps()
+		return
+	}
+
+	editor := novi.NewEditor()
+	editor.ViewOptions = view
+	if recoverFlag {
+		if err := editor.LoadFile(fileName); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+		if _, err := editor.RecoverSwap(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+	} else if err := editor.LoadFileAsync(fileName); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	// the other files are loaded once they're shown
+	if len(flag.Args()) > 1 {
+		for _, name := range flag.Args()[1:] {
+			editor.AddFile(name)
+		}
+	}
 	editor.SetCursor(8, 0)
 
+	ui := termui.NewTermUI(editor)
+	ui.SetSize(w, h)
+	defer novi.RecoverFromPanic(func() {
+		ui.Finish()
+		if err := editor.FlushSwap(); err != nil {
+			fmt.Println(err)
+		}
+	})
+
 	var emu novi.Emulation
 
 	if emuFlag == "vi" {
@@ -20,6 +20,7 @@ var log = logger.GetLogger("basicemu")
  *
  * Ctrl-s - save
  * Ctrl-q - quite
+ * Ctrl-z, Ctrl-y - undo, redo
  * Home/End - start/end line
  * pgup, pgdn
  * insert: toggle overwrite/insert-move (include change cursor)
@@ -29,7 +30,8 @@ var log = logger.GetLogger("basicemu")
 type Basic struct {
 	Editor *novi.Editor
 
-	c chan novi.EmuEvent
+	c      chan novi.EmuEvent
+	typing bool
 }
 
 func NewBasic(e *novi.Editor) *Basic {
@@ -53,22 +55,29 @@ func (em *Basic) SetChan(c chan novi.EmuEvent) {
 
 func (em *Basic) Backspace() {
 	for _, c := range em.Editor.Cursors {
+		// the buffer takes care of moving c and all other cursors
 		if c.Pos > 0 {
 			em.Editor.Buffer.RemoveRuneBeforeCursor(c)
-			Move(c, novi.CursorLeft)
 		} else if c.Line > 0 {
-			// first move the cursor so we can use CursorEnd to move to the desired position
-			l := c.Line
-			Move(c, novi.CursorUp)
-			Move(c, novi.CursorEnd)
-			em.Editor.Buffer.JoinLineWithPrevious(l)
-
-			// adjust all other cursors that are on/after l
-			// XXX Untested
-			// XXX also wrong, also changes cursors *before* line.
-			for _, cc := range em.Editor.Cursors.After(c) {
-				Move(cc, novi.CursorUp)
-			}
+			em.Editor.Buffer.JoinLineWithPrevious(c.Line)
+		}
+	}
+}
+
+// Page scrolls a page up or down, the cursors move along
+func (em *Basic) Page(movement novi.CursorDirection) {
+	v := &em.Editor.Viewport
+	rows := v.Rows()
+	if movement == novi.CursorUp {
+		em.Editor.ScrollTo(v.Line - rows)
+	} else if line := v.Line + rows; line+rows <= em.Editor.Buffer.Length() {
+		em.Editor.ScrollTo(line)
+	} else {
+		em.Editor.ScrollTo(em.Editor.Buffer.Length() - rows)
+	}
+	for _, c := range em.Editor.Cursors {
+		for i := 0; i < rows; i++ {
+			Move(c, movement)
 		}
 	}
 }
@@ -82,6 +91,22 @@ func (em *Basic) Backspace() {
  * Also, who is in charge of updating the cursor(s)?
  */
 func (em *Basic) HandleEvent(_ novi.InputID, event novi.Event) bool {
+	// A sequence of typed characters is undone as a whole, any other
+	// event is a separate change
+	_, typing := event.(*novi.CharacterEvent)
+	if em.typing && !typing {
+		em.Editor.Buffer.EndChange(em.Editor.Cursors)
+		em.typing = false
+	}
+	if !em.typing {
+		em.Editor.Buffer.BeginChange(em.Editor.Cursors)
+	}
+	if typing {
+		em.typing = true
+	} else {
+		defer em.Editor.Buffer.EndChange(em.Editor.Cursors)
+	}
+
 	switch ev := event.(type) {
 	case *novi.KeyEvent:
 		// control keys, purely control
@@ -91,6 +116,10 @@ func (em *Basic) HandleEvent(_ novi.InputID, event novi.Event) bool {
 				em.Backspace()
 			case 'q':
 				return false
+			case 'z':
+				em.Editor.Buffer.Undo(em.Editor.Cursors)
+			case 'y':
+				em.Editor.Buffer.Redo(em.Editor.Cursors)
 			case 's':
 				em.c <- &novi.SaveEvent{}
 				log.Println("File saved")
@@ -105,18 +134,31 @@ func (em *Basic) HandleEvent(_ novi.InputID, event novi.Event) bool {
 				em.Backspace()
 			case novi.KeyEnter:
 				for _, c := range em.Editor.Cursors {
+					// cursors after c are moved down by the buffer
 					em.Editor.Buffer.SplitLine(c)
 					Move(c, novi.CursorDown)
 					Move(c, novi.CursorBegin)
-					// update all cursors after
-					for _, ca := range em.Editor.Cursors.After(c) {
-						ca.Line++
+				}
+			case novi.KeyUp, novi.KeyDown:
+				// move a screen row (which is a line unless wrapping), keeping
+				// the screen column rather than the position in the line
+				n := 1
+				if ev.Key == novi.KeyUp {
+					n = -1
+				}
+				for _, c := range em.Editor.Cursors {
+					if line, pos, ok := em.Editor.MoveScreenRows(c.Line, c.Pos, n); ok {
+						c.Line, c.Pos = line, pos
 					}
 				}
-			case novi.KeyLeft, novi.KeyRight, novi.KeyUp, novi.KeyDown, novi.KeyHome, novi.KeyEnd:
+			case novi.KeyLeft, novi.KeyRight, novi.KeyHome, novi.KeyEnd:
 				for _, c := range em.Editor.Cursors {
 					Move(c, novi.CursorMap[ev.Key])
 				}
+			case novi.KeyPgUp:
+				em.Page(novi.CursorUp)
+			case novi.KeyPgDn:
+				em.Page(novi.CursorDown)
 			default:
 				log.Printf("Don't know what to do with key event %+v", ev)
 			}
@@ -141,6 +183,6 @@ func (em *Basic) GetStatus(width int) string {
 		changed = "(changed) "
 	}
 	// Make use of width to align cursor row/col right. Truncate if necessary
-	return fmt.Sprintf("%s %srow %d col %d (INS)",
-		em.Editor.GetFilename(), changed, first.Line+1, first.Pos+1)
+	return fmt.Sprintf("%s %s[%s] row %d col %d (INS)",
+		em.Editor.GetFilename(), changed, em.Editor.Buffer.Format, first.Line+1, first.Pos+1)
 }
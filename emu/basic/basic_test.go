@@ -0,0 +1,119 @@
+package basicemu
+
+import (
+	"testing"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+func SetupBasic(lines ...string) *Basic {
+	editor := novi.NewEditor()
+	editor.Buffer.LoadStrings(lines)
+	editor.SetCursor(0, 0)
+	emu := NewBasic(editor)
+	emu.SetChan(make(chan novi.EmuEvent, 100))
+	return emu
+}
+
+func TestUndo(t *testing.T) {
+	t.Run("Typed text is undone as a whole", func(t *testing.T) {
+		em := SetupBasic("world")
+		for _, r := range "hello " {
+			em.HandleEvent(0, &novi.CharacterEvent{Rune: r})
+		}
+		em.HandleEvent(0, &novi.KeyEvent{Key: novi.KeyEnter})
+		novi.AssertBufferMatch(t, em.Editor.Buffer, "hello ", "world")
+
+		em.HandleEvent(0, &novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'z'})
+		novi.AssertBufferMatch(t, em.Editor.Buffer, "hello world")
+
+		em.HandleEvent(0, &novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'z'})
+		novi.AssertBufferMatch(t, em.Editor.Buffer, "world")
+		novi.AssertCursor(t, em.Editor.Cursors[0], 0, 0)
+	})
+	t.Run("Redo", func(t *testing.T) {
+		em := SetupBasic("world")
+		em.HandleEvent(0, &novi.CharacterEvent{Rune: '!'})
+		em.HandleEvent(0, &novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'z'})
+		em.HandleEvent(0, &novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'y'})
+		novi.AssertBufferMatch(t, em.Editor.Buffer, "!world")
+		novi.AssertCursor(t, em.Editor.Cursors[0], 0, 1)
+	})
+}
+
+func TestMultipleCursors(t *testing.T) {
+	t.Run("Enter moves cursors after it down", func(t *testing.T) {
+		em := SetupBasic("hello world", "second")
+		em.Editor.SetCursor(0, 5)
+		em.Editor.Cursors = append(em.Editor.Cursors, em.Editor.Buffer.NewCursor(1, 3))
+		em.HandleEvent(0, &novi.KeyEvent{Key: novi.KeyEnter})
+
+		novi.AssertBufferMatch(t, em.Editor.Buffer, "hello", " world", "sec", "ond")
+		novi.AssertCursor(t, em.Editor.Cursors[0], 1, 0)
+		novi.AssertCursor(t, em.Editor.Cursors[1], 3, 0)
+	})
+	t.Run("Backspace on the same line", func(t *testing.T) {
+		em := SetupBasic("abcdef")
+		em.Editor.SetCursor(0, 2)
+		em.Editor.Cursors = append(em.Editor.Cursors, em.Editor.Buffer.NewCursor(0, 5))
+		em.HandleEvent(0, &novi.KeyEvent{Key: novi.KeyBackspace})
+
+		novi.AssertBufferMatch(t, em.Editor.Buffer, "acdf")
+		novi.AssertCursor(t, em.Editor.Cursors[0], 0, 1)
+		novi.AssertCursor(t, em.Editor.Cursors[1], 0, 3)
+	})
+	t.Run("Backspace joining lines", func(t *testing.T) {
+		em := SetupBasic("one", "two", "three")
+		em.Editor.SetCursor(1, 0)
+		em.Editor.Cursors = append(em.Editor.Cursors, em.Editor.Buffer.NewCursor(2, 2))
+		em.HandleEvent(0, &novi.KeyEvent{Key: novi.KeyBackspace})
+
+		novi.AssertBufferMatch(t, em.Editor.Buffer, "onetwo", "tree")
+		novi.AssertCursor(t, em.Editor.Cursors[0], 0, 3)
+		novi.AssertCursor(t, em.Editor.Cursors[1], 1, 1)
+	})
+}
+
+func TestPage(t *testing.T) {
+	var lines []string
+	for i := 0; i < 25; i++ {
+		lines = append(lines, "line")
+	}
+	em := SetupBasic(lines...)
+	em.Editor.UpdateViewport(80, 10)
+
+	em.HandleEvent(0, &novi.KeyEvent{Key: novi.KeyPgDn})
+	novi.AssertCursor(t, em.Editor.Cursors[0], 10, 0)
+	if first, last := em.Editor.VisibleLines(); first != 10 || last != 19 {
+		t.Errorf("Expected lines 10-19 to be visible, got %d-%d", first, last)
+	}
+
+	// the last page is a full page
+	em.HandleEvent(0, &novi.KeyEvent{Key: novi.KeyPgDn})
+	novi.AssertCursor(t, em.Editor.Cursors[0], 20, 0)
+	if first, _ := em.Editor.VisibleLines(); first != 15 {
+		t.Errorf("Expected line 15 at the top, got %d", first)
+	}
+
+	em.HandleEvent(0, &novi.KeyEvent{Key: novi.KeyPgUp})
+	novi.AssertCursor(t, em.Editor.Cursors[0], 10, 0)
+	if first, _ := em.Editor.VisibleLines(); first != 5 {
+		t.Errorf("Expected line 5 at the top, got %d", first)
+	}
+}
+
+func TestWrappedUpDown(t *testing.T) {
+	em := SetupBasic("0123456789abcdefghij", "xy")
+	em.Editor.ViewOptions.Wrap = true
+	em.Editor.UpdateViewport(8, 10)
+	em.Editor.SetCursor(0, 2)
+
+	em.HandleEvent(0, &novi.KeyEvent{Key: novi.KeyDown})
+	novi.AssertCursor(t, em.Editor.Cursors[0], 0, 10)
+	em.HandleEvent(0, &novi.KeyEvent{Key: novi.KeyDown})
+	novi.AssertCursor(t, em.Editor.Cursors[0], 0, 18)
+	em.HandleEvent(0, &novi.KeyEvent{Key: novi.KeyDown})
+	novi.AssertCursor(t, em.Editor.Cursors[0], 1, 2)
+	em.HandleEvent(0, &novi.KeyEvent{Key: novi.KeyUp})
+	novi.AssertCursor(t, em.Editor.Cursors[0], 0, 18)
+}
@@ -0,0 +1,172 @@
+package viemu
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+/*
+ * Ex addresses select the lines an ex command works on. An address is one of
+ *
+ * N          line N, 0 is the line before the first for commands like :m
+ * .          the current line
+ * $          the last line
+ * 'x         the line of mark x, e.g. '< and '> for the last selection
+ * /pat/      the next line matching pat, ?pat? the previous one
+ *
+ * optionally followed by offsets (+N, -N, or just + or -). An address that's
+ * only an offset is relative to the current line.
+ *
+ * A range is % (all lines) or addresses separated by , or ; where ; makes
+ * the address before it the current line for the ones after it, e.g.
+ * "/foo/;+2". A missing address after a separator is the current line.
+ */
+
+// exRange is the range of lines an ex command applies to
+type exRange struct {
+	start, end int // the first and last line, -1 for line 0
+	count      int // the number of addresses given
+}
+
+// parseNumber parses the number at the start of s, returning its length
+func parseNumber(s string) (int, int) {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	n, _ := strconv.Atoi(s[:i])
+	return n, i
+}
+
+// patternLine returns the line of the next (or previous) match of a pattern,
+// searching from the line after (or before) line. An empty pattern is the
+// last search pattern
+func (em *Vi) patternLine(pattern string, line int, backward bool) (int, error) {
+	if pattern == "" {
+		if em.lastSearch == nil {
+			return 0, errors.New("E35: No previous regular expression")
+		}
+		pattern = em.lastSearch.pattern
+	}
+	search, err := em.compile(pattern)
+	if err != nil {
+		return 0, errors.New("E383: Invalid search string: " + pattern)
+	}
+	em.lastSearch = &viSearch{pattern: pattern, backward: backward}
+	pos := em.Editor.Buffer.GetLine(line).Len()
+	if backward {
+		pos = 0
+	}
+	m, found := em.findMatch(search, line, pos, backward, false)
+	if !found {
+		return 0, errors.New("E486: Pattern not found: " + pattern)
+	}
+	return m.Line, nil
+}
+
+// parseAddress parses the address at the start of s, relative to line cur. It
+// returns the line, the rest of s and whether there was an address at all
+func (em *Vi) parseAddress(s string, cur int) (int, string, bool, error) {
+	line, found := cur, true
+	switch {
+	case s == "":
+		found = false
+	case s[0] == '.':
+		s = s[1:]
+	case s[0] == '$':
+		line, s = em.Editor.Buffer.Length()-1, s[1:]
+	case s[0] >= '0' && s[0] <= '9':
+		n, l := parseNumber(s)
+		line, s = n-1, s[l:]
+	case s[0] == '\'':
+		if len(s) < 2 {
+			return 0, "", false, errors.New("E20: Mark not set")
+		}
+		var err error
+		if line, err = em.markLine(rune(s[1])); err != nil {
+			return 0, "", false, err
+		}
+		s = s[2:]
+	case s[0] == '/' || s[0] == '?':
+		pattern, rest, _ := splitDelimited(s[1:], rune(s[0]))
+		var err error
+		if line, err = em.patternLine(pattern, cur, s[0] == '?'); err != nil {
+			return 0, "", false, err
+		}
+		s = rest
+	default:
+		found = false
+	}
+	for len(s) > 0 && (s[0] == '+' || s[0] == '-' || found && s[0] >= '0' && s[0] <= '9') {
+		sign := 1
+		if s[0] == '-' {
+			sign = -1
+		}
+		if s[0] == '+' || s[0] == '-' {
+			s = s[1:]
+		}
+		n, l := parseNumber(s)
+		if l == 0 {
+			n = 1
+		}
+		line, s, found = line+sign*n, s[l:], true
+	}
+	return line, s, found, nil
+}
+
+// parseRange parses the range at the start of an ex command. Without a range
+// it's the current line. It returns the range and the rest of the command
+func (em *Vi) parseRange(cmd string) (exRange, string, error) {
+	cur := em.Editor.Cursors[0].Line
+	if strings.HasPrefix(cmd, "%") {
+		return exRange{0, em.Editor.Buffer.Length() - 1, 2}, cmd[1:], nil
+	}
+	var lines []int
+	s := cmd
+	for {
+		line, rest, found, err := em.parseAddress(s, cur)
+		if err != nil {
+			return exRange{}, "", err
+		}
+		separated := len(rest) > 0 && (rest[0] == ',' || rest[0] == ';')
+		if found || separated || len(lines) > 0 {
+			lines = append(lines, line)
+		}
+		if !separated {
+			s = rest
+			break
+		}
+		if rest[0] == ';' {
+			cur = line
+		}
+		s = rest[1:]
+	}
+	r := exRange{cur, cur, len(lines)}
+	switch len(lines) {
+	case 0:
+	case 1:
+		r.start, r.end = lines[0], lines[0]
+	default:
+		r.start, r.end = lines[len(lines)-2], lines[len(lines)-1]
+	}
+	if r.start > r.end {
+		r.start, r.end = r.end, r.start
+	}
+	return r, s, nil
+}
+
+// validate checks that the range is within the buffer. Line 0 is only
+// allowed if zero is set, otherwise it's taken as line 1
+func (r *exRange) validate(lines int, zero bool) error {
+	if !zero && r.start == -1 {
+		r.start = 0
+		if r.end == -1 {
+			r.end = 0
+		}
+	}
+	if r.start < -1 || r.end >= lines {
+		return errors.New("E16: Invalid range")
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package viemu
+
+import "testing"
+
+func TestParseRange(t *testing.T) {
+	for _, tc := range []struct {
+		cmd        string
+		start, end int
+		count      int
+		rest       string
+	}{
+		{"d", 2, 2, 0, "d"},
+		{"5", 4, 4, 1, ""},
+		{"%s", 0, 5, 2, "s"},
+		{".,$", 2, 5, 2, ""},
+		{"$,1", 0, 5, 2, ""},
+		{"+1", 3, 3, 1, ""},
+		{"-", 1, 1, 1, ""},
+		{".+2,$-1y", 4, 4, 2, "y"},
+		{"1,", 0, 2, 2, ""},
+		{",3", 2, 2, 2, ""},
+		{"/foo/", 4, 4, 1, ""},
+		{"?foo?,.", 1, 2, 2, ""},
+		{"/foo/+1", 5, 5, 1, ""},
+		{"1;/foo/", 0, 1, 2, ""},
+		{"1,/foo/", 0, 4, 2, ""},
+		{"1,2,3", 1, 2, 3, ""},
+		{"0", -1, -1, 1, ""},
+	} {
+		t.Run(tc.cmd, func(t *testing.T) {
+			vi, _ := SetupViAndCursor(ModeCommand, 2, 0, "a", "foo", "b", "c", "foo", "d")
+			r, rest, err := vi.parseRange(tc.cmd)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if r.start != tc.start || r.end != tc.end || r.count != tc.count || rest != tc.rest {
+				t.Errorf("Expected %d,%d (%d) %q, got %d,%d (%d) %q", tc.start, tc.end, tc.count,
+					tc.rest, r.start, r.end, r.count, rest)
+			}
+		})
+	}
+}
@@ -62,6 +62,16 @@ func WordStarts(l *novi.Line, SepAndAlnum bool) []int {
 	return res
 }
 
+// isWordStart returns true if a word starts at pos
+func isWordStart(l *novi.Line, pos int) bool {
+	for _, p := range WordStarts(l, false) {
+		if p == pos {
+			return true
+		}
+	}
+	return false
+}
+
 // WordEnds finds all the endings of words in a given line.
 // words are either sequences of alphanum or non-whitespace,
 // e,g ab123 []=-- or sequences of alphanum *and* non-ws
@@ -98,7 +108,7 @@ func JumpAlNumSepForward(b *novi.Buffer, c *novi.Cursor, alnumSepSame bool) (int
 	line, pos := c.Line, c.Pos
 
 	for line < b.Length() {
-		l := b.Lines[line]
+		l := b.GetLine(line)
 
 		positions := WordStarts(l, alnumSepSame)
 
@@ -110,7 +120,7 @@ func JumpAlNumSepForward(b *novi.Buffer, c *novi.Cursor, alnumSepSame bool) (int
 		pos = -1 // make sure we're really smaller, so we will match on pos 0
 		line++
 	}
-	return b.Length() - 1, b.Lines[b.Length()-1].Len() - 1
+	return b.Length() - 1, b.GetLine(b.Length()-1).Len() - 1
 }
 
 // JumpForward jumps to the next sequence of alphanum or separators, skipping whitespace
@@ -129,7 +139,7 @@ func JumpAlNumSepBackward(b *novi.Buffer, c *novi.Cursor, alnumSepSame bool) (in
 	line, pos := c.Line, c.Pos
 
 	for line >= 0 {
-		l := b.Lines[line]
+		l := b.GetLine(line)
 		positions := WordStarts(l, alnumSepSame)
 		lastPos := -1
 
@@ -149,7 +159,7 @@ func JumpAlNumSepBackward(b *novi.Buffer, c *novi.Cursor, alnumSepSame bool) (in
 		// continue to the next line, position cursor at the end
 		line--
 		if line >= 0 {
-			pos = b.Lines[line].Len() + 1 // add one so we're larger than a match at the end
+			pos = b.GetLine(line).Len() + 1 // add one so we're larger than a match at the end
 		}
 	}
 	return 0, 0
@@ -171,7 +181,7 @@ func JumpAlNumSepForwardEnd(b *novi.Buffer, c *novi.Cursor, alnumSepSame bool) (
 	line, pos := c.Line, c.Pos
 
 	for line < b.Length() {
-		l := b.Lines[line]
+		l := b.GetLine(line)
 
 		positions := WordEnds(l, alnumSepSame)
 
@@ -183,7 +193,7 @@ func JumpAlNumSepForwardEnd(b *novi.Buffer, c *novi.Cursor, alnumSepSame bool) (
 		pos = -1 // make sure we're really smaller, so we will match on pos 0
 		line++
 	}
-	return b.Length() - 1, b.Lines[b.Length()-1].Len() - 1
+	return b.Length() - 1, b.GetLine(b.Length()-1).Len() - 1
 }
 
 // JumpForwardEnd implements "b" behaviour, the beginning of the previous sequence of alphanum or other non-whitespace
@@ -1,71 +1,324 @@
 package viemu
 
 import (
+	"fmt"
 	"math"
 	"strconv"
 	"strings"
+
+	"github.com/iivvoo/novi/novi"
 )
 
-// ParseCommand attempts to parse vi command mode commands into count + command
-func ParseCommand(command string) (int, string) {
-	/*
-	 * a vi(m?) command has the structure
-	 * <number?>character
-	 * <number?>character(<number?>character)? e.g. 2d3d -> 6dd, or d10d -> 10dd
-	 *
-	 * (vim actually understands <num><keyup>!)
-	 * Also, 2d0 is executed immediately and deletes to home
-	 */
-	count := 1
-	cmd := ""
-	numMode := false
-
-	storeCount := func(sub string) {
-		if sub != "" {
-			if v, e := strconv.Atoi(sub); e != nil {
-				// can only happen with an overflowing number. Not sure what the right
-				// cause of action would be
-				count = math.MaxInt64
+/*
+ * The command grammar is
+ *
+ * [count]operator[count]motion    e.g. d$, c2e, 3y}
+ * [count]operator[count]object    a text object, e.g. diw, c2a(
+ * [count]operator[operator]       the operator on count lines, e.g. 3dd, gUU
+ * [count]motion                   e.g. 3w, G, 2fx
+ * [count]command                  e.g. 2p, u
+ * [count]command{char}            a command that takes a character, e.g. qa, 3@a
+ * [count]/pattern<cr>             a search, which is a motion, e.g. d/foo<cr>
+ *
+ * A register ("x) is selected separately, see HandleSelectRegister. Counts
+ * before and after the operator multiply, so 2d3w deletes 6 words. In select
+ * mode an operator works on the selection and doesn't take a motion, and a
+ * text object extends the selection.
+ */
+
+// ViCommand is a parsed command
+type ViCommand struct {
+	Count    int // 0 if no count was given
+	Operator string
+	Motion   string
+	Object   string // a text object, e.g. "iw"
+	Command  string
+	Arg      rune // the character following a command that takes one
+}
+
+// count returns the count, defaulting to 1
+func (cmd *ViCommand) count() int {
+	if cmd.Count == 0 {
+		return 1
+	}
+	return cmd.Count
+}
+
+// argCommands are the commands that take a character argument
+var argCommands = map[string]bool{
+	"q": true,
+	"@": true,
+	"m": true,
+}
+
+// commandAliases are shorthands for an operator and motion
+var commandAliases = map[string]string{
+	"x": "dl",
+	"X": "dh",
+	"D": "d$",
+	"C": "c$",
+	"s": "cl",
+	"S": "cc",
+	"Y": "yy",
+}
+
+// splitCount splits a leading count from keys. A count doesn't start with
+// 0, since that's a motion by itself. It returns 0 if there's no count
+func splitCount(keys string) (int, string) {
+	i := 0
+	for i < len(keys) && keys[i] >= '0' && keys[i] <= '9' && (i > 0 || keys[i] != '0') {
+		i++
+	}
+	if i == 0 {
+		return 0, keys
+	}
+	count, err := strconv.Atoi(keys[:i])
+	if err != nil {
+		count = math.MaxInt32
+	}
+	return count, keys[i:]
+}
+
+// multiplyCounts combines the counts before and after an operator
+func multiplyCounts(a, b int) int {
+	switch {
+	case a == 0:
+		return b
+	case b == 0:
+		return a
+	}
+	return a * b
+}
+
+// initCommands registers the commands that aren't motions or operators
+func (em *Vi) initCommands() {
+	em.commands = map[string]func(cmd *ViCommand) bool{
+		"p": func(cmd *ViCommand) bool {
+			em.Put(cmd.count(), false)
+			return true
+		},
+		"P": func(cmd *ViCommand) bool {
+			em.Put(cmd.count(), true)
+			return true
+		},
+		"u": func(cmd *ViCommand) bool {
+			em.Undo(cmd.count())
+			return true
+		},
+		".": func(cmd *ViCommand) bool {
+			return em.Repeat(cmd.Count)
+		},
+		"q": func(cmd *ViCommand) bool {
+			if em.recording != 0 {
+				em.StopRecording()
 			} else {
-				count *= v
+				em.StartRecording(cmd.Arg)
 			}
+			return true
+		},
+		"@": func(cmd *ViCommand) bool {
+			return em.PlayMacro(cmd.Arg, cmd.count())
+		},
+		"m": func(cmd *ViCommand) bool {
+			return em.SetMark(cmd.Arg)
+		},
+		"zz": em.scrollCursor,
+		"zt": em.scrollCursor,
+		"zb": em.scrollCursor,
+		"gn": em.selectMatch,
+		"gN": em.selectMatch,
+		"ZZ": func(*ViCommand) bool {
+			em.c <- &novi.SaveEvent{}
+			em.c <- &novi.QuitEvent{}
+			return true
+		},
+		"ZQ": func(*ViCommand) bool {
+			em.c <- &novi.QuitEvent{Force: true}
+			return false // signals exit
+		},
+	}
+}
+
+// isPrefix returns true if keys is the start of any of the names
+func isPrefix(keys string, names ...string) bool {
+	for _, name := range names {
+		if strings.HasPrefix(name, keys) {
+			return true
+		}
+	}
+	return false
+}
+
+// motionKeys returns the keys of all motions
+func (em *Vi) motionKeys() []string {
+	var names []string
+	for name := range em.motions {
+		names = append(names, name)
+	}
+	return names
+}
+
+// keysOf returns the keys of all motions, operators and commands
+func (em *Vi) keysOf() []string {
+	names := em.motionKeys()
+	for name := range em.operators {
+		names = append(names, name)
+	}
+	for name := range em.commands {
+		names = append(names, name)
+	}
+	for name := range commandAliases {
+		names = append(names, name)
+	}
+	return names
+}
+
+// parseCommand parses the keys typed in command or select mode. It returns
+// nil if the keys are the start of a command but it's not complete yet, and
+// an error if they can't become a valid command
+func (em *Vi) parseCommand(keys string) (*ViCommand, error) {
+	count, rest := splitCount(keys)
+	if rest == "" {
+		return nil, nil
+	}
+	if alias, ok := commandAliases[rest]; ok && em.Mode != ModeSelect {
+		rest = alias
+	}
+	if em.Mode == ModeSelect {
+		if em.isTextObject(rest) {
+			return &ViCommand{Count: count, Object: rest}, nil
+		}
+		if isPrefix(rest, em.textObjectKeys()...) {
+			return nil, nil
 		}
 	}
 
-	storeCommand := func(sub string) {
-		if sub != "" {
-			cmd += sub
+	for op := range em.operators {
+		if !strings.HasPrefix(rest, op) {
+			continue
+		}
+		cmd := &ViCommand{Count: count, Operator: op}
+		if em.Mode == ModeSelect {
+			return cmd, nil
+		}
+		count2, motion := splitCount(rest[len(op):])
+		cmd.Count = multiplyCounts(count, count2)
+		name, arg, incomplete := em.matchMotion(motion)
+		switch {
+		case motion == "":
+			return nil, nil
+		case motion == op || motion == op[len(op)-1:]:
+			// doubled, e.g. dd, gUgU or gUU
+			return cmd, nil
+		case name != "":
+			cmd.Motion, cmd.Arg = name, arg
+			return cmd, nil
+		case em.isTextObject(motion):
+			cmd.Object = motion
+			return cmd, nil
+		case incomplete || isPrefix(motion, op) || isPrefix(motion, em.textObjectKeys()...):
+			return nil, nil
 		}
+		return nil, fmt.Errorf("Unknown motion %q", motion)
 	}
 
-	s, e := 0, 0
-	for e < len(command) {
-		r := rune(command[e])
-		if strings.IndexRune("0123456789", r) != -1 {
-			if numMode {
-				e++
-				continue
-			}
-			numMode = true
-			storeCommand(command[s:e])
-			s = e
-		} else {
-			if !numMode {
-				e++
-				continue
-			}
-			numMode = false
-			storeCount(command[s:e])
-			s = e
+	if name, arg, _ := em.matchMotion(rest); name != "" {
+		return &ViCommand{Count: count, Motion: name, Arg: arg}, nil
+	}
+	if rest == "q" && em.recording != 0 {
+		// stops recording, without a register
+		return &ViCommand{Count: count, Command: rest}, nil
+	}
+	for name := range argCommands {
+		if !strings.HasPrefix(rest, name) || em.Mode == ModeSelect {
+			continue
 		}
-		e++
+		arg := []rune(rest[len(name):])
+		switch len(arg) {
+		case 0:
+			return nil, nil
+		case 1:
+			return &ViCommand{Count: count, Command: name, Arg: arg[0]}, nil
+		}
+		return nil, fmt.Errorf("Unknown command %q", rest)
+	}
+	if em.commands[rest] != nil && em.Mode != ModeSelect {
+		return &ViCommand{Count: count, Command: rest}, nil
 	}
-	// store whatever is left
-	if numMode {
-		storeCount(command[s:e])
-	} else {
-		storeCommand(command[s:e])
+	if isPrefix(rest, em.keysOf()...) {
+		return nil, nil
 	}
+	return nil, fmt.Errorf("Unknown command %q", rest)
+}
 
-	return count, cmd
+// Execute executes a parsed command. It returns false if the editor should exit
+func (em *Vi) Execute(cmd *ViCommand) bool {
+	register := em.register
+	switch {
+	case cmd.Motion == "/" || cmd.Motion == "?":
+		// executed once the pattern is entered
+		em.StartSearch(cmd)
+	case cmd.Command != "":
+		res := em.commands[cmd.Command](cmd)
+		if cmd.Command == "p" || cmd.Command == "P" {
+			em.recordChange(register, cmd.Count, keyEvents(cmd.Command), false)
+		}
+		return res
+
+	case cmd.Object != "" && cmd.Operator == "":
+		em.selectTextObject(cmd)
+
+	case cmd.Operator != "" && em.Mode == ModeSelect:
+		keys := em.selectionKeys()
+		r := em.selectionRange()
+		c := em.Editor.Cursors[0]
+		em.CancelSelection()
+		em.operators[cmd.Operator](c, r, true)
+		if cmd.Operator != "y" && cmd.Operator != "!" {
+			em.recordChange(register, 0, append(keys, keyEvents(cmd.Operator)...), true)
+		}
+
+	case cmd.Operator != "":
+		done := false
+		for i, c := range em.Editor.Cursors {
+			if r, ok := em.operatorRange(c, cmd); ok {
+				em.operators[cmd.Operator](c, r, i == 0)
+				done = true
+			}
+		}
+		if !done {
+			em.failed = true
+		} else if cmd.Operator != "y" && cmd.Operator != "!" {
+			// ! only starts an ex command, which makes the change
+			motion := cmd.Motion + cmd.Object
+			if cmd.Arg != 0 {
+				motion += string(cmd.Arg)
+			}
+			if motion == "" {
+				motion = cmd.Operator
+			}
+			em.recordChange(register, cmd.Count, keyEvents(cmd.Operator+motion), false)
+		}
+
+	default:
+		motion := em.motions[cmd.Motion]
+		moved := false
+		from := *em.Editor.Cursors[0]
+		for _, c := range em.Editor.Cursors {
+			if l, p, ok := motion.Move(c, MotionArgs{Count: cmd.Count, Char: cmd.Arg}); ok {
+				c.Line, c.Pos = l, p
+				moved = true
+			}
+		}
+		if !moved {
+			em.failed = true
+		} else if jumpMotions[cmd.Motion] {
+			em.pushJump(from.Line, from.Pos)
+		}
+		if em.Mode == ModeSelect {
+			em.selectionMoved(cmd.Motion, moved)
+		}
+		em.UpdateSelection()
+	}
+	return true
 }
@@ -16,51 +16,40 @@ func AssertCommand(t *testing.T, gotCount int, gotCmd string, expectCount int, e
 	}
 }
 
-func TestCommandParsing(t *testing.T) {
+func TestSplitCount(t *testing.T) {
 	t.Run("Test single character", func(t *testing.T) {
-		count, cmd := ParseCommand("l")
+		count, cmd := splitCount("l")
 
-		AssertCommand(t, count, cmd, 1, "l")
+		AssertCommand(t, count, cmd, 0, "l")
 	})
 	t.Run("Test single with count", func(t *testing.T) {
-		count, cmd := ParseCommand("32l")
+		count, cmd := splitCount("32l")
 
 		AssertCommand(t, count, cmd, 32, "l")
-
-	})
-	t.Run("Test double character", func(t *testing.T) {
-		count, cmd := ParseCommand("dd")
-
-		AssertCommand(t, count, cmd, 1, "dd")
 	})
-	t.Run("Test double character, weird mix", func(t *testing.T) {
-		count, cmd := ParseCommand("2d3d")
+	t.Run("Test count in between", func(t *testing.T) {
+		count, cmd := splitCount("d3d")
 
-		AssertCommand(t, count, cmd, 6, "dd")
+		AssertCommand(t, count, cmd, 0, "d3d")
 	})
-	t.Run("Test double character, count in between", func(t *testing.T) {
-		count, cmd := ParseCommand("d3d")
+	t.Run("Test zero is not a count", func(t *testing.T) {
+		count, cmd := splitCount("0")
 
-		AssertCommand(t, count, cmd, 3, "dd")
+		AssertCommand(t, count, cmd, 0, "0")
 	})
 	t.Run("Test very long count", func(t *testing.T) {
-		count, cmd := ParseCommand("99999999999999999999999999999999999999999999999999999999999999999999999l")
-
-		AssertCommand(t, count, cmd, math.MaxInt64, "l")
-	})
-	t.Run("Test very long count 2", func(t *testing.T) {
-		ParseCommand("99999999999999999999999999999999999999999999999999999999999999999999999d999d")
+		count, cmd := splitCount("99999999999999999999999999999999999999999999999999999999999999999999999l")
 
-		// at this point I don't care about the count, as long as it doesn't crash
+		AssertCommand(t, count, cmd, math.MaxInt32, "l")
 	})
 	t.Run("Test just a number", func(t *testing.T) {
-		count, cmd := ParseCommand("999")
+		count, cmd := splitCount("999")
 
 		AssertCommand(t, count, cmd, 999, "")
 	})
 	t.Run("Test empty", func(t *testing.T) {
-		count, cmd := ParseCommand("")
+		count, cmd := splitCount("")
 
-		AssertCommand(t, count, cmd, 1, "")
+		AssertCommand(t, count, cmd, 0, "")
 	})
 }
@@ -9,7 +9,7 @@ import (
 // which Vi does in edit mode
 func (em *Vi) Move(c *novi.Cursor, movement novi.CursorDirection) {
 	maxPos := func(l *novi.Line) int {
-		limit := c.Buffer.Lines[c.Line].Len()
+		limit := c.Buffer.GetLine(c.Line).Len()
 		if em.Mode == ModeCommand {
 			return limit
 		}
@@ -19,30 +19,30 @@ func (em *Vi) Move(c *novi.Cursor, movement novi.CursorDirection) {
 	switch movement {
 	case novi.CursorUp:
 		if c.Line > 0 {
-			c.Line--
+			c.Line, c.Pos = c.Line-1, em.verticalPos(c.Line, c.Pos, c.Line-1)
 		}
 	case novi.CursorDown:
 		// weirdness because empty last line that we want to position on
-		if c.Line < len(c.Buffer.Lines)-1 {
-			c.Line++
+		if c.Line < c.Buffer.Length()-1 {
+			c.Line, c.Pos = c.Line+1, em.verticalPos(c.Line, c.Pos, c.Line+1)
 		}
 	case novi.CursorLeft:
 		if c.Pos > 0 {
 			c.Pos--
 		}
 	case novi.CursorRight:
-		if c.Pos < maxPos(c.Buffer.Lines[c.Line]) {
+		if c.Pos < maxPos(c.Buffer.GetLine(c.Line)) {
 			c.Pos++
 		}
 	case novi.CursorBegin:
 		c.Pos = 0
 	case novi.CursorEnd:
-		c.Pos = c.Buffer.Lines[c.Line].Len() - 1
+		c.Pos = c.Buffer.GetLine(c.Line).Len() - 1
 		if c.Pos < 0 {
 			c.Pos = 0
 		}
 	}
-	if l := maxPos(c.Buffer.Lines[c.Line]); c.Pos >= l {
+	if l := maxPos(c.Buffer.GetLine(c.Line)); c.Pos >= l {
 		c.Pos = l - 1
 	}
 	if c.Pos < 0 {
@@ -50,6 +50,14 @@ func (em *Vi) Move(c *novi.Cursor, movement novi.CursorDirection) {
 	}
 }
 
+// verticalPos returns the position on line that's shown in the same screen
+// column as pos on line from, so moving up and down keeps the visual column
+func (em *Vi) verticalPos(from, pos, line int) int {
+	b := em.Editor.Buffer
+	opts := em.Editor.ViewOptions
+	return opts.PosAt(b.GetLine(line), opts.Column(b.GetLine(from), pos))
+}
+
 // MoveMany moves the cursor more than one position, if possible
 func (em *Vi) MoveMany(c *novi.Cursor, movement novi.CursorDirection, count int) {
 	for i := 0; i < count; i++ {
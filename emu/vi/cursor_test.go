@@ -106,3 +106,30 @@ func TestCursorMove(t *testing.T) {
 	})
 	// left/right should actualy go to prev/next line, if possible
 }
+
+func TestVerticalColumn(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		line, pos int
+		keys      string
+		cline     int
+		cpos      int
+	}{
+		{"Down onto a tab", 0, 4, "j", 1, 1},
+		{"Down past a tab", 0, 8, "j", 1, 2},
+		{"Up past a tab", 1, 2, "k", 0, 8},
+		{"Down onto a wide character", 0, 4, "2j", 2, 2},
+		{"Up from a wide character", 2, 2, "2k", 0, 4},
+		{"Arrow down", 0, 9, "<down>", 1, 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			vi, cursor := SetupViAndCursor(ModeCommand, tc.line, tc.pos,
+				"abcdefghijk",
+				"a\tbc",
+				"日本語",
+			)
+			SendKeys(vi, tc.keys)
+			novi.AssertCursor(t, cursor, tc.cline, tc.cpos)
+		})
+	}
+}
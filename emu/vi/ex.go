@@ -1,6 +1,7 @@
 package viemu
 
 import (
+	"errors"
 	"strconv"
 	"strings"
 
@@ -62,14 +63,30 @@ func (i *Input) Insert(r rune) {
 	i.Pos++
 }
 
+// Set replaces the contents of the input, with the cursor at the end
+func (i *Input) Set(s string) {
+	i.Clear()
+	for _, r := range s {
+		i.Insert(r)
+	}
+}
+
 // Ex encapsulates the state of the ex buffer / mode
 type Ex struct {
-	input *Input
+	input  *Input
+	last   string // the last command executed, for the ':' register
+	active bool   // the input is being shown
+	prompt string // ":" for an ex command, "/" or "?" for a search
+
+	history map[string][]string // the input entered before, for ":" and "/"
+	histPos int                 // the history entry shown, len(history) for new input
+
+	awaitRegister bool // ctrl-r was pressed, the next key selects a register
 }
 
 // NewEx creates a new Ex instance
 func NewEx() *Ex {
-	return &Ex{input: NewInput()}
+	return &Ex{input: NewInput(), history: make(map[string][]string)}
 }
 
 // Clear clears the ex instance (input)
@@ -77,12 +94,57 @@ func (ex *Ex) Clear() {
 	ex.input.Clear()
 }
 
+// historyKind returns the history the input uses, searches in both
+// directions share theirs
+func (ex *Ex) historyKind() string {
+	if ex.prompt == "?" {
+		return "/"
+	}
+	return ex.prompt
+}
+
+// addHistory adds entered input to the history. Entering input that's in
+// the history already moves it to the end
+func (ex *Ex) addHistory(text string) {
+	if text == "" {
+		return
+	}
+	kind := ex.historyKind()
+	var history []string
+	for _, h := range ex.history[kind] {
+		if h != text {
+			history = append(history, h)
+		}
+	}
+	ex.history[kind] = append(history, text)
+}
+
+// browseHistory shows the previous (dir -1) or next (dir 1) history entry
+func (ex *Ex) browseHistory(dir int) {
+	history := ex.history[ex.historyKind()]
+	pos := ex.histPos + dir
+	if pos < 0 || pos > len(history) {
+		return
+	}
+	ex.histPos = pos
+	if pos == len(history) {
+		ex.input.Clear()
+	} else {
+		ex.input.Set(history[pos])
+	}
+}
+
+// openInput shows the input with a prompt
+func (em *Vi) openInput(prompt string) {
+	em.ex.Clear()
+	em.ex.prompt = prompt
+	em.ex.histPos = len(em.ex.history[em.ex.historyKind()])
+	em.inputEvent(&novi.AskInputEvent{ID: ExInputID, Prompt: prompt})
+}
+
 /*
- * TODO:
- * minimal buffer editing (cursor, backspace)
- * backspace on empty = cancel
- *
- * Eventually we'll need similar input for /search, so reuse is desirable
+ * The input is used for both ex commands and searches (see search.go), which
+ * each have their own history, browsed with up and down
  */
 
 // HandleExCommand handles the ':' ex commands
@@ -94,7 +156,19 @@ func (em *Vi) HandleExCommand() {
 	 * :q :q!
 	 * :w :w!
 	 * :x <- wq!
-	 * :<linenumber>
+	 * :[range] (go to the last line of the range, see address.go)
+	 * :u[ndo] :red[o]
+	 * :se[t] option ...
+	 * :checkt[ime]
+	 * :e[dit][!] [file]
+	 * :bn[ext] :bp[revious] :b[uffer] N :ls :bd[elete][!] [N]
+	 * :wa[ll][!] :qa[ll][!] :wqa[ll][!] :xa[ll][!]
+	 * :[range]s/pattern/replacement/[flags] :& :&& :~ (see substitute.go)
+	 * :noh[lsearch]
+	 * :[range]d :y :m :t :j :> :< :normal (see excommands.go)
+	 * :[range]g/pattern/cmd :v (see global.go)
+	 * :[range]!cmd :r !cmd :w !cmd (see filter.go)
+	 * :marks [names] :ju[mps] (see marks.go and jumps.go)
 	 */
 
 	cmd := strings.TrimSpace(em.ex.input.ToString())
@@ -102,96 +176,289 @@ func (em *Vi) HandleExCommand() {
 	if cmd == "" {
 		return
 	}
+	em.ex.last = cmd
+	em.ExecuteEx(cmd)
+}
+
+// ExecuteEx executes an ex command, optionally preceded by a range
+func (em *Vi) ExecuteEx(cmd string) {
+	r, rest, err := em.parseRange(cmd)
+	if err != nil {
+		em.exError(err)
+		return
+	}
+	rest = strings.TrimLeft(rest, " :")
+
+	// the pattern of :g and :s may contain spaces, so check for them first
+	if isGlobal(rest) {
+		if r.count == 0 {
+			r = exRange{0, em.Editor.Buffer.Length() - 1, 2}
+		}
+		if err := r.validate(em.Editor.Buffer.Length(), false); err != nil {
+			em.exError(err)
+			return
+		}
+		em.HandleGlobal(r.start, r.end, rest)
+		return
+	}
+	if isSubstitute(rest) {
+		if err := r.validate(em.Editor.Buffer.Length(), false); err != nil {
+			em.exError(err)
+			return
+		}
+		em.HandleSubstitute(r.start, r.end, rest)
+		return
+	}
 
-	if number, err := strconv.Atoi(cmd); err == nil {
-		if number <= 0 {
-			number = 1
+	name, arg := splitExCommand(rest)
+	if r.count > 0 {
+		if err := r.validate(em.Editor.Buffer.Length(), zeroCommands[name]); err != nil {
+			em.exError(err)
+			return
 		}
-		if number > em.Editor.Buffer.Length() {
-			number = em.Editor.Buffer.Length()
+	}
+	if name == "" {
+		// just a range, go to its last line
+		if r.count > 0 {
+			c := em.Editor.Cursors[0]
+			em.pushJump(c.Line, c.Pos)
+			em.moveToLine(r.end)
+		}
+		return
+	}
+	key := name
+	if key[0] == '>' || key[0] == '<' {
+		key = key[:1] // :>> shifts twice
+	}
+	if !rangeCommands[key] {
+		if r.count > 0 {
+			em.exError(errors.New("E481: No range allowed"))
+			return
 		}
-		first := em.Editor.Cursors[0]
-		first.Line = number - 1
+		em.exCommand(name, strings.Fields(arg))
 		return
 	}
+	if r.start == -1 {
+		r.start = 0
+	}
+
+	em.Editor.Buffer.BeginChange(em.Editor.Cursors)
+	defer em.Editor.Buffer.EndChange(em.Editor.Cursors)
 
-	parts := strings.Split(cmd, " ")
-	p := parts[0]
+	switch key {
+	case "d", "delete", "y", "yank":
+		err = em.exDeleteYank(r, arg, name[0] == 'd')
+	case "m", "move", "t", "co", "copy":
+		err = em.exMoveCopy(r, arg, name[0] == 'm')
+	case "j", "join", "j!", "join!":
+		err = em.exJoin(r, arg, !strings.HasSuffix(name, "!"))
+	case "norm", "normal", "norm!", "normal!":
+		em.exNormal(r, arg)
+	case "w", "write", "w!", "write!", "wq", "wq!", "x", "x!":
+		err = em.exWrite(r, name, arg)
+	case "!":
+		err = em.exFilter(r, arg)
+	case "r", "read":
+		err = em.exRead(r, arg)
+	case "r!", "read!":
+		err = em.exRead(r, "!"+arg)
+	case ">":
+		err = em.exShift(r, arg, 1, len(name))
+	case "<":
+		err = em.exShift(r, arg, -1, len(name))
+	}
+	if err != nil {
+		em.exError(err)
+	}
+}
+
+// exCommand handles the ex commands that don't take a range
+func (em *Vi) exCommand(p string, args []string) {
+	parts := append([]string{p}, args...)
 	l := len(parts)
 	// may contain filename?
 	switch p {
-	case "$": // last line of file
-		// Error if any additional arguments
-		if l > 1 {
-			em.c <- &novi.ErrorEvent{Message: "Extra characters after command"}
-			return
-		}
-		em.JumpTopBottom(0, false)
-	case "w", "wq", "w!", "wq!", "x", "x!":
+	case "e", "edit", "e!", "edit!":
 		if l > 2 {
 			em.c <- &novi.ErrorEvent{Message: "Extra characters after command"}
 			return
 		}
-		force := strings.ContainsRune(p, '!')
-		quit := strings.ContainsRune(p, 'q')
 		fname := ""
 		if l > 1 {
 			fname = parts[1]
 		}
-		em.c <- &novi.SaveEvent{Name: fname, Force: force}
-		if quit {
+		em.c <- &novi.EditEvent{Name: fname, Force: strings.HasSuffix(p, "!")}
+	case "bn", "bnext":
+		em.c <- &novi.BufferEvent{Op: novi.BufferNext}
+	case "bp", "bprevious", "bN", "bNext":
+		em.c <- &novi.BufferEvent{Op: novi.BufferPrevious}
+	case "b", "buffer":
+		if l == 1 {
+			return
+		}
+		number, err := strconv.Atoi(parts[1])
+		if err != nil || l > 2 {
+			em.c <- &novi.ErrorEvent{Message: "E94: No matching buffer for " + strings.Join(parts[1:], " ")}
+			return
+		}
+		em.c <- &novi.BufferEvent{Op: novi.BufferGoto, Number: number}
+	case "bd", "bdelete", "bd!", "bdelete!":
+		number := 0
+		if l > 1 {
+			var err error
+			if number, err = strconv.Atoi(parts[1]); err != nil || l > 2 {
+				em.c <- &novi.ErrorEvent{Message: "E94: No matching buffer for " + strings.Join(parts[1:], " ")}
+				return
+			}
+		}
+		em.c <- &novi.BufferEvent{Op: novi.BufferDelete, Number: number, Force: strings.HasSuffix(p, "!")}
+	case "ls", "buffers", "files":
+		em.c <- &novi.BufferEvent{Op: novi.BufferList}
+	case "wa", "wall", "wa!", "wall!", "wqa", "wqall", "wqa!", "wqall!", "xa", "xall", "xa!", "xall!":
+		if l > 1 {
+			em.c <- &novi.ErrorEvent{Message: "Extra characters after command"}
+			return
+		}
+		force := strings.HasSuffix(p, "!")
+		em.c <- &novi.SaveEvent{All: true, Force: force}
+		if !strings.HasPrefix(p, "wa") {
 			em.c <- &novi.QuitEvent{Force: force}
 		}
-	case "q", "q!":
+	case "se", "set":
+		em.HandleSet(parts[1:])
+	case "checkt", "checktime":
+		em.CheckTime()
+	case "marks":
+		em.ListMarks(strings.Join(parts[1:], ""))
+	case "ju", "jumps":
+		em.ListJumps()
+	case "noh", "nohlsearch":
+		em.NoHighlight()
+	case "u", "undo":
+		em.Undo(1)
+	case "red", "redo":
+		em.Redo(1)
+	case "q", "q!", "qa", "qall", "qa!", "qall!", "quita", "quitall", "quita!", "quitall!":
 		if l > 1 {
 			em.c <- &novi.ErrorEvent{Message: "Extra characters after command"}
 			return
 		}
 		force := strings.ContainsRune(p, '!')
 		em.c <- &novi.QuitEvent{Force: force}
+	default:
+		em.exError(errors.New("E492: Not an editor command: " + strings.Join(parts, " ")))
 	}
 }
 
-// HandleExKey handles non-character "special" keys such as cursor keys, escape, backspace
-func (em *Vi) HandleExKey(e *novi.KeyEvent) {
+// HandleExKey handles non-character "special" keys such as cursor keys, escape,
+// backspace. It returns false if the editor should exit
+func (em *Vi) HandleExKey(e *novi.KeyEvent) bool {
 	/*
 	   Left/right: move cursor
 	   backspace: remove characters, escape if empty
-
-	   nice to have:
-	   up/down> history (if empty)
+	   up/down: browse the history
 	*/
+	if e.Modifier == novi.ModCtrl && e.Rune == 'r' {
+		em.ex.awaitRegister = true
+		return true
+	}
+	if em.ex.awaitRegister {
+		// e.g. escape cancels ctrl-r, but not the input
+		em.ex.awaitRegister = false
+		return true
+	}
 	switch e.Key {
 	case novi.KeyBackspace:
 		if em.ex.input.Len() == 0 {
-			em.c <- &novi.CloseInputEvent{ID: 1}
+			em.CancelSearch()
+			em.inputEvent(&novi.CloseInputEvent{ID: ExInputID})
+			return true
 		}
 		em.ex.input.Backspace()
 	case novi.KeyLeft:
 		em.ex.input.CursorLeft()
 	case novi.KeyRight:
 		em.ex.input.CursorRight()
+	case novi.KeyUp:
+		em.ex.browseHistory(-1)
+	case novi.KeyDown:
+		em.ex.browseHistory(1)
 	case novi.KeyEscape:
 		em.ex.Clear()
-		em.c <- &novi.CloseInputEvent{ID: 1}
-		return
+		em.CancelSearch()
+		em.inputEvent(&novi.CloseInputEvent{ID: ExInputID})
+		return true
 	case novi.KeyEnter:
-		log.Printf("Handling ex command '%s'", em.ex.input.ToString())
-		em.HandleExCommand()
+		text := em.ex.input.ToString()
+		em.ex.addHistory(text)
+		if em.ex.prompt == ":" {
+			log.Printf("Handling ex command '%s'", text)
+			// the command may ask for input itself, e.g. :s///c
+			em.inputEvent(&novi.CloseInputEvent{ID: ExInputID})
+			em.HandleExCommand()
+			em.ex.Clear()
+			return true
+		}
 		em.ex.Clear()
-		em.c <- &novi.CloseInputEvent{ID: 1}
-		return
+		em.inputEvent(&novi.CloseInputEvent{ID: ExInputID})
+		return em.HandleSearch(text)
+	}
+	em.updateInput()
+	return true
+}
+
+// updateInput shows the changed input, and its matches for a search
+func (em *Vi) updateInput() {
+	if em.ex.prompt != ":" {
+		em.updateIncSearch()
+	}
+	em.inputEvent(&novi.UpdateInputEvent{ID: ExInputID, Text: em.ex.input.ToString(), Pos: em.ex.input.Pos})
+}
+
+// inputEvent sends an event about the ex input to the core. While a macro
+// plays the input isn't shown at all
+func (em *Vi) inputEvent(ev novi.EmuEvent) {
+	switch ev.(type) {
+	case *novi.AskInputEvent:
+		em.ex.active = true
+	case *novi.CloseInputEvent:
+		em.ex.active = false
+	}
+	if em.replaying == 0 {
+		em.c <- ev
 	}
-	em.c <- &novi.UpdateInputEvent{ID: 1, Text: em.ex.input.ToString(), Pos: em.ex.input.Pos}
 }
 
 // HandleExInput handles the Ex input events
 func (em *Vi) HandleExInput(event novi.Event) bool {
-	if char, ok := event.(*novi.CharacterEvent); ok {
+	if em.confirm != nil {
+		em.HandleConfirm(event)
+		return true
+	}
+	if char, ok := event.(*novi.CharacterEvent); ok && em.ex.awaitRegister {
+		em.ex.awaitRegister = false
+		// newlines are inserted literally, as carriage return
+		if reg := em.GetRegister(char.Rune); reg != nil {
+			for _, r := range strings.Join(reg.Text, "\r") {
+				em.ex.input.Insert(r)
+			}
+		}
+		em.updateInput()
+	} else if ok {
 		em.ex.input.Insert(char.Rune)
-		em.c <- &novi.UpdateInputEvent{ID: 1, Text: em.ex.input.Buffer.ToString(), Pos: em.ex.input.Pos}
+		em.updateInput()
 	} else if key, ok := event.(*novi.KeyEvent); ok {
-		em.HandleExKey(key)
+		return em.HandleExKey(key)
 	}
 	return true
 }
+
+// CheckTime checks if the file changed on disk, like the core does periodically
+func (em *Vi) CheckTime() {
+	switch em.Editor.CheckFile() {
+	case novi.FileModified:
+		em.c <- &novi.FileChangedEvent{Name: em.Editor.GetFilename(), Number: em.Editor.Number()}
+	case novi.FileRemoved:
+		em.c <- &novi.FileChangedEvent{Name: em.Editor.GetFilename(), Number: em.Editor.Number(), Removed: true}
+	}
+}
@@ -0,0 +1,138 @@
+package viemu
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+// RunEx runs an ex command and returns the events it sent
+func RunEx(em *Vi, cmd string) []novi.EmuEvent {
+	c := make(chan novi.EmuEvent, 10)
+	em.SetChan(c)
+	em.ex.Clear()
+	for _, r := range cmd {
+		em.ex.input.Insert(r)
+	}
+	em.HandleExCommand()
+	close(c)
+
+	var events []novi.EmuEvent
+	for ev := range c {
+		events = append(events, ev)
+	}
+	return events
+}
+
+func TestExBuffers(t *testing.T) {
+	cases := []struct {
+		cmd      string
+		expected []novi.EmuEvent
+	}{
+		{"e other.txt", []novi.EmuEvent{&novi.EditEvent{Name: "other.txt"}}},
+		{"e!", []novi.EmuEvent{&novi.EditEvent{Force: true}}},
+		{"bn", []novi.EmuEvent{&novi.BufferEvent{Op: novi.BufferNext}}},
+		{"bprevious", []novi.EmuEvent{&novi.BufferEvent{Op: novi.BufferPrevious}}},
+		{"b 3", []novi.EmuEvent{&novi.BufferEvent{Op: novi.BufferGoto, Number: 3}}},
+		{"b foo", []novi.EmuEvent{&novi.ErrorEvent{Message: "E94: No matching buffer for foo"}}},
+		{"bd", []novi.EmuEvent{&novi.BufferEvent{Op: novi.BufferDelete}}},
+		{"bd! 2", []novi.EmuEvent{&novi.BufferEvent{Op: novi.BufferDelete, Number: 2, Force: true}}},
+		{"ls", []novi.EmuEvent{&novi.BufferEvent{Op: novi.BufferList}}},
+		{"wa", []novi.EmuEvent{&novi.SaveEvent{All: true}}},
+		{"xa!", []novi.EmuEvent{&novi.SaveEvent{All: true, Force: true}, &novi.QuitEvent{Force: true}}},
+		{"qa", []novi.EmuEvent{&novi.QuitEvent{}}},
+	}
+	for _, c := range cases {
+		t.Run(c.cmd, func(t *testing.T) {
+			vi := SetupVi(ModeCommand, "hello")
+			if events := RunEx(vi, c.cmd); !reflect.DeepEqual(events, c.expected) {
+				t.Errorf("Expected %v, got %v", c.expected, events)
+			}
+		})
+	}
+}
+
+func TestExErrors(t *testing.T) {
+	cases := []struct {
+		cmd      string
+		expected []novi.EmuEvent
+	}{
+		{"1,5d", []novi.EmuEvent{&novi.ErrorEvent{Message: "E16: Invalid range"}}},
+		{"'a", []novi.EmuEvent{&novi.ErrorEvent{Message: "E20: Mark not set"}}},
+		{"/nope/d", []novi.EmuEvent{&novi.ErrorEvent{Message: "E486: Pattern not found: nope"}}},
+		{"2bn", []novi.EmuEvent{&novi.ErrorEvent{Message: "E481: No range allowed"}}},
+		{"foo", []novi.EmuEvent{&novi.ErrorEvent{Message: "E492: Not an editor command: foo"}}},
+		{"1,2m1", []novi.EmuEvent{&novi.ErrorEvent{Message: "E134: Cannot move a range of lines into itself"}}},
+		{"2,3w part.txt", []novi.EmuEvent{&novi.SaveEvent{Name: "part.txt", Partial: true, Start: 1, End: 2}}},
+		{"%w! all.txt", []novi.EmuEvent{&novi.SaveEvent{Name: "all.txt", Force: true}}},
+	}
+	for _, c := range cases {
+		t.Run(c.cmd, func(t *testing.T) {
+			vi := SetupVi(ModeCommand, "one", "two", "three")
+			if events := RunEx(vi, c.cmd); !reflect.DeepEqual(events, c.expected) {
+				t.Errorf("Expected %v, got %v", c.expected, events)
+			}
+		})
+	}
+}
+
+func TestExCommands(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		line, pos int
+		keys      string
+		expect    []string
+		cline     int
+		cpos      int
+	}{
+		{"Goto line", 0, 2, ":3<enter>", []string{"a", "b", "  c", "d", "e"}, 2, 2},
+		{"Goto last line", 0, 0, ":$<enter>", []string{"a", "b", "  c", "d", "e"}, 4, 0},
+		{"Goto pattern", 0, 0, ":/d/<enter>", []string{"a", "b", "  c", "d", "e"}, 3, 0},
+		{"Delete", 0, 0, ":2,3d<enter>", []string{"a", "d", "e"}, 1, 0},
+		{"Delete count", 1, 0, ":d 2<enter>", []string{"a", "d", "e"}, 1, 0},
+		{"Delete to pattern", 0, 0, ":.;/d/d<enter>", []string{"e"}, 0, 0},
+		{"Delete and put", 0, 0, ":1d x<enter>\"xp", []string{"b", "a", "  c", "d", "e"}, 1, 0},
+		{"Yank", 4, 0, ":1,2y<enter>P", []string{"a", "b", "  c", "d", "a", "b", "e"}, 4, 0},
+		{"Move down", 0, 0, ":1,2m$<enter>", []string{"  c", "d", "e", "a", "b"}, 4, 0},
+		{"Move up", 3, 0, ":m0<enter>", []string{"d", "a", "b", "  c", "e"}, 0, 0},
+		{"Move relative", 0, 0, ":m+2<enter>", []string{"b", "  c", "a", "d", "e"}, 2, 0},
+		{"Copy", 0, 0, ":1,2t.<enter>", []string{"a", "a", "b", "b", "  c", "d", "e"}, 2, 0},
+		{"Copy to start", 4, 0, ":co0<enter>", []string{"e", "a", "b", "  c", "d", "e"}, 0, 0},
+		{"Join", 0, 0, ":1,3j<enter>", []string{"a b c", "d", "e"}, 0, 0},
+		{"Join single line", 1, 0, ":j<enter>", []string{"a", "b c", "d", "e"}, 1, 0},
+		{"Join without spaces", 1, 0, ":j!<enter>", []string{"a", "b  c", "d", "e"}, 1, 0},
+		{"Shift right", 0, 0, ":1,2><enter>", []string{"    a", "    b", "  c", "d", "e"}, 1, 4},
+		{"Shift twice", 0, 0, ":>><enter>", []string{"        a", "b", "  c", "d", "e"}, 0, 8},
+		{"Shift left", 2, 0, ":<<enter>", []string{"a", "b", "c", "d", "e"}, 2, 0},
+		{"Normal", 0, 0, ":%norm A;<enter>", []string{"a;", "b;", "  c;", "d;", "e;"}, 4, 1},
+		{"Normal adding lines", 0, 0, ":1,2normal yyp<enter>", []string{"a", "a", "b", "b", "  c", "d", "e"}, 3, 0},
+		{"Normal deleting lines", 0, 0, ":1,3norm dd<enter>", []string{"d", "e"}, 0, 0},
+		{"Visual range", 1, 0, "Vj:d<enter>", []string{"a", "d", "e"}, 1, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			vi, cursor := SetupViAndCursor(ModeCommand, tc.line, tc.pos, "a", "b", "  c", "d", "e")
+			vi.ExpandTab, vi.ShiftWidth = true, 4
+			SendKeys(vi, tc.keys)
+			novi.AssertBufferMatch(t, vi.Editor.Buffer, tc.expect...)
+			novi.AssertCursor(t, cursor, tc.cline, tc.cpos)
+		})
+	}
+	t.Run("Undo in a single step", func(t *testing.T) {
+		vi := SetupVi(ModeCommand, "a", "b", "c")
+		SendKeys(vi, ":%norm x<enter>u")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "a", "b", "c")
+	})
+	t.Run("Events of every line are collected", func(t *testing.T) {
+		lines := make([]string, 40)
+		for i := range lines {
+			lines[i] = "a"
+		}
+		vi := SetupVi(ModeCommand, lines...)
+		events := RunEx(vi, "%norm u")
+		expected := []novi.EmuEvent{&novi.ErrorEvent{Message: "Already at oldest change"}}
+		if !reflect.DeepEqual(events, expected) {
+			t.Errorf("Expected %v, got %v", expected, events)
+		}
+	})
+}
@@ -0,0 +1,321 @@
+package viemu
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+/*
+ * Ex commands that work on a range of lines (see address.go):
+ *
+ * :[range]d[elete] [x] [count]    delete lines, into register x
+ * :[range]y[ank] [x] [count]      yank lines
+ * :[range]m[ove] {address}        move lines below address
+ * :[range]t {address}             copy lines below address, also :co[py]
+ * :[range]j[oin][!] [count]       join lines, without adding spaces if !
+ * :[range]> [count]               shift lines right, once for every >
+ * :[range]< [count]               shift lines left
+ * :[range]norm[al] {commands}     execute normal mode commands on each line
+ * :[range]w[rite][!] [file]       write (part of) the buffer
+ * :[range]!cmd, :r !cmd, :w !cmd   run external commands, see filter.go
+ *
+ * A count makes the range start at its last line, e.g. ":d 3" deletes the
+ * current line and the two below it.
+ */
+
+// rangeCommands are the commands that accept a range
+var rangeCommands = map[string]bool{
+	"d": true, "delete": true,
+	"y": true, "yank": true,
+	"m": true, "move": true,
+	"t": true, "co": true, "copy": true,
+	"j": true, "join": true, "j!": true, "join!": true,
+	">": true, "<": true,
+	"norm": true, "normal": true, "norm!": true, "normal!": true,
+	"w": true, "write": true, "w!": true, "write!": true,
+	"wq": true, "wq!": true, "x": true, "x!": true,
+	"!": true, "r": true, "read": true, "r!": true, "read!": true,
+}
+
+// zeroCommands are the commands that accept line 0, meaning before the first
+// line
+var zeroCommands = map[string]bool{
+	"m": true, "move": true,
+	"t": true, "co": true, "copy": true,
+	"r": true, "read": true, "r!": true, "read!": true,
+}
+
+// splitExCommand splits an ex command (without its range) in its name,
+// including a trailing !, and its argument
+func splitExCommand(cmd string) (string, string) {
+	i := strings.IndexFunc(cmd, func(r rune) bool { return !unicode.IsLetter(r) })
+	switch {
+	case i == -1:
+		i = len(cmd)
+	case i == 0 && cmd != "":
+		// a single character command, > and < can be repeated
+		i = 1
+		for i < len(cmd) && (cmd[0] == '>' || cmd[0] == '<') && cmd[i] == cmd[0] {
+			i++
+		}
+	case cmd[i] == '!':
+		i++
+	}
+	return cmd[:i], strings.TrimSpace(cmd[i:])
+}
+
+// exError reports a failed ex command
+func (em *Vi) exError(err error) {
+	em.c <- &novi.ErrorEvent{Message: err.Error()}
+	em.failed = true
+}
+
+// applyCount makes the range count lines, starting at its last line
+func (em *Vi) applyCount(r *exRange, count int) {
+	if count == 0 {
+		return
+	}
+	r.start, r.end = r.end, r.end+count-1
+	if last := em.Editor.Buffer.Length() - 1; r.end > last {
+		r.end = last
+	}
+}
+
+// parseRegisterCount parses the [x] [count] argument of :d and :y
+func parseRegisterCount(arg string) (rune, int, error) {
+	reg := rune(0)
+	if arg != "" && (arg[0] < '0' || arg[0] > '9') {
+		reg, arg = rune(arg[0]), strings.TrimSpace(arg[1:])
+	}
+	count, l := parseNumber(arg)
+	if l < len(arg) {
+		return 0, 0, errors.New("E488: Trailing characters: " + arg[l:])
+	}
+	return reg, count, nil
+}
+
+// lineRange returns the operator range for lines start to end
+func lineRange(start, end int) Range {
+	return Range{Line: start, EndLine: end, Linewise: true}
+}
+
+// lineText returns the text of lines start to end
+func (em *Vi) lineText(start, end int) []string {
+	b := em.Editor.Buffer
+	return b.Text(start, 0, end, b.GetLine(end).Len())
+}
+
+// insertLines inserts lines below line after, -1 inserts at the start
+func (em *Vi) insertLines(after int, text []string) {
+	b := em.Editor.Buffer
+	if after < 0 {
+		b.Replace(0, 0, 0, 0, append(append([]string{}, text...), ""))
+		return
+	}
+	end := b.GetLine(after).Len()
+	b.Replace(after, end, after, end, append([]string{""}, text...))
+}
+
+// moveToLine moves the cursor to the first non-blank of a line
+func (em *Vi) moveToLine(line int) {
+	c := em.Editor.Cursors[0]
+	c.Line, c.Pos = line, firstNonBlank(em.Editor.Buffer.GetLine(line))
+}
+
+// exDeleteYank handles :d and :y
+func (em *Vi) exDeleteYank(r exRange, arg string, delete bool) error {
+	reg, count, err := parseRegisterCount(arg)
+	if err != nil {
+		return err
+	}
+	em.applyCount(&r, count)
+	em.register = reg
+	if delete {
+		em.opDelete(em.Editor.Cursors[0], lineRange(r.start, r.end), true)
+	} else {
+		em.yanked(em.rangeRegister(lineRange(r.start, r.end)))
+	}
+	return nil
+}
+
+// exMoveCopy handles :m and :t, the lines are moved or copied below address
+func (em *Vi) exMoveCopy(r exRange, address string, move bool) error {
+	dest, rest, found, err := em.parseAddress(address, em.Editor.Cursors[0].Line)
+	switch {
+	case err != nil:
+		return err
+	case !found:
+		return errors.New("E14: Invalid address")
+	case strings.TrimSpace(rest) != "":
+		return errors.New("E488: Trailing characters: " + rest)
+	case dest < -1 || dest >= em.Editor.Buffer.Length():
+		return errors.New("E16: Invalid range")
+	case move && dest >= r.start && dest < r.end:
+		return errors.New("E134: Cannot move a range of lines into itself")
+	}
+	text := em.lineText(r.start, r.end)
+	n := r.end - r.start + 1
+	if !move {
+		em.insertLines(dest, text)
+		em.moveToLine(dest + n)
+		return nil
+	}
+	switch {
+	case dest == r.end || dest == r.start-1:
+		// already there
+	case dest > r.end:
+		em.insertLines(dest, text)
+		em.Editor.Buffer.RemoveLines(r.start, r.end)
+		dest -= n
+	default:
+		em.Editor.Buffer.RemoveLines(r.start, r.end)
+		em.insertLines(dest, text)
+	}
+	em.moveToLine(dest + n)
+	return nil
+}
+
+// joinLines joins the lines from start up to and including end. Unless
+// spaces is false, leading whitespace is removed and a space inserted
+func (em *Vi) joinLines(start, end int, spaces bool) {
+	b := em.Editor.Buffer
+	for i := start; i < end; i++ {
+		cur := b.GetLine(start).ToString()
+		next := b.GetLine(start + 1).ToString()
+		skip, sep := 0, ""
+		if spaces {
+			trimmed := strings.TrimLeft(next, " \t")
+			skip = len([]rune(next)) - len([]rune(trimmed))
+			if cur != "" && trimmed != "" && !strings.HasSuffix(cur, " ") &&
+				!strings.HasSuffix(cur, "\t") && !strings.HasPrefix(trimmed, ")") {
+				sep = " "
+			}
+		}
+		b.Replace(start, len([]rune(cur)), start+1, skip, []string{sep})
+	}
+}
+
+// exJoin handles :j, a range of a single line joins it with the next
+func (em *Vi) exJoin(r exRange, arg string, spaces bool) error {
+	count, l := parseNumber(arg)
+	if l < len(arg) {
+		return errors.New("E488: Trailing characters: " + arg[l:])
+	}
+	em.applyCount(&r, count)
+	if r.start == r.end {
+		r.end++
+	}
+	if r.end >= em.Editor.Buffer.Length() {
+		r.end = em.Editor.Buffer.Length() - 1
+	}
+	em.joinLines(r.start, r.end, spaces)
+	em.moveToLine(r.start)
+	return nil
+}
+
+// exShift handles :> and :<, shifting times levels
+func (em *Vi) exShift(r exRange, arg string, dir, times int) error {
+	count, l := parseNumber(arg)
+	if l < len(arg) {
+		return errors.New("E488: Trailing characters: " + arg[l:])
+	}
+	em.applyCount(&r, count)
+	c := em.Editor.Cursors[0]
+	for i := 0; i < times; i++ {
+		em.opShift(dir)(c, lineRange(r.start, r.end), true)
+	}
+	em.moveToLine(r.end)
+	return nil
+}
+
+// exNormal handles :normal, executing keys as typed in command mode on each
+// line in the range, or at the cursor without a range. An incomplete command
+// is ended as if escape was pressed
+func (em *Vi) exNormal(r exRange, keys string) {
+	if keys == "" {
+		return
+	}
+	b := em.Editor.Buffer
+	// the commands may add or remove lines, so keep track of them
+	var lines []*novi.Cursor
+	if r.count > 0 {
+		for line := r.start; line <= r.end; line++ {
+			c := &novi.Cursor{Line: line}
+			untrack := b.Track(c)
+			defer untrack()
+			lines = append(lines, c)
+		}
+	} else {
+		lines = append(lines, nil)
+	}
+
+	em.replaying++
+	defer func() { em.replaying-- }()
+	escape := &novi.KeyEvent{Key: novi.KeyEscape}
+	// the keys run for every line may report all kinds of things
+	em.collectEvents(func() {
+		for _, line := range lines {
+			if line != nil {
+				if line.Line >= b.Length() {
+					break
+				}
+				em.Editor.Cursors[0].Line, em.Editor.Cursors[0].Pos = line.Line, 0
+			}
+			em.Mode = ModeCommand
+			for _, ev := range keyEvents(keys) {
+				if !em.HandleEvent(em.inputID(), ev) {
+					return
+				}
+				if em.failed {
+					// like a macro, the rest of the keys is skipped
+					break
+				}
+			}
+			em.failed = false
+			if em.ex.active {
+				em.HandleEvent(ExInputID, escape)
+			}
+			if em.Mode != ModeCommand || em.CommandBuffer != "" {
+				em.HandleEvent(MainInputID, escape)
+			}
+		}
+	})
+}
+
+// inputID returns the input events are sent to when replaying them
+func (em *Vi) inputID() novi.InputID {
+	if em.ex.active {
+		return ExInputID
+	}
+	return MainInputID
+}
+
+// exWrite handles :w, :wq and :x. Writing part of the buffer doesn't mark
+// it as saved
+func (em *Vi) exWrite(r exRange, name string, arg string) error {
+	if name == "w" && strings.HasPrefix(arg, "!") {
+		return em.writeCommand(r, strings.TrimSpace(arg[1:]))
+	}
+	args := strings.Fields(arg)
+	if len(args) > 1 {
+		return errors.New("Extra characters after command")
+	}
+	force := strings.ContainsRune(name, '!')
+	quit := strings.ContainsRune(name, 'q')
+	fname := ""
+	if len(args) > 0 {
+		fname = args[0]
+	}
+	ev := &novi.SaveEvent{Name: fname, Force: force}
+	if r.count > 0 && (r.start != 0 || r.end != em.Editor.Buffer.Length()-1) {
+		ev.Partial, ev.Start, ev.End = true, r.start, r.end
+	}
+	em.c <- ev
+	if quit {
+		em.c <- &novi.QuitEvent{Force: force}
+	}
+	return nil
+}
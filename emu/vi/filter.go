@@ -0,0 +1,169 @@
+package viemu
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+/*
+ * Running external commands (see novi.Filter):
+ *
+ * :!cmd              run cmd and show its output
+ * :[range]!cmd       filter the lines in range through cmd, replacing them
+ * :[range]r[ead] !cmd  insert the output of cmd below the last line of range
+ * :[range]w !cmd     write the lines in range (all by default) to cmd
+ * !{motion}          start :[range]! for the lines motion covers, also
+ *                    visual !
+ *
+ * An unescaped ! in cmd is replaced by the previous command. If a command
+ * fails the buffer isn't modified.
+ */
+
+// expandBang replaces an unescaped ! in a command by the last command
+func expandBang(command, last string) string {
+	var b strings.Builder
+	for i := 0; i < len(command); i++ {
+		switch {
+		case command[i] == '\\' && i+1 < len(command) && command[i+1] == '!':
+			b.WriteByte('!')
+			i++
+		case command[i] == '!':
+			b.WriteString(last)
+		default:
+			b.WriteByte(command[i])
+		}
+	}
+	return b.String()
+}
+
+// shellCommand expands a command and remembers it for !
+func (em *Vi) shellCommand(command string) (string, error) {
+	if command == "" {
+		return "", errors.New("E471: Argument required")
+	}
+	if strings.Contains(strings.Replace(command, `\!`, "", -1), "!") && em.lastShell == "" {
+		return "", errors.New("E34: No previous command")
+	}
+	command = expandBang(command, em.lastShell)
+	em.lastShell = command
+	return command, nil
+}
+
+// showOutput shows the output of a command. There's only room for a single
+// line, so lines are separated by |
+func (em *Vi) showOutput(output []string, message string) {
+	if message != "" {
+		output = append(output, message)
+	}
+	if len(output) > 0 {
+		em.c <- &novi.ErrorEvent{Message: strings.Join(output, " | ")}
+	}
+}
+
+// exFilter handles :!, which filters the lines in range if one is given
+func (em *Vi) exFilter(r exRange, arg string) error {
+	command, err := em.shellCommand(arg)
+	if err != nil {
+		return err
+	}
+	if r.count == 0 {
+		output, message, err := novi.Filter(command, nil)
+		if err != nil {
+			return err
+		}
+		em.showOutput(output, message)
+		return nil
+	}
+	output, message, err := novi.Filter(command, em.lineText(r.start, r.end))
+	if err != nil {
+		return err
+	}
+	b := em.Editor.Buffer
+	if len(output) == 0 {
+		b.RemoveLines(r.start, r.end)
+	} else {
+		b.Replace(r.start, 0, r.end, b.GetLine(r.end).Len(), output)
+	}
+	line := r.start
+	if line >= b.Length() {
+		line = b.Length() - 1
+	}
+	em.moveToLine(line)
+	if message != "" {
+		em.c <- &novi.ErrorEvent{Message: message}
+	} else if n := r.end - r.start + 1; n > 2 {
+		em.c <- &novi.ErrorEvent{Message: fmt.Sprintf("%d lines filtered", n)}
+	}
+	return nil
+}
+
+// exRead handles :r, inserting a file or the output of a command below the
+// last line in range. Line 0 inserts at the start of the buffer
+func (em *Vi) exRead(r exRange, arg string) error {
+	var lines []string
+	switch {
+	case strings.HasPrefix(arg, "!"):
+		command, err := em.shellCommand(strings.TrimSpace(arg[1:]))
+		if err != nil {
+			return err
+		}
+		output, message, err := novi.Filter(command, nil)
+		if err != nil {
+			return err
+		}
+		if message != "" {
+			em.c <- &novi.ErrorEvent{Message: message}
+		}
+		lines = output
+	case arg == "":
+		return errors.New("E32: No file name")
+	default:
+		data, err := ioutil.ReadFile(arg)
+		if err != nil {
+			return errors.New("E484: Can't open file " + arg)
+		}
+		lines = strings.Split(strings.TrimSuffix(strings.Replace(string(data), "\r\n", "\n", -1), "\n"), "\n")
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	em.insertLines(r.end, lines)
+	em.moveToLine(r.end + 1)
+	return nil
+}
+
+// writeCommand handles :w !cmd, writing the lines in range to a command
+func (em *Vi) writeCommand(r exRange, arg string) error {
+	command, err := em.shellCommand(arg)
+	if err != nil {
+		return err
+	}
+	if r.count == 0 {
+		r.start, r.end = 0, em.Editor.Buffer.Length()-1
+	}
+	output, message, err := novi.Filter(command, em.lineText(r.start, r.end))
+	if err != nil {
+		return err
+	}
+	em.showOutput(output, message)
+	return nil
+}
+
+// opFilter implements !, it starts an ex command to filter the lines in range
+func (em *Vi) opFilter(c *novi.Cursor, r Range, first bool) {
+	if !first {
+		return
+	}
+	c.Line, c.Pos = r.Line, em.columnOn(r.Line, c.Pos)
+	prefix := ".!"
+	if n := r.EndLine - r.Line; n > 0 {
+		prefix = fmt.Sprintf(".,.+%d!", n)
+	}
+	em.openInput(":")
+	em.ex.input.Set(prefix)
+	em.updateInput()
+}
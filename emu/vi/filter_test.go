@@ -0,0 +1,81 @@
+//go:build !windows
+// +build !windows
+
+package viemu
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+func TestExpandBang(t *testing.T) {
+	for _, tc := range []struct {
+		command, expect string
+	}{
+		{"sort", "sort"},
+		{"!", "sort -r"},
+		{"! | head", "sort -r | head"},
+		{`echo \!`, "echo !"},
+	} {
+		if res := expandBang(tc.command, "sort -r"); res != tc.expect {
+			t.Errorf("Expected %q, got %q", tc.expect, res)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		line, pos int
+		keys      string
+		expect    []string
+		cline     int
+		cpos      int
+	}{
+		{"Range", 0, 0, ":1,3!sort<enter>", []string{"a", "b", "c", "a"}, 0, 0},
+		{"Entire buffer", 0, 0, ":%!sort -u<enter>", []string{"a", "b", "c"}, 0, 0},
+		{"No output removes lines", 1, 0, ":.,+1!true<enter>", []string{"c", "a"}, 1, 0},
+		{"Failure keeps lines", 0, 0, ":%!false<enter>", []string{"c", "b", "a", "a"}, 0, 0},
+		{"Repeat last command", 0, 0, ":1,2!sort<enter>:3,4!!<enter>", []string{"b", "c", "a", "a"}, 2, 0},
+		{"Read", 0, 0, ":r !echo x<enter>", []string{"c", "x", "b", "a", "a"}, 1, 0},
+		{"Read at start", 2, 0, ":0r !printf 'x\\ny\\n'<enter>", []string{"x", "y", "c", "b", "a", "a"}, 0, 0},
+		{"Read without space", 3, 0, ":r!echo x<enter>", []string{"c", "b", "a", "a", "x"}, 4, 0},
+		{"Operator", 0, 0, "!jsort<enter>", []string{"b", "c", "a", "a"}, 0, 0},
+		{"Doubled operator", 0, 0, "3!!tr a-z A-Z<enter>", []string{"C", "B", "A", "a"}, 0, 0},
+		{"Visual", 1, 0, "Vj!sort -r<enter>", []string{"c", "b", "a", "a"}, 1, 0},
+		{"Undo", 0, 0, ":%!sort<enter>u", []string{"c", "b", "a", "a"}, 0, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			vi, cursor := SetupViAndCursor(ModeCommand, tc.line, tc.pos, "c", "b", "a", "a")
+			SendKeys(vi, tc.keys)
+			novi.AssertBufferMatch(t, vi.Editor.Buffer, tc.expect...)
+			novi.AssertCursor(t, cursor, tc.cline, tc.cpos)
+		})
+	}
+}
+
+func TestFilterOutput(t *testing.T) {
+	for _, tc := range []struct {
+		cmd      string
+		expected []novi.EmuEvent
+	}{
+		{"!echo hello", []novi.EmuEvent{&novi.ErrorEvent{Message: "hello"}}},
+		{"!printf 'a\\nb\\n'", []novi.EmuEvent{&novi.ErrorEvent{Message: "a | b"}}},
+		{"w !grep -c .", []novi.EmuEvent{&novi.ErrorEvent{Message: "3"}}},
+		{"2w !cat", []novi.EmuEvent{&novi.ErrorEvent{Message: "two"}}},
+		{"%!echo oops >&2; exit 2", []novi.EmuEvent{&novi.ErrorEvent{Message: "shell returned 2: oops"}}},
+		{"!", []novi.EmuEvent{&novi.ErrorEvent{Message: "E471: Argument required"}}},
+		{"!!", []novi.EmuEvent{&novi.ErrorEvent{Message: "E34: No previous command"}}},
+	} {
+		t.Run(tc.cmd, func(t *testing.T) {
+			vi := SetupVi(ModeCommand, "one", "two", "three")
+			events := RunEx(vi, tc.cmd)
+			if !reflect.DeepEqual(events, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, events)
+			}
+			novi.AssertBufferMatch(t, vi.Editor.Buffer, "one", "two", "three")
+		})
+	}
+}
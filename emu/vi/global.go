@@ -0,0 +1,191 @@
+package viemu
+
+import (
+	"errors"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+/*
+ * :[range]g[lobal]/pattern/cmd executes the ex command cmd on every line in
+ * range (the entire buffer by default) that matches pattern, :g! and
+ * :v[global] on every line that doesn't. The lines are marked first, then
+ * cmd runs with the cursor on each marked line in turn. Lines that are
+ * removed (or joined with the line before them) while running lose their
+ * mark, so e.g. ":g/^$/j" doesn't visit the lines it joined.
+ *
+ * Use :normal to execute normal mode commands, e.g. ":g/TODO/norm dd". The
+ * entire command is a single change and it stops at the first error.
+ * Substitutions can't be confirmed from within :g, and they're reported in
+ * total once it's done.
+ */
+
+// globalMarks holds the lines marked by :g. Lines are visited in order, so
+// only the lines from next on are kept up to date. Changes are usually made
+// at or above the line being visited, which shifts all pending lines by the
+// same amount; that's kept in shift so large buffers don't take quadratic
+// time
+type globalMarks struct {
+	lines   []int  // the marked lines, without shift
+	deleted []bool // the line was removed
+	next    int    // the next line to visit
+	shift   int    // added to all lines from next on
+
+	subCount, subLines int // the substitutions made
+}
+
+// line returns the current line of mark i
+func (g *globalMarks) line(i int) int {
+	return g.lines[i] + g.shift
+}
+
+// after returns the first pending mark on a line after line
+func (g *globalMarks) after(line int) int {
+	return g.next + sort.Search(len(g.lines)-g.next, func(i int) bool {
+		return g.line(g.next+i) > line
+	})
+}
+
+// pop returns the next marked line, if any
+func (g *globalMarks) pop() (int, bool) {
+	for g.next < len(g.lines) {
+		i := g.next
+		g.next++
+		if !g.deleted[i] {
+			return g.lines[i] + g.shift, true
+		}
+	}
+	return 0, false
+}
+
+// BufferChanged adjusts the pending marks to a change
+func (g *globalMarks) BufferChanged(b *novi.Buffer, ch *novi.Change) {
+	if ch == nil {
+		g.next = len(g.lines)
+		return
+	}
+	rl, rp := ch.RemovedEnd()
+	il, ip := ch.InsertedEnd()
+
+	// lines removed entirely, or joined with the line before them, lose
+	// their mark. A line that only gets lines inserted above it moves along
+	removed := g.after(ch.Line)
+	if ch.Pos == 0 && rl > ch.Line {
+		removed = g.after(ch.Line - 1)
+	}
+	moved := g.after(rl)
+	if rp == 0 && ip == 0 {
+		moved = g.after(rl - 1)
+	}
+	if removed == g.next && moved > removed {
+		g.next = moved
+	}
+	for i := removed; i < moved; i++ {
+		g.deleted[i] = true
+		g.lines[i] = ch.Line - g.shift
+	}
+
+	if delta := il - rl; delta != 0 {
+		g.shift += delta
+		for i := g.next; i < moved; i++ {
+			g.lines[i] -= delta
+		}
+	}
+}
+
+// splitGlobal splits a :g or :v command in whether it applies to lines that
+// don't match and its arguments. ok is false if it's not a :g or :v command
+func splitGlobal(cmd string) (invert bool, args string, ok bool) {
+	for _, long := range []string{"global", "vglobal"} {
+		i := 0
+		for i < len(cmd) && i < len(long) && cmd[i] == long[i] {
+			i++
+		}
+		if i == 0 {
+			continue
+		}
+		invert = long[0] == 'v'
+		if long[0] == 'g' && i < len(cmd) && cmd[i] == '!' {
+			invert = true
+			i++
+		}
+		if i < len(cmd) {
+			if r, _ := utf8.DecodeRuneInString(cmd[i:]); isDelimiter(r) {
+				return invert, cmd[i:], true
+			}
+		}
+	}
+	return false, "", false
+}
+
+// isGlobal returns true if cmd is a :g or :v command
+func isGlobal(cmd string) bool {
+	_, _, ok := splitGlobal(cmd)
+	return ok
+}
+
+// HandleGlobal executes a :g or :v command on the lines start to end
+func (em *Vi) HandleGlobal(start, end int, cmd string) {
+	if em.global != nil {
+		em.exError(errors.New("E147: Cannot do :global recursive"))
+		return
+	}
+	invert, args, _ := splitGlobal(cmd)
+	delim, size := utf8.DecodeRuneInString(args)
+	pattern, command, _ := splitDelimited(args[size:], delim)
+	if pattern == "" {
+		if em.lastSearch == nil {
+			em.exError(errors.New("E35: No previous regular expression"))
+			return
+		}
+		pattern = em.lastSearch.pattern
+	}
+	search, err := em.compile(pattern)
+	if err != nil {
+		em.exError(errors.New("E383: Invalid search string: " + pattern))
+		return
+	}
+	em.lastSearch = &viSearch{pattern: pattern}
+	if em.HLSearch {
+		em.Editor.Highlight = search
+	}
+
+	b := em.Editor.Buffer
+	g := &globalMarks{}
+	re := search.Regexp()
+	for line := start; line <= end; line++ {
+		if re.MatchString(b.GetLine(line).ToString()) != invert {
+			g.lines = append(g.lines, line)
+		}
+	}
+	switch {
+	case len(g.lines) == 0 && invert:
+		em.exError(errors.New("E538: Pattern found in every line: " + pattern))
+		return
+	case len(g.lines) == 0:
+		em.exError(errors.New("E486: Pattern not found: " + pattern))
+		return
+	}
+	g.deleted = make([]bool, len(g.lines))
+
+	defer b.Subscribe(g)()
+	b.BeginChange(em.Editor.Cursors)
+	defer b.EndChange(em.Editor.Cursors)
+
+	em.global = g
+	defer func() { em.global = nil }()
+	// the commands run for every line may report all kinds of things, only
+	// the last message is shown
+	em.collectEvents(func() {
+		em.failed = false
+		for line, ok := g.pop(); ok && !em.failed; line, ok = g.pop() {
+			em.moveToLine(line)
+			em.ExecuteEx(command)
+		}
+		if g.subCount > 0 && !em.failed {
+			em.c <- &novi.ErrorEvent{Message: substitutionMessage(g.subCount, g.subLines)}
+		}
+	})
+}
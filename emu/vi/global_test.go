@@ -0,0 +1,91 @@
+package viemu
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+func TestGlobal(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		lines  []string
+		keys   string
+		expect []string
+		cline  int
+		cpos   int
+	}{
+		{"Delete matching", []string{"a", "b", "a", "c"}, ":g/a/d<enter>", []string{"b", "c"}, 1, 0},
+		{"Delete not matching", []string{"a", "b", "a", "c"}, ":v/a/d<enter>", []string{"a", "a"}, 1, 0},
+		{"Bang inverts", []string{"a", "b", "a", "c"}, ":g!/a/d<enter>", []string{"a", "a"}, 1, 0},
+		{"Consecutive lines", []string{"a", "a", "a", "b"}, ":g/a/d<enter>", []string{"b"}, 0, 0},
+		{"Range", []string{"a", "a", "a", "a"}, ":2,3g/a/d<enter>", []string{"a", "a"}, 1, 0},
+		{"Substitute", []string{"a x", "b x", "a x"}, ":g/a/s/x/y/<enter>", []string{"a y", "b x", "a y"}, 2, 0},
+		{"Move reverses", []string{"1", "2", "3"}, ":g/^/m0<enter>", []string{"3", "2", "1"}, 0, 0},
+		{"Copy to end", []string{"a", "b"}, ":g/./t$<enter>", []string{"a", "b", "a", "b"}, 3, 0},
+		{"Join skips joined lines", []string{"a", "a", "a", "b"}, ":g/a/j<enter>", []string{"a a", "a b"}, 1, 0},
+		{"Normal", []string{"a", "b", "a"}, ":g/a/normal A!<enter>", []string{"a!", "b", "a!"}, 2, 1},
+		{"Normal deleting below", []string{"a", "a", "b", "a", "c"}, ":g/a/norm jdd<enter>", []string{"a", "b", "a"}, 2, 0},
+		{"Normal adding lines", []string{"a", "b", "a"}, ":g/a/norm yyp<enter>", []string{"a", "a", "b", "a", "a"}, 4, 0},
+		{"Last search pattern", []string{"a", "b", "a"}, "/b<enter>:g//d<enter>", []string{"a", "a"}, 1, 0},
+		{"Stops at error", []string{"a", "a"}, ":g/a/foo<enter>", []string{"a", "a"}, 0, 0},
+		{"No command", []string{"a", "b", "a"}, ":g/a<enter>", []string{"a", "b", "a"}, 2, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			vi, cursor := SetupViAndCursor(ModeCommand, 0, 0, tc.lines...)
+			SendKeys(vi, tc.keys)
+			novi.AssertBufferMatch(t, vi.Editor.Buffer, tc.expect...)
+			novi.AssertCursor(t, cursor, tc.cline, tc.cpos)
+		})
+	}
+	t.Run("Single undo step", func(t *testing.T) {
+		vi := SetupVi(ModeCommand, "a", "b", "a")
+		SendKeys(vi, ":g/a/norm Ax<enter>u")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "a", "b", "a")
+	})
+	t.Run("Reports substitutions in total", func(t *testing.T) {
+		vi := SetupVi(ModeCommand, "a a", "b", "a")
+		events := RunEx(vi, "g/a/s/a/x/g")
+		expected := "3 substitutions on 2 lines"
+		if len(events) != 1 || events[0].(*novi.ErrorEvent).Message != expected {
+			t.Errorf("Expected %q, got %v", expected, events)
+		}
+	})
+	t.Run("Not found", func(t *testing.T) {
+		vi := SetupVi(ModeCommand, "a")
+		events := RunEx(vi, "v/a/d")
+		expected := "E538: Pattern found in every line: a"
+		if len(events) != 1 || events[0].(*novi.ErrorEvent).Message != expected {
+			t.Errorf("Expected %q, got %v", expected, events)
+		}
+	})
+	t.Run("Passes on the last event", func(t *testing.T) {
+		lines := make([]string, 20)
+		for i := range lines {
+			lines[i] = "a"
+		}
+		vi := SetupVi(ModeCommand, lines...)
+		events := RunEx(vi, "g/a/w")
+		if len(events) != 1 || !reflect.DeepEqual(events[0], &novi.SaveEvent{}) {
+			t.Errorf("Expected a single save, got %v", events)
+		}
+	})
+	t.Run("Large buffer", func(t *testing.T) {
+		lines := make([]string, 100000)
+		for i := range lines {
+			lines[i] = fmt.Sprintf("line %d", i)
+		}
+		vi := SetupVi(ModeCommand, lines...)
+		SendKeys(vi, ":g/[13579]$/d<enter>")
+		if l := vi.Editor.Buffer.Length(); l != 50000 {
+			t.Fatalf("Expected 50000 lines, got %d", l)
+		}
+		for i := 0; i < 50000; i += 9999 {
+			if l := vi.Editor.Buffer.GetLine(i).ToString(); l != lines[i*2] {
+				t.Errorf("Expected line %d to be %q, got %q", i, lines[i*2], l)
+			}
+		}
+	})
+}
@@ -0,0 +1,141 @@
+package viemu
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+/*
+ * The jump list remembers the positions jumps were made from: G, gg, a
+ * search, a mark, H, M, L and :N. Ctrl-O goes back to older positions, Ctrl-I (Tab)
+ * forward again. Jumping back from the newest position first adds it, so
+ * Ctrl-I can return to it. A jump also sets the ' mark, '' goes back to
+ * where the latest jump was made.
+ */
+
+// maxJumps is the number of positions the jump list remembers
+const maxJumps = 100
+
+// jumpMotions are the motions that are jumps
+var jumpMotions = map[string]bool{
+	"G":  true,
+	"gg": true,
+	"/":  true,
+	"?":  true,
+	"n":  true,
+	"N":  true,
+	"*":  true,
+	"#":  true,
+	"'":  true,
+	"`":  true,
+	"{":  true,
+	"}":  true,
+	"H":  true,
+	"M":  true,
+	"L":  true,
+}
+
+// addJump adds a position in the current document to the jump list,
+// replacing an older entry for the same line
+func (em *Vi) addJump(line, pos int) {
+	doc := em.Editor.Document
+	for i, m := range em.jumps {
+		if m.doc == doc && m.pos.Line == line {
+			m.untrack()
+			em.jumps = append(em.jumps[:i], em.jumps[i+1:]...)
+			break
+		}
+	}
+	if len(em.jumps) == maxJumps {
+		em.jumps[0].untrack()
+		em.jumps = em.jumps[1:]
+	}
+	c := doc.Buffer.NewCursor(line, pos)
+	em.jumps = append(em.jumps, &mark{doc: doc, pos: c, untrack: doc.Buffer.Track(c)})
+}
+
+// pushJump records a jump from line, pos
+func (em *Vi) pushJump(line, pos int) {
+	em.addJump(line, pos)
+	em.jumpIndex = len(em.jumps)
+	em.setMark('\'', line, pos)
+}
+
+// Jump moves count entries back (or forward, if count is negative) in the
+// jump list. Entries for documents that were closed are skipped
+func (em *Vi) Jump(count int) bool {
+	c := em.Editor.Cursors[0]
+	if count > 0 && em.jumpIndex == len(em.jumps) {
+		em.addJump(c.Line, c.Pos)
+		em.jumpIndex = len(em.jumps) - 1
+	}
+	step := -1
+	if count < 0 {
+		step, count = 1, -count
+	}
+	index := em.jumpIndex
+	for count > 0 {
+		index += step
+		if index < 0 || index >= len(em.jumps) {
+			em.failed = true
+			return true
+		}
+		if em.validMark(em.jumps[index]) {
+			count--
+		}
+	}
+	em.jumpIndex = index
+	m := em.jumps[index]
+	if m.doc != em.Editor.Document {
+		em.gotoDocument(m.doc, m.pos.Line, m.pos.Pos)
+		return true
+	}
+	em.setMark('\'', c.Line, c.Pos)
+	c.Line, c.Pos = m.pos.Line, m.pos.Pos
+	c.Validate()
+	return true
+}
+
+// HandleJumpBack handles Ctrl-O
+func (em *Vi) HandleJumpBack(novi.Event) bool {
+	count, _ := splitCount(em.CommandBuffer)
+	em.CommandBuffer = ""
+	if count == 0 {
+		count = 1
+	}
+	return em.Jump(count)
+}
+
+// HandleJumpForward handles Ctrl-I (or Tab)
+func (em *Vi) HandleJumpForward(novi.Event) bool {
+	count, _ := splitCount(em.CommandBuffer)
+	em.CommandBuffer = ""
+	if count == 0 {
+		count = 1
+	}
+	return em.Jump(-count)
+}
+
+// ListJumps handles :jumps. Every entry shows how many jumps away it is, >
+// marks the current position
+func (em *Vi) ListJumps() {
+	res := []string{" jump line  col file/text"}
+	for i, m := range em.jumps {
+		if !em.validMark(m) {
+			continue
+		}
+		n, current := em.jumpIndex-i, " "
+		if n < 0 {
+			n = -n
+		} else if n == 0 {
+			current = ">"
+		}
+		res = append(res, fmt.Sprintf("%s%3d %s", current, n, em.describeMark(m)))
+	}
+	if em.jumpIndex == len(em.jumps) {
+		res = append(res, ">")
+	}
+	em.c <- &novi.ErrorEvent{Message: strings.Join(res, " | ")}
+}
@@ -0,0 +1,220 @@
+package viemu
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+/*
+ * Macros: q{register} records all events that reach HandleEvent, including
+ * ex commands, until q is pressed again. [count]@{register} plays them back,
+ * @@ repeats the last macro played and @: the last ex command.
+ *
+ * Macros are stored in registers as text, using <...> for special keys the way
+ * vim writes them (e.g. "cwfoo<esc>j"), so they can be put, edited and yanked
+ * back like any other text. A newline in a register is played as enter.
+ */
+
+// maxMacroDepth limits macros calling macros, including themselves
+const maxMacroDepth = 100
+
+// keyNames maps special keys to their <name>
+var keyNames = map[novi.KeyType]string{
+	novi.KeyEscape:    "esc",
+	novi.KeyEnter:     "cr",
+	novi.KeyUp:        "up",
+	novi.KeyDown:      "down",
+	novi.KeyLeft:      "left",
+	novi.KeyRight:     "right",
+	novi.KeyHome:      "home",
+	novi.KeyEnd:       "end",
+	novi.KeyPgUp:      "pageup",
+	novi.KeyPgDn:      "pagedown",
+	novi.KeyBackspace: "bs",
+	novi.KeyTab:       "tab",
+	novi.KeyDelete:    "del",
+	novi.KeyInsert:    "insert",
+	novi.KeyF1:        "f1",
+	novi.KeyF2:        "f2",
+	novi.KeyF3:        "f3",
+	novi.KeyF4:        "f4",
+	novi.KeyF5:        "f5",
+	novi.KeyF6:        "f6",
+	novi.KeyF7:        "f7",
+	novi.KeyF8:        "f8",
+	novi.KeyF9:        "f9",
+	novi.KeyF10:       "f10",
+	novi.KeyF11:       "f11",
+	novi.KeyF12:       "f12",
+}
+
+// modifierNames are the prefixes used for modifiers, e.g. <c-r>
+var modifierNames = []struct {
+	mod  novi.KeyModifier
+	name string
+}{
+	{novi.ModCtrl, "c-"},
+	{novi.ModShift, "s-"},
+	{novi.ModAlt, "a-"},
+	{novi.ModMeta, "m-"},
+}
+
+// EventsToText returns the text representation of a sequence of events
+func EventsToText(events []novi.Event) string {
+	var b strings.Builder
+	for _, ev := range events {
+		switch e := ev.(type) {
+		case *novi.CharacterEvent:
+			if e.Rune == '<' {
+				b.WriteString("<lt>")
+			} else {
+				b.WriteRune(e.Rune)
+			}
+		case *novi.KeyEvent:
+			name, ok := keyNames[e.Key]
+			if e.Key == novi.KeyRune {
+				name, ok = string(unicode.ToLower(e.Rune)), true
+			}
+			if !ok {
+				continue
+			}
+			b.WriteRune('<')
+			for _, m := range modifierNames {
+				if e.Modifier&m.mod != 0 {
+					b.WriteString(m.name)
+				}
+			}
+			b.WriteString(name + ">")
+		}
+	}
+	return b.String()
+}
+
+// parseKey parses the name of a key between <>, e.g. "c-r" or "esc"
+func parseKey(name string) (novi.Event, bool) {
+	name = strings.ToLower(name)
+	if name == "lt" {
+		return &novi.CharacterEvent{Rune: '<'}, true
+	}
+	ev := &novi.KeyEvent{}
+	for found := true; found; {
+		found = false
+		for _, m := range modifierNames {
+			if strings.HasPrefix(name, m.name) && len(name) > len(m.name) {
+				ev.Modifier |= m.mod
+				name = name[len(m.name):]
+				found = true
+			}
+		}
+	}
+	for key, n := range keyNames {
+		if n == name {
+			ev.Key = key
+			return ev, true
+		}
+	}
+	if r := []rune(name); len(r) == 1 && ev.Modifier != 0 {
+		ev.Rune = r[0]
+		return ev, true
+	}
+	return nil, false
+}
+
+// TextToEvents parses the text representation of a sequence of events. A '<'
+// that doesn't start a key name is taken literally
+func TextToEvents(text string) []novi.Event {
+	var events []novi.Event
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch r {
+		case '\n', '\r':
+			events = append(events, &novi.KeyEvent{Key: novi.KeyEnter})
+			continue
+		case '<':
+			if end := strings.IndexRune(string(runes[i:]), '>'); end > 1 {
+				name := []rune(string(runes[i:])[1:end])
+				if ev, ok := parseKey(string(name)); ok {
+					events = append(events, ev)
+					i += len(name) + 1
+					continue
+				}
+			}
+		}
+		events = append(events, &novi.CharacterEvent{Rune: r})
+	}
+	return events
+}
+
+// StartRecording starts recording a macro to register name
+func (em *Vi) StartRecording(name rune) {
+	if name > unicode.MaxASCII || !unicode.IsLetter(name) && !unicode.IsDigit(name) {
+		em.c <- &novi.ErrorEvent{Message: "E354: Invalid register name: '" + string(name) + "'"}
+		return
+	}
+	em.recording = name
+	em.macro = nil
+}
+
+// StopRecording stops recording and stores the macro
+func (em *Vi) StopRecording() {
+	// the q that stopped the recording isn't part of it
+	events := em.macro
+	if len(events) > 0 {
+		events = events[:len(events)-1]
+	}
+	reg := &Register{Text: []string{EventsToText(events)}, Type: RegisterCharwise}
+	if err := em.registers.Record(em.recording, reg); err != nil {
+		em.c <- &novi.ErrorEvent{Message: err.Error()}
+	}
+	em.recording = 0
+	em.macro = nil
+}
+
+// PlayMacro plays the macro in register name count times. Playing stops as
+// soon as a command fails. It returns false if the editor should exit
+func (em *Vi) PlayMacro(name rune, count int) bool {
+	if name == '@' {
+		if em.lastMacro == 0 {
+			em.c <- &novi.ErrorEvent{Message: "E748: No previously used register"}
+			return true
+		}
+		name = em.lastMacro
+	}
+	var text string
+	switch reg := em.GetRegister(name); {
+	case name == ':' && reg != nil:
+		text = ":" + reg.String() + "\n"
+	case reg != nil:
+		text = reg.String()
+	default:
+		return true
+	}
+	em.lastMacro = name
+	if em.replaying >= maxMacroDepth {
+		em.failed = true
+		return true
+	}
+
+	events := TextToEvents(text)
+	em.replaying++
+	defer func() { em.replaying-- }()
+	em.failed = false
+	res := true
+	em.collectEvents(func() {
+		for i := 0; i < count; i++ {
+			for _, ev := range events {
+				if !em.HandleEvent(em.inputID(), ev) {
+					res = false
+					return
+				}
+				if em.failed {
+					return
+				}
+			}
+		}
+	})
+	return res
+}
@@ -0,0 +1,93 @@
+package viemu
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+func TestMacroText(t *testing.T) {
+	events := []novi.Event{
+		&novi.CharacterEvent{Rune: 'c'},
+		&novi.CharacterEvent{Rune: '<'},
+		&novi.KeyEvent{Key: novi.KeyEscape},
+		&novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'r'},
+		&novi.KeyEvent{Modifier: novi.ModShift, Key: novi.KeyLeft},
+	}
+	text := EventsToText(events)
+	if text != "c<lt><esc><c-r><s-left>" {
+		t.Errorf("Unexpected text %q", text)
+	}
+	back := TextToEvents(text)
+	if len(back) != len(events) {
+		t.Fatalf("Expected %d events, got %d", len(events), len(back))
+	}
+	for i, ev := range events {
+		if !back[i].Equals(ev) {
+			t.Errorf("Event %d: expected %v, got %v", i, ev, back[i])
+		}
+	}
+	if back := TextToEvents("a<b>\n"); len(back) != 5 || !back[4].Equals(&novi.KeyEvent{Key: novi.KeyEnter}) {
+		t.Errorf("Unexpected events for unknown key name: %v", back)
+	}
+}
+
+func TestMacros(t *testing.T) {
+	t.Run("Record and play", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 0, "one", "two", "three", "four")
+		SendKeys(vi, "qaA!<esc>jq")
+		AssertRegister(t, vi.GetRegister('a'), RegisterCharwise, "A!<esc>j")
+		SendKeys(vi, "@a")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "one!", "two!", "three", "four")
+		SendKeys(vi, "@@")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "one!", "two!", "three!", "four")
+	})
+	t.Run("Count stops at a failing motion", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 0, "a", "b", "c")
+		SendKeys(vi, "qqA.<esc>jq10@q")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "a.", "b.", "c.")
+	})
+	t.Run("Ex commands", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 0, "a", "b", "c")
+		SendKeys(vi, "qa:2<enter>xq")
+		AssertRegister(t, vi.GetRegister('a'), RegisterCharwise, ":2<cr>x")
+		SendKeys(vi, "u:1<enter>@a")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "a", "", "c")
+		if vi.ex.active {
+			t.Error("Ex input should be closed after the macro")
+		}
+	})
+	t.Run("Events of a long replay are collected", func(t *testing.T) {
+		lines := make([]string, 30)
+		for i := range lines {
+			lines[i] = "a"
+		}
+		vi := SetupVi(ModeCommand, lines...)
+		c := make(chan novi.EmuEvent, 10)
+		vi.SetChan(c)
+		vi.registers.Yank('a', &Register{Text: []string{":s/a/b/<cr>:w<cr>j"}, Type: RegisterCharwise})
+		SendKeys(vi, "30@a")
+		if vi.Editor.Buffer.GetLine(29).ToString() != "b" {
+			t.Errorf("Expected the macro to run on every line, got %v", vi.Editor.Buffer.Strings())
+		}
+		if len(c) > 2 {
+			t.Errorf("Expected at most a save and a message, got %d events", len(c))
+		}
+	})
+	t.Run("Edited macro", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 0, "\t\thello")
+		vi.registers.Yank('b', &Register{Text: []string{"x<lt><lt>"}, Type: RegisterCharwise})
+		SendKeys(vi, "@b")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "hello")
+	})
+	t.Run("Status and unnamed register", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 0, "hello")
+		SendKeys(vi, "ylqa")
+		if status := vi.GetStatus(80); !strings.Contains(status, "recording @a") {
+			t.Errorf("Expected recording in status, got %s", status)
+		}
+		SendKeys(vi, "lq")
+		AssertRegister(t, vi.GetRegister('"'), RegisterCharwise, "h")
+	})
+}
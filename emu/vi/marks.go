@@ -0,0 +1,238 @@
+package viemu
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+/*
+ * Marks remember positions. They're tracked by their buffer, so they move
+ * along with the text when lines are added or removed above them.
+ *
+ * a-z   set with m{a-z}, local to a buffer
+ * A-Z   set with m{A-Z}, they remember the document as well
+ * '     the position before the latest jump, also `
+ * .     the position of the last change
+ * ^     where insert mode was left
+ * [ ]   the start and end of the last change or yank
+ * < >   the start and end of the last selection
+ *
+ * 'x moves to the first non-blank of the line of mark x (linewise), `x to
+ * its exact position (exclusive). Both are jumps, see jumps.go. Jumping to
+ * an A-Z mark in another document switches to that document.
+ */
+
+// markNames lists the marks in the order :marks shows them
+const markNames = "'abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ[]^.<>"
+
+// mark is a position in a document
+type mark struct {
+	doc     *novi.Document
+	pos     *novi.Cursor // tracked by the document's buffer
+	untrack func()
+}
+
+// isFileMark returns true if name is a mark that remembers its document
+func isFileMark(name rune) bool {
+	return name >= 'A' && name <= 'Z'
+}
+
+// localMarks are the marks local to a buffer
+type localMarks struct {
+	marks       map[rune]*mark
+	unsubscribe func() // stops tracking the changes of the buffer
+}
+
+// bufferMarks returns the marks local to the current buffer. The first time
+// a buffer is seen its changes are tracked for the . [ and ] marks
+func (em *Vi) bufferMarks() map[rune]*mark {
+	b := em.Editor.Buffer
+	local, ok := em.marks[b]
+	if !ok {
+		marks := make(map[rune]*mark)
+		doc := em.Editor.Document
+		unsubscribe := b.Subscribe(novi.ListenerFunc(func(b *novi.Buffer, ch *novi.Change) {
+			if ch == nil {
+				return
+			}
+			l, p := ch.InsertedEnd()
+			if p > 0 {
+				p--
+			}
+			em.setMarkIn(doc, marks, '.', ch.Line, ch.Pos)
+			em.setMarkIn(doc, marks, '[', ch.Line, ch.Pos)
+			em.setMarkIn(doc, marks, ']', l, p)
+		}))
+		local = &localMarks{marks: marks, unsubscribe: unsubscribe}
+		em.marks[b] = local
+	}
+	return local.marks
+}
+
+// documentClosed forgets the marks and jumps in a document that was closed
+func (em *Vi) documentClosed(doc *novi.Document) {
+	if local, ok := em.marks[doc.Buffer]; ok {
+		local.unsubscribe()
+		for _, m := range local.marks {
+			m.untrack()
+		}
+		delete(em.marks, doc.Buffer)
+	}
+	for name, m := range em.fileMarks {
+		if m.doc == doc {
+			m.untrack()
+			delete(em.fileMarks, name)
+		}
+	}
+	jumps := em.jumps[:0]
+	for i, m := range em.jumps {
+		if m.doc != doc {
+			jumps = append(jumps, m)
+		} else {
+			m.untrack()
+			if i < em.jumpIndex {
+				em.jumpIndex--
+			}
+		}
+	}
+	em.jumps = jumps
+}
+
+// setMarkIn sets a mark in a set of marks of a document
+func (em *Vi) setMarkIn(doc *novi.Document, marks map[rune]*mark, name rune, line, pos int) {
+	if m, ok := marks[name]; ok && m.doc == doc {
+		m.pos.Line, m.pos.Pos = line, pos
+		return
+	}
+	if m, ok := marks[name]; ok {
+		m.untrack()
+	}
+	c := doc.Buffer.NewCursor(line, pos)
+	marks[name] = &mark{doc: doc, pos: c, untrack: doc.Buffer.Track(c)}
+}
+
+// setMark sets a mark in the current document
+func (em *Vi) setMark(name rune, line, pos int) {
+	if name == '`' {
+		name = '\''
+	}
+	if isFileMark(name) {
+		em.setMarkIn(em.Editor.Document, em.fileMarks, name, line, pos)
+		return
+	}
+	em.setMarkIn(em.Editor.Document, em.bufferMarks(), name, line, pos)
+}
+
+// getMark returns a mark, or an error if it isn't set
+func (em *Vi) getMark(name rune) (*mark, error) {
+	if name == '`' {
+		name = '\''
+	}
+	if !strings.ContainsRune(markNames, name) {
+		return nil, errors.New("E78: Unknown mark")
+	}
+	marks := em.bufferMarks()
+	if isFileMark(name) {
+		marks = em.fileMarks
+	}
+	m, ok := marks[name]
+	if !ok || !em.validMark(m) {
+		return nil, errors.New("E20: Mark not set")
+	}
+	return m, nil
+}
+
+// validMark returns false if the document of a mark was closed or reloaded
+func (em *Vi) validMark(m *mark) bool {
+	return em.Editor.GetDocument(m.doc.Number()) == m.doc && m.pos.Buffer == m.doc.Buffer
+}
+
+// SetMark handles m{a-zA-Z'`[]<>}
+func (em *Vi) SetMark(name rune) bool {
+	if !strings.ContainsRune(markNames, name) && name != '`' || name == '.' || name == '^' {
+		em.c <- &novi.ErrorEvent{Message: "E191: Argument must be a letter or forward/backward quote"}
+		em.failed = true
+		return true
+	}
+	c := em.Editor.Cursors[0]
+	em.setMark(name, c.Line, c.Pos)
+	return true
+}
+
+// markLine returns the line of a mark for an address
+func (em *Vi) markLine(name rune) (int, error) {
+	m, err := em.getMark(name)
+	if err != nil {
+		return 0, err
+	}
+	if m.doc != em.Editor.Document {
+		return 0, errors.New("E20: Mark not set")
+	}
+	return m.pos.Line, nil
+}
+
+// markMotion creates the ' (linewise) and ` motions, which move to a mark.
+// A mark in another document switches to it, which is only possible without
+// an operator
+func (em *Vi) markMotion(exact bool) MotionFunc {
+	return func(c *novi.Cursor, args MotionArgs) (int, int, bool) {
+		m, err := em.getMark(args.Char)
+		if err != nil {
+			em.c <- &novi.ErrorEvent{Message: err.Error()}
+			return 0, 0, false
+		}
+		if m.doc != em.Editor.Document {
+			if args.Operator {
+				em.c <- &novi.ErrorEvent{Message: "E20: Mark not set"}
+				return 0, 0, false
+			}
+			if c == em.Editor.Cursors[0] {
+				em.gotoDocument(m.doc, m.pos.Line, m.pos.Pos)
+			}
+			return c.Line, c.Pos, true
+		}
+		if exact {
+			return m.pos.Line, m.pos.Pos, true
+		}
+		return em.lineMotion(m.pos.Line)
+	}
+}
+
+// gotoDocument makes another document current with its cursor at line, pos
+func (em *Vi) gotoDocument(doc *novi.Document, line, pos int) {
+	c := doc.Cursors[0]
+	c.Line, c.Pos = line, pos
+	c.Validate()
+	em.c <- &novi.BufferEvent{Op: novi.BufferGoto, Number: doc.Number()}
+}
+
+// describeMark describes a position like :marks and :jumps do: the line,
+// the column and the text of the line, or the name of another document
+func (em *Vi) describeMark(m *mark) string {
+	text := m.doc.Name()
+	if m.doc == em.Editor.Document {
+		text = strings.TrimSpace(m.doc.Buffer.GetLine(m.pos.Line).ToString())
+	}
+	return fmt.Sprintf("%5d %4d %s", m.pos.Line+1, m.pos.Pos, text)
+}
+
+// ListMarks handles :marks, listing all marks or the ones in names
+func (em *Vi) ListMarks(names string) {
+	res := []string{"mark  line  col file/text"}
+	for _, name := range markNames {
+		if names != "" && !strings.ContainsRune(names, name) {
+			continue
+		}
+		if m, err := em.getMark(name); err == nil {
+			res = append(res, fmt.Sprintf(" %c %s", name, em.describeMark(m)))
+		}
+	}
+	if len(res) == 1 {
+		em.c <- &novi.ErrorEvent{Message: "E283: No marks matching \"" + names + "\""}
+		return
+	}
+	em.c <- &novi.ErrorEvent{Message: strings.Join(res, " | ")}
+}
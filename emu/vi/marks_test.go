@@ -0,0 +1,115 @@
+package viemu
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+func TestMarks(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		line, pos int
+		keys      string
+		expect    []string
+		cline     int
+		cpos      int
+	}{
+		{"Back to line", 1, 3, "majj'a", []string{"a", "  bbb", "c", "d"}, 1, 2},
+		{"Back to position", 1, 3, "majj`a", []string{"a", "  bbb", "c", "d"}, 1, 3},
+		{"Mark moves with lines", 1, 3, "maggOnew<esc>G`a", []string{"new", "a", "  bbb", "c", "d"}, 2, 3},
+		{"Delete to mark", 3, 0, "kmakkd'a", []string{"d"}, 0, 0},
+		{"Delete to exact mark", 1, 4, "maj0d`a", []string{"a", "  bb", "c", "d"}, 1, 3},
+		{"Global mark", 0, 0, "mAG'A", []string{"a", "  bbb", "c", "d"}, 0, 0},
+		{"Last change", 3, 0, "kx3G'.", []string{"a", "  bbb", "", "d"}, 2, 0},
+		{"Last insert", 0, 0, "Axyz<esc>G`^", []string{"axyz", "  bbb", "c", "d"}, 0, 4},
+		{"Last yank", 0, 0, "yjG'[", []string{"a", "  bbb", "c", "d"}, 0, 0},
+		{"Last yank end", 0, 0, "yjG`]", []string{"a", "  bbb", "c", "d"}, 1, 4},
+		{"Last selection", 1, 0, "vj<esc>gg`>", []string{"a", "  bbb", "c", "d"}, 2, 0},
+		{"Ex range", 0, 0, "majmb:'a,'bd<enter>", []string{"c", "d"}, 0, 0},
+		{"Previous position", 0, 0, "G''", []string{"a", "  bbb", "c", "d"}, 0, 0},
+		{"Previous position twice", 0, 0, "G''``", []string{"a", "  bbb", "c", "d"}, 3, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			vi, cursor := SetupViAndCursor(ModeCommand, tc.line, tc.pos, "a", "  bbb", "c", "d")
+			SendKeys(vi, tc.keys)
+			novi.AssertBufferMatch(t, vi.Editor.Buffer, tc.expect...)
+			novi.AssertCursor(t, cursor, tc.cline, tc.cpos)
+		})
+	}
+	t.Run("Mark not set", func(t *testing.T) {
+		vi, cursor := SetupViAndCursor(ModeCommand, 1, 0, "a", "b")
+		SendKeys(vi, "'b")
+		novi.AssertCursor(t, cursor, 1, 0)
+		expected := &novi.ErrorEvent{Message: "E20: Mark not set"}
+		if ev := <-vi.c; !reflect.DeepEqual(ev, expected) {
+			t.Errorf("Expected %v, got %v", expected, ev)
+		}
+	})
+	t.Run("Mark removed with its line", func(t *testing.T) {
+		vi, cursor := SetupViAndCursor(ModeCommand, 1, 0, "a", "b", "c")
+		SendKeys(vi, "majmbkdd'b")
+		novi.AssertCursor(t, cursor, 1, 0)
+	})
+	t.Run("List", func(t *testing.T) {
+		vi := SetupVi(ModeCommand, "one", "two", "three")
+		SendKeys(vi, "majmb")
+		expected := []novi.EmuEvent{&novi.ErrorEvent{
+			Message: "mark  line  col file/text |  a     1    0 one |  b     2    0 two"}}
+		if events := RunEx(vi, "marks ab"); !reflect.DeepEqual(events, expected) {
+			t.Errorf("Expected %v, got %v", expected, events)
+		}
+	})
+	t.Run("Forgotten when the document is closed", func(t *testing.T) {
+		vi := SetupVi(ModeCommand, "one", "two", "three")
+		b := vi.Editor.Buffer
+		SendKeys(vi, "majmBG")
+		if err := vi.Editor.CloseDocument(0, true); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := vi.marks[b]; ok {
+			t.Error("Expected the marks of the closed buffer to be removed")
+		}
+		if len(vi.fileMarks) != 0 || len(vi.jumps) != 0 || vi.jumpIndex != 0 {
+			t.Errorf("Expected no file marks and jumps, got %v %v", vi.fileMarks, vi.jumps)
+		}
+		SendKeys(vi, "x")
+		if _, ok := vi.marks[b]; ok {
+			t.Error("Expected the closed buffer not to be tracked again")
+		}
+	})
+}
+
+func TestJumps(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		keys        string
+		cline, cpos int
+	}{
+		{"Back", "G<c-o>", 1, 2},
+		{"Back and forward", "G<c-o><c-i>", 4, 0},
+		{"Back twice", "Ggg<c-o><c-o>", 1, 2},
+		{"Back with count", "G3Ggg2<c-o>", 4, 0},
+		{"Search", "/e<enter><c-o>", 1, 2},
+		{"Ex line", ":5<enter>:1<enter><c-o>", 4, 0},
+		{"Not a jump", "jjl<c-o>", 3, 1},
+		{"Nothing to go back to", "<c-o>", 1, 2},
+		{"Follows changes", "GggOnew<esc><c-o>", 5, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			vi, cursor := SetupViAndCursor(ModeCommand, 1, 2, "a", "b c", "c", "d e", "e")
+			SendKeys(vi, tc.keys)
+			novi.AssertCursor(t, cursor, tc.cline, tc.cpos)
+		})
+	}
+	t.Run("List", func(t *testing.T) {
+		vi := SetupVi(ModeCommand, "one", "two", "three")
+		SendKeys(vi, "G")
+		expected := []novi.EmuEvent{&novi.ErrorEvent{
+			Message: " jump line  col file/text |    1     1    0 one | >"}}
+		if events := RunEx(vi, "jumps"); !reflect.DeepEqual(events, expected) {
+			t.Errorf("Expected %v, got %v", expected, events)
+		}
+	})
+}
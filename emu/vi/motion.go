@@ -0,0 +1,356 @@
+package viemu
+
+import (
+	"strings"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+/*
+ * Motions move the cursor. Used after an operator they determine the text the
+ * operator works on, which depends on the type of the motion:
+ *
+ * exclusive   up to, but not including, the position moved to (e.g. w, h)
+ * inclusive   including the character moved to (e.g. e, $)
+ * linewise    entire lines (e.g. j, G)
+ *
+ * Motions are registered by key(s) in the Vi instance (see initMotions).
+ */
+
+// MotionType determines the text a motion covers when used with an operator
+type MotionType int
+
+// The possible motion types
+const (
+	MotionExclusive MotionType = iota
+	MotionInclusive
+	MotionLinewise
+)
+
+// MotionArgs describes how a motion is invoked
+type MotionArgs struct {
+	Count    int  // 0 if no count was given
+	Operator bool // the motion is used by an operator
+	Char     rune // the character argument, for motions that take one
+}
+
+// count returns the count, defaulting to 1
+func (a MotionArgs) count() int {
+	if a.Count == 0 {
+		return 1
+	}
+	return a.Count
+}
+
+// MotionFunc returns the position a cursor moves to, or false if it can't move
+type MotionFunc func(c *novi.Cursor, args MotionArgs) (int, int, bool)
+
+// Motion is a motion that can be used by itself or after an operator
+type Motion struct {
+	Type MotionType
+	Move MotionFunc
+}
+
+// argMotions are the motions that take a character argument
+var argMotions = map[string]bool{
+	"f": true,
+	"F": true,
+	"t": true,
+	"T": true,
+	"'": true,
+	"`": true,
+}
+
+// initMotions registers the motions
+func (em *Vi) initMotions() {
+	b := func() *novi.Buffer { return em.Editor.Buffer }
+	// repeat applies a jump count times
+	repeat := func(jump func(*novi.Buffer, *novi.Cursor) (int, int)) MotionFunc {
+		return func(c *novi.Cursor, args MotionArgs) (int, int, bool) {
+			pos := *c
+			for i := 0; i < args.count(); i++ {
+				pos.Line, pos.Pos = jump(b(), &pos)
+			}
+			return pos.Line, pos.Pos, pos.Line != c.Line || pos.Pos != c.Pos
+		}
+	}
+
+	em.motions = map[string]*Motion{
+		"h": {MotionExclusive, func(c *novi.Cursor, args MotionArgs) (int, int, bool) {
+			if c.Pos == 0 {
+				return 0, 0, false
+			}
+			pos := c.Pos - args.count()
+			if pos < 0 {
+				pos = 0
+			}
+			return c.Line, pos, true
+		}},
+		"l": {MotionExclusive, func(c *novi.Cursor, args MotionArgs) (int, int, bool) {
+			// an operator can include the last character
+			max := b().GetLine(c.Line).Len()
+			if !args.Operator {
+				max--
+			}
+			if c.Pos >= max {
+				return 0, 0, false
+			}
+			pos := c.Pos + args.count()
+			if pos > max {
+				pos = max
+			}
+			return c.Line, pos, true
+		}},
+		"j": {MotionLinewise, func(c *novi.Cursor, args MotionArgs) (int, int, bool) {
+			if c.Line >= b().Length()-1 {
+				return 0, 0, false
+			}
+			line := c.Line + args.count()
+			if line > b().Length()-1 {
+				line = b().Length() - 1
+			}
+			return line, em.columnOn(line, em.verticalPos(c.Line, c.Pos, line)), true
+		}},
+		"k": {MotionLinewise, func(c *novi.Cursor, args MotionArgs) (int, int, bool) {
+			if c.Line == 0 {
+				return 0, 0, false
+			}
+			line := c.Line - args.count()
+			if line < 0 {
+				line = 0
+			}
+			return line, em.columnOn(line, em.verticalPos(c.Line, c.Pos, line)), true
+		}},
+		"w": {MotionExclusive, em.wordMotion(JumpForward)},
+		"W": {MotionExclusive, em.wordMotion(JumpWordForward)},
+		"b": {MotionExclusive, repeat(JumpBackward)},
+		"B": {MotionExclusive, repeat(JumpWordBackward)},
+		"e": {MotionInclusive, repeat(JumpForwardEnd)},
+		"E": {MotionInclusive, repeat(JumpWordForwardEnd)},
+		"0": {MotionExclusive, func(c *novi.Cursor, args MotionArgs) (int, int, bool) {
+			return c.Line, 0, true
+		}},
+		"^": {MotionExclusive, func(c *novi.Cursor, args MotionArgs) (int, int, bool) {
+			return c.Line, firstNonBlank(b().GetLine(c.Line)), true
+		}},
+		"$": {MotionInclusive, func(c *novi.Cursor, args MotionArgs) (int, int, bool) {
+			line := c.Line + args.count() - 1
+			if line > b().Length()-1 {
+				return 0, 0, false
+			}
+			pos := b().GetLine(line).Len() - 1
+			if pos < 0 {
+				pos = 0
+			}
+			return line, pos, true
+		}},
+		"gg": {MotionLinewise, func(c *novi.Cursor, args MotionArgs) (int, int, bool) {
+			return em.lineMotion(args.count() - 1)
+		}},
+		"gj": {MotionExclusive, em.screenRowMotion(1)},
+		"gk": {MotionExclusive, em.screenRowMotion(-1)},
+		"g0": {MotionExclusive, em.rowEndMotion(false)},
+		"g$": {MotionInclusive, em.rowEndMotion(true)},
+		"G": {MotionLinewise, func(c *novi.Cursor, args MotionArgs) (int, int, bool) {
+			if args.Count == 0 {
+				return em.lineMotion(b().Length() - 1)
+			}
+			return em.lineMotion(args.Count - 1)
+		}},
+		"}": {MotionExclusive, func(c *novi.Cursor, args MotionArgs) (int, int, bool) {
+			return em.paragraph(c, args, 1)
+		}},
+		"{": {MotionExclusive, func(c *novi.Cursor, args MotionArgs) (int, int, bool) {
+			return em.paragraph(c, args, -1)
+		}},
+		"f": {MotionInclusive, em.findMotion("f")},
+		"F": {MotionExclusive, em.findMotion("F")},
+		"t": {MotionInclusive, em.findMotion("t")},
+		"T": {MotionExclusive, em.findMotion("T")},
+		";": {MotionExclusive, em.repeatFind(false)},
+		",": {MotionExclusive, em.repeatFind(true)},
+		"/": {MotionExclusive, em.searchMotion(false)},
+		"?": {MotionExclusive, em.searchMotion(false)},
+		"n": {MotionExclusive, em.searchMotion(false)},
+		"N": {MotionExclusive, em.searchMotion(true)},
+		"*": {MotionExclusive, em.wordSearchMotion(false)},
+		"#": {MotionExclusive, em.wordSearchMotion(true)},
+		"H": {MotionLinewise, em.screenMotion(-1)},
+		"M": {MotionLinewise, em.screenMotion(0)},
+		"L": {MotionLinewise, em.screenMotion(1)},
+		"'": {MotionLinewise, em.markMotion(false)},
+		"`": {MotionExclusive, em.markMotion(true)},
+	}
+}
+
+// matchMotion matches keys against the motions. It returns the motion and its
+// character argument, or incomplete if keys are the start of a motion
+func (em *Vi) matchMotion(keys string) (string, rune, bool) {
+	if em.motions[keys] != nil && !argMotions[keys] {
+		return keys, 0, false
+	}
+	for name := range argMotions {
+		if !strings.HasPrefix(keys, name) {
+			continue
+		}
+		switch arg := []rune(keys[len(name):]); len(arg) {
+		case 0:
+			return "", 0, true
+		case 1:
+			return name, arg[0], false
+		}
+	}
+	return "", 0, isPrefix(keys, em.motionKeys()...)
+}
+
+// motionType returns the type of a motion. The type of ; and , depends on
+// the find they repeat, that of a search on its offset
+func (em *Vi) motionType(name string) MotionType {
+	switch name {
+	case "/", "?", "n", "N", "*", "#":
+		return em.searchType()
+	}
+	if name == ";" || name == "," {
+		if find, _ := em.lastFindMotion(name == ","); find != "" {
+			return em.motions[find].Type
+		}
+	}
+	return em.motions[name].Type
+}
+
+// columnOn returns pos limited to the length of line, for vertical motions
+func (em *Vi) columnOn(line, pos int) int {
+	if l := em.Editor.Buffer.GetLine(line).Len() - 1; pos > l {
+		pos = l
+	}
+	if pos < 0 {
+		pos = 0
+	}
+	return pos
+}
+
+// lineMotion moves to the first non-blank of a line, limited to the buffer
+func (em *Vi) lineMotion(line int) (int, int, bool) {
+	if last := em.Editor.Buffer.Length() - 1; line > last {
+		line = last
+	}
+	return line, firstNonBlank(em.Editor.Buffer.GetLine(line)), true
+}
+
+// wordMotion creates the w/W motion. Used with an operator it doesn't go past
+// the end of the line the last word is on
+func (em *Vi) wordMotion(jump func(*novi.Buffer, *novi.Cursor) (int, int)) MotionFunc {
+	return func(c *novi.Cursor, args MotionArgs) (int, int, bool) {
+		b := em.Editor.Buffer
+		pos := *c
+		for i := 0; i < args.count(); i++ {
+			prev := pos
+			pos.Line, pos.Pos = jump(b, &pos)
+			if pos == prev {
+				break
+			}
+		}
+		if !args.Operator {
+			return pos.Line, pos.Pos, pos.Line != c.Line || pos.Pos != c.Pos
+		}
+		last := b.Length() - 1
+		if pos.Line == last && pos.Pos == b.GetLine(last).Len()-1 && !isWordStart(b.GetLine(last), pos.Pos) {
+			// there was no next word, include the rest of the buffer
+			return last, b.GetLine(last).Len(), true
+		}
+		if pos.Line > c.Line && pos.Pos <= firstNonBlank(b.GetLine(pos.Line)) {
+			// the last word moved over is at the end of a line
+			return pos.Line - 1, b.GetLine(pos.Line - 1).Len(), true
+		}
+		return pos.Line, pos.Pos, pos.Line != c.Line || pos.Pos != c.Pos
+	}
+}
+
+// paragraph moves to the next (dir 1) or previous (dir -1) empty line after
+// a paragraph, or to the start/end of the buffer
+func (em *Vi) paragraph(c *novi.Cursor, args MotionArgs, dir int) (int, int, bool) {
+	b := em.Editor.Buffer
+	line := c.Line
+	for i := 0; i < args.count(); i++ {
+		// skip empty lines, then find the next empty one
+		line += dir
+		for line >= 0 && line < b.Length() && b.GetLine(line).Len() == 0 {
+			line += dir
+		}
+		for line >= 0 && line < b.Length() && b.GetLine(line).Len() > 0 {
+			line += dir
+		}
+		if line < 0 {
+			return 0, 0, c.Line != 0 || c.Pos != 0
+		}
+		if line >= b.Length() {
+			last := b.Length() - 1
+			pos := b.GetLine(last).Len()
+			if !args.Operator && pos > 0 {
+				pos--
+			}
+			return last, pos, c.Line != last || c.Pos != pos
+		}
+	}
+	return line, 0, true
+}
+
+// findMotion creates the f, F, t and T motions, which find the count'th
+// occurrence of a character on the line
+func (em *Vi) findMotion(name string) MotionFunc {
+	return func(c *novi.Cursor, args MotionArgs) (int, int, bool) {
+		em.lastFind, em.lastFindChar = name, args.Char
+		return em.find(c, name, args.Char, args.count(), false)
+	}
+}
+
+// lastFindMotion returns the last find motion and its character, reversed
+// for ','
+func (em *Vi) lastFindMotion(reverse bool) (string, rune) {
+	find := em.lastFind
+	if reverse {
+		find = map[string]string{"f": "F", "F": "f", "t": "T", "T": "t"}[find]
+	}
+	return find, em.lastFindChar
+}
+
+// repeatFind creates the ; and , motions, which repeat the last find in the
+// same or the opposite direction
+func (em *Vi) repeatFind(reverse bool) MotionFunc {
+	return func(c *novi.Cursor, args MotionArgs) (int, int, bool) {
+		find, char := em.lastFindMotion(reverse)
+		if find == "" {
+			return 0, 0, false
+		}
+		return em.find(c, find, char, args.count(), true)
+	}
+}
+
+// find finds the count'th occurrence of char on the line of c. When repeated,
+// t and T skip the occurrence right next to the cursor, so they don't get stuck
+func (em *Vi) find(c *novi.Cursor, name string, char rune, count int, repeat bool) (int, int, bool) {
+	runes := em.Editor.Buffer.GetLine(c.Line).AllRunes()
+	forward := name == "f" || name == "t"
+	till := name == "t" || name == "T"
+	dir := 1
+	if !forward {
+		dir = -1
+	}
+	pos := c.Pos
+	if till && repeat {
+		pos += dir
+	}
+	for count > 0 {
+		pos += dir
+		if pos < 0 || pos >= len(runes) {
+			return 0, 0, false
+		}
+		if runes[pos] == char {
+			count--
+		}
+	}
+	if till {
+		pos -= dir
+	}
+	return c.Line, pos, true
+}
@@ -0,0 +1,57 @@
+package viemu
+
+import (
+	"testing"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+func TestFindMotions(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		pos    int
+		keys   string
+		expect int
+	}{
+		{"f", 0, "fc", 2},
+		{"f with count", 0, "2fc", 6},
+		{"f not found", 0, "fz", 0},
+		{"t", 0, "tc", 1},
+		{"F", 8, "Fa", 4},
+		{"T", 8, "Ta", 5},
+		{"; repeats f", 0, "fc;", 6},
+		{", reverses f", 0, "2fc,", 2},
+		{"; doesn't get stuck on t", 0, "tc;", 5},
+		{"; with count", 0, "fb2;", 9},
+		{"; without a find", 3, ";", 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			vi, cursor := SetupViAndCursor(ModeCommand, 0, tc.pos, "abc abc abc")
+			SendKeys(vi, tc.keys)
+			novi.AssertCursor(t, cursor, 0, tc.expect)
+		})
+	}
+}
+
+func TestFindOperators(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		pos    int
+		keys   string
+		expect string
+	}{
+		{"dt)", 2, "dt)", "f()"},
+		{"cf,", 0, "cf,x<esc>", "x b, c)"},
+		{"dF is exclusive", 6, "dFa", "f(, c)"},
+		{"d; uses the type of the last find", 0, "f,d;", "f(a c)"},
+		{"d, reverses", 0, "2f,d,", "f(a, c)"},
+		{"df repeats", 0, "df,.", " c)"},
+		{"Visual", 2, "vf,d", "f( b, c)"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			vi, _ := SetupViAndCursor(ModeCommand, 0, tc.pos, "f(a, b, c)")
+			SendKeys(vi, tc.keys)
+			novi.AssertBufferMatch(t, vi.Editor.Buffer, tc.expect)
+		})
+	}
+}
@@ -0,0 +1,412 @@
+package viemu
+
+import (
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+/*
+ * Operators work on a range of text: the text covered by a motion ("d$"),
+ * count entire lines when the operator is repeated ("3dd", "gUU") or the
+ * selection in select mode.
+ *
+ * The range a motion covers follows vi's rules: an exclusive motion that ends
+ * in the first column of a line ends at the end of the line before it instead,
+ * and if it also starts at or before the first non-blank of its line it
+ * becomes linewise (e.g. "d}" at the start of a paragraph).
+ */
+
+// Range is the text an operator works on: from Line/Pos up to (exclusive)
+// EndLine/EndPos, the entire lines from Line to EndLine if Linewise, or the
+// screen columns from Pos up to EndPos on each line if Block
+type Range struct {
+	Line, Pos       int
+	EndLine, EndPos int
+	Linewise        bool
+	Block           bool
+}
+
+// empty returns true if the range doesn't contain any text
+func (r Range) empty() bool {
+	return !r.Linewise && !r.Block && r.Line == r.EndLine && r.Pos >= r.EndPos
+}
+
+// OperatorFunc applies an operator to a range, on behalf of cursor c. Only
+// the operation for the first cursor stores text in a register
+type OperatorFunc func(c *novi.Cursor, r Range, first bool)
+
+// initOperators registers the operators
+func (em *Vi) initOperators() {
+	em.operators = map[string]OperatorFunc{
+		"d":  em.opDelete,
+		"c":  em.opChange,
+		"y":  em.opYank,
+		">":  em.opShift(1),
+		"<":  em.opShift(-1),
+		"gu": em.opCase(unicode.ToLower),
+		"gU": em.opCase(unicode.ToUpper),
+		"=":  em.opIndent,
+		"!":  em.opFilter,
+	}
+}
+
+// motionRange returns the range covered by moving c to line, pos
+func (em *Vi) motionRange(c *novi.Cursor, line, pos int, typ MotionType) Range {
+	b := em.Editor.Buffer
+	r := Range{Line: c.Line, Pos: c.Pos, EndLine: line, EndPos: pos}
+	if line < c.Line || line == c.Line && pos < c.Pos {
+		r = Range{Line: line, Pos: pos, EndLine: c.Line, EndPos: c.Pos}
+	}
+	switch typ {
+	case MotionLinewise:
+		r.Pos, r.EndPos = 0, 0
+		r.Linewise = true
+	case MotionInclusive:
+		if r.EndPos < b.GetLine(r.EndLine).Len() {
+			r.EndPos++
+		}
+	case MotionExclusive:
+		if r.EndLine > r.Line && r.EndPos == 0 {
+			r.EndLine--
+			r.EndPos = b.GetLine(r.EndLine).Len()
+			if r.Pos <= firstNonBlank(b.GetLine(r.Line)) {
+				r.Linewise = true
+			}
+		}
+	}
+	if l := b.GetLine(r.Line).Len(); r.Pos > l {
+		r.Pos = l
+	}
+	return r
+}
+
+// operatorRange returns the range an operator works on for cursor c
+func (em *Vi) operatorRange(c *novi.Cursor, cmd *ViCommand) (Range, bool) {
+	b := em.Editor.Buffer
+	if cmd.Object != "" {
+		r, ok := em.textObjectRange(c, cmd.Object, cmd.count())
+		return r, ok && !r.empty()
+	}
+
+	if cmd.Motion == "" {
+		// a repeated operator works on count lines
+		end := c.Line + cmd.count() - 1
+		if end >= b.Length() {
+			end = b.Length() - 1
+		}
+		return Range{Line: c.Line, EndLine: end, Linewise: true}, true
+	}
+
+	motion := em.motions[cmd.Motion]
+	if cmd.Operator == "c" && (cmd.Motion == "w" || cmd.Motion == "W") {
+		// cw on a word changes up to the end of the word, like ce
+		line := b.GetLine(c.Line)
+		if c.Pos < line.Len() && !unicode.IsSpace(line.AllRunes()[c.Pos]) {
+			return em.changeWordRange(c, cmd.count(), cmd.Motion == "W"), true
+		}
+	}
+	l, p, ok := motion.Move(c, MotionArgs{Count: cmd.Count, Operator: true, Char: cmd.Arg})
+	if !ok {
+		return Range{}, false
+	}
+	r := em.motionRange(c, l, p, em.motionType(cmd.Motion))
+	return r, !r.empty()
+}
+
+// changeWordRange returns the range for cw: up to the end of the count'th
+// word, where the word the cursor is on counts as the first
+func (em *Vi) changeWordRange(c *novi.Cursor, count int, bigword bool) Range {
+	jump := JumpForwardEnd
+	if bigword {
+		jump = JumpWordForwardEnd
+	}
+	pos := *c
+	for _, end := range WordEnds(em.Editor.Buffer.GetLine(c.Line), bigword) {
+		if end == c.Pos {
+			count--
+			break
+		}
+	}
+	for i := 0; i < count; i++ {
+		pos.Line, pos.Pos = jump(em.Editor.Buffer, &pos)
+	}
+	return em.motionRange(c, pos.Line, pos.Pos, MotionInclusive)
+}
+
+// selectionRange returns the range of the current selection
+func (em *Vi) selectionRange() Range {
+	s, e := em.GetEmuSelection()
+	switch em.Selection {
+	case SelectionLines:
+		return Range{Line: s.Line, EndLine: e.Line, Linewise: true}
+	case SelectionBlock:
+		start, end := em.blockSpan()
+		return Range{Line: s.Line, Pos: start, EndLine: e.Line, EndPos: end, Block: true}
+	}
+	end := e.Pos + 1
+	if l := em.Editor.Buffer.GetLine(e.Line).Len(); end > l {
+		end = l
+	}
+	return Range{Line: s.Line, Pos: s.Pos, EndLine: e.Line, EndPos: end}
+}
+
+// blockColumns returns the part of a line that's in a block range, which
+// includes the characters that are partly in it
+func (em *Vi) blockColumns(r Range, line int) (int, int) {
+	l := em.Editor.Buffer.GetLine(line)
+	opts := em.Editor.ViewOptions
+	start, end := opts.PosAt(l, r.Pos), opts.NextPos(l, r.EndPos)
+	if start > end {
+		start = end
+	}
+	return start, end
+}
+
+// rangeStart returns the position the text in a range starts at on its
+// first line
+func (em *Vi) rangeStart(r Range) int {
+	if r.Block {
+		start, _ := em.blockColumns(r, r.Line)
+		return start
+	}
+	return r.Pos
+}
+
+// rangeRegister returns the text in a range as register
+func (em *Vi) rangeRegister(r Range) *Register {
+	b := em.Editor.Buffer
+	switch {
+	case r.Linewise:
+		return em.linesRegister(r.Line, r.EndLine+1)
+	case r.Block:
+		reg := &Register{Type: RegisterBlockwise}
+		for line := r.Line; line <= r.EndLine; line++ {
+			start, end := em.blockColumns(r, line)
+			reg.Text = append(reg.Text, b.Text(line, start, line, end)[0])
+		}
+		return reg
+	}
+	return &Register{Text: b.Text(r.Line, r.Pos, r.EndLine, r.EndPos), Type: RegisterCharwise}
+}
+
+// removeRange removes the text in a (non linewise) range
+func (em *Vi) removeRange(r Range) {
+	b := em.Editor.Buffer
+	if !r.Block {
+		b.Replace(r.Line, r.Pos, r.EndLine, r.EndPos, []string{""})
+		return
+	}
+	for line := r.Line; line <= r.EndLine; line++ {
+		start, end := em.blockColumns(r, line)
+		b.Replace(line, start, line, end, []string{""})
+	}
+}
+
+// opDelete implements d
+func (em *Vi) opDelete(c *novi.Cursor, r Range, first bool) {
+	b := em.Editor.Buffer
+	if first {
+		em.deleted(em.rangeRegister(r))
+	}
+	if r.Linewise {
+		b.RemoveLines(r.Line, r.EndLine)
+		c.Line = r.Line
+		if c.Line >= b.Length() {
+			c.Line = b.Length() - 1
+		}
+		c.Pos = firstNonBlank(b.GetLine(c.Line))
+		return
+	}
+	start := em.rangeStart(r)
+	em.removeRange(r)
+	c.Line, c.Pos = r.Line, em.columnOn(r.Line, start)
+}
+
+// opChange implements c, linewise it leaves a single empty line to insert on
+func (em *Vi) opChange(c *novi.Cursor, r Range, first bool) {
+	b := em.Editor.Buffer
+	if first {
+		em.deleted(em.rangeRegister(r))
+	}
+	start := em.rangeStart(r)
+	if r.Linewise {
+		b.Replace(r.Line, 0, r.EndLine, b.GetLine(r.EndLine).Len(), []string{""})
+	} else {
+		em.removeRange(r)
+	}
+	c.Line, c.Pos = r.Line, start
+	em.Mode = ModeEdit
+}
+
+// opYank implements y
+func (em *Vi) opYank(c *novi.Cursor, r Range, first bool) {
+	if first {
+		em.yanked(em.rangeRegister(r))
+		start, end := em.rangeStart(r), r.EndPos-1
+		switch {
+		case r.Linewise:
+			start, end = 0, math.MaxInt32
+		case r.Block:
+			_, end = em.blockColumns(r, r.EndLine)
+			end--
+		}
+		em.setMark('[', r.Line, start)
+		em.setMark(']', r.EndLine, em.columnOn(r.EndLine, end))
+	}
+	if r.Linewise {
+		c.Line, c.Pos = r.Line, em.columnOn(r.Line, c.Pos)
+	} else {
+		c.Line, c.Pos = r.Line, em.rangeStart(r)
+	}
+}
+
+// indentOf returns the width of the indentation of a line and its length in runes
+func (em *Vi) indentOf(l *novi.Line) (int, int) {
+	ts := em.Editor.ViewOptions.TabWidth()
+	width := 0
+	for i, r := range l.AllRunes() {
+		switch r {
+		case ' ':
+			width++
+		case '\t':
+			width += ts - width%ts
+		default:
+			return width, i
+		}
+	}
+	return width, l.Len()
+}
+
+// makeIndent returns the whitespace for an indentation of width, using tabs
+// unless expandtab is set
+func (em *Vi) makeIndent(width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if em.ExpandTab {
+		return strings.Repeat(" ", width)
+	}
+	ts := em.Editor.ViewOptions.TabWidth()
+	return strings.Repeat("\t", width/ts) + strings.Repeat(" ", width%ts)
+}
+
+// setIndent changes the indentation of a line to width
+func (em *Vi) setIndent(line, width int) {
+	l := em.Editor.Buffer.GetLine(line)
+	_, length := em.indentOf(l)
+	indent := em.makeIndent(width)
+	if string(l.GetRunes(0, length)) != indent {
+		em.Editor.Buffer.Replace(line, 0, line, length, []string{indent})
+	}
+}
+
+// opShift creates the > (dir 1) and < (dir -1) operators. They always work on
+// entire lines, empty lines are left alone
+func (em *Vi) opShift(dir int) OperatorFunc {
+	return func(c *novi.Cursor, r Range, first bool) {
+		b := em.Editor.Buffer
+		for line := r.Line; line <= r.EndLine; line++ {
+			if b.GetLine(line).Len() == 0 {
+				continue
+			}
+			width, _ := em.indentOf(b.GetLine(line))
+			em.setIndent(line, width+dir*em.ShiftWidth)
+		}
+		c.Line, c.Pos = r.Line, firstNonBlank(b.GetLine(r.Line))
+	}
+}
+
+// opCase creates the gu and gU operators
+func (em *Vi) opCase(convert func(rune) rune) OperatorFunc {
+	return func(c *novi.Cursor, r Range, first bool) {
+		b := em.Editor.Buffer
+		apply := func(line, pos, endLine, endPos int) {
+			text := b.Text(line, pos, endLine, endPos)
+			converted := make([]string, len(text))
+			for i, t := range text {
+				converted[i] = strings.Map(convert, t)
+			}
+			if strings.Join(text, "\n") != strings.Join(converted, "\n") {
+				b.Replace(line, pos, endLine, endPos, converted)
+			}
+		}
+		switch {
+		case r.Linewise:
+			pos := c.Pos
+			apply(r.Line, 0, r.EndLine, b.GetLine(r.EndLine).Len())
+			c.Line, c.Pos = r.Line, em.columnOn(r.Line, pos)
+			return
+		case r.Block:
+			for line := r.Line; line <= r.EndLine; line++ {
+				start, end := em.blockColumns(r, line)
+				apply(line, start, line, end)
+			}
+		default:
+			apply(r.Line, r.Pos, r.EndLine, r.EndPos)
+		}
+		c.Line, c.Pos = r.Line, em.columnOn(r.Line, em.rangeStart(r))
+	}
+}
+
+// opIndent implements =. It has no knowledge of any language: lines are
+// indented one level deeper for every bracket that's still open, starting
+// from the line above the range. Brackets in strings or comments aren't
+// recognized
+func (em *Vi) opIndent(c *novi.Cursor, r Range, first bool) {
+	b := em.Editor.Buffer
+	isOpen := func(r rune) bool { return strings.ContainsRune("({[", r) }
+	isClose := func(r rune) bool { return strings.ContainsRune(")}]", r) }
+	// balance returns the brackets opened minus the brackets closed
+	balance := func(s string) int {
+		n := 0
+		for _, r := range s {
+			if isOpen(r) {
+				n++
+			} else if isClose(r) {
+				n--
+			}
+		}
+		return n
+	}
+
+	next := 0
+	for line := r.Line - 1; line >= 0; line-- {
+		l := b.GetLine(line)
+		if strings.TrimSpace(l.ToString()) == "" {
+			continue
+		}
+		width, length := em.indentOf(l)
+		text := l.ToString()[len(string(l.GetRunes(0, length))):]
+		next = width + em.ShiftWidth*balance(text)
+		if isClose([]rune(text)[0]) {
+			next += em.ShiftWidth
+		}
+		break
+	}
+
+	for line := r.Line; line <= r.EndLine; line++ {
+		text := strings.TrimSpace(b.GetLine(line).ToString())
+		if text == "" {
+			if b.GetLine(line).Len() > 0 {
+				b.Replace(line, 0, line, b.GetLine(line).Len(), []string{""})
+			}
+			continue
+		}
+		width := next
+		if isClose([]rune(text)[0]) {
+			width -= em.ShiftWidth
+		}
+		if width < 0 {
+			width = 0
+		}
+		em.setIndent(line, width)
+		next = width + em.ShiftWidth*balance(text)
+		if isClose([]rune(text)[0]) {
+			next += em.ShiftWidth
+		}
+	}
+	c.Line, c.Pos = r.Line, firstNonBlank(b.GetLine(r.Line))
+}
@@ -0,0 +1,128 @@
+package viemu
+
+import (
+	"testing"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+func TestCommandGrammar(t *testing.T) {
+	vi := SetupVi(ModeCommand, "hello")
+	for _, tc := range []struct {
+		keys     string
+		complete bool
+		expect   ViCommand
+	}{
+		{"d", false, ViCommand{}},
+		{"2d3", false, ViCommand{}},
+		{"g", false, ViCommand{}},
+		{"gU", false, ViCommand{}},
+		{"d$", true, ViCommand{Operator: "d", Motion: "$"}},
+		{"c2e", true, ViCommand{Count: 2, Operator: "c", Motion: "e"}},
+		{"2d3w", true, ViCommand{Count: 6, Operator: "d", Motion: "w"}},
+		{"d0", true, ViCommand{Operator: "d", Motion: "0"}},
+		{"3dd", true, ViCommand{Count: 3, Operator: "d"}},
+		{"gUU", true, ViCommand{Operator: "gU"}},
+		{"gUgU", true, ViCommand{Operator: "gU"}},
+		{"dgg", true, ViCommand{Operator: "d", Motion: "gg"}},
+		{"0", true, ViCommand{Motion: "0"}},
+		{"10G", true, ViCommand{Count: 10, Motion: "G"}},
+		{"x", true, ViCommand{Operator: "d", Motion: "l"}},
+		{"2p", true, ViCommand{Count: 2, Command: "p"}},
+	} {
+		cmd, err := vi.parseCommand(tc.keys)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tc.keys, err)
+			continue
+		}
+		if !tc.complete {
+			if cmd != nil {
+				t.Errorf("%s: expected incomplete command, got %+v", tc.keys, cmd)
+			}
+			continue
+		}
+		if cmd == nil || *cmd != tc.expect {
+			t.Errorf("%s: expected %+v, got %+v", tc.keys, tc.expect, cmd)
+		}
+	}
+	if _, err := vi.parseCommand("dq"); err == nil {
+		t.Error("Expected an error for an unknown motion")
+	}
+}
+
+func TestOperators(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		line, pos int
+		lines     []string
+		keys      string
+		expect    []string
+		cline     int
+		cpos      int
+	}{
+		{"d$ deletes to the end of the line", 0, 2, []string{"hello world"}, "d$", []string{"he"}, 0, 1},
+		{"c2e changes two words", 0, 0, []string{"one two three"}, "c2eX<esc>", []string{"X three"}, 0, 1},
+		{"cw keeps the space", 0, 0, []string{"one two"}, "cwX<esc>", []string{"X two"}, 0, 1},
+		{"dw on the last word", 0, 4, []string{"one two"}, "dw", []string{"one "}, 0, 3},
+		{"dw at the end of a line", 0, 4, []string{"one two", "three"}, "dw", []string{"one ", "three"}, 0, 3},
+		{"d} from the start of a paragraph is linewise", 0, 0, []string{"a", "b", "", "c"}, "d}", []string{"", "c"}, 0, 0},
+		{"d} from within a line is charwise", 0, 1, []string{"ab", "c", "", "d"}, "d}", []string{"a", "", "d"}, 0, 0},
+		{"dG deletes to the end", 1, 1, []string{"a", "b", "c"}, "dG", []string{"a"}, 0, 0},
+		{"dgg deletes to the start", 1, 0, []string{"a", "b", "c"}, "dgg", []string{"c"}, 0, 0},
+		{"dj deletes two lines", 0, 0, []string{"a", "b", "c"}, "dj", []string{"c"}, 0, 0},
+		{"d0 deletes to the start of the line", 0, 3, []string{"hello"}, "d0", []string{"lo"}, 0, 0},
+		{"de is inclusive", 0, 0, []string{"one two"}, "de", []string{" two"}, 0, 0},
+		{"db is exclusive", 0, 4, []string{"one two"}, "db", []string{"two"}, 0, 0},
+		{"3dd", 1, 0, []string{"a", "b", "c", "d", "e"}, "3dd", []string{"a", "e"}, 1, 0},
+		{"dd on the last line", 2, 0, []string{"a", "b", "c"}, "dd", []string{"a", "b"}, 1, 0},
+		{"cc leaves an empty line", 1, 0, []string{"a", "b", "c"}, "ccX<esc>", []string{"a", "X", "c"}, 1, 0},
+		{"D", 0, 1, []string{"abc"}, "D", []string{"a"}, 0, 0},
+		{"3x", 0, 1, []string{"abcde"}, "3x", []string{"ae"}, 0, 1},
+		{">> shifts a line", 0, 0, []string{"a", "b"}, ">>", []string{"\ta", "b"}, 0, 1},
+		{">j shifts two lines", 0, 0, []string{"a", "", "c"}, ">2j", []string{"\ta", "", "\tc"}, 0, 1},
+		{"<< unshifts a line", 0, 0, []string{"\t\ta"}, "<<", []string{"\ta"}, 0, 1},
+		{"gUw", 0, 0, []string{"one two"}, "gUw", []string{"ONE two"}, 0, 0},
+		{"guu", 0, 3, []string{"ONE TWO"}, "guu", []string{"one two"}, 0, 3},
+		{"gU$", 0, 4, []string{"one two"}, "gU$", []string{"one TWO"}, 0, 4},
+		{"= reindents", 0, 0, []string{"func() {", "a", "if {", "b", "}", "}"}, "=G",
+			[]string{"func() {", "\ta", "\tif {", "\t\tb", "\t}", "}"}, 0, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			vi, cursor := SetupViAndCursor(ModeCommand, tc.line, tc.pos, tc.lines...)
+			SendKeys(vi, tc.keys)
+			novi.AssertBufferMatch(t, vi.Editor.Buffer, tc.expect...)
+			novi.AssertCursor(t, cursor, tc.cline, tc.cpos)
+		})
+	}
+}
+
+func TestOperatorRegisters(t *testing.T) {
+	t.Run("y} yanks up to the paragraph", func(t *testing.T) {
+		vi, cursor := SetupViAndCursor(ModeCommand, 0, 1, "ab", "c", "", "d")
+		SendKeys(vi, "y}")
+		AssertRegister(t, vi.GetRegister('"'), RegisterCharwise, "b", "c")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "ab", "c", "", "d")
+		novi.AssertCursor(t, cursor, 0, 1)
+	})
+	t.Run("yj is linewise", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 1, "ab", "c", "d")
+		SendKeys(vi, "yjGp")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "ab", "c", "d", "ab", "c")
+	})
+	t.Run("Register and count", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 0, "one two three")
+		SendKeys(vi, "\"a2dw")
+		AssertRegister(t, vi.GetRegister('a'), RegisterCharwise, "one two ")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "three")
+	})
+	t.Run("Operator on a selection", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 0, "one two")
+		SendKeys(vi, "veU")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "one two")
+		SendKeys(vi, "<esc>0vegU")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "ONE two")
+		if vi.Mode != ModeCommand {
+			t.Errorf("Expected command mode after operator, got %d", vi.Mode)
+		}
+	})
+}
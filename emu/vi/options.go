@@ -0,0 +1,154 @@
+package viemu
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+/*
+ * Support for :set. Options are either booleans (set with "name" and unset
+ * with "noname") or have a value ("name=value")
+ */
+
+// SetOption handles a single :set argument, e.g. "fileformat=dos" or "nofixeol"
+func (em *Vi) SetOption(arg string) error {
+	name, value := arg, ""
+	hasValue := false
+	if i := strings.IndexRune(arg, '='); i != -1 {
+		name, value = arg[:i], arg[i+1:]
+		hasValue = true
+	}
+	enable := true
+	if !hasValue && strings.HasPrefix(name, "no") {
+		name = name[2:]
+		enable = false
+	}
+
+	format := em.Editor.Buffer.Format
+	save := &em.Editor.SaveOptions
+
+	switch name {
+	case "backup", "bk":
+		if !hasValue {
+			save.Backup = novi.BackupOff
+			if enable {
+				save.Backup = novi.BackupSameDir
+			}
+			return nil
+		}
+		policy, err := novi.ParseBackupPolicy(value)
+		if err != nil {
+			return fmt.Errorf("E474: Invalid argument: %s", arg)
+		}
+		save.Backup = policy
+		return nil
+	case "backupdir", "bdir":
+		if !hasValue || value == "" {
+			return fmt.Errorf("E474: Invalid argument: %s", arg)
+		}
+		save.BackupDir = value
+		save.Backup = novi.BackupDir
+		return nil
+
+	case "shiftwidth", "sw", "tabstop", "ts":
+		n, err := strconv.Atoi(value)
+		if !hasValue || err != nil || n <= 0 {
+			return fmt.Errorf("E487: Argument must be positive: %s", arg)
+		}
+		if name == "shiftwidth" || name == "sw" {
+			em.ShiftWidth = n
+		} else {
+			em.Editor.ViewOptions.TabStop = n
+		}
+		return nil
+	case "scrolloff", "so", "sidescrolloff", "siso":
+		n, err := strconv.Atoi(value)
+		if !hasValue || err != nil || n < 0 {
+			return fmt.Errorf("E487: Argument must be positive: %s", arg)
+		}
+		if name == "scrolloff" || name == "so" {
+			em.Editor.ViewOptions.ScrollOff = n
+		} else {
+			em.Editor.ViewOptions.SideScrollOff = n
+		}
+		return nil
+	case "wrap":
+		em.Editor.ViewOptions.Wrap = enable
+		return nil
+	case "linebreak", "lbr":
+		em.Editor.ViewOptions.LineBreak = enable
+		return nil
+	case "showbreak", "sbr":
+		if !hasValue {
+			return fmt.Errorf("E474: Invalid argument: %s", arg)
+		}
+		em.Editor.ViewOptions.ShowBreak = value
+		return nil
+	case "syntax", "syn":
+		if value == "" || value == "off" {
+			em.Editor.SetLexer(nil)
+			return nil
+		}
+		l := novi.LexerByName(value)
+		if l == nil {
+			return fmt.Errorf("E474: Invalid argument: %s", arg)
+		}
+		em.Editor.SetLexer(l)
+		return nil
+	case "expandtab", "et":
+		em.ExpandTab = enable
+		return nil
+
+	case "ignorecase", "ic":
+		em.SearchOptions.IgnoreCase = enable
+		return nil
+	case "smartcase", "scs":
+		em.SearchOptions.SmartCase = enable
+		return nil
+	case "wrapscan", "ws":
+		em.SearchOptions.WrapScan = enable
+		return nil
+	case "hlsearch", "hls":
+		em.HLSearch = enable
+		if !enable {
+			em.NoHighlight()
+		}
+		return nil
+	case "incsearch", "is":
+		em.IncSearch = enable
+		return nil
+
+	case "fileformat", "ff":
+		if !hasValue {
+			return fmt.Errorf("E474: Invalid argument: %s", arg)
+		}
+		ending, err := novi.ParseLineEnding(value)
+		if err != nil {
+			return fmt.Errorf("E474: Invalid argument: %s", arg)
+		}
+		format.Ending = ending
+	case "fixendofline", "fixeol":
+		format.FixEOL = enable
+	case "endofline", "eol":
+		format.EOL = enable
+	case "bomb":
+		format.BOM = enable
+	default:
+		return fmt.Errorf("E518: Unknown option: %s", name)
+	}
+	em.Editor.Buffer.SetFormat(format)
+	return nil
+}
+
+// HandleSet handles the arguments to the :set command
+func (em *Vi) HandleSet(args []string) {
+	for _, arg := range args {
+		if err := em.SetOption(arg); err != nil {
+			em.c <- &novi.ErrorEvent{Message: err.Error()}
+			return
+		}
+	}
+}
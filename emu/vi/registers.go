@@ -0,0 +1,138 @@
+package viemu
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+/*
+ * Registers hold yanked and deleted text, like in vi:
+ *
+ * "       the unnamed register, refers to the register that was written last
+ * a-z     named registers, A-Z appends to them
+ * 0       the last yanked text
+ * 1-9     the last deletes of one or more lines, 1 being the most recent
+ * -       the last delete within a line
+ * . : %   read-only: the last inserted text, the last ex command, the file name
+ * _       the black hole, anything written to it is discarded
+ *
+ * Text is stored as a slice of lines, like novi.Change does. Whether a register
+ * holds characters, entire lines or a block determines how it's put back.
+ */
+
+// RegisterType determines how the contents of a register are put
+type RegisterType int
+
+// The different types of register contents
+const (
+	RegisterCharwise RegisterType = iota
+	RegisterLinewise
+	RegisterBlockwise
+)
+
+// Register holds the contents of a single register
+type Register struct {
+	Text []string
+	Type RegisterType
+}
+
+// String returns the contents as text. Linewise contents end with a newline
+func (r *Register) String() string {
+	s := strings.Join(r.Text, "\n")
+	if r.Type == RegisterLinewise {
+		s += "\n"
+	}
+	return s
+}
+
+// ValidRegister returns true if name is a register name
+func ValidRegister(name rune) bool {
+	return name < unicode.MaxASCII && (unicode.IsLetter(name) || unicode.IsDigit(name) || strings.ContainsRune(`"-.:%_`, name))
+}
+
+// Registers holds all writable registers
+type Registers struct {
+	registers map[rune]*Register
+	unnamed   rune
+}
+
+// NewRegisters creates an empty set of registers
+func NewRegisters() *Registers {
+	return &Registers{registers: make(map[rune]*Register)}
+}
+
+// Get returns the contents of a register, nil if it's empty. The unnamed
+// register can be passed as '"' or 0
+func (rs *Registers) Get(name rune) *Register {
+	if name == 0 || name == '"' {
+		name = rs.unnamed
+	}
+	return rs.registers[unicode.ToLower(name)]
+}
+
+// Yank stores yanked text in a register, 0 means no register was given
+func (rs *Registers) Yank(name rune, r *Register) error {
+	if name == 0 || name == '"' {
+		name = '0'
+	}
+	return rs.store(name, r)
+}
+
+// Delete stores deleted text in a register, 0 means no register was given.
+// Without a register, deletes of (parts of) multiple lines go to the numbered
+// registers, others go to the small delete register
+func (rs *Registers) Delete(name rune, r *Register) error {
+	if name != 0 && name != '"' {
+		return rs.store(name, r)
+	}
+	if r.Type == RegisterCharwise && len(r.Text) == 1 {
+		return rs.store('-', r)
+	}
+	for i := '9'; i > '1'; i-- {
+		rs.registers[i] = rs.registers[i-1]
+	}
+	return rs.store('1', r)
+}
+
+// Record stores a recorded macro in a register. Unlike yanks and deletes it
+// doesn't change the unnamed register
+func (rs *Registers) Record(name rune, r *Register) error {
+	unnamed := rs.unnamed
+	err := rs.store(name, r)
+	rs.unnamed = unnamed
+	return err
+}
+
+// store writes to a register and makes it the unnamed register
+func (rs *Registers) store(name rune, r *Register) error {
+	switch {
+	case name == '_':
+		return nil
+	case !ValidRegister(name) || strings.ContainsRune(".:%", name):
+		return fmt.Errorf("E354: Invalid register name: '%c'", name)
+	case unicode.IsUpper(name):
+		name = unicode.ToLower(name)
+		if prev := rs.registers[name]; prev != nil {
+			r = appendRegister(prev, r)
+		}
+	}
+	rs.registers[name] = r
+	rs.unnamed = name
+	return nil
+}
+
+// appendRegister returns the contents of r appended to prev. If either is
+// linewise the result is linewise as well
+func appendRegister(prev, r *Register) *Register {
+	text := append([]string(nil), prev.Text...)
+	if prev.Type == RegisterCharwise && r.Type == RegisterCharwise {
+		text[len(text)-1] += r.Text[0]
+		return &Register{append(text, r.Text[1:]...), RegisterCharwise}
+	}
+	typ := prev.Type
+	if r.Type == RegisterLinewise {
+		typ = RegisterLinewise
+	}
+	return &Register{append(text, r.Text...), typ}
+}
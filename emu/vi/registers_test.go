@@ -0,0 +1,129 @@
+package viemu
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+func AssertRegister(t *testing.T, r *Register, typ RegisterType, text ...string) {
+	t.Helper()
+
+	if r == nil {
+		t.Errorf("Expected register with %v, got nil", text)
+		return
+	}
+	if r.Type != typ || !reflect.DeepEqual(r.Text, text) {
+		t.Errorf("Expected register %d %v, got %d %v", typ, text, r.Type, r.Text)
+	}
+}
+
+func TestRegisters(t *testing.T) {
+	t.Run("Yank goes to 0", func(t *testing.T) {
+		rs := NewRegisters()
+		rs.Yank(0, &Register{Text: []string{"hello"}})
+		AssertRegister(t, rs.Get('0'), RegisterCharwise, "hello")
+		AssertRegister(t, rs.Get('"'), RegisterCharwise, "hello")
+	})
+	t.Run("Small deletes go to -", func(t *testing.T) {
+		rs := NewRegisters()
+		rs.Delete(0, &Register{Text: []string{"x"}})
+		AssertRegister(t, rs.Get('-'), RegisterCharwise, "x")
+		if rs.Get('1') != nil {
+			t.Error("Expected register 1 to be empty")
+		}
+	})
+	t.Run("Line deletes shift numbered registers", func(t *testing.T) {
+		rs := NewRegisters()
+		rs.Delete(0, &Register{Text: []string{"one"}, Type: RegisterLinewise})
+		rs.Delete(0, &Register{Text: []string{"two", ""}})
+		AssertRegister(t, rs.Get('1'), RegisterCharwise, "two", "")
+		AssertRegister(t, rs.Get('2'), RegisterLinewise, "one")
+		AssertRegister(t, rs.Get(0), RegisterCharwise, "two", "")
+	})
+	t.Run("Uppercase appends", func(t *testing.T) {
+		rs := NewRegisters()
+		rs.Yank('a', &Register{Text: []string{"hello"}})
+		rs.Yank('A', &Register{Text: []string{" world"}})
+		AssertRegister(t, rs.Get('a'), RegisterCharwise, "hello world")
+		rs.Yank('A', &Register{Text: []string{"line"}, Type: RegisterLinewise})
+		AssertRegister(t, rs.Get('a'), RegisterLinewise, "hello world", "line")
+	})
+	t.Run("Black hole and read-only registers", func(t *testing.T) {
+		rs := NewRegisters()
+		rs.Yank(0, &Register{Text: []string{"keep"}})
+		if err := rs.Delete('_', &Register{Text: []string{"gone"}}); err != nil {
+			t.Error(err)
+		}
+		AssertRegister(t, rs.Get(0), RegisterCharwise, "keep")
+		if err := rs.Yank('%', &Register{Text: []string{"x"}}); err == nil {
+			t.Error("Expected error writing to read-only register")
+		}
+	})
+}
+
+func TestYankPut(t *testing.T) {
+	t.Run("yy and p", func(t *testing.T) {
+		vi, cursor := SetupViAndCursor(ModeCommand, 0, 2, "  one", "two")
+		SendKeys(vi, "yyjp")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "  one", "two", "  one")
+		novi.AssertCursor(t, cursor, 2, 2)
+	})
+	t.Run("dd and P", func(t *testing.T) {
+		vi, cursor := SetupViAndCursor(ModeCommand, 0, 0, "one", "two")
+		SendKeys(vi, "ddP")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "one", "two")
+		novi.AssertCursor(t, cursor, 0, 0)
+	})
+	t.Run("xp swaps characters", func(t *testing.T) {
+		vi, cursor := SetupViAndCursor(ModeCommand, 0, 0, "ab")
+		SendKeys(vi, "xp")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "ba")
+		novi.AssertCursor(t, cursor, 0, 1)
+	})
+	t.Run("Put with count", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 0, "ab")
+		SendKeys(vi, "yw3P")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "abababab")
+	})
+	t.Run("Named registers", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 0, "one", "two")
+		SendKeys(vi, `"ayyj"Ayy"_ddk"ap`)
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "one", "one", "two")
+	})
+	t.Run("Visual yank", func(t *testing.T) {
+		vi, cursor := SetupViAndCursor(ModeCommand, 0, 1, "hello")
+		SendKeys(vi, "v<right>y$p")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "helloel")
+		novi.AssertCursor(t, cursor, 0, 6)
+	})
+	t.Run("Block put", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 0, "abc", "def", "g")
+		SendKeys(vi, "<c-v><down>y")
+		SendKeys(vi, "jjP")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "abc", "def", "ag", "d")
+	})
+	t.Run("Empty register", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 0, "abc")
+		SendKeys(vi, `"bp`)
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "abc")
+	})
+	t.Run("Insert register", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 0, "abc")
+		SendKeys(vi, "ix<esc>A<c-r>.<c-r>%<esc>")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "xabcx")
+		if vi.lastInsert != "x" {
+			t.Errorf("Expected last insert to be x, got %q", vi.lastInsert)
+		}
+	})
+	t.Run("Insert register in ex", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 0, "abc")
+		SendKeys(vi, "yw")
+		vi.HandleEvent(ExInputID, &novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'r'})
+		vi.HandleEvent(ExInputID, &novi.CharacterEvent{Rune: '"'})
+		if s := vi.ex.input.ToString(); s != "abc" {
+			t.Errorf("Expected abc in ex input, got %q", s)
+		}
+	})
+}
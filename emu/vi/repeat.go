@@ -0,0 +1,109 @@
+package viemu
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+/*
+ * Repeating the last change with '.'. A change is recorded as the keys of the
+ * command that made it, followed by the events of the insert session it
+ * started (if any), e.g. "cw" + "foo<esc>". Repeating it simply sends these
+ * events through HandleEvent again, so it behaves exactly like typing them.
+ *
+ * The count and register are stored separately, since a count given to '.'
+ * replaces the original count. An operator on a selection is repeated on the
+ * same amount of text, starting at the cursor.
+ */
+
+// viChange is a change that can be repeated
+type viChange struct {
+	register rune
+	count    int
+	keys     []novi.Event
+	visual   bool // the keys select the text, a count doesn't apply
+	insert   []novi.Event
+}
+
+// keyEvents returns the character events for typing keys
+func keyEvents(keys string) []novi.Event {
+	var events []novi.Event
+	for _, r := range keys {
+		events = append(events, &novi.CharacterEvent{Rune: r})
+	}
+	return events
+}
+
+// recordChange records a change. If it started an insert session, it's
+// completed by HandleEvent when the session ends
+func (em *Vi) recordChange(register rune, count int, keys []novi.Event, visual bool) {
+	change := &viChange{register: register, count: count, keys: keys, visual: visual}
+	if em.Mode == ModeEdit {
+		em.change = change
+		return
+	}
+	em.lastChange = change
+}
+
+// selectionKeys returns the keys that select the same amount of text as the
+// current selection, starting at the cursor
+func (em *Vi) selectionKeys() []novi.Event {
+	s, e := em.GetEmuSelection()
+	lines := ""
+	if e.Line > s.Line {
+		lines = fmt.Sprintf("%dj", e.Line-s.Line)
+	}
+	switch em.Selection {
+	case SelectionLines:
+		return keyEvents("V" + lines)
+	case SelectionBlock:
+		keys := []novi.Event{&novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'v'}}
+		if em.blockToEOL {
+			lines += "$"
+		} else if e.Pos > s.Pos {
+			lines += fmt.Sprintf("%dl", e.Pos-s.Pos)
+		}
+		return append(keys, keyEvents(lines)...)
+	}
+	switch {
+	case e.Line > s.Line && e.Pos > 0:
+		lines += fmt.Sprintf("0%dl", e.Pos)
+	case e.Line > s.Line:
+		lines += "0"
+	case e.Pos > s.Pos:
+		lines += fmt.Sprintf("%dl", e.Pos-s.Pos)
+	}
+	return keyEvents("v" + lines)
+}
+
+// Repeat repeats the last change, count replaces its count if not 0. It
+// returns false if the editor should exit
+func (em *Vi) Repeat(count int) bool {
+	change := em.lastChange
+	if change == nil {
+		return true
+	}
+	var events []novi.Event
+	if change.register != 0 {
+		events = keyEvents("\"" + string(change.register))
+	}
+	if count == 0 || change.visual {
+		count = change.count
+	}
+	if count != 0 {
+		events = append(events, keyEvents(strconv.Itoa(count))...)
+	}
+	events = append(events, change.keys...)
+	events = append(events, change.insert...)
+
+	em.replaying++
+	defer func() { em.replaying-- }()
+	for _, ev := range events {
+		if !em.HandleEvent(MainInputID, ev) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+package viemu
+
+import (
+	"testing"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+func TestRepeat(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		line, pos int
+		lines     []string
+		keys      string
+		expect    []string
+		cline     int
+		cpos      int
+	}{
+		{"cw and typed text", 0, 0, []string{"one two three"}, "cwX<esc>w.", []string{"X X three"}, 0, 3},
+		{"x", 0, 0, []string{"abcdef"}, "x..", []string{"def"}, 0, 0},
+		{"x with a new count", 0, 0, []string{"abcdef"}, "x3.", []string{"ef"}, 0, 0},
+		{"dd with its count", 0, 0, []string{"a", "b", "c", "d", "e"}, "2dd.", []string{"e"}, 0, 0},
+		{"o and text", 0, 0, []string{"a"}, "onew<esc>.", []string{"a", "new", "new"}, 2, 2},
+		{"A and text", 0, 0, []string{"a", "b"}, "A!<esc>j.", []string{"a!", "b!"}, 1, 1},
+		{"Visual operator", 0, 0, []string{"abcdef", "abcdef"}, "vld<down>0.", []string{"cdef", "cdef"}, 1, 0},
+		{"Linewise visual", 0, 0, []string{"a", "b", "c", "d", "e"}, "V<down>d.", []string{"e"}, 0, 0},
+		{"Put", 0, 0, []string{"ab"}, "ylp.", []string{"aaab"}, 0, 2},
+		{"Nothing to repeat", 0, 0, []string{"ab"}, ".", []string{"ab"}, 0, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			vi, cursor := SetupViAndCursor(ModeCommand, tc.line, tc.pos, tc.lines...)
+			SendKeys(vi, tc.keys)
+			novi.AssertBufferMatch(t, vi.Editor.Buffer, tc.expect...)
+			novi.AssertCursor(t, cursor, tc.cline, tc.cpos)
+		})
+	}
+	t.Run("Repeat is a single undo step", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 0, "one two three")
+		SendKeys(vi, "cwX<esc>w.")
+		SendKeys(vi, "u")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "X two three")
+		SendKeys(vi, "u")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "one two three")
+	})
+	t.Run("Multiple cursors", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 0, "abc", "abc")
+		vi.Editor.Cursors = append(vi.Editor.Cursors, vi.Editor.Buffer.NewCursor(1, 0))
+		SendKeys(vi, "x.")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "c", "c")
+	})
+}
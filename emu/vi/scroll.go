@@ -0,0 +1,207 @@
+package viemu
+
+import "github.com/iivvoo/novi/novi"
+
+/*
+ * Scrolling, relative to the viewport of the document (see novi.Viewport):
+ *
+ * Ctrl-F Ctrl-B  a page forward/backward, keeping two lines of context
+ * Ctrl-D Ctrl-U  half a page down/up, the cursor moves the same number of
+ *                lines. A count sets the number of lines for later uses
+ * Ctrl-E Ctrl-Y  a line (count lines) down/up, the cursor stays on its line
+ *                unless it would scroll out of view
+ * zz zt zb       scroll the cursor line (line count) to the middle, top or
+ *                bottom of the screen
+ * H M L          motions to the top, middle and bottom line of the screen
+ * gj gk          motions a screen row (count rows) down/up, which differs
+ *                from j and k when long lines wrap
+ * g0 g$          motions to the first and last character on the screen row
+ *
+ * The scrolloff (so) and sidescrolloff (siso) options set the number of
+ * lines and columns kept visible around the cursor.
+ */
+
+// scrollKeys are the Ctrl keys that scroll
+var scrollKeys = []novi.Event{
+	&novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'f'},
+	&novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'b'},
+	&novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'd'},
+	&novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'u'},
+	&novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'e'},
+	&novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'y'},
+}
+
+// scrollOff returns the scrolloff margin, limited to what fits on the screen
+func (em *Vi) scrollOff() int {
+	off := em.Editor.ViewOptions.ScrollOff
+	if max := (em.Editor.Viewport.Rows() - 1) / 2; off > max {
+		off = max
+	}
+	return off
+}
+
+// HandleScroll handles the Ctrl keys that scroll the viewport
+func (em *Vi) HandleScroll(ev novi.Event) bool {
+	count, _ := splitCount(em.CommandBuffer)
+	em.CommandBuffer = ""
+
+	e := em.Editor
+	rows := e.Viewport.Rows()
+	top, last := e.Viewport.Line, e.Buffer.Length()-1
+	page := rows - 2
+	if page < 1 {
+		page = 1
+	}
+	times := count
+	if times == 0 {
+		times = 1
+	}
+
+	switch r := ev.(*novi.KeyEvent).Rune; r {
+	case 'f', 'b':
+		if r == 'f' && top >= last || r == 'b' && top == 0 {
+			em.failed = true
+			return true
+		}
+		if r == 'b' {
+			page = -page
+		}
+		e.ScrollTo(top + page*times)
+		em.cursorsToView(true)
+	case 'd', 'u':
+		if count > 0 {
+			em.scrollLines = count
+		}
+		n := em.scrollLines
+		if n == 0 {
+			n = (rows + 1) / 2
+		}
+		c := e.Cursors[0]
+		if r == 'd' && c.Line == last || r == 'u' && c.Line == 0 {
+			em.failed = true
+			return true
+		}
+		if r == 'u' {
+			n = -n
+			e.ScrollTo(top + n)
+		} else if bottom := last - rows + 1; top+n <= bottom {
+			e.ScrollTo(top + n)
+		} else if top < bottom {
+			// stop once the last line is at the bottom
+			e.ScrollTo(bottom)
+		}
+		for _, c := range e.Cursors {
+			line := c.Line + n
+			if line > last {
+				line = last
+			} else if line < 0 {
+				line = 0
+			}
+			c.Line, c.Pos = line, firstNonBlank(e.Buffer.GetLine(line))
+		}
+		em.cursorsToView(true)
+	case 'e':
+		e.ScrollTo(top + times)
+		em.cursorsToView(false)
+	case 'y':
+		e.ScrollTo(top - times)
+		em.cursorsToView(false)
+	}
+	em.UpdateSelection()
+	return true
+}
+
+// cursorsToView moves the cursors that scrolled out of view back into it, to
+// the first non-blank of their new line if nonBlank is set
+func (em *Vi) cursorsToView(nonBlank bool) {
+	for _, c := range em.Editor.Cursors {
+		if em.Editor.CursorToView(c) {
+			if nonBlank {
+				c.Pos = firstNonBlank(em.Editor.Buffer.GetLine(c.Line))
+			} else {
+				c.Pos = em.columnOn(c.Line, c.Pos)
+			}
+		}
+	}
+}
+
+// scrollCursor handles zz, zt and zb, which scroll the cursor line (line
+// count) to the middle, top or bottom of the screen
+func (em *Vi) scrollCursor(cmd *ViCommand) bool {
+	e := em.Editor
+	c := e.Cursors[0]
+	if cmd.Count > 0 {
+		line := cmd.Count - 1
+		if last := e.Buffer.Length() - 1; line > last {
+			line = last
+		}
+		c.Line, c.Pos = line, em.columnOn(line, c.Pos)
+	}
+	rows := e.Viewport.Rows()
+	switch cmd.Command {
+	case "zz":
+		e.ScrollTo(c.Line - (rows-1)/2)
+	case "zt":
+		e.ScrollTo(c.Line - em.scrollOff())
+	case "zb":
+		e.ScrollTo(c.Line - rows + 1 + em.scrollOff())
+	}
+	return true
+}
+
+// screenMotion creates H (where < 0), M (where 0) and L (where > 0). H and
+// L move to the line count lines from the top or bottom of the screen, but
+// not into the scrolloff margin
+func (em *Vi) screenMotion(where int) MotionFunc {
+	return func(c *novi.Cursor, args MotionArgs) (int, int, bool) {
+		first, last := em.Editor.VisibleLines()
+		n := args.count() - 1
+		switch {
+		case where < 0:
+			if off := em.scrollOff(); first > 0 && n < off {
+				n = off
+			}
+			if first+n < last {
+				return em.lineMotion(first + n)
+			}
+			return em.lineMotion(last)
+		case where > 0:
+			if off := em.scrollOff(); last < em.Editor.Buffer.Length()-1 && n < off {
+				n = off
+			}
+			if last-n > first {
+				return em.lineMotion(last - n)
+			}
+			return em.lineMotion(first)
+		}
+		return em.lineMotion((first + last) / 2)
+	}
+}
+
+// screenRowMotion creates gj (dir > 0) and gk (dir < 0)
+func (em *Vi) screenRowMotion(dir int) MotionFunc {
+	return func(c *novi.Cursor, args MotionArgs) (int, int, bool) {
+		line, pos, ok := em.Editor.MoveScreenRows(c.Line, c.Pos, dir*args.count())
+		if !ok {
+			return 0, 0, false
+		}
+		return line, em.columnOn(line, pos), true
+	}
+}
+
+// rowEndMotion creates g0 (end false) and g$ (end true)
+func (em *Vi) rowEndMotion(end bool) MotionFunc {
+	return func(c *novi.Cursor, args MotionArgs) (int, int, bool) {
+		rows := em.Editor.ScreenRows(c.Line)
+		row := rows[novi.RowOf(rows, c.Pos)]
+		l := em.Editor.Buffer.GetLine(c.Line)
+		x := row.Indent
+		if end {
+			// without a viewport the line is a single row
+			if x = em.Editor.Viewport.Width - 1; x < 0 {
+				return c.Line, em.columnOn(c.Line, l.Len()), true
+			}
+		}
+		return c.Line, em.columnOn(c.Line, em.Editor.ViewOptions.RowPos(l, row, x)), true
+	}
+}
@@ -0,0 +1,112 @@
+package viemu
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+func TestScroll(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		top, line int
+		keys      string
+		first     int
+		cline     int
+	}{
+		{"Page forward", 0, 0, "<c-f>", 8, 8},
+		{"Two pages forward", 0, 3, "2<c-f>", 16, 16},
+		{"Page backward", 20, 25, "<c-b>", 12, 21},
+		{"Page backward at the top", 0, 5, "<c-b>", 0, 5},
+		{"Half a page down", 0, 2, "<c-d>", 5, 7},
+		{"Half a page down near the end", 38, 40, "<c-d>", 40, 45},
+		{"Half a page down at the end", 45, 46, "<c-d>", 45, 49},
+		{"Count sets the lines", 0, 2, "3<c-d><c-d>", 6, 8},
+		{"Half a page up", 20, 22, "<c-u>", 15, 17},
+		{"Line down", 0, 4, "<c-e>", 1, 4},
+		{"Line down moves the cursor", 0, 0, "3<c-e>", 3, 3},
+		{"Line up moves the cursor", 10, 19, "<c-y>", 9, 18},
+		{"Cursor to the middle", 0, 20, "zz", 16, 20},
+		{"Cursor to the top", 0, 20, "zt", 20, 20},
+		{"Cursor to the bottom", 0, 20, "zb", 11, 20},
+		{"Line to the top", 0, 0, "31zt", 30, 30},
+		{"High", 10, 15, "H", 10, 10},
+		{"High with count", 10, 15, "3H", 10, 12},
+		{"Middle", 10, 15, "M", 10, 14},
+		{"Low", 10, 15, "L", 10, 19},
+		{"Low with count", 10, 15, "2L", 10, 18},
+		{"Delete to low", 45, 46, "dL", 45, 45},
+		{"Back from high", 10, 15, "H<c-o>", 10, 15},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var lines []string
+			for i := 1; i <= 50; i++ {
+				lines = append(lines, strconv.Itoa(i))
+			}
+			vi, cursor := SetupViAndCursor(ModeCommand, tc.line, 0, lines...)
+			vi.Editor.UpdateViewport(80, 10)
+			vi.Editor.ScrollTo(tc.top)
+			SendKeys(vi, tc.keys)
+			vi.Editor.UpdateViewport(80, 10)
+			if first := vi.Editor.Viewport.Line; first != tc.first {
+				t.Errorf("Expected line %d at the top, got %d", tc.first, first)
+			}
+			novi.AssertCursor(t, cursor, tc.cline, 0)
+		})
+	}
+	t.Run("Scrolloff", func(t *testing.T) {
+		var lines []string
+		for i := 1; i <= 50; i++ {
+			lines = append(lines, strconv.Itoa(i))
+		}
+		vi, cursor := SetupViAndCursor(ModeCommand, 15, 0, lines...)
+		vi.Editor.UpdateViewport(80, 10)
+		SendKeys(vi, ":set so=3<enter>H")
+		novi.AssertCursor(t, cursor, 9, 0)
+		SendKeys(vi, "zt")
+		if first := vi.Editor.Viewport.Line; first != 6 {
+			t.Errorf("Expected line 6 at the top, got %d", first)
+		}
+		SendKeys(vi, "<c-e><c-e><c-e>")
+		novi.AssertCursor(t, cursor, 12, 0)
+	})
+}
+
+func TestScreenRows(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		line, pos int
+		keys      string
+		cline     int
+		cpos      int
+	}{
+		{"Row down", 0, 2, "gj", 0, 12},
+		{"Rows down into the next line", 0, 2, "3gj", 1, 2},
+		{"Row up", 0, 22, "gk", 0, 12},
+		{"Row up into the previous line", 1, 3, "gk", 0, 23},
+		{"Row start", 0, 15, "g0", 0, 10},
+		{"Row end", 0, 15, "g$", 0, 19},
+		{"Row end on the last row", 0, 21, "g$", 0, 24},
+		{"Delete to the row end", 0, 15, "dg$", 0, 15},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			vi, cursor := SetupViAndCursor(ModeCommand, tc.line, tc.pos,
+				"0123456789abcdefghijABCDE",
+				"xyzw",
+			)
+			SendKeys(vi, ":set wrap<enter>")
+			vi.Editor.UpdateViewport(10, 10)
+			SendKeys(vi, tc.keys)
+			novi.AssertCursor(t, cursor, tc.cline, tc.cpos)
+		})
+	}
+	t.Run("Without wrap", func(t *testing.T) {
+		vi, cursor := SetupViAndCursor(ModeCommand, 0, 2, "0123456789abcdefghij", "xyzw")
+		vi.Editor.UpdateViewport(10, 10)
+		SendKeys(vi, "gj")
+		novi.AssertCursor(t, cursor, 1, 2)
+		SendKeys(vi, "kg$")
+		novi.AssertCursor(t, cursor, 0, 9)
+	})
+}
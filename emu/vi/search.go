@@ -0,0 +1,361 @@
+package viemu
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+/*
+ * Searching with / and ?. The pattern is typed in the ex input, which shows
+ * the matches and moves the cursor to the first one while typing. A search
+ * can be followed by an offset, separated by the same / or ?:
+ *
+ * /foo/e+1   one character after the end of the match (inclusive)
+ * /foo/s-1   one character before the start (b works like s)
+ * /foo/+2    two lines below the match (linewise)
+ *
+ * A search is a motion, so it can be used with an operator ("d/foo") or to
+ * extend a selection. n and N repeat it, * and # search for the word under
+ * the cursor and gn selects (or operates on) the next match.
+ */
+
+// viSearch is a search pattern with its direction and offset
+type viSearch struct {
+	pattern  string
+	backward bool
+	offset   string
+}
+
+// parseSearch parses the text typed after / or ?: the pattern, optionally
+// followed by the separator and an offset
+func parseSearch(text string, backward bool) *viSearch {
+	sep := '/'
+	if backward {
+		sep = '?'
+	}
+	s := &viSearch{backward: backward}
+	var pattern strings.Builder
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case runes[i] == '\\' && i+1 < len(runes) && runes[i+1] == sep:
+			pattern.WriteRune(sep)
+			i++
+		case runes[i] == '\\' && i+1 < len(runes):
+			pattern.WriteRune('\\')
+			pattern.WriteRune(runes[i+1])
+			i++
+		case runes[i] == sep:
+			s.offset = string(runes[i+1:])
+			s.pattern = pattern.String()
+			return s
+		default:
+			pattern.WriteRune(runes[i])
+		}
+	}
+	s.pattern = pattern.String()
+	return s
+}
+
+// lineOffset returns the number of lines the offset moves, and whether it's a
+// line offset at all
+func (s *viSearch) lineOffset() (int, bool) {
+	if s.offset == "" || strings.IndexAny(s.offset[:1], "esb") != -1 {
+		return 0, false
+	}
+	return offsetCount(s.offset), true
+}
+
+// offsetCount parses the count of an offset, e.g. "+2", "-", "3"
+func offsetCount(offset string) int {
+	switch offset {
+	case "":
+		return 0
+	case "+":
+		return 1
+	case "-":
+		return -1
+	}
+	n, err := strconv.Atoi(offset)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// motionType returns how an operator uses the search
+func (s *viSearch) motionType() MotionType {
+	if _, ok := s.lineOffset(); ok {
+		return MotionLinewise
+	}
+	if strings.HasPrefix(s.offset, "e") {
+		return MotionInclusive
+	}
+	return MotionExclusive
+}
+
+// apply returns the position the offset moves to from a match
+func (s *viSearch) apply(b *novi.Buffer, m novi.Match) (int, int) {
+	if n, ok := s.lineOffset(); ok {
+		line := m.Line + n
+		if line < 0 {
+			line = 0
+		}
+		if line >= b.Length() {
+			line = b.Length() - 1
+		}
+		return line, 0
+	}
+	pos := m.Pos
+	if strings.HasPrefix(s.offset, "e") && m.End > m.Pos {
+		pos = m.End - 1
+	}
+	if s.offset != "" {
+		pos += offsetCount(s.offset[1:])
+	}
+	if max := b.GetLine(m.Line).Len() - 1; pos > max {
+		pos = max
+	}
+	if pos < 0 {
+		pos = 0
+	}
+	return m.Line, pos
+}
+
+// compile compiles a pattern using the search options
+func (em *Vi) compile(pattern string) (*novi.Search, error) {
+	return novi.NewSearch(pattern, em.SearchOptions)
+}
+
+// findMatch finds the next match from a position, reporting wrapping around
+// and errors if report is set
+func (em *Vi) findMatch(search *novi.Search, line, pos int, backward, report bool) (novi.Match, bool) {
+	m, found, wrapped := em.Editor.Buffer.Find(search, line, pos, backward, em.SearchOptions.WrapScan)
+	if !report {
+		return m, found
+	}
+	switch {
+	case !found && !em.SearchOptions.WrapScan && backward:
+		em.c <- &novi.ErrorEvent{Message: "E384: search hit TOP without match for: " + search.Pattern}
+	case !found && !em.SearchOptions.WrapScan:
+		em.c <- &novi.ErrorEvent{Message: "E385: search hit BOTTOM without match for: " + search.Pattern}
+	case !found:
+		em.c <- &novi.ErrorEvent{Message: "E486: Pattern not found: " + search.Pattern}
+	case wrapped && backward:
+		em.c <- &novi.ErrorEvent{Message: "search hit TOP, continuing at BOTTOM"}
+	case wrapped:
+		em.c <- &novi.ErrorEvent{Message: "search hit BOTTOM, continuing at TOP"}
+	}
+	return m, found
+}
+
+// searchMotion returns the motion repeating the last search, in the opposite
+// direction if reverse is set
+func (em *Vi) searchMotion(reverse bool) MotionFunc {
+	return func(c *novi.Cursor, args MotionArgs) (int, int, bool) {
+		if em.lastSearch == nil {
+			if c == em.Editor.Cursors[0] {
+				em.c <- &novi.ErrorEvent{Message: "E35: No previous regular expression"}
+			}
+			return 0, 0, false
+		}
+		return em.search(c, c.Pos, em.lastSearch, reverse, args.count())
+	}
+}
+
+// wordSearchMotion returns the motion for * and #, searching for the word
+// under (or after) the cursor
+func (em *Vi) wordSearchMotion(backward bool) MotionFunc {
+	return func(c *novi.Cursor, args MotionArgs) (int, int, bool) {
+		runes := em.Editor.Buffer.GetLine(c.Line).AllRunes()
+		start := c.Pos
+		for start < len(runes) && GetRuneType(runes[start]) != TypeAlNum {
+			start++
+		}
+		if start == len(runes) {
+			if c == em.Editor.Cursors[0] {
+				em.c <- &novi.ErrorEvent{Message: "E348: No string under cursor"}
+			}
+			return 0, 0, false
+		}
+		for start > 0 && GetRuneType(runes[start-1]) == TypeAlNum {
+			start--
+		}
+		end := start
+		for end < len(runes) && GetRuneType(runes[end]) == TypeAlNum {
+			end++
+		}
+		pattern := `\<` + regexp.QuoteMeta(string(runes[start:end])) + `\>`
+		em.lastSearch = &viSearch{pattern: pattern, backward: backward}
+		// searching back starts at the start of the word, to skip it
+		from := c.Pos
+		if backward {
+			from = start
+		}
+		return em.search(c, from, em.lastSearch, false, args.count())
+	}
+}
+
+// search moves count matches from c, searching from column from. The match
+// the cursor is at because of the offset is skipped
+func (em *Vi) search(c *novi.Cursor, from int, s *viSearch, reverse bool, count int) (int, int, bool) {
+	report := c == em.Editor.Cursors[0]
+	search, err := em.compile(s.pattern)
+	if err != nil {
+		if report {
+			em.c <- &novi.ErrorEvent{Message: "E383: Invalid search string: " + s.pattern}
+		}
+		return 0, 0, false
+	}
+	if report && em.HLSearch {
+		em.Editor.Highlight = search
+	}
+	backward := s.backward != reverse
+	line, pos := c.Line, from
+	var m novi.Match
+	for i := 0; i < count; i++ {
+		found := false
+		if m, found = em.findMatch(search, line, pos, backward, report && i == count-1); !found {
+			return 0, 0, false
+		}
+		line, pos = m.Line, m.Pos
+		if l, p := s.apply(em.Editor.Buffer, m); i == 0 && l == c.Line && p == c.Pos {
+			// e.g. "n" after "/foo/e" would find the same match again
+			count++
+		}
+	}
+	l, p := s.apply(em.Editor.Buffer, m)
+	return l, p, true
+}
+
+// searchType returns the motion type of the search motions, which depends on
+// the offset of the last search
+func (em *Vi) searchType() MotionType {
+	if em.lastSearch == nil {
+		return MotionExclusive
+	}
+	return em.lastSearch.motionType()
+}
+
+// StartSearch asks for a search pattern, cmd is executed once it's entered
+func (em *Vi) StartSearch(cmd *ViCommand) {
+	em.searchCmd = cmd
+	em.searchStart = *em.Editor.Cursors[0]
+	em.searchHighlight = em.Editor.Highlight
+	em.openInput(cmd.Motion)
+}
+
+// updateIncSearch shows the first match of the pattern typed so far
+func (em *Vi) updateIncSearch() {
+	if !em.IncSearch || em.searchCmd == nil {
+		return
+	}
+	c := em.Editor.Cursors[0]
+	c.Line, c.Pos = em.searchStart.Line, em.searchStart.Pos
+	em.Editor.Highlight = em.searchHighlight
+	s := parseSearch(em.ex.input.ToString(), em.searchCmd.Motion == "?")
+	if s.pattern == "" {
+		return
+	}
+	search, err := em.compile(s.pattern)
+	if err != nil {
+		return
+	}
+	em.Editor.Highlight = search
+	if m, found := em.findMatch(search, c.Line, c.Pos, s.backward, false); found {
+		c.Line, c.Pos = m.Line, m.Pos
+	}
+}
+
+// CancelSearch restores the cursor and highlight when a search is cancelled
+func (em *Vi) CancelSearch() {
+	if em.searchCmd == nil {
+		return
+	}
+	em.searchCmd = nil
+	c := em.Editor.Cursors[0]
+	c.Line, c.Pos = em.searchStart.Line, em.searchStart.Pos
+	em.Editor.Highlight = em.searchHighlight
+}
+
+// HandleSearch executes the command waiting for the search in text. An empty
+// pattern repeats the last one
+func (em *Vi) HandleSearch(text string) bool {
+	cmd := em.searchCmd
+	em.CancelSearch()
+	if cmd == nil {
+		return true
+	}
+	s := parseSearch(text, cmd.Motion == "?")
+	if s.pattern == "" {
+		if em.lastSearch == nil {
+			em.c <- &novi.ErrorEvent{Message: "E35: No previous regular expression"}
+			em.failed = true
+			return true
+		}
+		s.pattern = em.lastSearch.pattern
+	}
+	em.lastSearch = s
+
+	// the search completes the command, which is a single change
+	em.Editor.Buffer.BeginChange(em.Editor.Cursors)
+	cmd.Motion = "n"
+	res := em.Execute(cmd)
+	if em.Mode == ModeEdit {
+		em.insertText = ""
+	} else {
+		em.Editor.Buffer.EndChange(em.Editor.Cursors)
+	}
+	return res
+}
+
+// searchObject returns the range of the match under the cursor, or the next
+// (previous if backward) match, for gn and gN. If text is selected already,
+// the selection is extended to the next match
+func (em *Vi) searchObject(c *novi.Cursor, backward bool) (Range, bool) {
+	if em.lastSearch == nil {
+		em.c <- &novi.ErrorEvent{Message: "E35: No previous regular expression"}
+		return Range{}, false
+	}
+	search, err := em.compile(em.lastSearch.pattern)
+	if err != nil {
+		return Range{}, false
+	}
+	if em.HLSearch {
+		em.Editor.Highlight = search
+	}
+	selected := em.Mode == ModeSelect && (em.SelectionStart.Line != c.Line || em.SelectionStart.Pos != c.Pos)
+	if !selected {
+		for _, m := range search.MatchesOn(em.Editor.Buffer, c.Line) {
+			if m.Pos <= c.Pos && c.Pos < m.End {
+				return Range{Line: m.Line, Pos: m.Pos, EndLine: m.Line, EndPos: m.End}, true
+			}
+		}
+	}
+	m, found := em.findMatch(search, c.Line, c.Pos, backward, true)
+	if !found {
+		return Range{}, false
+	}
+	return Range{Line: m.Line, Pos: m.Pos, EndLine: m.Line, EndPos: m.End}, true
+}
+
+// selectMatch starts selecting and selects the next match, for gn and gN
+func (em *Vi) selectMatch(cmd *ViCommand) bool {
+	if _, ok := em.searchObject(em.Editor.Cursors[0], cmd.Command == "gN"); !ok {
+		em.failed = true
+		return true
+	}
+	em.Selection = SelectionFluid
+	em.StartSelection()
+	em.selectTextObject(&ViCommand{Count: cmd.Count, Object: cmd.Command})
+	return true
+}
+
+// NoHighlight stops highlighting the matches of the last search, until the
+// next search
+func (em *Vi) NoHighlight() {
+	em.Editor.Highlight = nil
+}
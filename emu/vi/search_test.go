@@ -0,0 +1,128 @@
+package viemu
+
+import (
+	"testing"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+func TestParseSearch(t *testing.T) {
+	for _, tc := range []struct {
+		text     string
+		backward bool
+		pattern  string
+		offset   string
+	}{
+		{"foo", false, "foo", ""},
+		{"foo/e+1", false, "foo", "e+1"},
+		{`a\/b/-1`, false, "a/b", "-1"},
+		{`a\.b`, false, `a\.b`, ""},
+		{"foo?e", true, "foo", "e"},
+		{"foo/e", true, "foo/e", ""},
+	} {
+		t.Run(tc.text, func(t *testing.T) {
+			s := parseSearch(tc.text, tc.backward)
+			if s.pattern != tc.pattern || s.offset != tc.offset {
+				t.Errorf("Expected %q %q, got %q %q", tc.pattern, tc.offset, s.pattern, s.offset)
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		line, pos int
+		lines     []string
+		keys      string
+		expect    []string
+		cline     int
+		cpos      int
+	}{
+		{"Forward", 0, 0, []string{"one two", "three two"}, "/two<enter>", nil, 0, 4},
+		{"n and N", 0, 0, []string{"one two", "three two"}, "/two<enter>nNn", nil, 1, 6},
+		{"Backward", 1, 0, []string{"one two", "three two"}, "?two<enter>", nil, 0, 4},
+		{"Backward n", 1, 8, []string{"one two", "three two"}, "?two<enter>n", nil, 0, 4},
+		{"Count", 0, 0, []string{"a x x x"}, "2/x<enter>", nil, 0, 4},
+		{"Wraps around", 1, 0, []string{"x", "a"}, "/x<enter>", nil, 0, 0},
+		{"Regular expression", 0, 0, []string{"a1 b22"}, "/[0-9]{2}<enter>", nil, 0, 4},
+		{"Not found", 0, 1, []string{"abc"}, "/x<enter>", nil, 0, 1},
+		{"End offset", 0, 0, []string{"a foo b"}, "/foo/e<enter>", nil, 0, 4},
+		{"End offset plus one", 0, 0, []string{"a foo b"}, "/foo/e+1<enter>", nil, 0, 5},
+		{"Start offset", 0, 0, []string{"a foo b"}, "/foo/s-1<enter>", nil, 0, 1},
+		{"Line offset", 0, 0, []string{"a", "foo", "b"}, "/foo/+1<enter>", nil, 2, 0},
+		{"n after end offset", 0, 8, []string{"foo foo x"}, "?foo?e<enter>n", nil, 0, 2},
+		{"Empty pattern repeats", 0, 0, []string{"x x x"}, "/x<enter>/<enter>", nil, 0, 4},
+		{"Escape cancels", 0, 0, []string{"a x"}, "/x<esc>", nil, 0, 0},
+		{"Star", 0, 0, []string{"foo food foo"}, "*", nil, 0, 9},
+		{"Star then n wraps", 0, 0, []string{"foo food foo"}, "*n", nil, 0, 0},
+		{"Hash", 0, 9, []string{"foo food foo"}, "#", nil, 0, 0},
+		{"Delete to a match", 0, 0, []string{"one two three"}, "d/thr<enter>", []string{"three"}, 0, 0},
+		{"Delete to the end of a match", 0, 0, []string{"one two three"}, "d/two/e<enter>", []string{" three"}, 0, 0},
+		{"Delete lines to a match", 0, 0, []string{"a", "b", "c", "d"}, "d/c<enter>", []string{"c", "d"}, 0, 0},
+		{"Delete with line offset", 0, 0, []string{"a", "b", "c", "d"}, "d/b/+1<enter>", []string{"d"}, 0, 0},
+		{"Change to a match", 0, 0, []string{"one two"}, "c/two<enter>1 <esc>", []string{"1 two"}, 0, 2},
+		{"Delete to the next match", 0, 0, []string{"a x b x"}, "/x<enter>0dn", []string{"x b x"}, 0, 0},
+		{"Repeat", 0, 0, []string{"a,b,c"}, "d/,<enter>.", []string{",c"}, 0, 0},
+		{"gn selects the match", 0, 0, []string{"a foo b"}, "/foo<enter>0gnd", []string{"a  b"}, 0, 2},
+		{"cgn and repeat", 0, 0, []string{"x foo foo"}, "/foo<enter>0cgnbar<esc>.", []string{"x bar bar"}, 0, 8},
+		{"dgN", 0, 8, []string{"foo x foo"}, "/foo<enter>$dgN", []string{"foo x "}, 0, 5},
+		{"Extends a selection", 0, 0, []string{"abc x def"}, "v/x<enter>d", []string{" def"}, 0, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			vi, cursor := SetupViAndCursor(ModeCommand, tc.line, tc.pos, tc.lines...)
+			SendKeys(vi, tc.keys)
+			if tc.expect == nil {
+				tc.expect = tc.lines
+			}
+			novi.AssertBufferMatch(t, vi.Editor.Buffer, tc.expect...)
+			novi.AssertCursor(t, cursor, tc.cline, tc.cpos)
+		})
+	}
+}
+
+func TestSearchOptions(t *testing.T) {
+	t.Run("Ignorecase and smartcase", func(t *testing.T) {
+		vi, cursor := SetupViAndCursor(ModeCommand, 0, 0, "a Foo foo")
+		SendKeys(vi, ":set ic<enter>/foo<enter>")
+		novi.AssertCursor(t, cursor, 0, 2)
+		SendKeys(vi, ":set scs<enter>/Foo<enter>")
+		novi.AssertCursor(t, cursor, 0, 2)
+	})
+	t.Run("Nowrapscan", func(t *testing.T) {
+		vi, cursor := SetupViAndCursor(ModeCommand, 1, 0, "x", "a")
+		SendKeys(vi, ":set nows<enter>/x<enter>")
+		novi.AssertCursor(t, cursor, 1, 0)
+	})
+	t.Run("Highlight", func(t *testing.T) {
+		vi := SetupVi(ModeCommand, "a foo")
+		SendKeys(vi, "/foo<enter>")
+		if vi.Editor.Highlight == nil || vi.Editor.Highlight.Pattern != "foo" {
+			t.Errorf("Expected foo to be highlighted, got %v", vi.Editor.Highlight)
+		}
+		SendKeys(vi, ":noh<enter>")
+		if vi.Editor.Highlight != nil {
+			t.Error("Expected no highlight after :noh")
+		}
+	})
+	t.Run("Incremental search", func(t *testing.T) {
+		vi, cursor := SetupViAndCursor(ModeCommand, 0, 0, "a foo", "fob")
+		SendKeys(vi, "/fo")
+		novi.AssertCursor(t, cursor, 0, 2)
+		SendKeys(vi, "b")
+		novi.AssertCursor(t, cursor, 1, 0)
+		SendKeys(vi, "<esc>")
+		novi.AssertCursor(t, cursor, 0, 0)
+		if vi.Editor.Highlight != nil {
+			t.Error("Expected the highlight to be restored")
+		}
+	})
+	t.Run("History", func(t *testing.T) {
+		vi, cursor := SetupViAndCursor(ModeCommand, 0, 0, "a b c")
+		SendKeys(vi, "/b<enter>/c<enter>0/<up><up><enter>")
+		novi.AssertCursor(t, cursor, 0, 2)
+		// b moved to the end of the history when it was used again
+		SendKeys(vi, "0/<up><down><up><up><enter>")
+		novi.AssertCursor(t, cursor, 0, 4)
+	})
+}
@@ -1,17 +1,28 @@
 package viemu
 
-import "github.com/iivvoo/novi/novi"
+import (
+	"math"
+
+	"github.com/iivvoo/novi/novi"
+)
 
 // StartSelection initializes start/end with the current cursor position
 func (em *Vi) StartSelection() {
 	em.SelectionStart = *em.Editor.Cursors[0]
+	em.blockToEOL = false
 	em.Mode = ModeSelect
 	em.Editor.Selection.Enable()
 	em.UpdateSelection()
 }
 
-// CancelSelection cancels the selection, returns to Command mode
+// CancelSelection cancels the selection, returns to Command mode. The
+// selection is remembered for the '< and '> marks
 func (em *Vi) CancelSelection() {
+	if em.Selection != SelectionNone {
+		s, e := em.GetEmuSelection()
+		em.setMark('<', s.Line, s.Pos)
+		em.setMark('>', e.Line, e.Pos)
+	}
 	em.Selection = SelectionNone
 	em.Mode = ModeCommand
 	em.Editor.Selection.Disable()
@@ -19,40 +30,29 @@ func (em *Vi) CancelSelection() {
 
 // HandleCancelSelect is invoked when Escape is hit during selection
 func (em *Vi) HandleCancelSelect(novi.Event) bool {
+	em.CommandBuffer = ""
 	em.CancelSelection()
 	return true
 }
 
-// HandleSelectRemove handles selection removal keys, xdD
-func (em *Vi) HandleSelectRemove(novi.Event) bool {
-	// Block works differently of course
-	s, e := em.GetEmuSelection()
-	if em.Selection == SelectionBlock {
-		for line := s.Line; line <= e.Line; line++ {
-			ss := novi.NewCursor(em.Editor.Buffer, line, s.Pos)
-			ee := novi.NewCursor(em.Editor.Buffer, line, e.Pos)
-			if max := em.Editor.Buffer.GetLine(line).Len() - 1; e.Pos > max {
-				ee.Pos = max
-			}
-
-			log.Printf("Deleting between (%d,%d) and (%d,%d)", ss.Line, ss.Pos, ee.Line, ee.Pos)
-			em.Editor.Buffer.RemoveBetweenCursors(ss, ee)
-		}
-	} else {
-		em.Editor.Buffer.RemoveBetweenCursors(&s, &e)
-	}
+// HandleSelectToEx handles ':' during selection, the ex command applies to
+// the selected lines
+func (em *Vi) HandleSelectToEx(novi.Event) bool {
+	em.CommandBuffer = ""
 	em.CancelSelection()
-	// move cursor to s
-	c := em.Editor.Cursors[0]
-	c.Line, c.Pos = s.Line, s.Pos
+	em.openInput(":")
+	em.ex.input.Set("'<,'>")
+	em.updateInput()
 	return true
 }
 
+// HandleSelectRemove handles selection removal keys, xdD
+func (em *Vi) HandleSelectRemove(novi.Event) bool {
+	return em.Execute(&ViCommand{Operator: "d"})
+}
+
 // HandleSelectChange handles selection change keys, cC
 func (em *Vi) HandleSelectChange(novi.Event) bool {
-	s, e := em.GetEmuSelection()
-	em.Editor.Buffer.RemoveBetweenCursors(&s, &e)
-	em.CancelSelection()
 	/*
 			  In the case of a block select, we want to replay the
 			  edit on each line. Using cursor keys seems to cancel this behaviour
@@ -61,10 +61,7 @@ func (em *Vi) HandleSelectChange(novi.Event) bool {
 				install a hook/handler to replay that change on each line
 		      - multi cursor. Create a cursor on each removed position, perform insert on each line
 	*/
-	em.Mode = ModeEdit
-	c := em.Editor.Cursors[0]
-	c.Line, c.Pos = s.Line, s.Pos
-	return true
+	return em.Execute(&ViCommand{Operator: "c"})
 }
 
 // GetEmuSelection translates the actual selection to how the emulation interprets them
@@ -87,6 +84,43 @@ func (em *Vi) GetEmuSelection() (novi.Cursor, novi.Cursor) {
 	return s, e
 }
 
+// blockSpan returns the screen columns a block selection covers, from the
+// first up to (not including) the second. A block includes wide characters
+// and tabs entirely, and ends past the end of every line after $
+func (em *Vi) blockSpan() (int, int) {
+	b := em.Editor.Buffer
+	opts := em.Editor.ViewOptions
+	s, e := em.SelectionStart, em.SelectionEnd
+	start, end := opts.Span(b.GetLine(s.Line), s.Pos)
+	s2, e2 := opts.Span(b.GetLine(e.Line), e.Pos)
+	if s2 < start {
+		start = s2
+	}
+	if e2 > end {
+		end = e2
+	}
+	if em.blockToEOL {
+		end = math.MaxInt32
+	}
+	return start, end
+}
+
+// selectionMoved keeps track of $ in a selection. After $ a block extends to
+// the end of every line, and moving up or down keeps the cursor at the end
+// of the line, until the cursor moves sideways
+func (em *Vi) selectionMoved(motion string, moved bool) {
+	switch {
+	case motion == "$":
+		em.blockToEOL = true
+	case moved && em.blockToEOL && em.motions[motion].Type == MotionLinewise:
+		for _, c := range em.Editor.Cursors {
+			c.Line, c.Pos, _ = em.motions["$"].Move(c, MotionArgs{})
+		}
+	case moved:
+		em.blockToEOL = false
+	}
+}
+
 // UpdateSelection updates the end of the selection
 func (em *Vi) UpdateSelection() {
 	if em.Selection != SelectionNone {
@@ -99,6 +133,7 @@ func (em *Vi) UpdateSelection() {
 		em.SelectionEnd = *em.Editor.Cursors[0]
 
 		em.Editor.Selection.SetBlock(em.Selection == SelectionBlock)
+		em.Editor.Selection.SetColumns(em.blockSpan())
 		s, e := em.GetEmuSelection()
 
 		em.Editor.Selection.SetStart(s)
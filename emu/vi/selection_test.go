@@ -65,3 +65,44 @@ func TestBlockSelection(t *testing.T) {
 		)
 	})
 }
+
+func TestBlockColumns(t *testing.T) {
+	t.Run("Test block over a tab", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 1,
+			"abcdefghij",
+			"a\tbc",
+		)
+		// the tab takes columns 1 up to 8
+		SendKeys(vi, "<c-v>jd")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer,
+			"aij",
+			"abc",
+		)
+	})
+	t.Run("Test block over wide characters", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 1,
+			"abcdefgh",
+			"a日本語b",
+		)
+		SendKeys(vi, "<c-v>jld")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer,
+			"afgh",
+			"a語b",
+		)
+	})
+	t.Run("Test block to the end of every line", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 0, "abc", "a")
+		SendKeys(vi, "<c-v>j$d")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "", "")
+	})
+	t.Run("Test end of line kept moving down", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 1, "abc", "a", "abcdef")
+		SendKeys(vi, "<c-v>$jjd")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "a", "a", "a")
+	})
+	t.Run("Test moving left ends the block at the cursor", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 0, "abc", "abcd")
+		SendKeys(vi, "<c-v>$jhd")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "", "d")
+	})
+}
@@ -0,0 +1,418 @@
+package viemu
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+/*
+ * :[range]s/pattern/replacement/[flags] replaces matches of pattern in the
+ * lines in range (the current line by default). The flags are
+ *
+ * g   replace all matches in a line, not just the first
+ * c   confirm each replacement, answering y(es), n(o), a(ll), q(uit) or l(ast)
+ * i   ignore case, I don't ignore case, regardless of 'ignorecase'
+ * &   (first flag only) keep the flags of the last substitution
+ *
+ * The replacement can contain
+ *
+ * &, \0      the entire match
+ * \1 .. \9   a group of the match
+ * \u \l      make the next character upper/lower case
+ * \U \L      make the following characters upper/lower case, up to \E or \e
+ * \n, \r     a line break
+ * ~          the replacement of the last substitution
+ *
+ * :& and :s repeat the last substitution, :&& with its flags, and :~ repeats
+ * it with the last search pattern instead. An empty pattern also uses the
+ * last search pattern. The entire substitution is a single change.
+ */
+
+// subCommand is a substitution, as remembered for repeating it
+type subCommand struct {
+	pattern     string
+	replacement string
+	flags       string
+}
+
+// substitution is a substitution being executed. It keeps track of where to
+// continue, since with the c flag it's executed one match at a time
+type substitution struct {
+	search      *novi.Search
+	replacement string
+	global      bool
+
+	line, end int    // the line being searched and the last line of the range
+	pos       int    // the byte offset in the line to continue at
+	emptyAt   int    // the offset an empty match isn't allowed, -1 if none
+	text      string // the line the current match is on
+	match     []int
+
+	matched  bool
+	count    int // the number of substitutions
+	lines    int // the number of lines with substitutions
+	lastLine int // the last line with a substitution
+}
+
+// isSubstitute returns true if an ex command (without a range) is a substitution
+func isSubstitute(cmd string) bool {
+	name, _ := splitSubstitute(cmd)
+	return name != ""
+}
+
+// splitSubstitute splits a substitution in its name ("s", "&" or "~") and
+// arguments. The name is empty if it's not a substitution
+func splitSubstitute(cmd string) (string, string) {
+	if strings.HasPrefix(cmd, "&") || strings.HasPrefix(cmd, "~") {
+		return cmd[:1], cmd[1:]
+	}
+	const long = "substitute"
+	i := 0
+	for i < len(cmd) && i < len(long) && cmd[i] == long[i] {
+		i++
+	}
+	if i == 0 || i < len(cmd) && !isDelimiter(rune(cmd[i])) {
+		return "", ""
+	}
+	return "s", cmd[i:]
+}
+
+// isDelimiter returns true if r can separate the pattern and replacement
+func isDelimiter(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r) && strings.IndexRune(`\"|`, r) == -1
+}
+
+// splitDelimited returns the text up to an unescaped delim, with \delim
+// unescaped, and the text after it
+func splitDelimited(s string, delim rune) (string, string, bool) {
+	var b strings.Builder
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case runes[i] == '\\' && i+1 < len(runes) && runes[i+1] == delim:
+			b.WriteRune(delim)
+			i++
+		case runes[i] == '\\' && i+1 < len(runes):
+			b.WriteRune('\\')
+			b.WriteRune(runes[i+1])
+			i++
+		case runes[i] == delim:
+			return b.String(), string(runes[i+1:]), true
+		default:
+			b.WriteRune(runes[i])
+		}
+	}
+	return b.String(), "", false
+}
+
+// expandTilde replaces an unescaped ~ in a replacement by the last replacement
+func expandTilde(replacement, last string) string {
+	var b strings.Builder
+	runes := []rune(replacement)
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case runes[i] == '\\' && i+1 < len(runes):
+			b.WriteRune('\\')
+			b.WriteRune(runes[i+1])
+			i++
+		case runes[i] == '~':
+			b.WriteString(last)
+		default:
+			b.WriteRune(runes[i])
+		}
+	}
+	return b.String()
+}
+
+// expandReplacement returns the replacement for a match in text, where match
+// holds the byte offsets of the match and its groups
+func expandReplacement(replacement, text string, match []int) string {
+	var b strings.Builder
+	var once, all func(rune) rune
+	write := func(s string) {
+		for _, r := range s {
+			if once != nil {
+				r, once = once(r), nil
+			} else if all != nil {
+				r = all(r)
+			}
+			b.WriteRune(r)
+		}
+	}
+	group := func(n int) string {
+		if 2*n+1 < len(match) && match[2*n] >= 0 {
+			return text[match[2*n]:match[2*n+1]]
+		}
+		return ""
+	}
+
+	runes := []rune(replacement)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == '&' {
+			write(group(0))
+			continue
+		}
+		if r != '\\' || i+1 == len(runes) {
+			write(string(r))
+			continue
+		}
+		i++
+		switch r = runes[i]; r {
+		case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+			write(group(int(r - '0')))
+		case 'n', 'r':
+			b.WriteRune('\n')
+		case 't':
+			write("\t")
+		case 'u':
+			once = unicode.ToUpper
+		case 'l':
+			once = unicode.ToLower
+		case 'U':
+			all = unicode.ToUpper
+		case 'L':
+			all = unicode.ToLower
+		case 'E', 'e':
+			all = nil
+		default:
+			// e.g. \& or \\
+			write(string(r))
+		}
+	}
+	return b.String()
+}
+
+// next finds the next match, returning false if there are no more
+func (s *substitution) next(b *novi.Buffer) bool {
+	for ; s.line <= s.end; s.line, s.pos, s.emptyAt = s.line+1, 0, -1 {
+		text := b.GetLine(s.line).ToString()
+		for _, m := range s.search.Regexp().FindAllStringSubmatchIndex(text, -1) {
+			if m[0] < s.pos || m[0] == m[1] && m[0] == s.emptyAt {
+				continue
+			}
+			s.text, s.match, s.matched = text, m, true
+			return true
+		}
+	}
+	return false
+}
+
+// advance continues after the current match, which ends at byte offset end
+func (s *substitution) advance(end int) {
+	s.pos, s.emptyAt = end, end
+	if !s.global {
+		s.line, s.pos, s.emptyAt = s.line+1, 0, -1
+	}
+}
+
+// skip skips the current match
+func (s *substitution) skip() {
+	s.advance(s.match[1])
+}
+
+// replace replaces the current match
+func (s *substitution) replace(b *novi.Buffer) {
+	replacement := expandReplacement(s.replacement, s.text, s.match)
+	start := utf8.RuneCountInString(s.text[:s.match[0]])
+	end := start + utf8.RuneCountInString(s.text[s.match[0]:s.match[1]])
+	lines := strings.Split(replacement, "\n")
+	b.Replace(s.line, start, s.line, end, lines)
+
+	s.count++
+	if s.line != s.lastLine {
+		s.lines++
+	}
+	offset := s.match[0] + len(replacement)
+	if n := len(lines) - 1; n > 0 {
+		// the rest of the line moved to a new line
+		s.line += n
+		s.end += n
+		offset = len(lines[n])
+	}
+	s.lastLine = s.line
+	s.advance(offset)
+}
+
+// parseSubstitute returns the substitution to execute for an ex command
+func (em *Vi) parseSubstitute(cmd string) (*subCommand, error) {
+	name, args := splitSubstitute(cmd)
+	last := em.lastSubstitute
+	sub := &subCommand{}
+
+	if name == "s" && args != "" {
+		delim, _ := utf8.DecodeRuneInString(args)
+		rest := args[utf8.RuneLen(delim):]
+		sub.pattern, rest, _ = splitDelimited(rest, delim)
+		sub.replacement, sub.flags, _ = splitDelimited(rest, delim)
+		if last != nil {
+			sub.replacement = expandTilde(sub.replacement, last.replacement)
+		}
+	} else {
+		if last == nil {
+			return nil, fmt.Errorf("E35: No previous regular expression")
+		}
+		sub.pattern, sub.replacement, sub.flags = last.pattern, last.replacement, args
+		if name == "~" {
+			sub.pattern = ""
+		}
+	}
+	if strings.HasPrefix(sub.flags, "&") {
+		sub.flags = sub.flags[1:]
+		if last != nil {
+			sub.flags = last.flags + sub.flags
+		}
+	}
+	if i := strings.IndexFunc(sub.flags, func(r rune) bool { return strings.IndexRune("gciI", r) == -1 }); i != -1 {
+		return nil, fmt.Errorf("E488: Trailing characters: %s", sub.flags[i:])
+	}
+	if sub.pattern == "" {
+		if em.lastSearch == nil {
+			return nil, fmt.Errorf("E35: No previous regular expression")
+		}
+		sub.pattern = em.lastSearch.pattern
+	}
+	return sub, nil
+}
+
+// HandleSubstitute handles a substitution on the lines from start to end
+func (em *Vi) HandleSubstitute(start, end int, cmd string) {
+	sub, err := em.parseSubstitute(cmd)
+	if err != nil {
+		em.c <- &novi.ErrorEvent{Message: err.Error()}
+		return
+	}
+	em.lastSubstitute = sub
+	backward := em.lastSearch != nil && em.lastSearch.backward
+	em.lastSearch = &viSearch{pattern: sub.pattern, backward: backward}
+
+	opts := em.SearchOptions
+	if strings.ContainsRune(sub.flags, 'i') {
+		opts.IgnoreCase, opts.SmartCase = true, false
+	}
+	if strings.ContainsRune(sub.flags, 'I') {
+		opts.IgnoreCase = false
+	}
+	search, err := novi.NewSearch(sub.pattern, opts)
+	if err != nil {
+		em.c <- &novi.ErrorEvent{Message: "E383: Invalid search string: " + sub.pattern}
+		return
+	}
+	if em.HLSearch {
+		em.Editor.Highlight = search
+	}
+
+	s := &substitution{
+		search:      search,
+		replacement: sub.replacement,
+		global:      strings.ContainsRune(sub.flags, 'g'),
+		line:        start,
+		end:         end,
+		emptyAt:     -1,
+		lastLine:    -1,
+	}
+	b := em.Editor.Buffer
+	b.BeginChange(em.Editor.Cursors)
+	if strings.ContainsRune(sub.flags, 'c') && em.global == nil {
+		em.confirm = s
+		if em.nextConfirm() {
+			em.inputEvent(&novi.AskInputEvent{ID: ExInputID, Prompt: "replace with " + sub.replacement + " (y/n/a/q/l)?"})
+		}
+		return
+	}
+	for s.next(b) {
+		s.replace(b)
+	}
+	em.finishSubstitute(s)
+}
+
+// finishSubstitute ends the change made by a substitution and reports it
+func (em *Vi) finishSubstitute(s *substitution) {
+	em.Editor.Buffer.EndChange(em.Editor.Cursors)
+	if !s.matched {
+		if em.global != nil {
+			// not an error for :g, most lines just don't match
+			return
+		}
+		em.c <- &novi.ErrorEvent{Message: "E486: Pattern not found: " + s.search.Pattern}
+		em.failed = true
+		return
+	}
+	if s.count == 0 {
+		return
+	}
+	c := em.Editor.Cursors[0]
+	c.Line, c.Pos = s.lastLine, firstNonBlank(em.Editor.Buffer.GetLine(s.lastLine))
+	if em.global != nil {
+		em.global.subCount += s.count
+		em.global.subLines += s.lines
+		return
+	}
+	em.c <- &novi.ErrorEvent{Message: substitutionMessage(s.count, s.lines)}
+}
+
+// substitutionMessage reports the number of substitutions made
+func substitutionMessage(count, lines int) string {
+	plural := func(n int, what string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, what)
+		}
+		return fmt.Sprintf("%d %ss", n, what)
+	}
+	return plural(count, "substitution") + " on " + plural(lines, "line")
+}
+
+// nextConfirm moves to the next match to confirm. If there are no more, the
+// substitution is finished and it returns false
+func (em *Vi) nextConfirm() bool {
+	s := em.confirm
+	if !s.next(em.Editor.Buffer) {
+		em.confirm = nil
+		if em.ex.active {
+			em.inputEvent(&novi.CloseInputEvent{ID: ExInputID})
+		}
+		em.finishSubstitute(s)
+		return false
+	}
+	c := em.Editor.Cursors[0]
+	c.Line, c.Pos = s.line, utf8.RuneCountInString(s.text[:s.match[0]])
+	return true
+}
+
+// HandleConfirm handles the answer to confirming a replacement
+func (em *Vi) HandleConfirm(event novi.Event) {
+	s := em.confirm
+	b := em.Editor.Buffer
+	answer := rune(0)
+	switch e := event.(type) {
+	case *novi.CharacterEvent:
+		answer = e.Rune
+	case *novi.KeyEvent:
+		if e.Key == novi.KeyEscape {
+			answer = 'q'
+		}
+	}
+	switch answer {
+	case 'y':
+		s.replace(b)
+	case 'n':
+		s.skip()
+	case 'a':
+		s.replace(b)
+		for s.next(b) {
+			s.replace(b)
+		}
+	case 'l':
+		s.replace(b)
+		s.line = s.end + 1
+	case 'q':
+		s.line = s.end + 1
+	default:
+		return
+	}
+	em.nextConfirm()
+}
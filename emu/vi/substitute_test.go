@@ -0,0 +1,104 @@
+package viemu
+
+import (
+	"testing"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+func TestExpandReplacement(t *testing.T) {
+	for _, tc := range []struct {
+		replacement string
+		expect      string
+	}{
+		{"x", "x"},
+		{"[&]", "[foo bar]"},
+		{`\0!`, "foo bar!"},
+		{`\2 \1`, "bar foo"},
+		{`\&`, "&"},
+		{`\u\1`, "Foo"},
+		{`\U\1\E \2`, "FOO bar"},
+		{`\U\l\1`, "fOO"},
+		{`\1\n\2`, "foo\nbar"},
+		{`a\\b`, `a\b`},
+	} {
+		t.Run(tc.replacement, func(t *testing.T) {
+			text := "foo bar"
+			match := []int{0, 7, 0, 3, 4, 7}
+			if res := expandReplacement(tc.replacement, text, match); res != tc.expect {
+				t.Errorf("Expected %q, got %q", tc.expect, res)
+			}
+		})
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		line, pos int
+		lines     []string
+		keys      string
+		expect    []string
+		cline     int
+		cpos      int
+	}{
+		{"First on current line", 1, 0, []string{"a a", "a a"}, ":s/a/b/<enter>", []string{"a a", "b a"}, 1, 0},
+		{"Global", 0, 0, []string{"a a", "a a"}, ":s/a/b/g<enter>", []string{"b b", "a a"}, 0, 0},
+		{"Entire buffer", 0, 0, []string{"a a", "a a"}, ":%s/a/b/g<enter>", []string{"b b", "b b"}, 1, 0},
+		{"Range", 0, 0, []string{"a", "a", "a", "a"}, ":2,3s/a/b<enter>", []string{"a", "b", "b", "a"}, 2, 0},
+		{"Relative range", 1, 0, []string{"a", "a", "a", "a"}, ":.,+1s/a/b<enter>", []string{"a", "b", "b", "a"}, 2, 0},
+		{"Invalid range", 0, 0, []string{"a"}, ":1,5s/a/b<enter>", []string{"a"}, 0, 0},
+		{"Groups", 0, 0, []string{"foo=bar"}, `:s/(\w+)=(\w+)/\2=\u\1/<enter>`, []string{"bar=Foo"}, 0, 0},
+		{"Other delimiter", 0, 0, []string{"a/b"}, ":s#/#-#<enter>", []string{"a-b"}, 0, 0},
+		{"Escaped delimiter", 0, 0, []string{"a/b"}, `:s/\//-/<enter>`, []string{"a-b"}, 0, 0},
+		{"Split lines", 0, 0, []string{"a,b,c", "d,e"}, `:%s/,/\r/g<enter>`, []string{"a", "b", "c", "d", "e"}, 4, 0},
+		{"Replacement grows", 0, 0, []string{"aa"}, ":s/a/aa/g<enter>", []string{"aaaa"}, 0, 0},
+		{"Empty matches", 0, 0, []string{"abc"}, ":s/x*/-/g<enter>", []string{"-a-b-c-"}, 0, 0},
+		{"Anchor", 0, 0, []string{"a", "b"}, ":%s/^/> /<enter>", []string{"> a", "> b"}, 1, 0},
+		{"Ignore case flag", 0, 0, []string{"A a"}, ":s/a/b/gi<enter>", []string{"b b"}, 0, 0},
+		{"Last search pattern", 0, 0, []string{"x a", "a"}, "/a<enter>:%s//b/<enter>", []string{"x b", "b"}, 1, 0},
+		{"Not found", 0, 1, []string{"abc"}, ":s/x/y/<enter>", []string{"abc"}, 0, 1},
+		{"Repeat with :&&", 0, 0, []string{"a a", "a a"}, ":s/a/b/g<enter>j:&&<enter>", []string{"b b", "b b"}, 1, 0},
+		{"Repeat with :& drops flags", 0, 0, []string{"a a", "a a"}, ":s/a/b/g<enter>j:&<enter>", []string{"b b", "b a"}, 1, 0},
+		{"Repeat with :s", 0, 0, []string{"a a", "a a"}, ":s/a/b/<enter>j:s<enter>", []string{"b a", "b a"}, 1, 0},
+		{"Repeat with :~", 0, 0, []string{"a x", "a x"}, ":s/a/b/<enter>j/x<enter>:~<enter>", []string{"b x", "a b"}, 1, 0},
+		{"Tilde", 0, 0, []string{"a", "b"}, ":s/a/x/<enter>j:s/b/~y/<enter>", []string{"x", "xy"}, 1, 0},
+		{"Confirm", 0, 0, []string{"a a a"}, ":s/a/b/gc<enter>yny", []string{"b a b"}, 0, 0},
+		{"Confirm all", 0, 0, []string{"a a", "a"}, ":%s/a/b/gc<enter>na", []string{"a b", "b"}, 1, 0},
+		{"Confirm last", 0, 0, []string{"a a a"}, ":s/a/b/gc<enter>nl", []string{"a b a"}, 0, 0},
+		{"Confirm quit", 0, 0, []string{"a a a"}, ":s/a/b/gc<enter>yq", []string{"b a a"}, 0, 0},
+		{"Confirm escape", 0, 0, []string{"a a a"}, ":s/a/b/gc<enter>n<esc>", []string{"a a a"}, 0, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			vi, cursor := SetupViAndCursor(ModeCommand, tc.line, tc.pos, tc.lines...)
+			SendKeys(vi, tc.keys)
+			novi.AssertBufferMatch(t, vi.Editor.Buffer, tc.expect...)
+			novi.AssertCursor(t, cursor, tc.cline, tc.cpos)
+		})
+	}
+	t.Run("Single undo step", func(t *testing.T) {
+		vi := SetupVi(ModeCommand, "a a", "a a")
+		SendKeys(vi, ":%s/a/b/g<enter>u")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "a a", "a a")
+	})
+	t.Run("Confirm is a single undo step", func(t *testing.T) {
+		vi := SetupVi(ModeCommand, "a a", "a a")
+		SendKeys(vi, ":%s/a/b/gc<enter>yyyyu")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "a a", "a a")
+	})
+	t.Run("Reports the count", func(t *testing.T) {
+		vi := SetupVi(ModeCommand, "a a", "a a", "b")
+		c := make(chan novi.EmuEvent, 100)
+		vi.SetChan(c)
+		SendKeys(vi, ":%s/a/b/g<enter>")
+		var message string
+		for len(c) > 0 {
+			if e, ok := (<-c).(*novi.ErrorEvent); ok {
+				message = e.Message
+			}
+		}
+		if message != "4 substitutions on 2 lines" {
+			t.Errorf("Unexpected message %q", message)
+		}
+	})
+}
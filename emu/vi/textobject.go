@@ -0,0 +1,468 @@
+package viemu
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+/*
+ * Text objects select text around the cursor, instead of moving it. They're
+ * used after an operator ("diw", "ca(") or in select mode ("vip"). Each comes
+ * in two variants:
+ *
+ * i   "inner", just the object, e.g. the word or the text between brackets
+ * a   "a"/"around", including the surrounding whitespace or the brackets
+ *
+ * Words, sentences and paragraphs are handled as a series of segments that
+ * are alternately text and whitespace (or blank lines), so a count simply
+ * selects more segments.
+ */
+
+// TextObjectFunc returns the range of a text object around cursor c
+type TextObjectFunc func(c *novi.Cursor, count int, around bool) (Range, bool)
+
+// initTextObjects registers the text objects, by the key following i or a
+func (em *Vi) initTextObjects() {
+	brackets := func(open, close rune) TextObjectFunc {
+		return func(c *novi.Cursor, count int, around bool) (Range, bool) {
+			return em.bracketObject(c, count, around, open, close)
+		}
+	}
+	quotes := func(quote rune) TextObjectFunc {
+		return func(c *novi.Cursor, count int, around bool) (Range, bool) {
+			return em.quoteObject(c, around, quote)
+		}
+	}
+	em.textObjects = map[string]TextObjectFunc{
+		"w":  em.wordObject(false),
+		"W":  em.wordObject(true),
+		"s":  em.sentenceObject,
+		"p":  em.paragraphObject,
+		"\"": quotes('"'),
+		"'":  quotes('\''),
+		"`":  quotes('`'),
+		"(":  brackets('(', ')'),
+		")":  brackets('(', ')'),
+		"b":  brackets('(', ')'),
+		"[":  brackets('[', ']'),
+		"]":  brackets('[', ']'),
+		"{":  brackets('{', '}'),
+		"}":  brackets('{', '}'),
+		"B":  brackets('{', '}'),
+		"<":  brackets('<', '>'),
+		">":  brackets('<', '>'),
+		"t":  em.tagObject,
+	}
+}
+
+// isTextObject returns true if keys select a text object, e.g. "iw". The
+// next match of the last search (gn, gN) works like a text object as well
+func (em *Vi) isTextObject(keys string) bool {
+	if keys == "gn" || keys == "gN" {
+		return true
+	}
+	return len(keys) > 1 && (keys[0] == 'i' || keys[0] == 'a') && em.textObjects[keys[1:]] != nil
+}
+
+// textObjectKeys returns the keys of all text objects
+func (em *Vi) textObjectKeys() []string {
+	keys := []string{"gn", "gN"}
+	for name := range em.textObjects {
+		keys = append(keys, "i"+name, "a"+name)
+	}
+	return keys
+}
+
+// textObjectRange returns the range of the text object in keys, e.g. "aw"
+func (em *Vi) textObjectRange(c *novi.Cursor, keys string, count int) (Range, bool) {
+	if keys == "gn" || keys == "gN" {
+		return em.searchObject(c, keys == "gN")
+	}
+	return em.textObjects[keys[1:]](c, count, keys[0] == 'a')
+}
+
+// selectTextObject extends the selection with a text object
+func (em *Vi) selectTextObject(cmd *ViCommand) {
+	c := em.Editor.Cursors[0]
+	r, ok := em.textObjectRange(c, cmd.Object, cmd.count())
+	if !ok || r.empty() {
+		em.failed = true
+		return
+	}
+	if r.Linewise {
+		em.Selection = SelectionLines
+		r.EndPos = em.Editor.Buffer.GetLine(r.EndLine).Len()
+	}
+	if em.SelectionStart.Line == c.Line && em.SelectionStart.Pos == c.Pos {
+		// nothing selected yet, select just the object
+		em.SelectionStart.Line, em.SelectionStart.Pos = r.Line, r.Pos
+	}
+	c.Line, c.Pos = r.EndLine, r.EndPos-1
+	if r.EndPos == 0 {
+		c.Line, c.Pos = r.EndLine-1, em.columnOn(r.EndLine-1, em.Editor.Buffer.GetLine(r.EndLine-1).Len())
+	}
+	if c.Pos < 0 {
+		c.Pos = 0
+	}
+	em.UpdateSelection()
+}
+
+// segment is a part of text that's either blank (whitespace, empty lines) or not
+type segment struct {
+	start, end int // end is exclusive
+	blank      bool
+}
+
+// selectSegments selects count segments starting at the one containing pos.
+// Around includes the whitespace after them, or the whitespace before them if
+// there's none after. Starting on whitespace, it includes the text after it
+func selectSegments(segs []segment, pos, count int, around bool) (int, int, bool) {
+	k := -1
+	for i, s := range segs {
+		if pos >= s.start && pos < s.end {
+			k = i
+			break
+		}
+	}
+	if k == -1 {
+		return 0, 0, false
+	}
+	clamp := func(i int) int {
+		if i >= len(segs) {
+			return len(segs) - 1
+		}
+		return i
+	}
+	start := segs[k].start
+	if !around {
+		return start, segs[clamp(k+count-1)].end, true
+	}
+	if segs[k].blank {
+		return start, segs[clamp(k+2*count-1)].end, true
+	}
+	last := clamp(k + 2*(count-1))
+	if last+1 < len(segs) && segs[last+1].blank {
+		last++
+	} else if k > 0 && segs[k-1].blank {
+		start = segs[k-1].start
+	}
+	return start, segs[last].end, true
+}
+
+// runeSegments splits runes into segments of the same class
+func runeSegments(runes []rune, class func(rune) RuneType) []segment {
+	var segs []segment
+	for i, r := range runes {
+		t := class(r)
+		if i > 0 && class(runes[i-1]) == t {
+			segs[len(segs)-1].end = i + 1
+			continue
+		}
+		segs = append(segs, segment{start: i, end: i + 1, blank: t == TypeSpace})
+	}
+	return segs
+}
+
+// wordObject creates the iw/aw (or iW/aW for bigword) object. Words don't
+// extend past the end of the line
+func (em *Vi) wordObject(bigword bool) TextObjectFunc {
+	class := GetRuneType
+	if bigword {
+		class = func(r rune) RuneType {
+			if unicode.IsSpace(r) {
+				return TypeSpace
+			}
+			return TypeAlNum
+		}
+	}
+	return func(c *novi.Cursor, count int, around bool) (Range, bool) {
+		segs := runeSegments(em.Editor.Buffer.GetLine(c.Line).AllRunes(), class)
+		start, end, ok := selectSegments(segs, c.Pos, count, around)
+		return Range{Line: c.Line, Pos: start, EndLine: c.Line, EndPos: end}, ok
+	}
+}
+
+// paragraphLines returns the lines of the paragraph (or series of blank
+// lines) that line is part of
+func (em *Vi) paragraphLines(line int) (int, int) {
+	b := em.Editor.Buffer
+	blank := func(l int) bool { return strings.TrimSpace(b.GetLine(l).ToString()) == "" }
+	start, end := line, line
+	for start > 0 && blank(start-1) == blank(line) {
+		start--
+	}
+	for end < b.Length()-1 && blank(end+1) == blank(line) {
+		end++
+	}
+	return start, end
+}
+
+// paragraphObject implements ip/ap, which are linewise
+func (em *Vi) paragraphObject(c *novi.Cursor, count int, around bool) (Range, bool) {
+	var segs []segment
+	for line := 0; line < em.Editor.Buffer.Length(); {
+		start, end := em.paragraphLines(line)
+		blank := strings.TrimSpace(em.Editor.Buffer.GetLine(line).ToString()) == ""
+		segs = append(segs, segment{start: start, end: end + 1, blank: blank})
+		line = end + 1
+	}
+	start, end, ok := selectSegments(segs, c.Line, count, around)
+	return Range{Line: start, EndLine: end - 1, Linewise: true}, ok
+}
+
+// sentenceObject implements is/as. A sentence ends at a '.', '!' or '?',
+// optionally followed by closing quotes or brackets, and then whitespace.
+// Sentences don't extend past their paragraph
+func (em *Vi) sentenceObject(c *novi.Cursor, count int, around bool) (Range, bool) {
+	if em.Editor.Buffer.GetLine(c.Line).Len() == 0 {
+		return Range{}, false
+	}
+	first, last := em.paragraphLines(c.Line)
+	text := newFlatText(em.Editor.Buffer, first, last)
+	runes := text.runes
+
+	var segs []segment
+	i := 0
+	for i < len(runes) {
+		start := i
+		if unicode.IsSpace(runes[i]) {
+			for i < len(runes) && unicode.IsSpace(runes[i]) {
+				i++
+			}
+			segs = append(segs, segment{start: start, end: i, blank: true})
+			continue
+		}
+		for i < len(runes) {
+			if strings.ContainsRune(".!?", runes[i]) {
+				end := i + 1
+				for end < len(runes) && strings.ContainsRune(")]\"'", runes[end]) {
+					end++
+				}
+				if end == len(runes) || unicode.IsSpace(runes[end]) {
+					i = end
+					break
+				}
+			}
+			i++
+		}
+		segs = append(segs, segment{start: start, end: i})
+	}
+
+	start, end, ok := selectSegments(segs, text.offset(c.Line, c.Pos), count, around)
+	return text.rangeOf(start, end), ok
+}
+
+// quoteObject implements i" a" and the other quotes. Quotes are paired from the
+// start of the line, quotes escaped by a backslash are skipped
+func (em *Vi) quoteObject(c *novi.Cursor, around bool, quote rune) (Range, bool) {
+	runes := em.Editor.Buffer.GetLine(c.Line).AllRunes()
+	var quotes []int
+	for i, r := range runes {
+		if r == quote && (i == 0 || runes[i-1] != '\\') {
+			quotes = append(quotes, i)
+		}
+	}
+	open, close := -1, -1
+	for i := 0; i+1 < len(quotes); i += 2 {
+		if c.Pos <= quotes[i+1] {
+			open, close = quotes[i], quotes[i+1]
+			break
+		}
+	}
+	if open == -1 {
+		return Range{}, false
+	}
+	r := Range{Line: c.Line, Pos: open + 1, EndLine: c.Line, EndPos: close}
+	if around {
+		r.Pos, r.EndPos = open, close+1
+		segs := runeSegments(runes, GetRuneType)
+		for _, s := range segs {
+			if s.blank && s.start == r.EndPos {
+				r.EndPos = s.end
+				return r, true
+			}
+		}
+		for _, s := range segs {
+			if s.blank && s.end == r.Pos {
+				r.Pos = s.start
+			}
+		}
+	}
+	return r, true
+}
+
+// bracketObject implements i( a( and the other brackets. The count selects
+// brackets further out. If the brackets are on lines of their own, the inner
+// object consists of the lines between them
+func (em *Vi) bracketObject(c *novi.Cursor, count int, around bool, open, close rune) (Range, bool) {
+	text := newFlatText(em.Editor.Buffer, 0, em.Editor.Buffer.Length()-1)
+	runes := text.runes
+	cur := text.offset(c.Line, c.Pos)
+	if cur >= len(runes) {
+		cur = len(runes) - 1
+	}
+
+	start, depth := -1, 0
+	for i := cur; i >= 0 && start == -1; i-- {
+		switch {
+		case runes[i] == close && i != cur:
+			depth++
+		case runes[i] == open && depth > 0:
+			depth--
+		case runes[i] == open:
+			if count--; count == 0 {
+				start = i
+			}
+		}
+	}
+	if start == -1 {
+		return Range{}, false
+	}
+	end := -1
+	depth = 0
+	for i := start + 1; i < len(runes) && end == -1; i++ {
+		switch {
+		case runes[i] == open:
+			depth++
+		case runes[i] == close && depth > 0:
+			depth--
+		case runes[i] == close:
+			end = i
+		}
+	}
+	if end == -1 {
+		return Range{}, false
+	}
+	if around {
+		return text.rangeOf(start, end+1), true
+	}
+
+	r := text.rangeOf(start+1, end)
+	closeLine, closePos := text.position(end)
+	if runes[start+1] == '\n' && closePos <= firstNonBlank(em.Editor.Buffer.GetLine(closeLine)) {
+		if r.Line+1 > closeLine-1 {
+			return Range{Line: r.Line, Pos: r.Pos, EndLine: r.Line, EndPos: r.Pos}, true
+		}
+		return Range{Line: r.Line + 1, EndLine: closeLine - 1, Linewise: true}, true
+	}
+	return r, true
+}
+
+// tag is an xml/html tag found in the text
+type tag struct {
+	name       string
+	start, end int // end is exclusive
+	closing    bool
+}
+
+// findTags returns all tags in runes, self-closing tags are skipped
+func findTags(runes []rune) []tag {
+	var tags []tag
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '<' {
+			continue
+		}
+		t := tag{start: i}
+		j := i + 1
+		if j < len(runes) && runes[j] == '/' {
+			t.closing = true
+			j++
+		}
+		nameStart := j
+		for j < len(runes) && !unicode.IsSpace(runes[j]) && runes[j] != '>' && runes[j] != '/' && runes[j] != '<' {
+			j++
+		}
+		t.name = string(runes[nameStart:j])
+		for j < len(runes) && runes[j] != '>' && runes[j] != '<' {
+			j++
+		}
+		if t.name == "" || j == len(runes) || runes[j] != '>' || runes[j-1] == '/' {
+			continue
+		}
+		t.end = j + 1
+		tags = append(tags, t)
+		i = j
+	}
+	return tags
+}
+
+// tagObject implements it/at, the contents of an xml/html tag or the tag itself
+func (em *Vi) tagObject(c *novi.Cursor, count int, around bool) (Range, bool) {
+	text := newFlatText(em.Editor.Buffer, 0, em.Editor.Buffer.Length()-1)
+	cur := text.offset(c.Line, c.Pos)
+
+	// match opening and closing tags, innermost pairs are found first
+	var pairs, enclosing [][2]tag
+	var open []tag
+	for _, t := range findTags(text.runes) {
+		if !t.closing {
+			open = append(open, t)
+			continue
+		}
+		for i := len(open) - 1; i >= 0; i-- {
+			if open[i].name == t.name {
+				pairs = append(pairs, [2]tag{open[i], t})
+				open = open[:i]
+				break
+			}
+		}
+	}
+	for _, pair := range pairs {
+		if pair[0].start <= cur && cur < pair[1].end {
+			enclosing = append(enclosing, pair)
+		}
+	}
+	if count > len(enclosing) {
+		return Range{}, false
+	}
+	// enclosing pairs are ordered from the innermost
+	pair := enclosing[count-1]
+	if around {
+		return text.rangeOf(pair[0].start, pair[1].end), true
+	}
+	return text.rangeOf(pair[0].end, pair[1].start), true
+}
+
+// flatText is a series of lines as a single slice of runes, separated by
+// newlines, for text objects that span lines
+type flatText struct {
+	runes  []rune
+	first  int   // the first line
+	starts []int // the offset of each line
+}
+
+// newFlatText creates the flat text of the lines first up to and including last
+func newFlatText(b *novi.Buffer, first, last int) *flatText {
+	f := &flatText{first: first}
+	for line := first; line <= last; line++ {
+		if line > first {
+			f.runes = append(f.runes, '\n')
+		}
+		f.starts = append(f.starts, len(f.runes))
+		f.runes = append(f.runes, b.GetLine(line).AllRunes()...)
+	}
+	return f
+}
+
+// offset returns the offset of a position
+func (f *flatText) offset(line, pos int) int {
+	return f.starts[line-f.first] + pos
+}
+
+// position returns the line and position of an offset
+func (f *flatText) position(offset int) (int, int) {
+	line := 0
+	for line+1 < len(f.starts) && f.starts[line+1] <= offset {
+		line++
+	}
+	return f.first + line, offset - f.starts[line]
+}
+
+// rangeOf returns the range between two offsets
+func (f *flatText) rangeOf(start, end int) Range {
+	line, pos := f.position(start)
+	endLine, endPos := f.position(end)
+	return Range{Line: line, Pos: pos, EndLine: endLine, EndPos: endPos}
+}
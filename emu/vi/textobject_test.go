@@ -0,0 +1,78 @@
+package viemu
+
+import (
+	"testing"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+func TestTextObjects(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		line, pos int
+		lines     []string
+		keys      string
+		expect    []string
+	}{
+		{"diw", 0, 5, []string{"one two three"}, "diw", []string{"one  three"}},
+		{"daw includes trailing space", 0, 5, []string{"one two three"}, "daw", []string{"one three"}},
+		{"daw at the end includes leading space", 0, 9, []string{"one two three"}, "daw", []string{"one two"}},
+		{"daw on whitespace", 0, 3, []string{"one two three"}, "daw", []string{"one three"}},
+		{"d2aw", 0, 0, []string{"one two three"}, "d2aw", []string{"three"}},
+		{"diW", 0, 5, []string{"a foo.bar b"}, "diW", []string{"a  b"}},
+		{"ciw", 0, 0, []string{"foo.bar"}, "ciwx<esc>", []string{"x.bar"}},
+		{"di\"", 0, 1, []string{`x = "a \" b" + "c"`}, `di"`, []string{`x = "" + "c"`}},
+		{"da\" before the quotes", 0, 0, []string{`x = "a" + "c"`}, `da"`, []string{`x = + "c"`}},
+		{"ci'", 0, 12, []string{`say 'hello' 'world'`}, "ci'x<esc>", []string{`say 'hello' 'x'`}},
+		{"di(", 0, 3, []string{"f(a, (b), c)"}, "di(", []string{"f()"}},
+		{"di( around a nested pair", 0, 3, []string{"f(a, (b), c)"}, "dib", []string{"f()"}},
+		{"d2i(", 0, 6, []string{"f(a, (b), c)"}, "d2i(", []string{"f()"}},
+		{"di( inner", 0, 6, []string{"f(a, (bc), c)"}, "di)", []string{"f(a, (), c)"}},
+		{"da[", 0, 2, []string{"x[1]y"}, "da[", []string{"xy"}},
+		{"di{ multi-line", 1, 1, []string{"if {", "\ta", "\tb", "}"}, "di{", []string{"if {", "}"}},
+		{"da{ multi-line", 1, 1, []string{"x {", "\ta", "} y"}, "da{", []string{"x  y"}},
+		{"di< on a bracket", 0, 1, []string{"<abc>"}, "di<", []string{"<>"}},
+		{"dit", 0, 8, []string{"<a><b>text</b></a>"}, "dit", []string{"<a><b></b></a>"}},
+		{"dat", 0, 8, []string{"<a><b>text</b></a>"}, "dat", []string{"<a></a>"}},
+		{"d2it", 0, 8, []string{"<a><b>text</b></a>"}, "d2it", []string{"<a></a>"}},
+		{"dit multi-line", 1, 0, []string{"<div class=\"x\">", "text", "<br/>", "</div>"}, "dit", []string{"<div class=\"x\"></div>"}},
+		{"dip", 1, 0, []string{"a", "b", "", "c"}, "dip", []string{"", "c"}},
+		{"dap", 0, 0, []string{"a", "b", "", "c"}, "dap", []string{"c"}},
+		{"dap at the end", 3, 0, []string{"a", "", "b", "c"}, "dap", []string{"a"}},
+		{"dis", 0, 12, []string{"One two. Three four? Five."}, "dis", []string{"One two.  Five."}},
+		{"das", 0, 12, []string{"One two. Three four? Five."}, "das", []string{"One two. Five."}},
+		{"das multi-line", 1, 0, []string{"One two. Three", "four. Five."}, "das", []string{"One two. Five."}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			vi, _ := SetupViAndCursor(ModeCommand, tc.line, tc.pos, tc.lines...)
+			SendKeys(vi, tc.keys)
+			novi.AssertBufferMatch(t, vi.Editor.Buffer, tc.expect...)
+		})
+	}
+}
+
+func TestTextObjectSelection(t *testing.T) {
+	t.Run("viw selects a word", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 5, "one two three")
+		SendKeys(vi, "viw")
+		s, e := vi.GetEmuSelection()
+		novi.AssertCursor(t, &s, 0, 4)
+		novi.AssertCursor(t, &e, 0, 6)
+		SendKeys(vi, "d")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "one  three")
+	})
+	t.Run("vip selects lines", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 1, 0, "a", "b", "", "c")
+		SendKeys(vi, "vip")
+		if vi.Selection != SelectionLines {
+			t.Errorf("Expected a linewise selection, got %d", vi.Selection)
+		}
+		SendKeys(vi, "y")
+		AssertRegister(t, vi.GetRegister('"'), RegisterLinewise, "a", "b")
+	})
+	t.Run("Repeat ciw", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 0, "one two")
+		SendKeys(vi, "ciwx<esc>w.")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "x x")
+	})
+}
@@ -2,7 +2,6 @@ package viemu
 
 import (
 	"fmt"
-	"strings"
 
 	"github.com/iivvoo/novi/logger"
 	"github.com/iivvoo/novi/novi"
@@ -17,8 +16,8 @@ import (
  * Cg Dg - change/delete till eof
 
  * regular <enter> in insert mode OK
- * HML - high / middle / low (screen, niet file)
- * vi scrolls few lines before top/bottom, not at
+ * HML - high / middle / low (screen, niet file) OK
+ * vi scrolls few lines before top/bottom, not at OK (scrolloff)
  * <num?>gg (top) G (end) of file OK
  * w (jump word), with counter. Keep support for "c<n>w" in mind!
  *  w = non-space? W=true word?
@@ -33,7 +32,7 @@ import (
  * vim itself provides ctrl-v which is a bit like a multi-cursor, but not all command work on it
  *  (e.g. o or O have no effect. 'i' does have effecti, 'a' doesn't. Perhaps vim limitation?)
  *
- * '.' replays last command - we need a way to "store" this (is storing the keypresses sufficient?)
+ * '.' replays last command OK (see repeat.go)
  *
  */
 
@@ -100,6 +99,54 @@ type Vi struct {
 
 	Selection                    SelectionType
 	SelectionStart, SelectionEnd novi.Cursor
+	blockToEOL                   bool // a block selection extends to the end of every line ($)
+
+	ShiftWidth int  // the width of an indentation level, for < > and =
+	ExpandTab  bool // indent using spaces only
+
+	SearchOptions novi.SearchOptions
+	HLSearch      bool // highlight the matches of the last search
+	IncSearch     bool // show matches while typing a search
+
+	registers     *Registers
+	register      rune // the register selected for the next command
+	awaitRegister bool // the next key selects a register
+	insertText    string
+	lastInsert    string
+
+	motions     map[string]*Motion
+	operators   map[string]OperatorFunc
+	textObjects map[string]TextObjectFunc
+	commands    map[string]func(cmd *ViCommand) bool
+
+	change     *viChange // the change being recorded, during an insert session
+	lastChange *viChange
+
+	lastFind     string // the last f, F, t or T, for ; and ,
+	lastFindChar rune
+
+	recording rune // the register a macro is being recorded to
+	macro     []novi.Event
+	lastMacro rune
+	replaying int  // events are replayed by '.' or a macro
+	failed    bool // a command failed, which stops a macro
+
+	lastSearch      *viSearch
+	searchCmd       *ViCommand // the command waiting for a search pattern
+	searchStart     novi.Cursor
+	searchHighlight *novi.Search // the highlight before the search started
+
+	lastSubstitute *subCommand
+	confirm        *substitution // the substitution waiting for confirmation
+	global         *globalMarks  // the lines :g is running on
+	lastShell      string        // the last external command, for !
+
+	marks     map[*novi.Buffer]*localMarks // the marks local to a buffer
+	fileMarks map[rune]*mark               // the A-Z marks
+	jumps     []*mark
+	jumpIndex int // the position in jumps, len(jumps) when not navigating
+
+	scrollLines int // the number of lines Ctrl-D and Ctrl-U scroll, 0 for half a screen
 
 	ex       *Ex
 	dispatch []Dispatch
@@ -131,16 +178,30 @@ type Vi struct {
 // NewVi creates/setups up a new Vi emulation instance
 func NewVi(e *novi.Editor) *Vi {
 	em := &Vi{
-		Editor:    e,
-		Mode:      ModeCommand,
-		ex:        NewEx(),
-		Selection: SelectionNone,
+		Editor:     e,
+		Mode:       ModeCommand,
+		ex:         NewEx(),
+		Selection:  SelectionNone,
+		registers:  NewRegisters(),
+		marks:      make(map[*novi.Buffer]*localMarks),
+		fileMarks:  make(map[rune]*mark),
+		ShiftWidth: 8,
+
+		SearchOptions: novi.DefaultSearchOptions,
+		HLSearch:      true,
+		IncSearch:     true,
 	}
+	e.OnClose(em.documentClosed)
+	em.initMotions()
+	em.initOperators()
+	em.initTextObjects()
+	em.initCommands()
 	dispatch := []Dispatch{
 		Dispatch{Mode: ModeCommand, Event: &novi.CharacterEvent{Rune: ':'}, Handler: em.HandleToExCommand},
 		Dispatch{Mode: ModeEdit, Event: &novi.KeyEvent{Key: novi.KeyEscape}, Handler: em.HandleToModeCommand},
 		Dispatch{Mode: ModeCommand, Event: &novi.KeyEvent{Key: novi.KeyEscape}, Handler: em.HandleCommandClear},
 		Dispatch{Mode: ModeSelect, Event: &novi.KeyEvent{Key: novi.KeyEscape}, Handler: em.HandleCancelSelect},
+		Dispatch{Mode: ModeSelect, Event: &novi.CharacterEvent{Rune: ':'}, Handler: em.HandleSelectToEx},
 		Dispatch{Mode: ModeCommand, Event: &novi.KeyEvent{Key: novi.KeyEnter}, Handler: em.HandleCommandEnter},
 		Dispatch{Mode: ModeEdit, Event: &novi.KeyEvent{Key: novi.KeyEnter}, Handler: em.HandleEditEnter},
 		Dispatch{Mode: ModeCommand, Events: []novi.Event{
@@ -152,6 +213,17 @@ func NewVi(e *novi.Editor) *Vi {
 			&novi.CharacterEvent{Rune: 'A'},
 		}, Handler: em.HandleInsertionKeys},
 
+		Dispatch{Mode: ModeCommand, Event: &novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'r'}, Handler: em.HandleRedo},
+		Dispatch{Mode: ModeCommand, Events: scrollKeys, Handler: em.HandleScroll},
+		Dispatch{Mode: ModeSelect, Events: scrollKeys, Handler: em.HandleScroll},
+		Dispatch{Mode: ModeCommand, Event: &novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'o'}, Handler: em.HandleJumpBack},
+		Dispatch{Mode: ModeCommand, Events: []novi.Event{
+			&novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'i'},
+			&novi.KeyEvent{Key: novi.KeyTab},
+		}, Handler: em.HandleJumpForward},
+		Dispatch{Mode: ModeEdit, Event: &novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'r'}, Handler: em.HandleInsertRegister},
+		Dispatch{Mode: ModeCommand, Event: &novi.CharacterEvent{Rune: '"'}, Handler: em.HandleSelectRegister},
+		Dispatch{Mode: ModeSelect, Event: &novi.CharacterEvent{Rune: '"'}, Handler: em.HandleSelectRegister},
 		Dispatch{Mode: ModeCommand, Event: &novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'v'}, Handler: em.HandleSelectionBlock},
 		Dispatch{Mode: ModeCommand, Event: &novi.CharacterEvent{Rune: 'v'}, Handler: em.HandleSelectionFluid},
 		Dispatch{Mode: ModeCommand, Event: &novi.CharacterEvent{Rune: 'V'}, Handler: em.HandleSelectionLines},
@@ -183,8 +255,10 @@ func NewVi(e *novi.Editor) *Vi {
 			&novi.CharacterEvent{Rune: 'c'},
 			&novi.CharacterEvent{Rune: 'C'},
 		}, Handler: em.HandleSelectChange},
+		Dispatch{Mode: ModeSelect, Event: &novi.CharacterEvent{Rune: 'y'}, Handler: em.HandleSelectYank},
 		// Sort of a generic fallthrough handler - handles commands in command mode
 		Dispatch{Mode: ModeCommand, Event: &novi.CharacterEvent{}, Handler: em.HandleCommandBuffer},
+		Dispatch{Mode: ModeSelect, Event: &novi.CharacterEvent{}, Handler: em.HandleCommandBuffer},
 		Dispatch{Mode: ModeEdit, Event: &novi.CharacterEvent{}, Handler: em.HandleAnyRune},
 	}
 	em.dispatch = dispatch
@@ -196,10 +270,43 @@ func (em *Vi) SetChan(c chan novi.EmuEvent) {
 	em.c = c
 }
 
+// collectEvents runs fn, which may send more events than the core's channel
+// holds (e.g. a command executed for every line). The core only reads them
+// once fn is done, so they're collected and only the last message and the
+// last other event are passed on
+func (em *Vi) collectEvents(fn func()) {
+	out := em.c
+	events := make(chan novi.EmuEvent)
+	done := make(chan struct{})
+	var message, last novi.EmuEvent
+	go func() {
+		defer close(done)
+		for ev := range events {
+			if _, ok := ev.(*novi.ErrorEvent); ok {
+				message = ev
+			} else {
+				last = ev
+			}
+		}
+	}()
+	em.c = events
+	defer func() {
+		em.c = out
+		close(events)
+		<-done
+		if last != nil {
+			out <- last
+		}
+		if message != nil {
+			out <- message
+		}
+	}()
+	fn()
+}
+
 // HandleToExCommand handles the ':' ex command input
 func (em *Vi) HandleToExCommand(ev novi.Event) bool {
-	em.ex.Clear()
-	em.c <- &novi.AskInputEvent{ID: ExInputID, Prompt: ":"}
+	em.openInput(":")
 	return true
 }
 
@@ -216,14 +323,12 @@ func (em *Vi) HandleCommandEnter(ev novi.Event) bool {
 func (em *Vi) HandleEditEnter(ev novi.Event) bool {
 	// XXX identical to "basic" emulation
 	for _, c := range em.Editor.Cursors {
+		// cursors after c are moved down by the buffer
 		em.Editor.Buffer.SplitLine(c)
 		em.Move(c, novi.CursorDown)
 		em.Move(c, novi.CursorBegin)
-		// update all cursors after
-		for _, ca := range em.Editor.Cursors.After(c) {
-			ca.Line++
-		}
 	}
+	em.insertText += "\n"
 	return true
 }
 
@@ -242,23 +347,17 @@ func (em *Vi) HandleBackspace(ev novi.Event) bool {
 		}
 	} else {
 		for _, c := range em.Editor.Cursors {
+			// identical to basic emulation, the buffer takes care of moving c
+			// and all other cursors
 			if c.Pos > 0 {
 				em.Editor.Buffer.RemoveRuneBeforeCursor(c)
-				em.Move(c, novi.CursorLeft)
-			} else {
-				// identical to basic emulation XXX
-				l := c.Line
-				em.Move(c, novi.CursorUp)
-				em.Move(c, novi.CursorEnd)
-				em.Editor.Buffer.JoinLineWithPrevious(l)
-				// except here, since "End" in vi moves to the last character, not past it, for which we need to compensate
-				em.Move(c, novi.CursorRight)
-
-				for _, cc := range em.Editor.Cursors.After(c) {
-					em.Move(cc, novi.CursorUp)
-				}
+			} else if c.Line > 0 {
+				em.Editor.Buffer.JoinLineWithPrevious(c.Line)
 			}
 		}
+		if r := []rune(em.insertText); len(r) > 0 {
+			em.insertText = string(r[:len(r)-1])
+		}
 	}
 	return true
 }
@@ -266,51 +365,57 @@ func (em *Vi) HandleBackspace(ev novi.Event) bool {
 // HandleCommandClear clears the current command state (if any) and clears the selection
 func (em *Vi) HandleCommandClear(ev novi.Event) bool {
 	em.CommandBuffer = ""
+	em.register = 0
 	em.CancelSelection()
 	return true
 }
 
-// RemoveCharacters removes a number of characters before or after the cursors
-func (em *Vi) RemoveCharacters(howmany int, before bool) {
-	for _, c := range em.Editor.Cursors {
-		em.Editor.Buffer.RemoveCharacters(c, before, howmany)
-		if before {
-			em.MoveMany(c, novi.CursorLeft, howmany)
-		}
+// HandleEvent is the main entry point
+func (em *Vi) HandleEvent(id novi.InputID, event novi.Event) bool {
+	em.bufferMarks() // keeps track of the changes for the . [ and ] marks
+	if em.recording != 0 && em.replaying == 0 {
+		em.macro = append(em.macro, event)
 	}
-}
-
-// RemoveLines removes full lines
-func (em *Vi) RemoveLines(howmany int) {
-	// How would this behave on multiple cursors?
-	first := em.Editor.Cursors[0]
-	for i := 0; i < howmany; i++ {
-		if !em.Editor.Buffer.RemoveLine(first.Line) {
-			// We ran out of lines, no need to continue, but do move up
-			em.Move(first, novi.CursorUp)
-			break
-		}
+	if id == ExInputID {
+		return em.HandleExInput(event)
+	}
+	if em.Mode == ModeEdit && em.change != nil {
+		// the insert session is part of the change that started it
+		em.change.insert = append(em.change.insert, event)
+	}
+	if em.awaitRegister {
+		em.HandleRegisterName(event)
+		return true
 	}
-	first.Validate()
-}
 
-// JumpStartEndLine handles jumping to the start/end of line
-func (em *Vi) JumpStartEndLine(howmany int, jumpstart bool) {
-	for _, c := range em.Editor.Cursors {
-		if jumpstart {
-			// howmany has no meaning
-			c.Pos = 0
-		} else {
-			em.MoveMany(c, novi.CursorDown, howmany-1)
-			em.Move(c, novi.CursorEnd)
-		}
+	// Everything that happens from command mode up to returning to command
+	// mode is a single undoable change, including an entire insert session
+	wasEdit := em.Mode == ModeEdit
+	if !wasEdit {
+		em.Editor.Buffer.BeginChange(em.Editor.Cursors)
 	}
-}
+	defer func() {
+		if em.Mode != ModeEdit {
+			em.Editor.Buffer.EndChange(em.Editor.Cursors)
+		}
+	}()
+
+	// keep track of the text inserted, for the '.' register and command
+	defer func() {
+		if !wasEdit && em.Mode == ModeEdit {
+			em.insertText = ""
+		} else if wasEdit && em.Mode != ModeEdit {
+			em.lastInsert = em.insertText
+			if em.change != nil {
+				em.lastChange, em.change = em.change, nil
+			}
+		}
+	}()
 
-// HandleEvent is the main entry point
-func (em *Vi) HandleEvent(id novi.InputID, event novi.Event) bool {
-	if id == ExInputID {
-		return em.HandleExInput(event)
+	// a key completing a pending command, e.g. the motion after an operator
+	if _, ok := event.(*novi.CharacterEvent); ok && em.Mode != ModeEdit && em.pending() {
+		em.HandleCommandBuffer(event)
+		return em.CheckExecuteCommandBuffer()
 	}
 
 	// Must be MainInputID
@@ -325,9 +430,11 @@ func (em *Vi) HandleEvent(id novi.InputID, event novi.Event) bool {
 
 // HandleInsertionKeys handles the different switches to insert mode
 func (em *Vi) HandleInsertionKeys(ev novi.Event) bool {
+	em.CommandBuffer = ""
 	em.Mode = ModeEdit
 
 	r := ev.(*novi.CharacterEvent).Rune
+	em.recordChange(0, 0, keyEvents(string(r)), false)
 	first := em.Editor.Cursors[0]
 
 	switch r {
@@ -341,9 +448,10 @@ func (em *Vi) HandleInsertionKeys(ev novi.Event) bool {
 		em.Move(first, novi.CursorDown)
 	case 'O': // add line above cursor
 		// XXX TODO preserve indent (depend on indent mode?)
+		line := first.Line
 		em.Editor.Buffer.InsertLine(first, "", true)
-		// The cursor will already be at the inserted line, but may need to move to the start
-		em.Move(first, novi.CursorBegin)
+		// The cursor moved along with its line, move it to the inserted line
+		first.Line, first.Pos = line, 0
 	case 'a': // after cursor
 		em.Move(first, novi.CursorRight)
 	case 'A': // at end
@@ -356,9 +464,11 @@ func (em *Vi) HandleInsertionKeys(ev novi.Event) bool {
 // HandleToModeCommand simply switches (back) to command mode
 func (em *Vi) HandleToModeCommand(novi.Event) bool {
 	em.Mode = ModeCommand
+	c := em.Editor.Cursors[0]
+	em.setMark('^', c.Line, c.Pos)
 	// Make sure no cursors are past the end
 	for _, c := range em.Editor.Cursors {
-		if l := em.Editor.Buffer.Lines[c.Line].Len() - 1; l >= 0 && c.Pos > l {
+		if l := em.Editor.Buffer.GetLine(c.Line).Len() - 1; l >= 0 && c.Pos > l {
 			c.Pos = l
 		}
 	}
@@ -373,131 +483,89 @@ func (em *Vi) HandleAnyRune(ev novi.Event) bool {
 		// Move(CursorRight) won't do since it will restrict to the last character
 		c.Pos++
 	}
+	em.insertText += string(r)
 	return true
 }
 
-// ReplaceDeleteWords handles the cw and dw commands
-func (em *Vi) ReplaceDeleteWords(howmany int, change bool) {
-	// difference cw/dw: cursor postion and mode after operation
-	first := em.Editor.Cursors[0]
-
-	if change {
-		l, p := -1, -1
-		end := first
-		for i := 0; i < howmany; i++ {
-			l, p = JumpForwardEnd(em.Editor.Buffer, end)
-			end = em.Editor.Buffer.NewCursor(l, p)
-		}
-		em.Editor.Buffer.RemoveBetweenCursors(first, end)
-		em.Mode = ModeEdit
-	} else {
-		l, p := -1, -1
-		end := first
-		for i := 0; i < howmany; i++ {
-			l, p = JumpForward(em.Editor.Buffer, end)
-			end = em.Editor.Buffer.NewCursor(l, p)
-		}
-		// If we'd remove now we'd also remove the first character
-		// of the word we ended up at
-		if end.Pos > 0 {
-			end.Pos--
-		} else if end.Line > 0 {
-			end.Line--
-			end.Pos = em.Editor.Buffer.Lines[end.Line].Len() - 1
-		}
-		em.Editor.Buffer.RemoveBetweenCursors(first, end)
-	}
-}
-
 // HandleCommandBuffer handles all keys that affect the command buffer
 func (em *Vi) HandleCommandBuffer(ev novi.Event) bool {
-	commands := "BbcdeEgGhjklxXdwWZQ0123456789$^"
-	r := ev.(*novi.CharacterEvent).Rune
+	em.CommandBuffer += string(ev.(*novi.CharacterEvent).Rune)
+	return true
+}
 
-	if strings.IndexRune(commands, r) != -1 {
-		em.CommandBuffer += string(r)
-		return true
-	}
-	return false
+// pending returns true if a command has been started, not just a count
+func (em *Vi) pending() bool {
+	_, rest := splitCount(em.CommandBuffer)
+	return rest != ""
 }
 
 // CheckExecuteCommandBuffer checks if there's a full, complete command and, if so, executes it
 func (em *Vi) CheckExecuteCommandBuffer() bool {
 	/*
-	 * a vi(m?) command has the structure
-	 * <number?>character
-	 * <number?>character(<number?>character)? e.g. 2d3d -> 6dd, or d10d -> 10dd
-	 *
 	 * (vim actually understands <num><keyup>!, same for backspace)
 	 *
 	 * "just" 0 = Begin of line
 	 * odd case, 2d0 deletes current line to beginning
 	 *
-	 * There are also combinations, e.g c3w -> what about 2c3w?
+	 * See command.go for the grammar
 	 */
+	res := true
+	if em.CommandBuffer != "" {
+		cmd, err := em.parseCommand(em.CommandBuffer)
+		if err != nil {
+			log.Printf("%s", err)
+			em.CommandBuffer = ""
+			em.failed = true
+		} else if cmd != nil {
+			em.CommandBuffer = ""
+			res = em.Execute(cmd)
+		}
+	}
+	// a selected register only applies to the next command
+	if em.CommandBuffer == "" && !em.awaitRegister {
+		em.register = 0
+	}
+	return res
+}
 
-	count, command := ParseCommand(em.CommandBuffer)
-	switch command {
-	case "h", "j", "k", "l":
-		em.MoveCursorRune(rune(command[0]), count)
-		em.CommandBuffer = ""
-	case "w", "W", "b", "B", "e", "E":
-		em.JumpWord(rune(command[0]), count)
-		em.CommandBuffer = ""
-	case "x", "X":
-		em.RemoveCharacters(count, command == "X")
-		em.CommandBuffer = ""
-	case "gg", "G":
-		em.JumpTopBottom(count, command == "gg")
-		em.CommandBuffer = ""
-	case "^", "$":
-		em.JumpStartEndLine(count, command == "^")
-		em.CommandBuffer = ""
-	case "ZZ":
-		em.c <- &novi.SaveEvent{}
-		em.c <- &novi.QuitEvent{}
-		em.CommandBuffer = ""
-	case "ZQ":
-		em.c <- &novi.QuitEvent{Force: true}
-		em.CommandBuffer = ""
-		return false // signals exit
-	case "dd":
-		em.RemoveLines(count)
-		em.CommandBuffer = ""
-	case "cw", "dw":
-		em.ReplaceDeleteWords(count, command == "cw")
-		em.CommandBuffer = ""
+// Undo undoes the last howmany changes
+func (em *Vi) Undo(howmany int) {
+	for i := 0; i < howmany; i++ {
+		if !em.Editor.Buffer.Undo(em.Editor.Cursors) {
+			em.c <- &novi.ErrorEvent{Message: "Already at oldest change"}
+			break
+		}
 	}
-	return true
+	em.validateCursors()
 }
 
-// JumpWord jumps to the next word / sequence of separators
-func (em *Vi) JumpWord(r rune, howmany int) {
+// Redo redoes the last howmany undone changes
+func (em *Vi) Redo(howmany int) {
 	for i := 0; i < howmany; i++ {
-		for _, c := range em.Editor.Cursors {
-			switch r {
-			case 'W':
-				l, p := JumpWordForward(em.Editor.Buffer, c)
-				c.Line, c.Pos = l, p
-			case 'w':
-				l, p := JumpForward(em.Editor.Buffer, c)
-				c.Line, c.Pos = l, p
-			case 'B':
-				l, p := JumpWordBackward(em.Editor.Buffer, c)
-				c.Line, c.Pos = l, p
-			case 'b':
-				l, p := JumpBackward(em.Editor.Buffer, c)
-				c.Line, c.Pos = l, p
-			case 'E':
-				l, p := JumpForwardEnd(em.Editor.Buffer, c)
-				c.Line, c.Pos = l, p
-			case 'e':
-				l, p := JumpWordForwardEnd(em.Editor.Buffer, c)
-				c.Line, c.Pos = l, p
-			}
+		if !em.Editor.Buffer.Redo(em.Editor.Cursors) {
+			em.c <- &novi.ErrorEvent{Message: "Already at newest change"}
+			break
 		}
 	}
+	em.validateCursors()
+}
 
+// validateCursors makes sure all cursors are on a valid position for the current mode
+func (em *Vi) validateCursors() {
+	for _, c := range em.Editor.Cursors {
+		c.Validate()
+	}
+}
+
+// HandleRedo handles ctrl-r, redo
+func (em *Vi) HandleRedo(ev novi.Event) bool {
+	count, _ := splitCount(em.CommandBuffer)
+	em.CommandBuffer = ""
+	if count == 0 {
+		count = 1
+	}
+	em.Redo(count)
+	return true
 }
 
 // JumpTopBottom handles jumping using the gg / G command
@@ -530,6 +598,13 @@ func (em *Vi) GetStatus(width int) string {
 	if em.Editor.Buffer.Modified {
 		modified = "(modified) "
 	}
-	return mode + fmt.Sprintf("%s %s   %s  row %d col %d",
-		em.Editor.GetFilename(), modified, em.CommandBuffer, first.Line+1, first.Pos+1)
+	pending := em.CommandBuffer
+	if em.register != 0 {
+		pending = "\"" + string(em.register) + pending
+	}
+	if em.recording != 0 {
+		mode += "recording @" + string(em.recording) + " "
+	}
+	return mode + fmt.Sprintf("%s %s[%s]   %s  row %d col %d",
+		em.Editor.GetFilename(), modified, em.Editor.Buffer.Format, pending, first.Line+1, first.Pos+1)
 }
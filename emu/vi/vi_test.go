@@ -1,6 +1,7 @@
 package viemu
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/iivvoo/novi/novi"
@@ -10,6 +11,7 @@ func SetupVi(mode ViMode, lines ...string) *Vi {
 	editor := novi.NewEditor()
 	editor.Buffer.LoadStrings(lines)
 	emu := NewVi(editor)
+	emu.SetChan(make(chan novi.EmuEvent, 100))
 	emu.Mode = mode
 
 	return emu
@@ -22,6 +24,54 @@ func SetupViAndCursor(mode ViMode, line, pos int, lines ...string) (*Vi, *novi.C
 	return emu, cursor
 }
 
+// SendKeys sends the runes in keys as character events, but maps <esc> and
+// <enter> to their respective key events. Keys go to the ex input while it's
+// active
+func SendKeys(em *Vi, keys string) {
+	special := map[string]novi.Event{
+		"<esc>":   &novi.KeyEvent{Key: novi.KeyEscape},
+		"<enter>": &novi.KeyEvent{Key: novi.KeyEnter},
+		"<bs>":    &novi.KeyEvent{Key: novi.KeyBackspace},
+		"<c-r>":   &novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'r'},
+		"<c-v>":   &novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'v'},
+		"<c-o>":   &novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'o'},
+		"<c-i>":   &novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'i'},
+		"<c-f>":   &novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'f'},
+		"<c-b>":   &novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'b'},
+		"<c-d>":   &novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'd'},
+		"<c-u>":   &novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'u'},
+		"<c-e>":   &novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'e'},
+		"<c-y>":   &novi.KeyEvent{Modifier: novi.ModCtrl, Rune: 'y'},
+		"<left>":  &novi.KeyEvent{Key: novi.KeyLeft},
+		"<right>": &novi.KeyEvent{Key: novi.KeyRight},
+		"<up>":    &novi.KeyEvent{Key: novi.KeyUp},
+		"<down>":  &novi.KeyEvent{Key: novi.KeyDown},
+	}
+	for len(keys) > 0 {
+		found := false
+		for k, ev := range special {
+			if strings.HasPrefix(keys, k) {
+				em.HandleEvent(inputID(em), ev)
+				keys = keys[len(k):]
+				found = true
+				break
+			}
+		}
+		if !found {
+			r := []rune(keys)[0]
+			em.HandleEvent(inputID(em), &novi.CharacterEvent{Rune: r})
+			keys = keys[len(string(r)):]
+		}
+	}
+}
+
+func inputID(em *Vi) novi.InputID {
+	if em.ex.active {
+		return ExInputID
+	}
+	return MainInputID
+}
+
 func TestVi(t *testing.T) {
 	t.Run("Cursor movement at end in Command mode", func(t *testing.T) {
 		vi, cursor := SetupViAndCursor(ModeCommand, 0, 4, "hello")
@@ -54,3 +104,153 @@ func TestVi(t *testing.T) {
 		novi.AssertCursor(t, cursor, 0, 0) // Can't get any smaller
 	})
 }
+
+func TestInsertMultipleCursors(t *testing.T) {
+	t.Run("Enter and backspace", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeEdit, 0, 2, "abcd", "efgh")
+		vi.Editor.Cursors = append(vi.Editor.Cursors, vi.Editor.Buffer.NewCursor(1, 2))
+
+		SendKeys(vi, "<enter>")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "ab", "cd", "ef", "gh")
+		novi.AssertCursor(t, vi.Editor.Cursors[0], 1, 0)
+		novi.AssertCursor(t, vi.Editor.Cursors[1], 3, 0)
+
+		SendKeys(vi, "<bs>")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "abcd", "efgh")
+		novi.AssertCursor(t, vi.Editor.Cursors[0], 0, 2)
+		novi.AssertCursor(t, vi.Editor.Cursors[1], 1, 2)
+
+		SendKeys(vi, "<bs>")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "acd", "egh")
+		novi.AssertCursor(t, vi.Editor.Cursors[0], 0, 1)
+		novi.AssertCursor(t, vi.Editor.Cursors[1], 1, 1)
+	})
+	t.Run("Open line above", func(t *testing.T) {
+		vi, cursor := SetupViAndCursor(ModeCommand, 1, 2, "one", "two")
+		SendKeys(vi, "Onew<esc>")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "one", "new", "two")
+		novi.AssertCursor(t, cursor, 1, 2)
+	})
+	t.Run("Remove characters before cursor", func(t *testing.T) {
+		vi, cursor := SetupViAndCursor(ModeCommand, 0, 4, "abcdef")
+		SendKeys(vi, "2X")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "abef")
+		novi.AssertCursor(t, cursor, 0, 2)
+	})
+}
+
+func TestUndo(t *testing.T) {
+	t.Run("Insert session is a single change", func(t *testing.T) {
+		vi, cursor := SetupViAndCursor(ModeCommand, 0, 0, "hello", "world")
+		SendKeys(vi, "ohi<enter>there<esc>")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "hello", "hi", "there", "world")
+
+		SendKeys(vi, "u")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "hello", "world")
+		novi.AssertCursor(t, cursor, 0, 0)
+	})
+	t.Run("Undo dd and redo", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 1, 0, "one", "two", "three", "four")
+		SendKeys(vi, "2dd")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "one", "four")
+
+		SendKeys(vi, "u")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "one", "two", "three", "four")
+
+		SendKeys(vi, "<c-r>")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "one", "four")
+	})
+	t.Run("Undo with count", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 0, "abcdef")
+		SendKeys(vi, "xxx")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "def")
+
+		SendKeys(vi, "2u")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "bcdef")
+	})
+	t.Run("Redo with count", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 0, "abcdef")
+		SendKeys(vi, "xxx3u")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "abcdef")
+
+		SendKeys(vi, "2<c-r>")
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "cdef")
+	})
+	t.Run("Undo through ex", func(t *testing.T) {
+		vi, _ := SetupViAndCursor(ModeCommand, 0, 0, "abcdef")
+		SendKeys(vi, "x")
+		vi.ex.input.Buffer = novi.NewLineFromString("undo")
+		vi.HandleExCommand()
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "abcdef")
+
+		vi.ex.input.Buffer = novi.NewLineFromString("redo")
+		vi.HandleExCommand()
+		novi.AssertBufferMatch(t, vi.Editor.Buffer, "bcdef")
+	})
+}
+
+func TestSetOption(t *testing.T) {
+	t.Run("Set fileformat", func(t *testing.T) {
+		vi := SetupVi(ModeCommand, "hello")
+		vi.HandleSet([]string{"ff=dos", "nofixeol"})
+
+		format := vi.Editor.Buffer.Format
+		if format.Ending != novi.EndingDos || format.FixEOL {
+			t.Errorf("Options not set correctly: %+v", format)
+		}
+		if !strings.Contains(vi.GetStatus(80), "[dos") {
+			t.Errorf("Expected format in status, got %s", vi.GetStatus(80))
+		}
+	})
+	t.Run("Format change survives undo", func(t *testing.T) {
+		vi := SetupVi(ModeCommand, "hello")
+		SendKeys(vi, "xu")
+		vi.HandleSet([]string{"ff=dos"})
+		SendKeys(vi, "xu")
+		novi.AssertBufferModified(t, vi.Editor.Buffer, true)
+		vi.Editor.Buffer.MarkSaved()
+		SendKeys(vi, "xu")
+		novi.AssertBufferModified(t, vi.Editor.Buffer, false)
+	})
+	t.Run("Set backup policy", func(t *testing.T) {
+		vi := SetupVi(ModeCommand, "hello")
+		vi.HandleSet([]string{"backup"})
+		if vi.Editor.SaveOptions.Backup != novi.BackupSameDir {
+			t.Errorf("Expected same dir backups, got %s", vi.Editor.SaveOptions.Backup)
+		}
+		vi.HandleSet([]string{"backupdir=/tmp/backups"})
+		if o := vi.Editor.SaveOptions; o.Backup != novi.BackupDir || o.BackupDir != "/tmp/backups" {
+			t.Errorf("Expected backups in /tmp/backups, got %+v", o)
+		}
+		vi.HandleSet([]string{"backup=numbered"})
+		if vi.Editor.SaveOptions.Backup != novi.BackupNumbered {
+			t.Errorf("Expected numbered backups, got %s", vi.Editor.SaveOptions.Backup)
+		}
+		if vi.Editor.Buffer.Modified {
+			t.Error("Backup options should not modify the buffer")
+		}
+		if err := vi.SetOption("backup=sometimes"); err == nil {
+			t.Error("Expected an error for an invalid policy")
+		}
+	})
+	t.Run("Set syntax", func(t *testing.T) {
+		vi := SetupVi(ModeCommand, "hello")
+		vi.HandleSet([]string{"syntax=json"})
+		if s := vi.Editor.Syntax; s == nil || s.Lexer.Name() != "json" {
+			t.Errorf("Expected json syntax, got %+v", s)
+		}
+		vi.HandleSet([]string{"syntax=off"})
+		if vi.Editor.Syntax != nil {
+			t.Error("Expected no syntax")
+		}
+		if err := vi.SetOption("syntax=cobol"); err == nil {
+			t.Error("Expected an error for an unknown syntax")
+		}
+	})
+	t.Run("Unknown option", func(t *testing.T) {
+		vi := SetupVi(ModeCommand, "hello")
+		if err := vi.SetOption("nosuchoption"); err == nil {
+			t.Error("Expected an error for an unknown option")
+		}
+	})
+}
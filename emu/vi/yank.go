@@ -0,0 +1,211 @@
+package viemu
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/iivvoo/novi/novi"
+)
+
+/*
+ * Yanking and putting text using registers (see registers.go). A register
+ * can be selected for the next command using "x, in command and select mode.
+ */
+
+// HandleSelectRegister handles '"', the next key selects a register
+func (em *Vi) HandleSelectRegister(novi.Event) bool {
+	em.awaitRegister = true
+	return true
+}
+
+// HandleInsertRegister handles ctrl-r in insert mode, the next key selects the
+// register to insert
+func (em *Vi) HandleInsertRegister(novi.Event) bool {
+	em.awaitRegister = true
+	return true
+}
+
+// HandleRegisterName handles the key following '"' or ctrl-r
+func (em *Vi) HandleRegisterName(event novi.Event) {
+	em.awaitRegister = false
+	char, ok := event.(*novi.CharacterEvent)
+	if !ok {
+		// e.g. escape, cancels the register selection
+		return
+	}
+	if !ValidRegister(char.Rune) {
+		em.c <- &novi.ErrorEvent{Message: "E354: Invalid register name: '" + string(char.Rune) + "'"}
+		return
+	}
+	if em.Mode == ModeEdit {
+		em.InsertRegister(char.Rune)
+		return
+	}
+	em.register = char.Rune
+}
+
+// takeRegister returns the register selected for the current command, if
+// any, and clears it
+func (em *Vi) takeRegister() rune {
+	r := em.register
+	em.register = 0
+	return r
+}
+
+// GetRegister returns the contents of a register, including the read-only
+// registers. It returns nil if the register is empty
+func (em *Vi) GetRegister(name rune) *Register {
+	text := ""
+	switch name {
+	case '%':
+		text = em.Editor.GetFilename()
+	case '.':
+		text = em.lastInsert
+	case ':':
+		text = em.ex.last
+	default:
+		return em.registers.Get(name)
+	}
+	if text == "" {
+		return nil
+	}
+	return &Register{Text: strings.Split(text, "\n"), Type: RegisterCharwise}
+}
+
+// yanked stores yanked text in the selected register
+func (em *Vi) yanked(r *Register) {
+	if err := em.registers.Yank(em.takeRegister(), r); err != nil {
+		em.c <- &novi.ErrorEvent{Message: err.Error()}
+	}
+}
+
+// deleted stores deleted text in the selected register
+func (em *Vi) deleted(r *Register) {
+	if err := em.registers.Delete(em.takeRegister(), r); err != nil {
+		em.c <- &novi.ErrorEvent{Message: err.Error()}
+	}
+}
+
+// linesRegister returns the lines from start up to end (exclusive) as register
+func (em *Vi) linesRegister(start, end int) *Register {
+	if end > em.Editor.Buffer.Length() {
+		end = em.Editor.Buffer.Length()
+	}
+	var text []string
+	for _, l := range em.Editor.Buffer.GetLines(start, end) {
+		text = append(text, l.ToString())
+	}
+	return &Register{Text: text, Type: RegisterLinewise}
+}
+
+// HandleSelectYank handles 'y' in select mode
+func (em *Vi) HandleSelectYank(novi.Event) bool {
+	return em.Execute(&ViCommand{Operator: "y"})
+}
+
+// firstNonBlank returns the position of the first non-blank character on a line
+func firstNonBlank(l *novi.Line) int {
+	for i, r := range l.AllRunes() {
+		if !unicode.IsSpace(r) {
+			return i
+		}
+	}
+	return 0
+}
+
+// Put puts the contents of the selected register howmany times after the
+// cursor, or before it
+func (em *Vi) Put(howmany int, before bool) {
+	name := em.takeRegister()
+	reg := em.GetRegister(name)
+	if reg == nil {
+		if name == 0 {
+			name = '"'
+		}
+		em.c <- &novi.ErrorEvent{Message: "E353: Nothing in register " + string(name)}
+		return
+	}
+	b := em.Editor.Buffer
+	first := em.Editor.Cursors[0]
+
+	switch reg.Type {
+	case RegisterLinewise:
+		var text []string
+		for i := 0; i < howmany; i++ {
+			text = append(text, reg.Text...)
+		}
+		line := first.Line
+		if before {
+			b.InsertText(b.NewCursor(line, 0), append(text, ""))
+		} else {
+			b.InsertText(b.NewCursor(line, b.GetLine(line).Len()), append([]string{""}, text...))
+			line++
+		}
+		first.Line, first.Pos = line, firstNonBlank(b.GetLine(line))
+
+	case RegisterCharwise:
+		text := reg.Text
+		for i := 1; i < howmany; i++ {
+			text = appendRegister(&Register{Text: text}, reg).Text
+		}
+		pos := first.Pos
+		if !before && b.GetLine(first.Line).Len() > 0 {
+			pos++
+		}
+		l, p := b.InsertText(b.NewCursor(first.Line, pos), text)
+		if len(text) == 1 {
+			first.Line, first.Pos = l, p-1
+		} else {
+			first.Pos = pos
+		}
+
+	case RegisterBlockwise:
+		// the block is put at the same screen column on every line
+		opts := em.Editor.ViewOptions
+		col, end := opts.Span(b.GetLine(first.Line), first.Pos)
+		if !before && b.GetLine(first.Line).Len() > 0 {
+			col = end
+		}
+		width := 0
+		for _, t := range reg.Text {
+			if w := opts.Width(novi.NewLineFromString(t)); w > width {
+				width = w
+			}
+		}
+		for i, t := range reg.Text {
+			line := first.Line + i
+			if line >= b.Length() {
+				b.InsertLine(b.NewCursor(b.Length()-1, 0), "", false)
+			}
+			l := b.GetLine(line)
+			text := strings.Repeat(t, howmany)
+			if w := opts.Width(l); w < col {
+				text = strings.Repeat(" ", col-w) + text
+				b.InsertText(b.NewCursor(line, l.Len()), []string{text})
+				continue
+			}
+			pos := opts.NextPos(l, col)
+			if pos < l.Len() {
+				// keep the text after the block aligned
+				pad := strings.Repeat(" ", width-opts.Width(novi.NewLineFromString(t)))
+				text = strings.Repeat(t+pad, howmany)
+			}
+			b.InsertText(b.NewCursor(line, pos), []string{text})
+		}
+		first.Pos = opts.NextPos(b.GetLine(first.Line), col)
+	}
+}
+
+// InsertRegister inserts the contents of a register at all cursors, in insert mode
+func (em *Vi) InsertRegister(name rune) {
+	reg := em.GetRegister(name)
+	if reg == nil {
+		return
+	}
+	s := reg.String()
+	text := strings.Split(s, "\n")
+	for _, c := range em.Editor.Cursors {
+		c.Line, c.Pos = em.Editor.Buffer.InsertText(c, text)
+	}
+	em.insertText += s
+}
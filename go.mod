@@ -4,5 +4,7 @@ go 1.13
 
 require (
 	github.com/gdamore/tcell v1.3.0
+	github.com/mattn/go-runewidth v0.0.4
 	github.com/rivo/tview v0.0.0-20200108161608-1316ea7a4b35
+	github.com/rivo/uniseg v0.1.0
 )
@@ -1,10 +1,5 @@
 package novi
 
-import (
-	"bufio"
-	"io"
-)
-
 /*
  * Buffer contains the implementaion of the text being manipulated by the editor.
  * It consists of an array of variable length strings of runes that can be manpipulated
@@ -35,45 +30,75 @@ import (
 
 // Buffer encapsulates the state o an editable line buffer
 type Buffer struct {
-	Lines       []*Line // Making Lines public is risky, shoud consider making it unexported
 	Modified    bool
+	Format      FileFormat
 	initialized bool
+	reformatted bool // the format changed since the buffer was saved
+	storage     StorageType
+	lines       lineStore
+	history     History
+	subscribers subscribers
+	loading     bool
 }
 
 // NewBuffer creates a new Buffer. You usually don't want to call this directly
 // since it will give you an unitialized buffer that you can't work with yet.
 func NewBuffer() *Buffer {
 	// the call you don't want since it doesn't initialize
-	return &Buffer{}
+	return &Buffer{lines: &sliceStore{}, Format: DefaultFileFormat}
 }
 
 func (b *Buffer) InitializeEmptyBuffer() *Buffer {
-	b.Lines = []*Line{&Line{}}
+	b.setLines([]string{""})
 	b.initialized = true
 	return b
 }
 
-func (b *Buffer) LoadFile(in io.Reader) *Buffer {
-	b.Lines = nil
-	scanner := bufio.NewScanner(in)
-	for scanner.Scan() {
-		b.AddLine(NewLineFromString(scanner.Text()))
-	}
+func (b *Buffer) LoadStrings(lines []string) *Buffer {
+	b.setLines(lines)
 	b.Validate()
+	b.ResetHistory()
 	b.initialized = true
+	b.notify(nil)
 	return b
 }
 
-func (b *Buffer) LoadStrings(lines []string) *Buffer {
-	b.Lines = nil
-	for _, l := range lines {
-		b.Lines = append(b.Lines, NewLineFromString(l))
+// SetStorage selects the storage engine for the buffer, converting the current
+// contents if necessary
+func (b *Buffer) SetStorage(storage StorageType) *Buffer {
+	b.storage = storage
+	if b.lines != nil {
+		b.setLines(b.lines.Strings())
 	}
-	b.Validate()
-	b.initialized = true
 	return b
 }
 
+// Storage returns the storage engine currently in use
+func (b *Buffer) Storage() StorageType {
+	if _, ok := b.lines.(*ropeStore); ok {
+		return StorageRope
+	}
+	return StorageSlice
+}
+
+// setLines replaces the entire contents of the buffer, selecting the
+// appropriate storage
+func (b *Buffer) setLines(lines []string) {
+	useRope := b.storage == StorageRope
+	if b.storage == StorageAuto {
+		size := 0
+		for _, l := range lines {
+			size += len(l) + 1
+		}
+		useRope = size > RopeThreshold
+	}
+	if useRope {
+		b.lines = newRopeStore(lines)
+	} else {
+		b.lines = newSliceStore(lines)
+	}
+}
+
 // NewCursor creates and binds a new cursor on this buffer
 func (b *Buffer) NewCursor(line, pos int) *Cursor {
 	return NewCursor(b, line, pos)
@@ -81,24 +106,28 @@ func (b *Buffer) NewCursor(line, pos int) *Cursor {
 
 // Length returns the number of lines in this buffer
 func (b *Buffer) Length() int {
-	return len(b.Lines)
+	if b.lines == nil {
+		return 0
+	}
+	return b.lines.Len()
 }
 
 // Validate verifies and makes sure the buffer has a valid state
 func (b *Buffer) Validate() bool {
 	if b.Length() == 0 {
-		b.Lines = []*Line{&Line{}}
+		b.setLines([]string{""})
 		return false
 	}
 	return true
 }
 
-// GetLine returns the line at a specific index
+// GetLine returns the line at a specific index. The line should not be
+// modified, all modifications go through the Buffer
 func (b *Buffer) GetLine(index int) *Line {
-	if index >= b.Length() {
+	if index < 0 || index >= b.Length() {
 		return nil
 	}
-	return b.Lines[index]
+	return b.lines.Get(index)
 }
 
 // GetLines attempts to retun the lines between start/end
@@ -112,60 +141,120 @@ func (b *Buffer) GetLines(start, end int) []*Line {
 	if end > b.Length() {
 		end = b.Length()
 	}
-	return b.Lines[start:end]
+	res := make([]*Line, 0, end-start)
+	for i := start; i < end; i++ {
+		res = append(res, b.lines.Get(i))
+	}
+	return res
+}
+
+// Strings returns the entire contents of the buffer as strings
+func (b *Buffer) Strings() []string {
+	return b.lines.Strings()
 }
 
 // AddLine adds a line to the bottom of the buffer
 func (b *Buffer) AddLine(line *Line) {
-	b.Lines = append(b.Lines, line)
-	b.Modified = true
+	if b.Length() == 0 {
+		b.lines.Replace(0, 0, []*Line{line})
+		b.Modified = true
+		b.notify(nil)
+		return
+	}
+	last := b.Length() - 1
+	end := b.GetLine(last).Len()
+	b.replace(last, end, last, end, []string{"", line.ToString()})
 }
 
 func (b *Buffer) DumpLog(header string) {
 	log.Println(header)
-	for i, l := range b.Lines {
-		log.Printf(" %d [%s]", i, string(l.ToString()))
+	for i, l := range b.Strings() {
+		log.Printf(" %d [%s]", i, l)
+	}
+}
+
+// textBetween returns the text between two positions (end is exclusive)
+func (b *Buffer) textBetween(line, pos, endLine, endPos int) []string {
+	first := b.GetLine(line)
+	if line == endLine {
+		return []string{string(first.GetRunes(pos, endPos))}
+	}
+	res := []string{string(first.GetRunes(pos, first.Len()))}
+	for l := line + 1; l < endLine; l++ {
+		res = append(res, b.GetLine(l).ToString())
 	}
+	return append(res, string(b.GetLine(endLine).GetRunes(0, endPos)))
+}
+
+// splice replaces the text between two positions (end is exclusive) with text
+func (b *Buffer) splice(line, pos, endLine, endPos int, text []string) {
+	prefix := b.GetLine(line).GetRunes(0, pos)
+	last := b.GetLine(endLine)
+	suffix := last.GetRunes(endPos, last.Len())
+
+	if len(text) == 0 {
+		text = []string{""}
+	}
+	newLines := make([]*Line, len(text))
+	for i, t := range text {
+		newLines[i] = NewLineFromString(t)
+	}
+	newLines[0].runes = append(prefix, newLines[0].runes...)
+	n := newLines[len(newLines)-1]
+	n.runes = append(n.runes, suffix...)
+
+	b.lines.Replace(line, endLine+1, newLines)
+}
+
+// replace replaces the text between two positions (end is exclusive) with the given text
+// and records the change so it can be undone. It returns the change that was made
+func (b *Buffer) replace(line, pos, endLine, endPos int, text []string) Change {
+	ch := Change{
+		Line:     line,
+		Pos:      pos,
+		Removed:  b.textBetween(line, pos, endLine, endPos),
+		Inserted: text,
+	}
+	b.splice(line, pos, endLine, endPos, text)
+	b.history.record(ch)
+	b.notify(&ch)
+	b.Modified = true
+	return ch
+}
+
+// replay applies a change without recording it
+func (b *Buffer) replay(ch Change) {
+	l, p := ch.RemovedEnd()
+	b.splice(ch.Line, ch.Pos, l, p, ch.Inserted)
+	b.notify(&ch)
 }
 
 /* PutRuneAtCursor
- * Does not update cursors
+ * Cursors after the inserted runes move along, the cursors themselves don't
  */
 func (b *Buffer) PutRuneAtCursors(cs Cursors, r rune) {
 	b.Validate()
 	for _, c := range cs {
-		line := b.Lines[c.Line]
-		line.InsertRune(r, c.Pos)
-		b.Lines[c.Line] = line
+		b.replace(c.Line, c.Pos, c.Line, c.Pos, []string{string(r)})
 	}
-	b.Modified = true
 }
 
 func (b *Buffer) RemoveRuneBeforeCursor(c *Cursor) {
 	// We can't really do all cursors at once. Perhaps let caller always loop?
 	// optionally, Cursors.all(func() {})
 	if c.Pos > 0 {
-		line := b.Lines[c.Line]
-		line.RemoveRune(c.Pos - 1)
-		b.Lines[c.Line] = line
-		b.Modified = true
+		b.replace(c.Line, c.Pos-1, c.Line, c.Pos, []string{""})
 	}
 }
 
 /* SplitLine
  *
  * Split lines at position of cursors.
- * This is tricky since it will create extra lines, which may affect cursors below
- *
- * If we return some generic modification detail, we may be able to automatically update
- * cursors?
+ * This will create extra lines, which affects cursors below. Those are
+ * updated automatically from the change (see notify.go)
  */
 func (b *Buffer) SplitLine(c *Cursor) {
-	line := b.Lines[c.Line]
-	before, after := line.Split(c.Pos)
-	b.Lines = append(b.Lines[:c.Line],
-		append([]*Line{before, after}, b.Lines[c.Line+1:]...)...)
-	b.Modified = true
+	b.replace(c.Line, c.Pos, c.Line, c.Pos, []string{"", ""})
 }
 
 /* InsertLine
@@ -183,31 +272,34 @@ func (b *Buffer) InsertLine(c *Cursor, line string, before bool) bool {
 	if c.Line >= b.Length() {
 		return false
 	}
-	pos := c.Line
-	if !before {
-		pos++
+	if before {
+		b.replace(c.Line, 0, c.Line, 0, []string{line, ""})
+	} else {
+		end := b.GetLine(c.Line).Len()
+		b.replace(c.Line, end, c.Line, end, []string{"", line})
 	}
-	// append() may copy if necessary. It will be copying slices in stead of
-	// arrays so it's not too inefficient, but a more efficient Buffer datastructure
-	// should be possible.
-	b.Lines = append(b.Lines[:pos],
-		append([]*Line{NewLineFromString(line)}, b.Lines[pos:]...)...)
-	b.Modified = true
 	return true
 }
 
 /* RemoveLine
  *
- * Remove and entire line. Does not update cursors wich may get invalid because
- * of the operation
+ * Remove and entire line. Cursors on the line move to the start of the next
+ * line, which may leave them invalid (e.g. after removing the last line)
  */
 func (b *Buffer) RemoveLine(line int) bool {
 	if line >= b.Length() {
 		return false
 	}
-	b.Lines = append(b.Lines[:line], b.Lines[line+1:]...)
-	b.Modified = true
-	b.Validate()
+	switch {
+	case b.Length() == 1:
+		// the buffer will always keep a single (empty) line
+		b.replace(0, 0, 0, b.GetLine(0).Len(), []string{""})
+	case line == b.Length()-1:
+		// remove the newline before the last line
+		b.replace(line-1, b.GetLine(line-1).Len(), line, b.GetLine(line).Len(), []string{""})
+	default:
+		b.replace(line, 0, line+1, 0, []string{""})
+	}
 	return true
 }
 
@@ -220,9 +312,7 @@ func (b *Buffer) JoinLineWithPrevious(line int) bool {
 		return false
 	}
 
-	b.Lines[line-1].Join(b.Lines[line])
-	b.RemoveLine(line)
-	b.Modified = true
+	b.replace(line-1, b.GetLine(line-1).Len(), line, 0, []string{""})
 	return true
 }
 
@@ -246,47 +336,97 @@ func (b *Buffer) RemoveCharacters(c *Cursor, before bool, howmany int) *Buffer {
 		return b.RemoveBetweenCursors(b.NewCursor(c.Line, startPos), endPos)
 	}
 	endPos := c.Pos + howmany - 1
-	if endPos > b.Lines[c.Line].Len()-1 {
-		endPos = b.Lines[c.Line].Len() - 1
+	if endPos > b.GetLine(c.Line).Len()-1 {
+		endPos = b.GetLine(c.Line).Len() - 1
 	}
 	return b.RemoveBetweenCursors(c, b.NewCursor(c.Line, endPos))
 }
 
-// RemoveBetweenCursors removes all characters between start/end cursors (inclusive),
-// across (entire) multiple lines if necessary. Returns the removed part as buffer
-// Not suitable for block selections
-func (b *Buffer) RemoveBetweenCursors(start, end *Cursor) *Buffer {
-	res := &Buffer{}
+// Text returns the text between two positions, the end is exclusive
+func (b *Buffer) Text(line, pos, endLine, endPos int) []string {
+	return b.textBetween(line, pos, endLine, endPos)
+}
 
-	if start.Line > end.Line || (start.Line == end.Line && start.Pos > end.Pos) {
+// Replace replaces the text between two positions (the end is exclusive)
+// with text and returns the change that was made
+func (b *Buffer) Replace(line, pos, endLine, endPos int, text []string) Change {
+	return b.replace(line, pos, endLine, endPos, text)
+}
+
+// RemoveLines removes the lines from start up to and including end and
+// returns them as buffer. The buffer always keeps a single (empty) line
+func (b *Buffer) RemoveLines(start, end int) *Buffer {
+	res := NewBuffer()
+	if end >= b.Length() {
+		end = b.Length() - 1
+	}
+	if start > end {
 		return res
 	}
-	// We could check if start.IsBefore(end) and only act if true
-	if end.Line > start.Line {
-		before, first := b.Lines[start.Line].Split(start.Pos)
-		res.Lines = append(res.Lines, first)
-
-		middleSize := end.Line - start.Line - 1
+	res.LoadStrings(b.textBetween(start, 0, end, b.GetLine(end).Len()))
+	switch {
+	case end < b.Length()-1:
+		b.replace(start, 0, end+1, 0, []string{""})
+	case start > 0:
+		// remove the newline before the first line
+		b.replace(start-1, b.GetLine(start-1).Len(), end, b.GetLine(end).Len(), []string{""})
+	default:
+		b.replace(0, 0, end, b.GetLine(end).Len(), []string{""})
+	}
+	return res
+}
 
-		if middleSize > 0 {
-			middle := b.Lines[start.Line+1 : end.Line]
-			res.Lines = append(res.Lines, middle...)
-		}
+// InsertText inserts text at the cursor, a slice of lines just like a Change.
+// It returns the position just after the inserted text. Cursors at the
+// position itself stay where they are
+func (b *Buffer) InsertText(c *Cursor, text []string) (int, int) {
+	if emptyText(text) {
+		return c.Line, c.Pos
+	}
+	ch := b.replace(c.Line, c.Pos, c.Line, c.Pos, text)
+	return ch.InsertedEnd()
+}
 
-		last, after := b.Lines[end.Line].Split(end.Pos + 1)
-		res.Lines = append(res.Lines, last)
+// clampBetween limits start/end (inclusive) to the buffer and returns the
+// exclusive end position, or false if there's nothing in between
+func (b *Buffer) clampBetween(start, end *Cursor) (int, int, bool) {
+	if start.Line > end.Line || (start.Line == end.Line && start.Pos > end.Pos) {
+		return 0, 0, false
+	}
+	endPos := end.Pos + 1
+	if l := b.GetLine(end.Line).Len(); endPos > l {
+		endPos = l
+	}
+	startPos := start.Pos
+	if l := b.GetLine(start.Line).Len(); startPos > l {
+		startPos = l
+	}
+	if start.Line == end.Line && startPos >= endPos {
+		return 0, 0, false
+	}
+	return startPos, endPos, true
+}
 
-		b.Lines[start.Line] = NewLine().Join(before).Join(after)
+// CopyBetweenCursors returns the characters between start/end cursors
+// (inclusive) as buffer, like RemoveBetweenCursors but without removing them
+func (b *Buffer) CopyBetweenCursors(start, end *Cursor) *Buffer {
+	res := NewBuffer()
+	startPos, endPos, ok := b.clampBetween(start, end)
+	if !ok {
+		return res
+	}
+	return res.LoadStrings(b.textBetween(start.Line, startPos, end.Line, endPos))
+}
 
-		b.Lines = append(b.Lines[:end.Line], b.Lines[end.Line+1:]...)
-		// now remove the middle part
-		if middleSize > 0 {
-			b.Lines = append(b.Lines[:start.Line+1], b.Lines[end.Line:]...)
-		}
-	} else { // removal is on same start/endline.
-		part := b.Lines[start.Line].Cut(start.Pos, end.Pos+1)
-		res.Lines = append(res.Lines, part)
+// RemoveBetweenCursors removes all characters between start/end cursors (inclusive),
+// across (entire) multiple lines if necessary. Returns the removed part as buffer
+// Not suitable for block selections
+func (b *Buffer) RemoveBetweenCursors(start, end *Cursor) *Buffer {
+	res := NewBuffer()
+	startPos, endPos, ok := b.clampBetween(start, end)
+	if !ok {
+		return res
 	}
-	b.Modified = true
-	return res
+	ch := b.replace(start.Line, startPos, end.Line, endPos, []string{""})
+	return res.LoadStrings(ch.Removed)
 }
@@ -194,3 +194,26 @@ func TestRemoveBetweenCursors(t *testing.T) {
 		AssertBufferModified(t, b, true)
 	})
 }
+
+func TestBufferCopyInsert(t *testing.T) {
+	t.Run("Copy between cursors", func(t *testing.T) {
+		b := BuildBuffer("hello", "world")
+		res := b.CopyBetweenCursors(b.NewCursor(0, 3), b.NewCursor(1, 1))
+		AssertBufferMatch(t, res, "lo", "wo")
+		AssertBufferMatch(t, b, "hello", "world")
+		AssertBufferModified(t, b, false)
+	})
+	t.Run("Insert text", func(t *testing.T) {
+		b := BuildBuffer("hello", "world")
+		c := b.NewCursor(0, 2)
+		after := b.NewCursor(1, 0)
+		b.Track(after)
+		l, p := b.InsertText(c, []string{"xx", "yy"})
+		AssertBufferMatch(t, b, "hexx", "yyllo", "world")
+		if l != 1 || p != 2 {
+			t.Errorf("Expected end of text at (1, 2), got (%d, %d)", l, p)
+		}
+		AssertCursor(t, c, 0, 2)
+		AssertCursor(t, after, 2, 0)
+	})
+}
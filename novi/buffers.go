@@ -0,0 +1,253 @@
+package novi
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+/*
+ * The buffer list. An editor holds any number of documents, one of which is
+ * current. Documents that aren't current stay loaded (like vim's 'hidden')
+ * and keep their own cursors, undo history and swap file.
+ *
+ * Documents are numbered from 1 in the order they're added, numbers are
+ * never reused.
+ */
+
+// Number returns the number that identifies the document in the buffer list
+func (d *Document) Number() int {
+	return d.number
+}
+
+// Name returns the name of the document as shown to the user
+func (d *Document) Name() string {
+	if d.filename == "" {
+		return "[No Name]"
+	}
+	return d.filename
+}
+
+// Documents returns all documents in the order they were added
+func (e *Editor) Documents() []*Document {
+	return e.documents
+}
+
+// GetDocument returns the document with the given number, or nil
+func (e *Editor) GetDocument(number int) *Document {
+	for _, d := range e.documents {
+		if d.number == number {
+			return d
+		}
+	}
+	return nil
+}
+
+// ModifiedDocuments returns the documents that have unsaved changes
+func (e *Editor) ModifiedDocuments() []*Document {
+	var res []*Document
+	for _, d := range e.documents {
+		if d.Buffer.Modified {
+			res = append(res, d)
+		}
+	}
+	return res
+}
+
+// each calls fn with each document made current in turn
+func (e *Editor) each(fn func()) {
+	current := e.Document
+	defer func() { e.Document = current }()
+	for _, d := range e.documents {
+		e.Document = d
+		fn()
+	}
+}
+
+// with calls fn with d made current
+func (e *Editor) with(d *Document, fn func()) {
+	current := e.Document
+	defer func() { e.Document = current }()
+	e.Document = d
+	fn()
+}
+
+// findDocument returns the document editing the given file, if any
+func (e *Editor) findDocument(name string) *Document {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return nil
+	}
+	for _, d := range e.documents {
+		if d.filename == "" {
+			continue
+		}
+		if other, err := filepath.Abs(d.filename); err == nil && other == abs {
+			return d
+		}
+	}
+	return nil
+}
+
+// AddFile adds a document for a file without loading it. The file is loaded
+// when the document is shown for the first time
+func (e *Editor) AddFile(name string) *Document {
+	if d := e.findDocument(name); d != nil {
+		return d
+	}
+	d := e.newDocument()
+	d.filename = name
+	d.loaded = false
+	return d
+}
+
+// show makes a document current, loading its file if that didn't happen yet
+func (e *Editor) show(d *Document) error {
+	e.Document = d
+	if !d.loaded {
+		d.loaded = true
+		return e.LoadFileAsync(d.filename)
+	}
+	return nil
+}
+
+// Edit makes the document for a file current, loading the file if it isn't
+// in the buffer list yet. Without a name the current file is reloaded, which
+// requires force if it has unsaved changes
+func (e *Editor) Edit(name string, force bool) error {
+	if name == "" {
+		if e.filename == "" {
+			return errors.New("E32: No file name")
+		}
+		if e.Buffer.Modified && !force {
+			return errors.New("E37: No write since last change (add ! to override)")
+		}
+		return e.ReloadFile()
+	}
+	if d := e.findDocument(name); d != nil {
+		if d == e.Document && force {
+			return e.ReloadFile()
+		}
+		return e.show(d)
+	}
+	// an unused empty document is reused
+	if e.filename != "" || e.Buffer.Modified {
+		e.Document = e.newDocument()
+	}
+	return e.LoadFileAsync(name)
+}
+
+// SwitchTo makes the document with the given number current
+func (e *Editor) SwitchTo(number int) error {
+	d := e.GetDocument(number)
+	if d == nil {
+		return fmt.Errorf("E86: Buffer %d does not exist", number)
+	}
+	return e.show(d)
+}
+
+// NextDocument makes the document count places further in the buffer list
+// current, wrapping around at the end. A negative count moves backwards
+func (e *Editor) NextDocument(count int) error {
+	n := len(e.documents)
+	for i, d := range e.documents {
+		if d == e.Document {
+			return e.show(e.documents[((i+count)%n+n)%n])
+		}
+	}
+	return nil
+}
+
+// CloseDocument removes a document from the buffer list, 0 means the current
+// one. Unsaved changes are only discarded with force. If the current document
+// is closed the next one becomes current, when the last one is closed a new
+// empty document is created
+func (e *Editor) CloseDocument(number int, force bool) error {
+	d := e.Document
+	if number != 0 {
+		if d = e.GetDocument(number); d == nil {
+			return fmt.Errorf("E516: No buffers were deleted: %d", number)
+		}
+	}
+	if d.Buffer.Modified && !force {
+		return fmt.Errorf("E89: No write since last change for buffer %d (add ! to override)", d.number)
+	}
+
+	current := e.Document
+	e.Document = d
+	e.CancelLoad()
+	e.closeSwap()
+	e.Document = current
+
+	index := 0
+	for i, other := range e.documents {
+		if other == d {
+			index = i
+		}
+	}
+	e.documents = append(e.documents[:index:index], e.documents[index+1:]...)
+	for _, fn := range e.closeListeners {
+		fn(d)
+	}
+
+	if d != current {
+		return nil
+	}
+	if len(e.documents) == 0 {
+		e.Document = e.newDocument()
+		return nil
+	}
+	if index == len(e.documents) {
+		index--
+	}
+	return e.show(e.documents[index])
+}
+
+// OnClose registers fn to be called when a document is removed from the
+// buffer list, e.g. to forget any state kept for it
+func (e *Editor) OnClose(fn func(*Document)) {
+	e.closeListeners = append(e.closeListeners, fn)
+}
+
+// SaveAll saves all documents with unsaved changes
+func (e *Editor) SaveAll(force bool) error {
+	var first error
+	e.each(func() {
+		if !e.Buffer.Modified {
+			return
+		}
+		var err error
+		if e.filename == "" {
+			err = fmt.Errorf("E141: No file name for buffer %d", e.number)
+		} else {
+			err = e.SaveFile("", force)
+		}
+		if err != nil && first == nil {
+			first = err
+		}
+	})
+	return first
+}
+
+// ListDocuments describes the documents in the buffer list like vim's :ls,
+// with % marking the current document and + unsaved changes
+func (e *Editor) ListDocuments() []string {
+	var res []string
+	for _, d := range e.documents {
+		flags := " "
+		if d == e.Document {
+			flags = "%"
+		}
+		if d.Buffer.Modified {
+			flags += "+"
+		} else {
+			flags += " "
+		}
+		line := 0
+		if len(d.Cursors) > 0 {
+			line = d.Cursors[0].Line + 1
+		}
+		res = append(res, fmt.Sprintf("%3d %s \"%s\" line %d", d.number, flags, d.Name(), line))
+	}
+	return res
+}
@@ -0,0 +1,164 @@
+package novi
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// setupBuffers creates files with the given contents in a temporary directory
+// and an editor that has the first one loaded
+func setupBuffers(t *testing.T, contents ...string) (*Editor, []string, func()) {
+	t.Helper()
+
+	e, first, cleanup := setupSave(t, contents[0], 0644)
+	names := []string{first}
+	for i, content := range contents[1:] {
+		name := filepath.Join(filepath.Dir(first), string(rune('b'+i))+".txt")
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	return e, names, cleanup
+}
+
+func TestBuffers(t *testing.T) {
+	t.Run("Edit adds documents", func(t *testing.T) {
+		e, names, cleanup := setupBuffers(t, "one\n", "two\n")
+		defer cleanup()
+
+		if err := e.Edit(names[1], false); err != nil {
+			t.Fatal(err)
+		}
+		AssertBufferMatch(t, e.Buffer, "two")
+		if e.Number() != 2 || len(e.Documents()) != 2 {
+			t.Errorf("Expected 2 documents, current 2, got %d (%d)", len(e.Documents()), e.Number())
+		}
+
+		// editing the same file again doesn't add a document
+		if err := e.Edit(names[0], false); err != nil {
+			t.Fatal(err)
+		}
+		AssertBufferMatch(t, e.Buffer, "one")
+		if len(e.Documents()) != 2 {
+			t.Errorf("Expected 2 documents, got %d", len(e.Documents()))
+		}
+	})
+	t.Run("Empty document is reused", func(t *testing.T) {
+		e, names, cleanup := setupBuffers(t, "one\n")
+		defer cleanup()
+
+		e = NewEditor()
+		if err := e.Edit(names[0], false); err != nil {
+			t.Fatal(err)
+		}
+		if len(e.Documents()) != 1 || e.GetFilename() != names[0] {
+			t.Errorf("Expected a single document for %s, got %v", names[0], e.ListDocuments())
+		}
+	})
+	t.Run("Documents keep their own cursors", func(t *testing.T) {
+		e, names, cleanup := setupBuffers(t, "one\nline\n", "two\n")
+		defer cleanup()
+
+		e.Cursors[0].Line, e.Cursors[0].Pos = 1, 2
+		e.Edit(names[1], false)
+		AssertCursor(t, e.Cursors[0], 0, 0)
+		e.Cursors[0].Pos = 1
+
+		e.NextDocument(1)
+		AssertCursor(t, e.Cursors[0], 1, 2)
+		e.NextDocument(-1)
+		AssertCursor(t, e.Cursors[0], 0, 1)
+	})
+	t.Run("Added files are loaded when shown", func(t *testing.T) {
+		e, names, cleanup := setupBuffers(t, "one\n", "two\n")
+		defer cleanup()
+
+		d := e.AddFile(names[1])
+		if d.Buffer.Length() != 1 || d.Buffer.GetLine(0).ToString() != "" {
+			t.Errorf("Expected added file not to be loaded yet")
+		}
+		if err := e.SwitchTo(d.Number()); err != nil {
+			t.Fatal(err)
+		}
+		AssertBufferMatch(t, e.Buffer, "two")
+	})
+	t.Run("Switch to unknown document", func(t *testing.T) {
+		e, _, cleanup := setupBuffers(t, "one\n")
+		defer cleanup()
+
+		if err := e.SwitchTo(3); err == nil {
+			t.Errorf("Expected error switching to non existing document")
+		}
+	})
+	t.Run("Reload requires force", func(t *testing.T) {
+		e, _, cleanup := setupBuffers(t, "one\n")
+		defer cleanup()
+
+		e.Buffer.PutRuneAtCursors(e.Cursors, 'x')
+		if err := e.Edit("", false); err == nil {
+			t.Errorf("Expected error reloading modified document")
+		}
+		if err := e.Edit("", true); err != nil {
+			t.Fatal(err)
+		}
+		AssertBufferMatch(t, e.Buffer, "one")
+		AssertBufferModified(t, e.Buffer, false)
+	})
+	t.Run("Close documents", func(t *testing.T) {
+		e, names, cleanup := setupBuffers(t, "one\n", "two\n", "three\n")
+		defer cleanup()
+
+		e.Edit(names[1], false)
+		e.Edit(names[2], false)
+		e.SwitchTo(2)
+		e.Buffer.PutRuneAtCursors(e.Cursors, 'x')
+
+		if err := e.CloseDocument(0, false); err == nil {
+			t.Errorf("Expected error closing modified document")
+		}
+		if err := e.CloseDocument(0, true); err != nil {
+			t.Fatal(err)
+		}
+		// the next document becomes current
+		if e.Number() != 3 {
+			t.Errorf("Expected document 3 to be current, got %d", e.Number())
+		}
+		if err := e.CloseDocument(1, false); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.CloseDocument(3, false); err != nil {
+			t.Fatal(err)
+		}
+		// closing the last document leaves an empty one
+		if len(e.Documents()) != 1 || e.GetFilename() != "" || e.Number() != 4 {
+			t.Errorf("Expected a new empty document, got %v", e.ListDocuments())
+		}
+	})
+	t.Run("Save all modified documents", func(t *testing.T) {
+		e, names, cleanup := setupBuffers(t, "one\n", "two\n", "three\n")
+		defer cleanup()
+
+		e.Buffer.PutRuneAtCursors(e.Cursors, 'x')
+		e.Edit(names[1], false)
+		e.Edit(names[2], false)
+		e.Buffer.PutRuneAtCursors(e.Cursors, 'y')
+
+		if modified := e.ModifiedDocuments(); len(modified) != 2 {
+			t.Errorf("Expected 2 modified documents, got %d", len(modified))
+		}
+		if err := e.SaveAll(false); err != nil {
+			t.Fatal(err)
+		}
+		if modified := e.ModifiedDocuments(); len(modified) != 0 {
+			t.Errorf("Expected no modified documents, got %d", len(modified))
+		}
+		AssertFileContent(t, names[0], "xone\n")
+		AssertFileContent(t, names[1], "two\n")
+		AssertFileContent(t, names[2], "ythree\n")
+		if e.Number() != 3 {
+			t.Errorf("Expected document 3 to stay current, got %d", e.Number())
+		}
+	})
+}
@@ -1,5 +1,11 @@
 package novi
 
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
 type Emulation interface {
 	HandleEvent(InputID, Event) bool
 	GetStatus(int) string
@@ -18,11 +24,19 @@ type UI interface {
 	SetError(string)
 }
 
+// CoreInputID identifies input that's handled by the Core itself, e.g. the
+// prompt asking what to do with a file that changed on disk
+const CoreInputID InputID = -1
+
 // Core glues Editor, UI and Emulation together, passing messages along as necessary
 type Core struct {
 	Editor    *Editor
 	UI        UI
 	Emulation Emulation
+
+	inputs  int       // number of additional inputs open
+	prompts []*prompt // questions to ask, the first one is shown once inputs are closed
+	quit    bool
 }
 
 func NewCore(e *Editor, ui UI, em Emulation) *Core {
@@ -40,14 +54,87 @@ func (c *Core) Loop() {
 	c.Emulation.SetChan(emuChan)
 	c.UI.Render()
 	c.UI.Loop(uiChan)
+	defer c.Editor.each(c.Editor.CancelLoad)
+
+	watch := time.NewTicker(WatchInterval)
+	defer watch.Stop()
+
+	// askInput opens an additional input in the UI for the emulation or core
+	askInput := func(id InputID, prompt string) {
+		source := c.UI.AskInput(prompt)
+		log.Printf("AskInput: %s -> %d", prompt, source)
+		ui2emu[source] = id
+		emu2ui[id] = source
+		c.inputs++
+	}
+	// nextPrompt shows the first pending prompt, if possible
+	nextPrompt := func() {
+		if c.inputs == 0 && len(c.prompts) > 0 {
+			askInput(CoreInputID, c.prompts[0].text)
+		}
+	}
+	closeInput := func(id InputID) {
+		c.UI.CloseInput(emu2ui[id])
+		c.inputs--
+		nextPrompt()
+	}
+
+	// fileChanged reports a file that changed on disk, asking what to do
+	// with a modified file once any open input (e.g. the ex command line) is closed
+	fileChanged := func(e *FileChangedEvent) {
+		log.Printf("FileChangedEvent %s %v", e.Name, e.Removed)
+		if e.Removed {
+			c.UI.SetError(fmt.Sprintf("E211: File \"%s\" no longer available", e.Name))
+		} else {
+			c.prompts = append(c.prompts, c.fileChangedPrompt(e))
+			nextPrompt()
+		}
+	}
+
+	// checkSwap asks what to do with a swap file found for the current document
+	checkSwap := func() {
+		if swap := c.Editor.SwapFound(); swap != nil {
+			emuChan <- &SwapFoundEvent{Name: c.Editor.GetFilename(), Swap: swap}
+		}
+	}
+	checkSwap()
+	swapTimer := time.NewTicker(SwapInterval)
+	defer swapTimer.Stop()
+
 main:
 	for {
 		width, _ := c.UI.GetDimension()
 		status := c.Emulation.GetStatus(width)
+		if progress, loading := c.Editor.LoadProgress(); loading {
+			status = fmt.Sprintf("Loading %d%% ", progress) + status
+		}
 		c.UI.SetStatus(status)
 		c.UI.Render()
 		select {
 
+		case batch := <-c.Editor.Loading():
+			if err := c.Editor.HandleLoadBatch(batch); err != nil {
+				c.UI.SetError(err.Error())
+			}
+
+		case <-swapTimer.C:
+			if err := c.Editor.FlushSwap(); err != nil {
+				c.UI.SetError(err.Error())
+			}
+
+		case <-watch.C:
+			if len(c.prompts) > 0 {
+				break
+			}
+			for _, d := range c.Editor.Documents() {
+				switch c.Editor.CheckDocument(d) {
+				case FileModified:
+					fileChanged(&FileChangedEvent{Name: d.Name(), Number: d.Number()})
+				case FileRemoved:
+					fileChanged(&FileChangedEvent{Name: d.Name(), Number: d.Number(), Removed: true})
+				}
+			}
+
 		case ev := <-uiChan:
 			// Filter event on what emulation subscribes to
 			// invoke plugins/extensions in some order
@@ -58,6 +145,16 @@ main:
 				id, ok := ui2emu[e.GetSource()]
 				if !ok {
 					log.Printf("Got event from unmapped source: %d", e.GetSource())
+				} else if id == CoreInputID {
+					if done, text := c.prompts[0].handle(e); done {
+						c.prompts = c.prompts[1:]
+						closeInput(CoreInputID)
+					} else {
+						c.UI.UpdateInput(e.GetSource(), text, len(text))
+					}
+					if c.quit {
+						break main
+					}
 				} else if !c.Emulation.HandleEvent(id, e) {
 					break main
 				}
@@ -66,33 +163,78 @@ main:
 			switch e := ev.(type) {
 			// other events we can handle here: quit, save file, open file
 			case *AskInputEvent:
-				id := c.UI.AskInput(e.Prompt)
-				log.Printf("Received AskInputEvent: %s -> %d", e.Prompt, id)
-				ui2emu[id] = e.ID
-				emu2ui[e.ID] = id
+				log.Printf("Received AskInputEvent: %s", e.Prompt)
+				askInput(e.ID, e.Prompt)
 			case *CloseInputEvent:
 				log.Printf("Core: CloseEvent %d", e.ID)
-				source := emu2ui[e.ID]
-				c.UI.CloseInput(source)
+				closeInput(e.ID)
 			case *UpdateInputEvent:
 				source := emu2ui[e.ID]
 				c.UI.UpdateInput(source, e.Text, e.Pos)
 			case *SaveEvent:
-				log.Printf("SaveEvent %s %v", e.Name, e.Force)
-				if err := c.Editor.SaveFile(e.Name, e.Force); err != nil {
+				log.Printf("SaveEvent %s %v %v", e.Name, e.Force, e.All)
+				var err error
+				if e.All {
+					err = c.Editor.SaveAll(e.Force)
+				} else if e.Partial {
+					err = c.Editor.WriteLines(e.Name, e.Start, e.End, e.Force)
+				} else {
+					err = c.Editor.SaveFile(e.Name, e.Force)
+				}
+				if err != nil {
 					c.UI.SetError("Could not save: " + err.Error())
 				}
+			case *EditEvent:
+				log.Printf("EditEvent %s %v", e.Name, e.Force)
+				if err := c.Editor.Edit(e.Name, e.Force); err != nil {
+					c.UI.SetError(err.Error())
+				}
+				checkSwap()
+			case *BufferEvent:
+				log.Printf("BufferEvent %d %d %v", e.Op, e.Number, e.Force)
+				current := c.Editor.Document
+				var err error
+				switch e.Op {
+				case BufferNext:
+					err = c.Editor.NextDocument(1)
+				case BufferPrevious:
+					err = c.Editor.NextDocument(-1)
+				case BufferGoto:
+					err = c.Editor.SwitchTo(e.Number)
+				case BufferDelete:
+					err = c.Editor.CloseDocument(e.Number, e.Force)
+				case BufferList:
+					c.UI.SetError(strings.Join(c.Editor.ListDocuments(), " | "))
+				}
+				if err != nil {
+					c.UI.SetError(err.Error())
+				}
+				if c.Editor.Document != current {
+					checkSwap()
+				}
 			case *QuitEvent:
 				log.Printf("QuitEvent %v", e.Force)
-				if c.Editor.Buffer.Modified && !e.Force {
+				if e.Force {
+					break main
+				}
+				if c.Editor.Buffer.Modified {
 					c.UI.SetError("Unsaved changes, please save first or use q!")
+				} else if modified := c.Editor.ModifiedDocuments(); len(modified) > 0 {
+					c.UI.SetError(fmt.Sprintf("E162: No write since last change for buffer \"%s\"", modified[0].Name()))
 				} else {
 					break main
 				}
 			case *ErrorEvent:
 				c.UI.SetError(e.Message)
 				log.Printf("ErrorEvent %s", e.Message)
+			case *FileChangedEvent:
+				fileChanged(e)
+			case *SwapFoundEvent:
+				log.Printf("SwapFoundEvent %s %s", e.Name, e.Swap.Path)
+				c.prompts = append(c.prompts, c.swapFoundPrompt(e))
+				nextPrompt()
 			}
 		}
 	}
+	c.Editor.CloseSwap()
 }
@@ -17,6 +17,10 @@ package novi
  *
  * Depending on those modifications, cursus before/after that C and possibly C
  * itself needs updating
+ *
+ * The buffer reports every modification as a Change which is used to adjust
+ * tracked cursors (see Buffer.Track and Cursor.Adjust in notify.go). The
+ * editor's cursors and selection are always tracked.
  */
 
 // Cursor defines a position within a buffer
@@ -49,8 +53,8 @@ func (c *Cursor) Validate() bool {
 		c.Line = 0
 		c.Pos = 0
 		valid = false
-	} else if c.Pos >= c.Buffer.Lines[c.Line].Len() {
-		c.Pos = c.Buffer.Lines[c.Line].Len() - 1
+	} else if c.Pos >= c.Buffer.GetLine(c.Line).Len() {
+		c.Pos = c.Buffer.GetLine(c.Line).Len() - 1
 		if c.Pos < 0 {
 			c.Pos = 0
 		}
@@ -0,0 +1,241 @@
+package novi
+
+import "fmt"
+
+/*
+ * A simple line based diff using Myers' algorithm, in linear space. Common
+ * lines at the start and end are skipped first, which keeps the typical "a
+ * few lines changed" case cheap even for large files.
+ */
+
+// DiffOp describes how a line in a diff changed
+type DiffOp int
+
+// The kinds of diff lines
+const (
+	DiffEqual DiffOp = iota
+	DiffDelete
+	DiffInsert
+)
+
+// DiffLine is a single line in a diff
+type DiffLine struct {
+	Op   DiffOp
+	Text string
+}
+
+// Diff returns the lines needed to turn a into b
+func Diff(a, b []string) []DiffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var res []DiffLine
+	for _, l := range a[:prefix] {
+		res = append(res, DiffLine{DiffEqual, l})
+	}
+	res = append(res, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, l := range a[len(a)-suffix:] {
+		res = append(res, DiffLine{DiffEqual, l})
+	}
+	return res
+}
+
+// myers calculates the shortest edit script from a to b. It uses the linear
+// space variant: the middle snake of the path splits it into two smaller
+// diffs, so only two vectors are kept instead of one for every edit
+func myers(a, b []string) []DiffLine {
+	var res []DiffLine
+	diffInto(&res, a, b)
+	return res
+}
+
+// diffInto appends the edit script from a to b to res
+func diffInto(res *[]DiffLine, a, b []string) {
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		*res = append(*res, DiffLine{DiffEqual, a[0]})
+		a, b = a[1:], b[1:]
+	}
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	end := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	switch {
+	case len(a) == 0:
+		for _, l := range b {
+			*res = append(*res, DiffLine{DiffInsert, l})
+		}
+	case len(b) == 0:
+		for _, l := range a {
+			*res = append(*res, DiffLine{DiffDelete, l})
+		}
+	default:
+		// both differ at the start and the end, so at least two edits are
+		// needed and both halves are smaller
+		x, y, u, v := middleSnake(a, b)
+		diffInto(res, a[:x], b[:y])
+		for _, l := range a[x:u] {
+			*res = append(*res, DiffLine{DiffEqual, l})
+		}
+		diffInto(res, a[u:], b[v:])
+	}
+	for _, l := range end {
+		*res = append(*res, DiffLine{DiffEqual, l})
+	}
+}
+
+// middleSnake finds the snake (a diagonal of equal lines) in the middle of
+// the shortest edit script from a to b, from (x, y) up to (u, v). The path is
+// searched from both ends until they overlap. The backward search counts
+// lines from the end of a and b
+func middleSnake(a, b []string) (int, int, int, int) {
+	n, m := len(a), len(b)
+	max := (n + m + 1) / 2
+	delta := n - m
+	odd := delta%2 != 0
+	offset := max + 1
+	forward := make([]int, 2*max+3)
+	backward := make([]int, 2*max+3)
+
+	for d := 0; d <= max; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && forward[offset+k-1] < forward[offset+k+1] {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			sx, sy := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			if rk := delta - k; odd && rk >= -(d-1) && rk <= d-1 && x+backward[offset+rk] >= n {
+				return sx, sy, x, y
+			}
+		}
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && backward[offset+k-1] < backward[offset+k+1] {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			sx, sy := x, y
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			if fk := delta - k; !odd && fk >= -d && fk <= d && x+forward[offset+fk] >= n {
+				return n - x, m - y, n - sx, m - sy
+			}
+		}
+	}
+	// not reached, the paths always overlap
+	return 0, 0, 0, 0
+}
+
+// DiffStat returns the number of inserted and deleted lines in a diff
+func DiffStat(diff []DiffLine) (int, int) {
+	inserted, deleted := 0, 0
+	for _, l := range diff {
+		switch l.Op {
+		case DiffInsert:
+			inserted++
+		case DiffDelete:
+			deleted++
+		}
+	}
+	return inserted, deleted
+}
+
+// UnifiedDiff formats a diff in unified diff format with the given number
+// of context lines
+func UnifiedDiff(aName, bName string, diff []DiffLine, context int) []string {
+	if ins, del := DiffStat(diff); ins == 0 && del == 0 {
+		return nil
+	}
+	res := []string{"--- " + aName, "+++ " + bName}
+
+	// aLine/bLine track the line numbers at each position in the diff
+	aLine := make([]int, len(diff)+1)
+	bLine := make([]int, len(diff)+1)
+	for i, l := range diff {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if l.Op != DiffInsert {
+			aLine[i+1]++
+		}
+		if l.Op != DiffDelete {
+			bLine[i+1]++
+		}
+	}
+
+	for i := 0; i < len(diff); {
+		if diff[i].Op == DiffEqual {
+			i++
+			continue
+		}
+		// find the end of the hunk: a change followed by more than 2*context equal lines
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(diff) {
+			if diff[end].Op != DiffEqual {
+				end++
+				continue
+			}
+			equal := end
+			for equal < len(diff) && diff[equal].Op == DiffEqual {
+				equal++
+			}
+			if equal == len(diff) || equal-end > 2*context {
+				end += context
+				if end > len(diff) {
+					end = len(diff)
+				}
+				break
+			}
+			end = equal
+		}
+
+		res = append(res, fmt.Sprintf("@@ -%s +%s @@",
+			hunkRange(aLine[start], aLine[end]-aLine[start]),
+			hunkRange(bLine[start], bLine[end]-bLine[start])))
+		for _, l := range diff[start:end] {
+			switch l.Op {
+			case DiffEqual:
+				res = append(res, " "+l.Text)
+			case DiffDelete:
+				res = append(res, "-"+l.Text)
+			case DiffInsert:
+				res = append(res, "+"+l.Text)
+			}
+		}
+		i = end
+	}
+	return res
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
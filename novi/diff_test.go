@@ -0,0 +1,140 @@
+package novi
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	t.Run("Identical", func(t *testing.T) {
+		diff := Diff([]string{"a", "b"}, []string{"a", "b"})
+		if ins, del := DiffStat(diff); ins != 0 || del != 0 || len(diff) != 2 {
+			t.Errorf("Expected no changes, got %v", diff)
+		}
+	})
+	t.Run("Changes", func(t *testing.T) {
+		a := strings.Split("a b c d e f g", " ")
+		b := strings.Split("a x c d f g h", " ")
+		diff := Diff(a, b)
+
+		var from, to []string
+		for _, l := range diff {
+			if l.Op != DiffInsert {
+				from = append(from, l.Text)
+			}
+			if l.Op != DiffDelete {
+				to = append(to, l.Text)
+			}
+		}
+		if strings.Join(from, " ") != strings.Join(a, " ") || strings.Join(to, " ") != strings.Join(b, " ") {
+			t.Errorf("Diff doesn't reproduce input: %v", diff)
+		}
+		if ins, del := DiffStat(diff); ins != 2 || del != 2 {
+			t.Errorf("Expected 2 insertions and 2 deletions, got %d %d", ins, del)
+		}
+	})
+	t.Run("Shortest", func(t *testing.T) {
+		// compare the number of edits to the longest common subsequence
+		r := rand.New(rand.NewSource(1))
+		random := func() []string {
+			res := make([]string, r.Intn(30))
+			for i := range res {
+				res[i] = string(rune('a' + r.Intn(4)))
+			}
+			return res
+		}
+		for i := 0; i < 200; i++ {
+			a, b := random(), random()
+			lcs := make([][]int, len(a)+1)
+			for x := range lcs {
+				lcs[x] = make([]int, len(b)+1)
+			}
+			for x := len(a) - 1; x >= 0; x-- {
+				for y := len(b) - 1; y >= 0; y-- {
+					switch {
+					case a[x] == b[y]:
+						lcs[x][y] = lcs[x+1][y+1] + 1
+					case lcs[x+1][y] > lcs[x][y+1]:
+						lcs[x][y] = lcs[x+1][y]
+					default:
+						lcs[x][y] = lcs[x][y+1]
+					}
+				}
+			}
+			diff := Diff(a, b)
+			var from, to []string
+			for _, l := range diff {
+				if l.Op != DiffInsert {
+					from = append(from, l.Text)
+				}
+				if l.Op != DiffDelete {
+					to = append(to, l.Text)
+				}
+			}
+			ins, del := DiffStat(diff)
+			if strings.Join(from, "") != strings.Join(a, "") || strings.Join(to, "") != strings.Join(b, "") ||
+				ins+del != len(a)+len(b)-2*lcs[0][0] {
+				t.Fatalf("Not the shortest diff from %v to %v: %v", a, b, diff)
+			}
+		}
+	})
+	t.Run("Large with scattered changes", func(t *testing.T) {
+		a := make([]string, 50000)
+		b := make([]string, 50000)
+		for i := range a {
+			a[i] = fmt.Sprintf("line %d", i)
+			b[i] = a[i]
+			if i%10 == 0 {
+				b[i] = "changed"
+			}
+		}
+		if ins, del := DiffStat(Diff(a, b)); ins != 5000 || del != 5000 {
+			t.Errorf("Expected 5000 changed lines, got %d %d", ins, del)
+		}
+	})
+	t.Run("Empty", func(t *testing.T) {
+		if ins, del := DiffStat(Diff(nil, []string{"a", "b"})); ins != 2 || del != 0 {
+			t.Errorf("Expected 2 insertions, got %d %d", ins, del)
+		}
+		if ins, del := DiffStat(Diff([]string{"a", "b"}, nil)); ins != 0 || del != 2 {
+			t.Errorf("Expected 2 deletions, got %d %d", ins, del)
+		}
+	})
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := buildLines(20)
+	b := append([]string(nil), a...)
+	b[2] = "changed"
+	b = append(b[:15], b[16:]...)
+
+	expected := []string{
+		"--- a",
+		"+++ b",
+		"@@ -1,6 +1,6 @@",
+		" " + a[0],
+		" " + a[1],
+		"-" + a[2],
+		"+changed",
+		" " + a[3],
+		" " + a[4],
+		" " + a[5],
+		"@@ -13,7 +13,6 @@",
+		" " + a[12],
+		" " + a[13],
+		" " + a[14],
+		"-" + a[15],
+		" " + a[16],
+		" " + a[17],
+		" " + a[18],
+	}
+	res := UnifiedDiff("a", "b", Diff(a, b), 3)
+	if strings.Join(res, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected diff:\n%s", strings.Join(res, "\n"))
+	}
+	if UnifiedDiff("a", "b", Diff(a, a), 3) != nil {
+		t.Error("Expected no diff for identical input")
+	}
+}
@@ -0,0 +1,226 @@
+package novi
+
+import (
+	"github.com/mattn/go-runewidth"
+	"github.com/rivo/uniseg"
+)
+
+/*
+ * Lines are stored as runes, but they're shown in screen columns. A tab
+ * takes up the columns up to the next tab stop, East Asian wide characters
+ * and most emoji take two columns and a grapheme cluster (e.g. a letter
+ * followed by combining accents, or an emoji sequence) is a single cell on
+ * the screen. Control characters are shown as ^X.
+ *
+ * Cursors keep using rune positions, Column and PosAt translate between the
+ * two. A cursor inside a grapheme cluster is shown on the cluster.
+ */
+
+// DefaultTabStop is the width of a tab if ViewOptions.TabStop isn't set
+const DefaultTabStop = 8
+
+// Cell is a grapheme cluster as it's shown on the screen
+type Cell struct {
+	Pos   int    // the position of its first rune in the line
+	Runes []rune // the runes in the cluster
+	Col   int    // the first screen column
+	Width int    // the number of screen columns it takes
+}
+
+// Expanded returns true if the cell isn't shown as its runes, but as Text:
+// a rune for every column
+func (c Cell) Expanded() bool {
+	return c.Runes[0] == '\t' || isControl(c.Runes[0])
+}
+
+// Text returns the runes to show for a cell. If it's Expanded there's one
+// for every column, otherwise they're a single grapheme cluster
+func (c Cell) Text() []rune {
+	switch r := c.Runes[0]; {
+	case r == '\t':
+		text := make([]rune, c.Width)
+		for i := range text {
+			text[i] = ' '
+		}
+		return text
+	case isControl(r):
+		return []rune{'^', r ^ 0x40}
+	}
+	return c.Runes
+}
+
+// isControl returns true for the characters that are shown as ^X
+func isControl(r rune) bool {
+	return r < ' ' && r != '\t' || r == 0x7f
+}
+
+// simpleRune returns true if r always takes a single column by itself
+func simpleRune(r rune) bool {
+	return r >= ' ' && r < 0x7f
+}
+
+// TabWidth returns the width of a tab
+func (o ViewOptions) TabWidth() int {
+	if o.TabStop <= 0 {
+		return DefaultTabStop
+	}
+	return o.TabStop
+}
+
+// cellWidth returns the width of the cluster runes when it starts at col
+func (o ViewOptions) cellWidth(runes []rune, col int) int {
+	switch r := runes[0]; {
+	case r == '\t':
+		return o.TabWidth() - col%o.TabWidth()
+	case isControl(r):
+		return 2
+	}
+	// the width of a cluster is that of its base character, e.g. an emoji
+	// sequence joined by zero width joiners takes two columns
+	for _, r := range runes {
+		if w := runewidth.RuneWidth(r); w > 0 {
+			return w
+		}
+	}
+	// a combining character on its own
+	return 1
+}
+
+// eachCell calls fn for the cells of a line in order, until it returns
+// false. Only the part of the line that's needed is segmented: two simple
+// runes are always separate cells, so uniseg only runs on the stretches in
+// between
+func (o ViewOptions) eachCell(l *Line, fn func(Cell) bool) {
+	runes := l.AllRunes()
+	pos, col := 0, 0
+	for pos < len(runes) {
+		if simpleRune(runes[pos]) && (pos+1 == len(runes) || simpleRune(runes[pos+1])) {
+			if !fn(Cell{Pos: pos, Runes: runes[pos : pos+1], Col: col, Width: 1}) {
+				return
+			}
+			pos++
+			col++
+			continue
+		}
+		end := pos + 1
+		for end < len(runes) && !(simpleRune(runes[end-1]) && simpleRune(runes[end])) {
+			end++
+		}
+		g := uniseg.NewGraphemes(string(runes[pos:end]))
+		for g.Next() {
+			cluster := g.Runes()
+			for len(cluster) > 0 {
+				w := o.cellWidth(cluster, col)
+				n := len(cluster)
+				if cluster[0] == '\t' || isControl(cluster[0]) {
+					// uniseg keeps \r\n together, but they're separate cells
+					n = 1
+				}
+				if !fn(Cell{Pos: pos, Runes: runes[pos : pos+n], Col: col, Width: w}) {
+					return
+				}
+				pos += n
+				col += w
+				cluster = cluster[n:]
+			}
+		}
+	}
+}
+
+// Cells returns the cells a line is shown in
+func (o ViewOptions) Cells(l *Line) []Cell {
+	cells := make([]Cell, 0, l.Len())
+	o.eachCell(l, func(cell Cell) bool {
+		cells = append(cells, cell)
+		return true
+	})
+	return cells
+}
+
+// Column returns the screen column rune pos of a line is shown at. A
+// position past the end of the line is in the columns after it
+func (o ViewOptions) Column(l *Line, pos int) int {
+	runes := l.AllRunes()
+	end := pos
+	if end > len(runes) {
+		end = len(runes)
+	}
+	simple := true
+	for _, r := range runes[:end] {
+		if !simpleRune(r) {
+			simple = false
+			break
+		}
+	}
+	if simple && (end == len(runes) || simpleRune(runes[end])) {
+		return pos
+	}
+	col, width := -1, 0
+	o.eachCell(l, func(cell Cell) bool {
+		if cell.Pos+len(cell.Runes) > pos {
+			col = cell.Col
+			return false
+		}
+		width = cell.Col + cell.Width
+		return true
+	})
+	if col >= 0 {
+		return col
+	}
+	return width + pos - len(runes)
+}
+
+// Span returns the screen columns the cell containing rune pos of a line
+// takes, from the first up to (not including) the second. A position past
+// the end of the line takes a single column
+func (o ViewOptions) Span(l *Line, pos int) (int, int) {
+	if pos < l.Len() {
+		start, end := 0, 0
+		o.eachCell(l, func(cell Cell) bool {
+			start, end = cell.Col, cell.Col+cell.Width
+			return cell.Pos+len(cell.Runes) <= pos
+		})
+		return start, end
+	}
+	col := o.Column(l, pos)
+	return col, col + 1
+}
+
+// Width returns the number of screen columns a line takes
+func (o ViewOptions) Width(l *Line) int {
+	width := 0
+	o.eachCell(l, func(cell Cell) bool {
+		width = cell.Col + cell.Width
+		return true
+	})
+	return width
+}
+
+// PosAt returns the position of the rune shown at screen column col, or the
+// first rune of a cell that covers it. Columns past the end of the line
+// return the length of the line
+func (o ViewOptions) PosAt(l *Line, col int) int {
+	pos := l.Len()
+	o.eachCell(l, func(cell Cell) bool {
+		if col < cell.Col+cell.Width {
+			pos = cell.Pos
+			return false
+		}
+		return true
+	})
+	return pos
+}
+
+// NextPos returns the position of the first rune shown at or after screen
+// column col, or the length of the line if there's none
+func (o ViewOptions) NextPos(l *Line, col int) int {
+	pos := l.Len()
+	o.eachCell(l, func(cell Cell) bool {
+		if cell.Col >= col {
+			pos = cell.Pos
+			return false
+		}
+		return true
+	})
+	return pos
+}
@@ -0,0 +1,78 @@
+package novi
+
+import "testing"
+
+func TestCells(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		line   string
+		cols   []int // the column of every cell
+		widths []int
+	}{
+		{"Plain", "abc", []int{0, 1, 2}, []int{1, 1, 1}},
+		{"Tab", "a\tb", []int{0, 1, 8}, []int{1, 7, 1}},
+		{"Tab on a stop", "\t\tb", []int{0, 8, 16}, []int{8, 8, 1}},
+		{"Wide", "a日本b", []int{0, 1, 3, 5}, []int{1, 2, 2, 1}},
+		{"Combining", "e\u0301x", []int{0, 1}, []int{1, 1}},
+		{"Emoji sequence", "\U0001F468‍\U0001F469x", []int{0, 2}, []int{2, 1}},
+		{"Control", "a\x01b", []int{0, 1, 3}, []int{1, 2, 1}},
+		{"Mixed", "ab\u0301cd日\r\nx", []int{0, 1, 2, 3, 4, 6, 8, 10}, []int{1, 1, 1, 1, 2, 2, 2, 1}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cells := ViewOptions{}.Cells(NewLineFromString(tc.line))
+			if len(cells) != len(tc.cols) {
+				t.Fatalf("Expected %d cells, got %d", len(tc.cols), len(cells))
+			}
+			for i, cell := range cells {
+				if cell.Col != tc.cols[i] || cell.Width != tc.widths[i] {
+					t.Errorf("Expected cell %d at %d width %d, got %d width %d",
+						i, tc.cols[i], tc.widths[i], cell.Col, cell.Width)
+				}
+			}
+		})
+	}
+	t.Run("Control text", func(t *testing.T) {
+		cells := ViewOptions{}.Cells(NewLineFromString("\x1b"))
+		if s := string(cells[0].Text()); s != "^[" {
+			t.Errorf("Expected ^[, got %q", s)
+		}
+	})
+	t.Run("Tabstop", func(t *testing.T) {
+		opts := ViewOptions{TabStop: 4}
+		if w := opts.Width(NewLineFromString("ab\tc")); w != 5 {
+			t.Errorf("Expected width 5, got %d", w)
+		}
+	})
+}
+
+func TestColumns(t *testing.T) {
+	opts := ViewOptions{}
+	l := NewLineFromString("a\t日e\u0301")
+	for _, tc := range []struct {
+		pos, col int
+	}{
+		{0, 0}, {1, 1}, {2, 8}, {3, 10}, {4, 10}, {5, 11}, {7, 13},
+	} {
+		if col := opts.Column(l, tc.pos); col != tc.col {
+			t.Errorf("Expected pos %d at column %d, got %d", tc.pos, tc.col, col)
+		}
+	}
+	for _, tc := range []struct {
+		col, pos, next int
+	}{
+		{0, 0, 0}, {1, 1, 1}, {4, 1, 2}, {8, 2, 2}, {9, 2, 3}, {10, 3, 3}, {11, 5, 5},
+	} {
+		if pos := opts.PosAt(l, tc.col); pos != tc.pos {
+			t.Errorf("Expected column %d at pos %d, got %d", tc.col, tc.pos, pos)
+		}
+		if next := opts.NextPos(l, tc.col); next != tc.next {
+			t.Errorf("Expected next pos %d for column %d, got %d", tc.next, tc.col, next)
+		}
+	}
+	if start, end := opts.Span(l, 1); start != 1 || end != 8 {
+		t.Errorf("Expected tab to span 1-8, got %d-%d", start, end)
+	}
+	if start, end := opts.Span(l, 4); start != 10 || end != 11 {
+		t.Errorf("Expected combining mark to span 10-11, got %d-%d", start, end)
+	}
+}
@@ -1,9 +1,10 @@
 package novi
 
 import (
-	"bufio"
-	"errors"
+	"crypto/sha256"
 	"fmt"
+	"hash"
+	"io"
 	"os"
 
 	"github.com/iivvoo/novi/logger"
@@ -29,11 +30,14 @@ import (
 
 var log = logger.GetLogger("editor")
 
-// Selection contains the start/end of a selection
+// Selection contains the start/end of a selection. A block selection
+// contains the screen columns from startCol up to endCol on every line
 type Selection struct {
 	start Cursor
 	end   Cursor
 
+	startCol, endCol int
+
 	block   bool
 	enabled bool
 }
@@ -52,6 +56,12 @@ func (s *Selection) SetBlock(b bool) {
 	s.block = b
 }
 
+// SetColumns sets the screen columns of a block selection, from start up to
+// (not including) end
+func (s *Selection) SetColumns(start, end int) {
+	s.startCol, s.endCol = start, end
+}
+
 func (s *Selection) Enabled() bool {
 	return s.enabled
 }
@@ -64,27 +74,22 @@ func (s *Selection) Disable() {
 	s.enabled = false
 }
 
-// InSelection returns true if there's a selection and (line, pos) is in the selection
-func (s *Selection) InSelection(line, pos int) bool {
+// InSelection returns true if there's a selection and (line, pos) is in the
+// selection. col is the screen column pos is shown at, a block selection
+// depends on that
+func (s *Selection) InSelection(line, pos, col int) bool {
 	if !s.enabled {
 		return false
 	}
+	if s.block {
+		return line >= s.start.Line && line <= s.end.Line && col >= s.startCol && col < s.endCol
+	}
 	if line < s.start.Line || line == s.start.Line && pos < s.start.Pos {
 		return false
 	}
 	if line > s.end.Line || line == s.end.Line && pos > s.end.Pos {
 		return false
 	}
-
-	if s.block {
-		log.Printf("Block selection")
-		if pos < s.start.Pos {
-			return false
-		}
-		if pos > s.end.Pos {
-			return false
-		}
-	}
 	return true
 }
 
@@ -92,104 +97,225 @@ func (s *Selection) ToString() string {
 	return fmt.Sprintf("from %d/%d to %d/%d", s.start.Line, s.start.Pos, s.end.Line, s.end.Pos)
 }
 
-type Editor struct {
+// Document is a single buffer in the editor, together with the file it's
+// loaded from and the cursors in it
+type Document struct {
+	number    int
 	filename  string
+	loaded    bool
 	Buffer    *Buffer
 	Cursors   Cursors
 	Selection Selection
+	Viewport  Viewport
+	Syntax    *Syntax // nil if the document isn't highlighted
+
+	stopLoading chan struct{} // set while loading in the background
+	loadSize    int64
+	loadRead    int64
+	loadHash    hash.Hash
+	readErr     error // set if the file couldn't be read completely
+
+	disk fileState // the file the buffer is based on
+	seen fileState // the file as last reported by CheckFile
+
+	swap      *swapFile
+	swapFound *SwapInfo
 }
 
-func NewEditor() *Editor {
-	e := &Editor{Buffer: NewBuffer().InitializeEmptyBuffer()}
-	e.Cursors = append(e.Cursors, e.Buffer.NewCursor(-1, 0))
-	return e
+func newDocument(number int) *Document {
+	d := &Document{number: number, loaded: true, Buffer: NewBuffer().InitializeEmptyBuffer()}
+	d.Cursors = append(d.Cursors, d.Buffer.NewCursor(0, 0))
+	d.Buffer.Subscribe(ListenerFunc(d.bufferChanged))
+	return d
 }
 
-func (e *Editor) GetFilename() string {
-	return e.filename
+// bufferChanged keeps the cursors and selection in place when the buffer changes
+func (d *Document) bufferChanged(b *Buffer, ch *Change) {
+	d.Cursors.Adjust(ch)
+	if d.Selection.enabled && ch != nil {
+		d.Selection.start.Adjust(ch)
+		d.Selection.end.Adjust(ch)
+	}
 }
 
-func (e *Editor) LoadFile(name string) {
-	// reset everything
+// Editor holds the documents being edited. The current document is embedded,
+// so e.g. e.Buffer and e.Cursors refer to the buffer and cursors being edited
+type Editor struct {
+	*Document
+	documents  []*Document
+	lastNumber int
 
-	file, err := os.Open(name)
-	if err != nil && !os.IsNotExist(err) {
-		panic(err)
-	}
+	SaveOptions SaveOptions
+	SwapOptions SwapOptions
+	ViewOptions ViewOptions
 
-	e.Buffer.LoadFile(file)
-	e.filename = name
-	e.Buffer.Modified = false
+	Highlight *Search // the matches of this search are highlighted, if set
+
+	loaded         chan *LoadBatch // the batches loaded for all documents
+	closeListeners []func(*Document)
 }
 
-var (
-	ErrSaveNoName         = errors.New("No filename set")
-	ErrSaveNoBackup       = errors.New("Could not create backup")
-	ErrSaveFailedCreate   = errors.New("Could not create file")
-	ErrSaveWrite          = errors.New("Failed to write contents")
-	ErrSaveWouldOverwrite = errors.New("Not overwriting existing file")
-	ErrSaveOther          = errors.New("Other error")
-)
+func NewEditor() *Editor {
+	e := &Editor{loaded: make(chan *LoadBatch, 4)}
+	e.Document = e.newDocument()
+	return e
+}
+
+// newDocument adds a new, empty document to the editor
+func (e *Editor) newDocument() *Document {
+	e.lastNumber++
+	d := newDocument(e.lastNumber)
+	e.documents = append(e.documents, d)
+	return d
+}
 
-// SaveFile saves the buffer to a file
-func (e *Editor) SaveFile(name string, force bool) error {
-	changed := name != "" && e.filename != name
-	exists := true
+// GetFilename returns the name of the file the document is loaded from
+func (d *Document) GetFilename() string {
+	return d.filename
+}
 
-	if name != "" {
-		e.filename = name
-	}
+// LoadFile loads a file into the editor. A file that doesn't exist yet results
+// in an empty buffer
+func (e *Editor) LoadFile(name string) error {
+	e.CancelLoad()
+	e.filename = name
+	e.readErr = nil
+	e.SetLexer(LexerFor(name))
 
-	if _, err := os.Stat(e.filename); err != nil {
-		if os.IsNotExist(err) {
-			exists = false
-		} else {
-			return ErrSaveOther
-		}
+	file, err := os.Open(name)
+	if os.IsNotExist(err) {
+		e.Buffer.LoadStrings(nil)
+		e.Buffer.Format = DefaultFileFormat
+		e.Buffer.MarkSaved()
+		e.recordFile(name, nil)
+		e.openSwap()
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("Could not open %s: %w", name, err)
 	}
+	defer file.Close()
 
-	// only overwrite existing file
-	if changed && exists && !force {
-		if _, err := os.Stat(e.filename); err == nil || !os.IsNotExist(err) {
-			return ErrSaveWouldOverwrite
-		}
+	h := sha256.New()
+	err = e.Buffer.LoadFile(io.TeeReader(file, h))
+	e.Buffer.MarkSaved()
+	e.recordFile(name, h)
+	e.openSwap()
+	if err != nil {
+		e.readErr = err
+		return fmt.Errorf("Could not read %s: %w", name, err)
 	}
+	return nil
+}
 
-	if e.filename == "" {
-		log.Println("No filename set on buffer, can't save")
-		return ErrSaveNoName
-	}
+// LoadFileAsync starts loading a file in the background. The first batch of lines
+// is loaded immediately, the rest is passed to the Core loop through Loading().
+// Loading continues when another document is made current
+func (e *Editor) LoadFileAsync(name string) error {
+	e.CancelLoad()
+	e.filename = name
+	e.readErr = nil
+	e.SetLexer(LexerFor(name))
 
-	if exists {
-		if err := CopyFile(e.filename, e.filename+".bak"); err != nil {
-			log.Printf("Failed to make backup copy for %s: %v", e.filename, err)
-			return ErrSaveNoBackup
-		}
+	file, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return e.LoadFile(name)
+	} else if err != nil {
+		return fmt.Errorf("Could not open %s: %w", name, err)
 	}
-	f, err := os.Create(e.filename)
+	info, err := file.Stat()
 	if err != nil {
-		log.Printf("Failed to open/create %s: %v", e.filename, err)
-		return ErrSaveFailedCreate
+		file.Close()
+		return fmt.Errorf("Could not stat %s: %w", name, err)
 	}
-	defer f.Close()
 
-	w := bufio.NewWriter(f)
+	// the first batch is handled here, the rest goes to the editor's channel,
+	// tagged with the document and the load it belongs to
+	first := make(chan *LoadBatch, 1)
+	d := e.Document
+	stop := make(chan struct{})
+	h := sha256.New()
+	go func() {
+		defer file.Close()
+		batches := first
+		readLines(io.TeeReader(file, h), func(batch *LoadBatch) bool {
+			batch.doc, batch.stop = d, stop
+			select {
+			case batches <- batch:
+				batches = e.loaded
+				return true
+			case <-stop:
+				return false
+			}
+		})
+	}()
+
+	e.stopLoading = stop
+	e.loadSize = info.Size()
+	e.loadRead = 0
+	e.loadHash = h
+	e.Buffer.startLoad(info.Size())
+	e.openSwap()
+
+	return e.HandleLoadBatch(<-first)
+}
 
-	for _, line := range e.Buffer.Lines {
-		if _, err := w.WriteString(line.ToString() + "\n"); err != nil {
-			log.Printf("Failed to Write %s: %v", e.filename, err)
-			return ErrSaveWrite
-		}
+// Loading returns the channel on which batches are passed while loading in the
+// background, for all documents
+func (e *Editor) Loading() <-chan *LoadBatch {
+	return e.loaded
+}
 
+// LoadProgress returns the percentage of the file that's loaded and if
+// loading is still in progress
+func (e *Editor) LoadProgress() (int, bool) {
+	if e.stopLoading == nil {
+		return 100, false
 	}
-	if err := w.Flush(); err != nil {
-		log.Printf("Failed to Flush %s: %v", e.filename, err)
+	if e.loadSize == 0 {
+		return 0, true
 	}
+	return int(e.loadRead * 100 / e.loadSize), true
+}
+
+// HandleLoadBatch adds a batch of lines that was loaded in the background
+// to the buffer of the document it was loaded for. It must be called from the
+// loop that owns the editor
+func (e *Editor) HandleLoadBatch(batch *LoadBatch) (err error) {
+	if batch.stop != batch.doc.stopLoading {
+		// loading was cancelled
+		return nil
+	}
+	e.with(batch.doc, func() { err = e.appendBatch(batch) })
+	return err
+}
 
-	e.Buffer.Modified = false
+// appendBatch adds a batch of lines to the current document
+func (e *Editor) appendBatch(batch *LoadBatch) error {
+	e.Buffer.appendLoaded(batch)
+	e.loadRead = batch.Read
+	if batch.Done {
+		e.stopLoading = nil
+		e.recordFile(e.filename, e.loadHash)
+		for _, c := range e.Cursors {
+			c.Validate()
+		}
+		if batch.Err != nil {
+			e.readErr = batch.Err
+			return fmt.Errorf("Could not read %s: %w", e.filename, batch.Err)
+		}
+	}
 	return nil
 }
 
+// CancelLoad stops loading a file in the background, if any
+func (e *Editor) CancelLoad() {
+	if e.stopLoading != nil {
+		close(e.stopLoading)
+	}
+	e.Buffer.loading = false
+	e.stopLoading = nil
+}
+
 // SetCursor sets the first cursor at a specific position
 func (e *Editor) SetCursor(row, col int) {
 	e.Cursors[0].Line = row
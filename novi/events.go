@@ -121,11 +121,59 @@ type QuitEvent struct {
 	Force bool
 }
 
+// SaveEvent asks the core to save the current document, or all modified
+// documents if All is set. If Partial is set only the lines from Start up to
+// and including End are written
 type SaveEvent struct {
+	Name    string
+	Force   bool
+	All     bool
+	Partial bool
+	Start   int
+	End     int
+}
+
+// EditEvent asks the core to edit a file, or to reload the current file if
+// Name is empty
+type EditEvent struct {
 	Name  string
 	Force bool
 }
 
+// BufferOp is an operation on the buffer list
+type BufferOp int
+
+// The operations a BufferEvent can ask for
+const (
+	BufferNext BufferOp = iota
+	BufferPrevious
+	BufferGoto
+	BufferDelete
+	BufferList
+)
+
+// BufferEvent asks the core to switch to, delete or list documents. Number
+// is the document to go to or delete, 0 means the current one
+type BufferEvent struct {
+	Op     BufferOp
+	Number int
+	Force  bool
+}
+
 type ErrorEvent struct {
 	Message string
 }
+
+// FileChangedEvent is raised when the file of a document changed on disk.
+// Number is the number of the document in the buffer list
+type FileChangedEvent struct {
+	Name    string
+	Number  int
+	Removed bool
+}
+
+// SwapFoundEvent is raised when a swap file was found for the file being edited
+type SwapFoundEvent struct {
+	Name string
+	Swap *SwapInfo
+}
@@ -0,0 +1,206 @@
+package novi
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// LineEnding identifies the line endings used in a file
+type LineEnding int
+
+// The supported line endings
+const (
+	EndingUnix LineEnding = iota // \n
+	EndingDos                    // \r\n
+	EndingMac                    // \r
+)
+
+var endingNames = map[LineEnding]string{
+	EndingUnix: "unix",
+	EndingDos:  "dos",
+	EndingMac:  "mac",
+}
+
+var endingSeparators = map[LineEnding]string{
+	EndingUnix: "\n",
+	EndingDos:  "\r\n",
+	EndingMac:  "\r",
+}
+
+// String returns the (vi) name of the line ending
+func (le LineEnding) String() string {
+	return endingNames[le]
+}
+
+// Separator returns the actual character(s) that end a line
+func (le LineEnding) Separator() string {
+	return endingSeparators[le]
+}
+
+// ParseLineEnding parses the name of a line ending (unix, dos or mac)
+func ParseLineEnding(name string) (LineEnding, error) {
+	for le, n := range endingNames {
+		if n == name {
+			return le, nil
+		}
+	}
+	return EndingUnix, fmt.Errorf("Invalid fileformat: %s", name)
+}
+
+const bom = "\xef\xbb\xbf"
+
+// FileFormat describes how the contents of a buffer are stored in a file
+type FileFormat struct {
+	Ending LineEnding
+	BOM    bool // the file starts with a utf-8 byte order mark
+	EOL    bool // the last line of the file ends with a line ending
+	FixEOL bool // always write a line ending after the last line
+}
+
+// DefaultFileFormat is the format for new files
+var DefaultFileFormat = FileFormat{Ending: EndingUnix, FixEOL: true}
+
+// SetFormat changes the format the buffer is saved in. This changes the
+// contents of the file, so the buffer stays modified until it's saved
+func (b *Buffer) SetFormat(f FileFormat) {
+	if f == b.Format {
+		return
+	}
+	b.Format = f
+	b.reformatted = true
+	b.Modified = true
+}
+
+// String returns a short description of the format, e.g. "dos,bom,noeol"
+func (f FileFormat) String() string {
+	s := f.Ending.String()
+	if f.BOM {
+		s += ",bom"
+	}
+	if !f.EOL && !f.FixEOL {
+		s += ",noeol"
+	}
+	return s
+}
+
+// formatDetector detects the file format from the raw lines (as read, including the
+// trailing '\n' if any) and strips line endings accordingly. The format is decided
+// on the first batch of lines
+type formatDetector struct {
+	format  FileFormat
+	decided bool
+}
+
+// lines converts raw lines into lines without line endings
+func (d *formatDetector) lines(raw []string) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	if !d.decided {
+		d.decide(raw)
+	}
+	// A file without any newlines but with carriage returns is an old mac file. Since
+	// it doesn't contain newlines, it will have been read as a single line
+	if d.format.Ending == EndingMac {
+		lines := strings.Split(raw[0], "\r")
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+			d.format.EOL = true
+		}
+		return lines
+	}
+
+	d.format.EOL = strings.HasSuffix(raw[len(raw)-1], "\n")
+	lines := make([]string, len(raw))
+	for i, l := range raw {
+		l = strings.TrimSuffix(l, "\n")
+		if d.format.Ending == EndingDos {
+			l = strings.TrimSuffix(l, "\r")
+		}
+		lines[i] = l
+	}
+	return lines
+}
+
+func (d *formatDetector) decide(raw []string) {
+	d.decided = true
+	d.format = DefaultFileFormat
+
+	if strings.HasPrefix(raw[0], bom) {
+		raw[0] = raw[0][len(bom):]
+		d.format.BOM = true
+	}
+
+	if len(raw) == 1 && !strings.HasSuffix(raw[0], "\n") && strings.ContainsRune(raw[0], '\r') {
+		d.format.Ending = EndingMac
+		return
+	}
+	// It's only a dos file if all lines that end in \n end in \r\n
+	for _, l := range raw {
+		if strings.HasSuffix(l, "\n") && !strings.HasSuffix(l, "\r\n") {
+			return
+		}
+	}
+	if len(raw) > 1 || strings.HasSuffix(raw[0], "\n") {
+		d.format.Ending = EndingDos
+	}
+}
+
+// Format returns the detected format
+func (d *formatDetector) Format() FileFormat {
+	if !d.decided {
+		// empty file
+		return DefaultFileFormat
+	}
+	return d.format
+}
+
+// Save writes the buffer to w, honouring the buffer's file format
+func (b *Buffer) Save(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	sep := b.Format.Ending.Separator()
+
+	if b.Format.BOM {
+		if _, err := bw.WriteString(bom); err != nil {
+			return err
+		}
+	}
+	// An "empty" buffer that was loaded from an empty file stays empty
+	empty := b.Length() == 1 && b.GetLine(0).Len() == 0 && !b.Format.EOL
+
+	for i, line := range b.Strings() {
+		if empty {
+			break
+		}
+		if _, err := bw.WriteString(line); err != nil {
+			return err
+		}
+		if i < b.Length()-1 || b.Format.EOL || b.Format.FixEOL {
+			if _, err := bw.WriteString(sep); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// SaveLines writes the lines from start up to and including end to w, each
+// followed by a line ending. The range is limited to the buffer
+func (b *Buffer) SaveLines(w io.Writer, start, end int) error {
+	if start < 0 {
+		start = 0
+	}
+	if last := b.Length() - 1; end > last {
+		end = last
+	}
+	bw := bufio.NewWriter(w)
+	sep := b.Format.Ending.Separator()
+	for line := start; line <= end; line++ {
+		if _, err := bw.WriteString(b.GetLine(line).ToString() + sep); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
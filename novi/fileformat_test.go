@@ -0,0 +1,110 @@
+package novi
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func AssertFormat(t *testing.T, got, expected FileFormat) {
+	t.Helper()
+
+	if got != expected {
+		t.Errorf("Expected format %+v but got %+v", expected, got)
+	}
+}
+
+func loadString(t *testing.T, content string) *Buffer {
+	t.Helper()
+
+	b := NewBuffer()
+	if err := b.LoadFile(strings.NewReader(content)); err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	return b
+}
+
+func roundTrip(t *testing.T, content string) *Buffer {
+	t.Helper()
+
+	b := loadString(t, content)
+	var out bytes.Buffer
+	if err := b.Save(&out); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if out.String() != content {
+		t.Errorf("Content changed after load/save.\nexpected: %q\ngot     : %q", content, out.String())
+	}
+	return b
+}
+
+func TestFileFormat(t *testing.T) {
+	t.Run("Unix file", func(t *testing.T) {
+		b := roundTrip(t, "one\ntwo\n")
+		AssertBufferMatch(t, b, "one", "two")
+		AssertFormat(t, b.Format, FileFormat{Ending: EndingUnix, EOL: true, FixEOL: true})
+	})
+	t.Run("Dos file", func(t *testing.T) {
+		b := roundTrip(t, "one\r\ntwo\r\n")
+		AssertBufferMatch(t, b, "one", "two")
+		AssertFormat(t, b.Format, FileFormat{Ending: EndingDos, EOL: true, FixEOL: true})
+	})
+	t.Run("Mac file", func(t *testing.T) {
+		b := roundTrip(t, "one\rtwo\r")
+		AssertBufferMatch(t, b, "one", "two")
+		AssertFormat(t, b.Format, FileFormat{Ending: EndingMac, EOL: true, FixEOL: true})
+	})
+	t.Run("Mixed endings are preserved as unix", func(t *testing.T) {
+		b := roundTrip(t, "one\r\ntwo\n")
+		AssertBufferMatch(t, b, "one\r", "two")
+		AssertFormat(t, b.Format, FileFormat{Ending: EndingUnix, EOL: true, FixEOL: true})
+	})
+	t.Run("BOM", func(t *testing.T) {
+		b := roundTrip(t, "\xef\xbb\xbfone\r\n")
+		AssertBufferMatch(t, b, "one")
+		AssertFormat(t, b.Format, FileFormat{Ending: EndingDos, BOM: true, EOL: true, FixEOL: true})
+	})
+	t.Run("Empty file", func(t *testing.T) {
+		b := roundTrip(t, "")
+		AssertBufferMatch(t, b, "")
+	})
+	t.Run("Missing final newline gets fixed", func(t *testing.T) {
+		b := loadString(t, "one\ntwo")
+		if b.Format.EOL {
+			t.Error("Expected missing final newline to be detected")
+		}
+		var out bytes.Buffer
+		b.Save(&out)
+		if out.String() != "one\ntwo\n" {
+			t.Errorf("Expected final newline to be added, got %q", out.String())
+		}
+	})
+	t.Run("Missing final newline is preserved with nofixeol", func(t *testing.T) {
+		b := loadString(t, "one\ntwo")
+		b.Format.FixEOL = false
+		var out bytes.Buffer
+		b.Save(&out)
+		if out.String() != "one\ntwo" {
+			t.Errorf("Expected no final newline, got %q", out.String())
+		}
+	})
+	t.Run("Changing the line ending", func(t *testing.T) {
+		b := loadString(t, "one\ntwo\n")
+		b.Format.Ending = EndingDos
+		var out bytes.Buffer
+		b.Save(&out)
+		if out.String() != "one\r\ntwo\r\n" {
+			t.Errorf("Expected dos line endings, got %q", out.String())
+		}
+	})
+	t.Run("Saving lines", func(t *testing.T) {
+		b := loadString(t, "one\r\ntwo\r\nthree\r\n")
+		var out bytes.Buffer
+		if err := b.SaveLines(&out, 1, 5); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != "two\r\nthree\r\n" {
+			t.Errorf("Expected the lines up to the end, got %q", out.String())
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package novi
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+/*
+ * Filtering text through external commands. The command is run by the
+ * user's shell, so pipes and quoting work as expected. The input lines are
+ * written to its standard input and its standard output is returned as
+ * lines.
+ */
+
+// FilterError is returned when a filter command fails
+type FilterError struct {
+	Command  string
+	ExitCode int    // -1 if the command couldn't be run at all
+	Stderr   string // what the command wrote to standard error
+	Err      error
+}
+
+func (e *FilterError) Error() string {
+	msg := e.Stderr
+	if msg == "" {
+		msg = e.Err.Error()
+	}
+	if e.ExitCode > 0 {
+		return fmt.Sprintf("shell returned %d: %s", e.ExitCode, msg)
+	}
+	return fmt.Sprintf("E282: Cannot execute %s: %s", e.Command, msg)
+}
+
+// Unwrap returns the underlying error
+func (e *FilterError) Unwrap() error {
+	return e.Err
+}
+
+// Filter runs command with input (if not nil) as its standard input and
+// returns its output. The command fails if it exits with a non-zero status,
+// in which case the error includes what it wrote to standard error. The
+// standard error of a successful command is returned as message
+func Filter(command string, input []string) ([]string, string, error) {
+	cmd := shellCommand(command)
+	if input != nil {
+		cmd.Stdin = strings.NewReader(strings.Join(input, "\n") + "\n")
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	if err := cmd.Run(); err != nil {
+		code := -1
+		var exit *exec.ExitError
+		if errors.As(err, &exit) {
+			code = exit.ExitCode()
+		}
+		return nil, "", &FilterError{Command: command, ExitCode: code, Stderr: strings.TrimSpace(stderr.String()), Err: err}
+	}
+	return outputLines(stdout.String()), strings.TrimSpace(stderr.String()), nil
+}
+
+// outputLines splits the output of a command in lines
+func outputLines(output string) []string {
+	if output == "" {
+		return []string{}
+	}
+	output = strings.TrimSuffix(output, "\n")
+	lines := strings.Split(output, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSuffix(l, "\r")
+	}
+	return lines
+}
@@ -0,0 +1,44 @@
+//go:build !windows
+// +build !windows
+
+package novi
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	t.Run("Output replaces input", func(t *testing.T) {
+		out, message, err := Filter("sort", []string{"b", "c", "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(out, []string{"a", "b", "c"}) || message != "" {
+			t.Errorf("Unexpected output %q, message %q", out, message)
+		}
+	})
+	t.Run("No output", func(t *testing.T) {
+		out, _, err := Filter("true", []string{"a"})
+		if err != nil || len(out) != 0 {
+			t.Errorf("Expected no output, got %q (%v)", out, err)
+		}
+	})
+	t.Run("Stderr of a successful command", func(t *testing.T) {
+		out, message, err := Filter("echo out; echo warning >&2", nil)
+		if err != nil || !reflect.DeepEqual(out, []string{"out"}) || message != "warning" {
+			t.Errorf("Unexpected output %q, message %q (%v)", out, message, err)
+		}
+	})
+	t.Run("Failure", func(t *testing.T) {
+		_, _, err := Filter("echo oops >&2; exit 3", []string{"a"})
+		var ferr *FilterError
+		if !errors.As(err, &ferr) || ferr.ExitCode != 3 || ferr.Stderr != "oops" {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if err.Error() != "shell returned 3: oops" {
+			t.Errorf("Unexpected message %q", err.Error())
+		}
+	})
+}
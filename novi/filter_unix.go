@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package novi
+
+import (
+	"os"
+	"os/exec"
+)
+
+// shellCommand returns the command that runs command using the user's shell
+func shellCommand(command string) *exec.Cmd {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	return exec.Command(shell, "-c", command)
+}
@@ -0,0 +1,15 @@
+package novi
+
+import (
+	"os"
+	"os/exec"
+)
+
+// shellCommand returns the command that runs command using the command interpreter
+func shellCommand(command string) *exec.Cmd {
+	shell := os.Getenv("COMSPEC")
+	if shell == "" {
+		shell = "cmd.exe"
+	}
+	return exec.Command(shell, "/C", command)
+}
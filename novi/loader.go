@@ -0,0 +1,120 @@
+package novi
+
+import (
+	"bufio"
+	"io"
+)
+
+/*
+ * Loading files. Lines are read using a bufio.Reader so there's no limit on
+ * the length of a line. Files are read in batches of lines; when loading in
+ * the background each batch is sent to the Core loop which adds it to the
+ * buffer, so huge files open incrementally while the editor stays responsive.
+ */
+
+// loadBatchLines is the number of lines read per batch
+const loadBatchLines = 10000
+
+// LoadBatch is a batch of lines read from a file that's being loaded
+type LoadBatch struct {
+	Lines  []string
+	Read   int64 // total number of bytes read so far
+	Format FileFormat
+	Done   bool
+	Err    error
+
+	doc  *Document     // the document it's loaded for
+	stop chan struct{} // identifies the load, see Document.stopLoading
+}
+
+// readLines reads all lines from in, calling emit for each batch of lines. The final
+// batch has Done set, and Err if reading failed. Reading stops if emit returns false
+func readLines(in io.Reader, emit func(*LoadBatch) bool) {
+	r := bufio.NewReaderSize(in, 64*1024)
+	detector := &formatDetector{}
+	var raw []string
+	var read int64
+
+	for {
+		s, err := r.ReadString('\n')
+		read += int64(len(s))
+		if s != "" {
+			raw = append(raw, s)
+		}
+		if err != nil {
+			batch := &LoadBatch{Lines: detector.lines(raw), Read: read, Done: true}
+			batch.Format = detector.Format()
+			if err != io.EOF {
+				batch.Err = err
+			}
+			emit(batch)
+			return
+		}
+		if len(raw) == loadBatchLines {
+			batch := &LoadBatch{Lines: detector.lines(raw), Read: read}
+			batch.Format = detector.Format()
+			if !emit(batch) {
+				return
+			}
+			raw = nil
+		}
+	}
+}
+
+// LoadFile loads the buffer from a reader, detecting its file format
+func (b *Buffer) LoadFile(in io.Reader) error {
+	var lines []string
+	var err error
+
+	readLines(in, func(batch *LoadBatch) bool {
+		lines = append(lines, batch.Lines...)
+		b.Format = batch.Format
+		err = batch.Err
+		return true
+	})
+	b.setLines(lines)
+	b.Validate()
+	b.ResetHistory()
+	b.initialized = true
+	b.notify(nil)
+	return err
+}
+
+// startLoad resets the buffer for loading a file of the given size in batches
+func (b *Buffer) startLoad(size int64) {
+	storage := b.storage
+	if storage == StorageAuto && size > int64(RopeThreshold) {
+		b.storage = StorageRope
+	}
+	b.setLines(nil)
+	b.storage = storage
+	b.ResetHistory()
+	b.reformatted = false
+	b.Modified = false
+	b.initialized = true
+	b.notify(nil)
+	b.loading = true
+}
+
+// appendLoaded adds a batch of loaded lines to the buffer. This is not an
+// undoable change and doesn't mark the buffer as modified. Listeners are
+// notified with a nil change while Loading() is still true
+func (b *Buffer) appendLoaded(batch *LoadBatch) {
+	lines := make([]*Line, len(batch.Lines))
+	for i, l := range batch.Lines {
+		lines[i] = NewLineFromString(l)
+	}
+	b.lines.Replace(b.Length(), b.Length(), lines)
+	b.Format = batch.Format
+	if batch.Done {
+		b.Validate()
+	}
+	b.notify(nil)
+	b.loading = !batch.Done
+}
+
+// Loading returns true while lines are being added to the buffer by a file
+// that's loaded in the background
+func (b *Buffer) Loading() bool {
+	return b.loading
+}
@@ -0,0 +1,123 @@
+package novi
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type failingReader struct {
+	data string
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, errors.New("disk on fire")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestLoadFile(t *testing.T) {
+	t.Run("Very long lines", func(t *testing.T) {
+		long := strings.Repeat("x", 1024*1024)
+		b := loadString(t, "short\n"+long+"\nlast\n")
+		AssertBufferMatch(t, b, "short", long, "last")
+	})
+	t.Run("Read errors are reported", func(t *testing.T) {
+		b := NewBuffer()
+		err := b.LoadFile(&failingReader{"one\ntwo\n"})
+		if err == nil || err.Error() != "disk on fire" {
+			t.Errorf("Expected read error, got %v", err)
+		}
+		AssertBufferMatch(t, b, "one", "two")
+	})
+	t.Run("Non-existing file results in empty buffer", func(t *testing.T) {
+		e := NewEditor()
+		if err := e.LoadFile(filepath.Join(os.TempDir(), "novi-does-not-exist")); err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+		AssertBufferMatch(t, e.Buffer, "")
+	})
+	t.Run("Directory can't be loaded", func(t *testing.T) {
+		e := NewEditor()
+		if err := e.LoadFile(os.TempDir()); err == nil {
+			t.Error("Expected an error loading a directory")
+		}
+	})
+}
+
+func TestLoadFileAsync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "novi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	lines := buildLines(loadBatchLines*2 + 10)
+	name := filepath.Join(dir, "big.txt")
+	if err := ioutil.WriteFile(name, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewEditor()
+	if err := e.LoadFileAsync(name); err != nil {
+		t.Fatalf("LoadFileAsync failed: %v", err)
+	}
+	if e.Buffer.Length() != loadBatchLines {
+		t.Errorf("Expected first batch to be loaded, got %d lines", e.Buffer.Length())
+	}
+	if progress, loading := e.LoadProgress(); !loading || progress == 0 || progress == 100 {
+		t.Errorf("Unexpected progress %d %v", progress, loading)
+	}
+
+	for e.Buffer.Loading() {
+		if err := e.HandleLoadBatch(<-e.Loading()); err != nil {
+			t.Fatalf("HandleLoadBatch failed: %v", err)
+		}
+	}
+	AssertBufferMatch(t, e.Buffer, lines...)
+	AssertBufferModified(t, e.Buffer, false)
+	if e.Buffer.Format.Ending != EndingDos {
+		t.Errorf("Expected dos format, got %s", e.Buffer.Format)
+	}
+}
+
+func TestLoadInBackground(t *testing.T) {
+	dir, err := ioutil.TempDir("", "novi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// more batches than the channel holds
+	lines := buildLines(loadBatchLines*8 + 10)
+	big := filepath.Join(dir, "big.txt")
+	if err := ioutil.WriteFile(big, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e := NewEditor()
+	if err := e.LoadFileAsync(big); err != nil {
+		t.Fatalf("LoadFileAsync failed: %v", err)
+	}
+	first := e.Document
+	if err := e.Edit(filepath.Join(dir, "other.txt"), false); err != nil {
+		t.Fatal(err)
+	}
+	for first.Buffer.Loading() {
+		if err := e.HandleLoadBatch(<-e.Loading()); err != nil {
+			t.Fatalf("HandleLoadBatch failed: %v", err)
+		}
+	}
+	AssertBufferMatch(t, first.Buffer, lines...)
+	if e.Document == first {
+		t.Error("Expected the other document to stay current")
+	}
+	if progress, loading := e.LoadProgress(); loading || progress != 100 {
+		t.Errorf("Unexpected progress of the other document %d %v", progress, loading)
+	}
+}
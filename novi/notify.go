@@ -0,0 +1,121 @@
+package novi
+
+/*
+ * Change notification. Every modification of a Buffer is reported as a
+ * Change (see undo.go) to the anchors and listeners registered on it.
+ *
+ * Anchors are positions (cursors, marks, selection ends, diagnostics, ...)
+ * that are kept up to date automatically: a position before a change stays
+ * where it is, a position inside removed text moves to the start of the
+ * change and a position after it shifts along with the text. A position at
+ * the exact start of an insertion stays put, so the text is inserted after
+ * it.
+ *
+ * Listeners are notified after the anchors have been adjusted, e.g. to
+ * update syntax highlighting. A nil Change means the entire contents of the
+ * buffer were replaced (e.g. by loading a file). While a file is loaded in
+ * the background (Buffer.Loading()) it means lines were added at the end.
+ */
+
+// Listener is notified of every change made to a buffer
+type Listener interface {
+	BufferChanged(b *Buffer, ch *Change)
+}
+
+// ListenerFunc allows a plain function to be used as Listener
+type ListenerFunc func(b *Buffer, ch *Change)
+
+// BufferChanged calls f
+func (f ListenerFunc) BufferChanged(b *Buffer, ch *Change) {
+	f(b, ch)
+}
+
+type listenerEntry struct {
+	id       int
+	listener Listener
+}
+
+type anchorEntry struct {
+	id     int
+	anchor *Cursor
+}
+
+// subscribers holds the anchors and listeners registered on a buffer
+type subscribers struct {
+	lastID    int
+	anchors   []anchorEntry
+	listeners []listenerEntry
+}
+
+// Subscribe registers a listener, it returns a function that unsubscribes it again
+func (b *Buffer) Subscribe(l Listener) func() {
+	s := &b.subscribers
+	s.lastID++
+	id := s.lastID
+	s.listeners = append(s.listeners, listenerEntry{id, l})
+	return func() {
+		for i, e := range s.listeners {
+			if e.id == id {
+				s.listeners = append(s.listeners[:i:i], s.listeners[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Track registers an anchor that's adjusted when the buffer changes. It
+// returns a function that stops tracking it
+func (b *Buffer) Track(c *Cursor) func() {
+	s := &b.subscribers
+	s.lastID++
+	id := s.lastID
+	s.anchors = append(s.anchors, anchorEntry{id, c})
+	return func() {
+		for i, e := range s.anchors {
+			if e.id == id {
+				s.anchors = append(s.anchors[:i:i], s.anchors[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// notify reports a change to all anchors and listeners
+func (b *Buffer) notify(ch *Change) {
+	for _, e := range b.subscribers.anchors {
+		e.anchor.Adjust(ch)
+	}
+	for _, e := range b.subscribers.listeners {
+		e.listener.BufferChanged(b, ch)
+	}
+}
+
+// Adjust moves the cursor according to a change in its buffer. A nil
+// change (the entire buffer was replaced) just makes sure it's valid
+func (c *Cursor) Adjust(ch *Change) {
+	if ch == nil {
+		c.Validate()
+		return
+	}
+	rl, rp := ch.RemovedEnd()
+	il, ip := ch.InsertedEnd()
+
+	switch {
+	case c.Line < ch.Line || c.Line == ch.Line && c.Pos <= ch.Pos:
+		// before the change
+	case c.Line < rl || c.Line == rl && c.Pos < rp:
+		// inside the removed text
+		c.Line, c.Pos = ch.Line, ch.Pos
+	case c.Line == rl:
+		c.Line, c.Pos = il, ip+c.Pos-rp
+	default:
+		c.Line += il - rl
+	}
+}
+
+// Adjust adjusts all cursors according to a change
+func (cs Cursors) Adjust(ch *Change) {
+	for _, c := range cs {
+		c.Adjust(ch)
+	}
+}
@@ -0,0 +1,103 @@
+package novi
+
+import "testing"
+
+func TestCursorAdjust(t *testing.T) {
+	type pos struct{ line, pos int }
+
+	for _, tc := range []struct {
+		name     string
+		edit     func(b *Buffer)
+		before   []pos
+		expected []pos
+	}{
+		{"Insert character",
+			func(b *Buffer) { b.PutRuneAtCursors(Cursors{b.NewCursor(0, 2)}, 'x') },
+			[]pos{{0, 1}, {0, 2}, {0, 4}, {1, 2}},
+			[]pos{{0, 1}, {0, 2}, {0, 5}, {1, 2}}},
+		{"Split line",
+			func(b *Buffer) { b.SplitLine(b.NewCursor(0, 2)) },
+			[]pos{{0, 1}, {0, 2}, {0, 4}, {1, 2}},
+			[]pos{{0, 1}, {0, 2}, {1, 2}, {2, 2}}},
+		{"Join lines",
+			func(b *Buffer) { b.JoinLineWithPrevious(1) },
+			[]pos{{0, 3}, {1, 0}, {1, 4}, {2, 1}},
+			[]pos{{0, 3}, {0, 5}, {0, 9}, {1, 1}}},
+		{"Remove across lines",
+			func(b *Buffer) { b.RemoveBetweenCursors(b.NewCursor(0, 2), b.NewCursor(1, 1)) },
+			[]pos{{0, 1}, {0, 4}, {1, 1}, {1, 2}, {2, 0}},
+			[]pos{{0, 1}, {0, 2}, {0, 2}, {0, 2}, {1, 0}}},
+		{"Remove line",
+			func(b *Buffer) { b.RemoveLine(1) },
+			[]pos{{0, 1}, {1, 3}, {2, 3}},
+			[]pos{{0, 1}, {1, 0}, {1, 3}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := BuildBuffer("hello", "world", "three")
+			var cs Cursors
+			for _, p := range tc.before {
+				c := b.NewCursor(p.line, p.pos)
+				b.Track(c)
+				cs = append(cs, c)
+			}
+			tc.edit(b)
+			for i, p := range tc.expected {
+				AssertCursor(t, cs[i], p.line, p.pos)
+			}
+		})
+	}
+}
+
+func TestNotify(t *testing.T) {
+	t.Run("Listeners receive changes", func(t *testing.T) {
+		b := BuildBuffer("hello")
+		var changes []*Change
+		unsubscribe := b.Subscribe(ListenerFunc(func(_ *Buffer, ch *Change) {
+			changes = append(changes, ch)
+		}))
+
+		b.PutRuneAtCursors(Cursors{b.NewCursor(0, 5)}, '!')
+		b.Undo(nil)
+		b.LoadStrings([]string{"new"})
+		unsubscribe()
+		b.SplitLine(b.NewCursor(0, 1))
+
+		if len(changes) != 3 {
+			t.Fatalf("Expected 3 notifications, got %d", len(changes))
+		}
+		if ch := changes[0]; ch.Line != 0 || ch.Pos != 5 || ch.Inserted[0] != "!" {
+			t.Errorf("Unexpected change %+v", ch)
+		}
+		if ch := changes[1]; ch.Removed[0] != "!" || !emptyText(ch.Inserted) {
+			t.Errorf("Expected undo to remove the character, got %+v", ch)
+		}
+		if changes[2] != nil {
+			t.Errorf("Expected nil change when replacing contents, got %+v", changes[2])
+		}
+	})
+	t.Run("Untracked anchors stay put", func(t *testing.T) {
+		b := BuildBuffer("hello")
+		c := b.NewCursor(0, 3)
+		untrack := b.Track(c)
+		b.PutRuneAtCursors(Cursors{b.NewCursor(0, 0)}, 'x')
+		untrack()
+		b.PutRuneAtCursors(Cursors{b.NewCursor(0, 0)}, 'x')
+		AssertCursor(t, c, 0, 4)
+	})
+	t.Run("Editor cursors and selection follow changes", func(t *testing.T) {
+		e := NewEditor()
+		e.Buffer.LoadStrings([]string{"hello", "world"})
+		e.SetCursor(1, 2)
+		e.Cursors = append(e.Cursors, e.Buffer.NewCursor(0, 4))
+		e.Selection.SetStart(*e.Buffer.NewCursor(0, 1))
+		e.Selection.SetEnd(*e.Buffer.NewCursor(1, 3))
+		e.Selection.Enable()
+
+		e.Buffer.InsertLine(e.Buffer.NewCursor(0, 0), "first", true)
+		AssertCursor(t, e.Cursors[0], 2, 2)
+		AssertCursor(t, e.Cursors[1], 1, 4)
+		if !e.Selection.InSelection(1, 1, 1) || !e.Selection.InSelection(2, 3, 3) || e.Selection.InSelection(0, 1, 1) {
+			t.Errorf("Selection didn't move along: %s", e.Selection.ToString())
+		}
+	})
+}
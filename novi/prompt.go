@@ -0,0 +1,125 @@
+package novi
+
+import "fmt"
+
+/*
+ * Prompts are questions the Core asks the user itself, e.g. what to do with
+ * a file that changed on disk. They're shown using the UI's additional input
+ * (AskInput) and answered with a single key.
+ */
+
+// prompt is a question asked by the Core
+type prompt struct {
+	text string
+	// answer handles the key pressed (escape is passed as '\x1b'). It returns
+	// true if the prompt is done, or else the text to show as input
+	answer func(rune) (bool, string)
+}
+
+// handle passes the key from an input event to the prompt
+func (p *prompt) handle(ev Event) (bool, string) {
+	switch e := ev.(type) {
+	case *CharacterEvent:
+		return p.answer(e.Rune)
+	case *KeyEvent:
+		if e.Key == KeyEscape {
+			return p.answer('\x1b')
+		}
+	}
+	return false, ""
+}
+
+// fileChangedPrompt asks what to do with a document whose file changed on
+// disk. Showing the diff opens it in a new document, which is closed again
+// once the question is answered
+func (c *Core) fileChangedPrompt(e *FileChangedEvent) *prompt {
+	editor := c.Editor
+	d := editor.GetDocument(e.Number)
+	if d == nil {
+		d = editor.Document
+	}
+	text := fmt.Sprintf("W11: \"%s\" changed on disk. [r]eload, [k]eep, [d]iff: ", e.Name)
+	if d.Buffer.Modified {
+		text = fmt.Sprintf("W12: \"%s\" and the buffer both changed. [r]eload, [k]eep, [d]iff: ", e.Name)
+	}
+	var diff *Document
+	closeDiff := func() {
+		if diff != nil && editor.GetDocument(diff.Number()) != nil {
+			editor.CloseDocument(diff.Number(), true)
+			if editor.GetDocument(d.Number()) != nil {
+				editor.SwitchTo(d.Number())
+			}
+		}
+	}
+	return &prompt{text: text, answer: func(r rune) (bool, string) {
+		switch r {
+		case 'r', 'R':
+			closeDiff()
+			editor.with(d, func() {
+				if err := editor.ReloadFile(); err != nil {
+					c.UI.SetError(err.Error())
+				}
+			})
+			return true, ""
+		case 'k', 'K', '\x1b':
+			closeDiff()
+			editor.with(d, editor.KeepFile)
+			return true, ""
+		case 'd', 'D':
+			if diff != nil {
+				return false, ""
+			}
+			var err error
+			editor.with(d, func() { diff, err = editor.DiffDocument() })
+			if err != nil {
+				return false, err.Error()
+			}
+			editor.SwitchTo(diff.Number())
+			return false, fmt.Sprintf("diff shown in buffer %d", diff.Number())
+		}
+		return false, ""
+	}}
+}
+
+func (c *Core) swapFoundPrompt(e *SwapFoundEvent) *prompt {
+	swap := e.Swap
+	if swap.Running {
+		text := fmt.Sprintf("E325: \"%s\" is being edited by process %d (%s). [e]dit anyway, [q]uit: ",
+			e.Name, swap.PID, swap.Path)
+		return &prompt{text: text, answer: func(r rune) (bool, string) {
+			switch r {
+			case 'e', 'E', '\x1b':
+				c.Editor.IgnoreSwap()
+				return true, ""
+			case 'q', 'Q':
+				c.quit = true
+				return true, ""
+			}
+			return false, ""
+		}}
+	}
+
+	text := fmt.Sprintf("E325: Found swap file %s from %s with %d changes. [r]ecover, [d]elete, [e]dit anyway: ",
+		swap.Path, swap.ModTime.Format("2006-01-02 15:04"), swap.Changes)
+	return &prompt{text: text, answer: func(r rune) (bool, string) {
+		switch r {
+		case 'r', 'R':
+			n, err := c.Editor.RecoverSwap()
+			if err != nil {
+				c.UI.SetError(err.Error())
+			} else {
+				c.UI.SetError(fmt.Sprintf("Recovered %d changes, save the file to keep them", n))
+			}
+			return true, ""
+		case 'd', 'D':
+			if err := c.Editor.DeleteSwap(); err != nil {
+				c.UI.SetError(err.Error())
+			}
+			return true, ""
+		case 'e', 'E', '\x1b':
+			c.Editor.IgnoreSwap()
+			return true, ""
+		}
+		return false, ""
+	}}
+}
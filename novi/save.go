@@ -0,0 +1,326 @@
+package novi
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+/*
+ * Saving files. The buffer is written to a temporary file next to the target
+ * which is synced to disk and then renamed over the target, so a crash or a
+ * full disk never leaves a half written file behind. The mode and ownership
+ * of the original file are copied to the new file, and symlinks are followed
+ * so the link itself stays intact.
+ *
+ * If ownership can't be preserved (e.g. editing someone else's file in a
+ * group-writable folder) the file is written in place in stead.
+ */
+
+// BackupPolicy defines if and where backups are made when saving
+type BackupPolicy int
+
+// The possible backup policies
+const (
+	BackupOff      BackupPolicy = iota
+	BackupSameDir               // file.bak next to file
+	BackupDir                   // in SaveOptions.BackupDir
+	BackupNumbered              // file.~1~, file.~2~, ... next to file
+)
+
+var backupPolicyNames = map[BackupPolicy]string{
+	BackupOff:      "off",
+	BackupSameDir:  "same",
+	BackupDir:      "dir",
+	BackupNumbered: "numbered",
+}
+
+// String returns the name of the policy
+func (p BackupPolicy) String() string {
+	return backupPolicyNames[p]
+}
+
+// ParseBackupPolicy parses the name of a backup policy
+func ParseBackupPolicy(name string) (BackupPolicy, error) {
+	for p, n := range backupPolicyNames {
+		if n == name {
+			return p, nil
+		}
+	}
+	return BackupOff, fmt.Errorf("Invalid backup policy: %s", name)
+}
+
+// SaveOptions configure how files are saved
+type SaveOptions struct {
+	Backup    BackupPolicy
+	BackupDir string
+}
+
+// The different reasons a save can fail
+var (
+	ErrSaveNoName         = errors.New("No filename set")
+	ErrSaveNoBackup       = errors.New("Could not create backup")
+	ErrSaveFailedCreate   = errors.New("Could not create file")
+	ErrSaveWrite          = errors.New("Failed to write contents")
+	ErrSaveWouldOverwrite = errors.New("Not overwriting existing file")
+	ErrSaveFileChanged    = errors.New("File changed on disk since reading it")
+	ErrSaveReadFailed     = errors.New("File was not read completely")
+	ErrSaveLoading        = errors.New("File is still loading")
+)
+
+// SaveError is returned when saving fails. It matches (errors.Is) one of the
+// ErrSave* errors and wraps the underlying error
+type SaveError struct {
+	Op   error
+	Path string
+	Err  error
+}
+
+func (e *SaveError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Op, e.Path, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *SaveError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the ErrSave* error describing the failure
+func (e *SaveError) Is(target error) bool {
+	return target == e.Op
+}
+
+// SaveFile saves the buffer to a file. If name is empty, the current filename is used.
+// An existing file is only overwritten when saving under a different name, when it
+// changed on disk since it was loaded or when it couldn't be read completely, if force
+// is set. A file that's loading in the background is fully loaded first
+func (e *Editor) SaveFile(name string, force bool) error {
+	filename := e.filename
+	if name != "" {
+		filename = name
+	}
+	if filename == "" {
+		log.Println("No filename set on buffer, can't save")
+		return ErrSaveNoName
+	}
+	// the read error, if any, is kept in e.readErr
+	e.FinishLoad()
+
+	// follow symlinks so we replace the file, not the link
+	target := filename
+	info, err := os.Stat(filename)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return &SaveError{ErrSaveFailedCreate, filename, err}
+	}
+	if exists {
+		if target, err = filepath.EvalSymlinks(filename); err != nil {
+			return &SaveError{ErrSaveFailedCreate, filename, err}
+		}
+	}
+
+	// only overwrite existing file
+	if filename != e.filename && exists && !force {
+		return &SaveError{ErrSaveWouldOverwrite, filename, errors.New("use ! to overwrite")}
+	}
+	if exists && filename == e.filename && !force && e.FileChanged() {
+		return &SaveError{ErrSaveFileChanged, filename, errors.New("use ! to overwrite")}
+	}
+	if exists && filename == e.filename && !force && e.readErr != nil {
+		return &SaveError{ErrSaveReadFailed, filename, errors.New("use ! to overwrite")}
+	}
+
+	if exists {
+		if err := e.backup(target); err != nil {
+			log.Printf("Failed to make backup copy for %s: %v", target, err)
+			return &SaveError{ErrSaveNoBackup, target, err}
+		}
+	}
+
+	h := sha256.New()
+	write := func(w io.Writer) error {
+		return e.Buffer.Save(io.MultiWriter(w, h))
+	}
+	if err := e.writeAtomic(target, info, write); err != nil {
+		log.Printf("Failed to save %s: %v", target, err)
+		return err
+	}
+
+	e.filename = filename
+	e.readErr = nil
+	e.Buffer.MarkSaved()
+	e.recordFile(filename, h)
+	e.resetSwap()
+	return nil
+}
+
+// WriteLines writes the lines from start up to and including end to a file,
+// the current file if name is empty. The buffer isn't marked as saved, and an
+// existing file is only overwritten if force is set. Lines can't be written
+// while the file is loading, as the range may not cover the whole file yet
+func (e *Editor) WriteLines(name string, start, end int, force bool) error {
+	if name == "" {
+		name = e.filename
+	}
+	if name == "" {
+		return ErrSaveNoName
+	}
+	if e.Buffer.Loading() {
+		return &SaveError{ErrSaveLoading, name, errors.New("try again when loading has finished")}
+	}
+	target := name
+	info, err := os.Stat(name)
+	if err == nil {
+		if !force {
+			return &SaveError{ErrSaveWouldOverwrite, name, errors.New("use ! to overwrite")}
+		}
+		if target, err = filepath.EvalSymlinks(name); err != nil {
+			return &SaveError{ErrSaveFailedCreate, name, err}
+		}
+	} else if os.IsNotExist(err) {
+		info = nil
+	} else {
+		return &SaveError{ErrSaveFailedCreate, name, err}
+	}
+	return e.writeAtomic(target, info, func(w io.Writer) error {
+		return e.Buffer.SaveLines(w, start, end)
+	})
+}
+
+// writeAtomic writes to a temporary file using write, which then replaces
+// target. info describes the existing file, if any
+func (e *Editor) writeAtomic(target string, info os.FileInfo, write func(io.Writer) error) error {
+	dir, base := filepath.Split(target)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := createTemp(dir, "."+base+".novi-")
+	if err != nil {
+		return &SaveError{ErrSaveFailedCreate, target, err}
+	}
+	tmp := f.Name()
+
+	fail := func(op error, err error) error {
+		f.Close()
+		os.Remove(tmp)
+		return &SaveError{op, target, err}
+	}
+
+	// a new file gets the default mode minus the umask from createTemp
+	if info != nil {
+		if err := f.Chmod(info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)); err != nil {
+			return fail(ErrSaveFailedCreate, err)
+		}
+		if err := copyOwner(f, info); err != nil {
+			log.Printf("Can't preserve ownership of %s (%v), writing in place", target, err)
+			f.Close()
+			os.Remove(tmp)
+			return e.writeInPlace(target, write)
+		}
+	}
+
+	if err := write(f); err != nil {
+		return fail(ErrSaveWrite, err)
+	}
+	if err := f.Sync(); err != nil {
+		return fail(ErrSaveWrite, err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return &SaveError{ErrSaveWrite, target, err}
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return &SaveError{ErrSaveWrite, target, err}
+	}
+	syncDir(dir)
+	return nil
+}
+
+// createTemp creates a new file in dir with a name starting with prefix.
+// Unlike ioutil.TempFile it's created with mode 0666, so the umask applies
+func createTemp(dir, prefix string) (*os.File, error) {
+	for i := 0; ; i++ {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 36))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) && i < 100 {
+			continue
+		}
+		return f, err
+	}
+}
+
+// writeInPlace truncates and overwrites target using write. Not crash safe,
+// only used when the file can't be replaced
+func (e *Editor) writeInPlace(target string, write func(io.Writer) error) error {
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return &SaveError{ErrSaveFailedCreate, target, err}
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return &SaveError{ErrSaveWrite, target, err}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return &SaveError{ErrSaveWrite, target, err}
+	}
+	if err := f.Close(); err != nil {
+		return &SaveError{ErrSaveWrite, target, err}
+	}
+	return nil
+}
+
+// syncDir makes sure a rename in dir is persisted. Not all platforms support
+// this so errors are ignored
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// BackupName returns the name of the backup for target according to the
+// current policy, or "" if no backup should be made
+func (e *Editor) BackupName(target string) string {
+	switch e.SaveOptions.Backup {
+	case BackupSameDir:
+		return target + ".bak"
+	case BackupDir:
+		abs, err := filepath.Abs(target)
+		if err != nil {
+			abs = target
+		}
+		// encode the full path so files with the same name don't collide
+		name := strings.Replace(abs, string(filepath.Separator), "%", -1)
+		return filepath.Join(e.SaveOptions.BackupDir, name+".bak")
+	case BackupNumbered:
+		for i := 1; ; i++ {
+			name := fmt.Sprintf("%s.~%d~", target, i)
+			if _, err := os.Lstat(name); os.IsNotExist(err) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// backup makes a backup of target according to the current policy
+func (e *Editor) backup(target string) error {
+	name := e.BackupName(target)
+	if name == "" {
+		return nil
+	}
+	if e.SaveOptions.Backup == BackupDir {
+		if err := os.MkdirAll(e.SaveOptions.BackupDir, 0700); err != nil {
+			return err
+		}
+	}
+	return CopyFile(target, name)
+}
@@ -0,0 +1,276 @@
+package novi
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupSave creates a temporary directory with a file and an editor that has it loaded
+func setupSave(t *testing.T, content string, mode os.FileMode) (*Editor, string, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "novi-save")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "file.txt")
+	if err := ioutil.WriteFile(name, []byte(content), mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(name, mode); err != nil {
+		t.Fatal(err)
+	}
+	e := NewEditor()
+	if err := e.LoadFile(name); err != nil {
+		t.Fatal(err)
+	}
+	return e, name, func() { os.RemoveAll(dir) }
+}
+
+func AssertFileContent(t *testing.T, name, expected string) {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatalf("Could not read %s: %v", name, err)
+	}
+	if string(data) != expected {
+		t.Errorf("Expected %s to contain %q, got %q", name, expected, string(data))
+	}
+}
+
+func TestSave(t *testing.T) {
+	t.Run("Save preserves mode", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\n", 0600)
+		defer cleanup()
+
+		e.Buffer.AddLine(NewLineFromString("world"))
+		if err := e.SaveFile("", false); err != nil {
+			t.Fatal(err)
+		}
+		AssertFileContent(t, name, "hello\nworld\n")
+		info, _ := os.Stat(name)
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("Expected mode 0600, got %o", info.Mode().Perm())
+		}
+		if e.Buffer.Modified {
+			t.Error("Buffer should not be modified after save")
+		}
+	})
+	t.Run("Save leaves no temporary files", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\n", 0644)
+		defer cleanup()
+
+		if err := e.SaveFile("", false); err != nil {
+			t.Fatal(err)
+		}
+		files, _ := ioutil.ReadDir(filepath.Dir(name))
+		if len(files) != 1 {
+			t.Errorf("Expected only the saved file, got %d files", len(files))
+		}
+	})
+	t.Run("Save follows symlinks", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\n", 0644)
+		defer cleanup()
+
+		link := filepath.Join(filepath.Dir(name), "link.txt")
+		if err := os.Symlink(name, link); err != nil {
+			t.Skip("Symlinks not supported")
+		}
+		if err := e.LoadFile(link); err != nil {
+			t.Fatal(err)
+		}
+		e.Buffer.AddLine(NewLineFromString("world"))
+		if err := e.SaveFile("", false); err != nil {
+			t.Fatal(err)
+		}
+		if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("Expected %s to still be a symlink", link)
+		}
+		AssertFileContent(t, name, "hello\nworld\n")
+	})
+	t.Run("New file", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\n", 0644)
+		defer cleanup()
+
+		other := filepath.Join(filepath.Dir(name), "other.txt")
+		if err := e.SaveFile(other, false); err != nil {
+			t.Fatal(err)
+		}
+		AssertFileContent(t, other, "hello\n")
+		if e.GetFilename() != other {
+			t.Errorf("Expected filename to be %s, got %s", other, e.GetFilename())
+		}
+	})
+	t.Run("Don't overwrite other file without force", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\n", 0644)
+		defer cleanup()
+
+		other := filepath.Join(filepath.Dir(name), "other.txt")
+		ioutil.WriteFile(other, []byte("other\n"), 0644)
+
+		err := e.SaveFile(other, false)
+		var saveErr *SaveError
+		if !errors.Is(err, ErrSaveWouldOverwrite) || !errors.As(err, &saveErr) || saveErr.Path != other {
+			t.Errorf("Expected ErrSaveWouldOverwrite for %s, got %v", other, err)
+		}
+		AssertFileContent(t, other, "other\n")
+
+		if err := e.SaveFile(other, true); err != nil {
+			t.Fatal(err)
+		}
+		AssertFileContent(t, other, "hello\n")
+	})
+	t.Run("Failure to create", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\n", 0644)
+		defer cleanup()
+
+		missing := filepath.Join(filepath.Dir(name), "nosuchdir", "file.txt")
+		err := e.SaveFile(missing, false)
+		if !errors.Is(err, ErrSaveFailedCreate) {
+			t.Errorf("Expected ErrSaveFailedCreate, got %v", err)
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected underlying error to be wrapped, got %v", err)
+		}
+		if e.GetFilename() != name {
+			t.Errorf("Filename should not change on failure, got %s", e.GetFilename())
+		}
+	})
+	t.Run("Save while loading", func(t *testing.T) {
+		lines := buildLines(loadBatchLines + 10)
+		content := strings.Join(lines, "\n") + "\n"
+		e, name, cleanup := setupSave(t, content, 0644)
+		defer cleanup()
+
+		if err := e.LoadFileAsync(name); err != nil {
+			t.Fatal(err)
+		}
+		if !e.Buffer.Loading() {
+			t.Fatal("Expected file to be loading")
+		}
+		if err := e.SaveFile("", false); err != nil {
+			t.Fatal(err)
+		}
+		AssertFileContent(t, name, content)
+	})
+	t.Run("Read error requires force", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\n", 0644)
+		defer cleanup()
+
+		e.readErr = errors.New("read failed")
+		if err := e.SaveFile("", false); !errors.Is(err, ErrSaveReadFailed) {
+			t.Errorf("Expected ErrSaveReadFailed, got %v", err)
+		}
+		if err := e.SaveFile("", true); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.SaveFile("", false); err != nil {
+			t.Errorf("Expected save after forced save to succeed, got %v", err)
+		}
+		AssertFileContent(t, name, "hello\n")
+	})
+}
+
+func TestWriteLines(t *testing.T) {
+	e, name, cleanup := setupSave(t, "one\ntwo\nthree\n", 0644)
+	defer cleanup()
+
+	e.Buffer.AddLine(NewLineFromString("four"))
+	part := filepath.Join(filepath.Dir(name), "part.txt")
+	if err := e.WriteLines(part, 1, 2, false); err != nil {
+		t.Fatal(err)
+	}
+	AssertFileContent(t, part, "two\nthree\n")
+	if e.GetFilename() != name || !e.Buffer.Modified {
+		t.Errorf("Writing lines should not save the buffer")
+	}
+
+	err := e.WriteLines("", 0, 0, false)
+	var saveErr *SaveError
+	if !errors.Is(err, ErrSaveWouldOverwrite) || !errors.As(err, &saveErr) || saveErr.Path != name {
+		t.Errorf("Expected ErrSaveWouldOverwrite for %s, got %v", name, err)
+	}
+	if err := os.Chmod(name, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.WriteLines("", 0, 0, true); err != nil {
+		t.Fatal(err)
+	}
+	AssertFileContent(t, name, "one\n")
+	if info, err := os.Stat(name); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600 to be preserved, got %v %v", info, err)
+	}
+
+	lines := buildLines(loadBatchLines + 10)
+	if err := ioutil.WriteFile(name, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.LoadFileAsync(name); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.WriteLines(part, 0, e.Buffer.Length()-1, true); !errors.Is(err, ErrSaveLoading) {
+		t.Errorf("Expected ErrSaveLoading, got %v", err)
+	}
+}
+
+func TestBackup(t *testing.T) {
+	t.Run("No backup by default", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\n", 0644)
+		defer cleanup()
+
+		e.SaveFile("", false)
+		if _, err := os.Stat(name + ".bak"); !os.IsNotExist(err) {
+			t.Error("Expected no backup")
+		}
+	})
+	t.Run("Backup in same dir", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\n", 0640)
+		defer cleanup()
+
+		e.SaveOptions.Backup = BackupSameDir
+		e.Buffer.AddLine(NewLineFromString("world"))
+		if err := e.SaveFile("", false); err != nil {
+			t.Fatal(err)
+		}
+		AssertFileContent(t, name+".bak", "hello\n")
+		AssertFileContent(t, name, "hello\nworld\n")
+		info, _ := os.Stat(name + ".bak")
+		if info.Mode().Perm() != 0640 {
+			t.Errorf("Expected backup mode 0640, got %o", info.Mode().Perm())
+		}
+	})
+	t.Run("Backup in central dir", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\n", 0644)
+		defer cleanup()
+
+		e.SaveOptions.Backup = BackupDir
+		e.SaveOptions.BackupDir = filepath.Join(filepath.Dir(name), "backups")
+		if err := e.SaveFile("", false); err != nil {
+			t.Fatal(err)
+		}
+		backup := e.BackupName(name)
+		if filepath.Dir(backup) != e.SaveOptions.BackupDir || !strings.Contains(filepath.Base(backup), "%file.txt") {
+			t.Errorf("Unexpected backup name %s", backup)
+		}
+		AssertFileContent(t, backup, "hello\n")
+	})
+	t.Run("Numbered backups", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "one\n", 0644)
+		defer cleanup()
+
+		e.SaveOptions.Backup = BackupNumbered
+		e.Buffer.LoadStrings([]string{"two"})
+		e.SaveFile("", false)
+		e.Buffer.LoadStrings([]string{"three"})
+		e.SaveFile("", false)
+
+		AssertFileContent(t, name+".~1~", "one\n")
+		AssertFileContent(t, name+".~2~", "two\n")
+		AssertFileContent(t, name, "three\n")
+	})
+}
@@ -0,0 +1,18 @@
+package novi
+
+import "os"
+
+// copyOwner is a no-op, windows doesn't have unix style ownership
+func copyOwner(f *os.File, info os.FileInfo) error {
+	return nil
+}
+
+// processRunning returns true if a process with the given pid exists
+func processRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
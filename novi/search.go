@@ -0,0 +1,101 @@
+package novi
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+ * Searching a buffer using regular expressions. Patterns use Go's regexp
+ * syntax, with \< and \> (word boundaries) accepted as well since vi users
+ * tend to type them. Matches don't span lines.
+ */
+
+// SearchOptions controls how patterns are matched
+type SearchOptions struct {
+	IgnoreCase bool
+	SmartCase  bool // with IgnoreCase, only ignore case if the pattern is all lower case
+	WrapScan   bool // searches wrap around the end/start of the buffer
+}
+
+// DefaultSearchOptions are the options used unless configured otherwise
+var DefaultSearchOptions = SearchOptions{WrapScan: true}
+
+// Search is a compiled search pattern
+type Search struct {
+	Pattern string
+	re      *regexp.Regexp
+}
+
+// Match is a single match of a search, from Pos up to (exclusive) End on Line
+type Match struct {
+	Line, Pos, End int
+}
+
+// NewSearch compiles a search pattern
+func NewSearch(pattern string, opts SearchOptions) (*Search, error) {
+	expr := strings.NewReplacer(`\<`, `\b`, `\>`, `\b`).Replace(pattern)
+	ignore := opts.IgnoreCase
+	if ignore && opts.SmartCase && strings.IndexFunc(pattern, unicode.IsUpper) != -1 {
+		ignore = false
+	}
+	if ignore {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &Search{Pattern: pattern, re: re}, nil
+}
+
+// Regexp returns the compiled regular expression of the search
+func (s *Search) Regexp() *regexp.Regexp {
+	return s.re
+}
+
+// MatchesOn returns all matches on a line of the buffer
+func (s *Search) MatchesOn(b *Buffer, line int) []Match {
+	text := b.GetLine(line).ToString()
+	var matches []Match
+	for _, m := range s.re.FindAllStringIndex(text, -1) {
+		start := utf8.RuneCountInString(text[:m[0]])
+		end := start + utf8.RuneCountInString(text[m[0]:m[1]])
+		matches = append(matches, Match{Line: line, Pos: start, End: end})
+	}
+	return matches
+}
+
+// Find finds the first match after (or before, if backward) a position. It
+// returns whether a match was found and whether the search wrapped around
+func (b *Buffer) Find(s *Search, line, pos int, backward, wrap bool) (Match, bool, bool) {
+	n := b.Length()
+	for i := 0; i <= n; i++ {
+		l := line + i
+		if backward {
+			l = line - i
+		}
+		wrapped := l < 0 || l >= n
+		if wrapped && !wrap {
+			break
+		}
+		l = (l%n + n) % n
+		matches := s.MatchesOn(b, l)
+		if backward {
+			for j := len(matches) - 1; j >= 0; j-- {
+				if m := matches[j]; i > 0 || m.Pos < pos {
+					return m, true, wrapped
+				}
+			}
+			continue
+		}
+		for _, m := range matches {
+			if i > 0 || m.Pos > pos {
+				return m, true, wrapped
+			}
+		}
+	}
+	return Match{}, false, false
+}
@@ -0,0 +1,81 @@
+package novi
+
+import (
+	"testing"
+)
+
+func TestNewSearch(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		pattern string
+		opts    SearchOptions
+		text    string
+		matches int
+	}{
+		{"Case sensitive", "foo", SearchOptions{}, "foo Foo FOO", 1},
+		{"Ignore case", "foo", SearchOptions{IgnoreCase: true}, "foo Foo FOO", 3},
+		{"Smartcase, lower case", "foo", SearchOptions{IgnoreCase: true, SmartCase: true}, "foo Foo FOO", 3},
+		{"Smartcase, upper case", "Foo", SearchOptions{IgnoreCase: true, SmartCase: true}, "foo Foo FOO", 1},
+		{"Smartcase without ignorecase", "foo", SearchOptions{SmartCase: true}, "foo Foo FOO", 1},
+		{"Word boundaries", `\<foo\>`, SearchOptions{}, "foo food foo", 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := NewSearch(tc.pattern, tc.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if m := s.MatchesOn(BuildBuffer(tc.text), 0); len(m) != tc.matches {
+				t.Errorf("Expected %d matches, got %v", tc.matches, m)
+			}
+		})
+	}
+	t.Run("Invalid pattern", func(t *testing.T) {
+		if _, err := NewSearch("foo(", SearchOptions{}); err == nil {
+			t.Error("Expected an error")
+		}
+	})
+	t.Run("Rune positions", func(t *testing.T) {
+		s, _ := NewSearch("x+", SearchOptions{})
+		m := s.MatchesOn(BuildBuffer("äöxx"), 0)
+		if len(m) != 1 || m[0].Pos != 2 || m[0].End != 4 {
+			t.Errorf("Unexpected matches %v", m)
+		}
+	})
+}
+
+func TestFind(t *testing.T) {
+	b := BuildBuffer("foo bar", "bar", "foo foo")
+	s, _ := NewSearch("foo", SearchOptions{})
+	for _, tc := range []struct {
+		name      string
+		line, pos int
+		backward  bool
+		wrap      bool
+		found     bool
+		wrapped   bool
+		match     Match
+	}{
+		{"Forward on same line", 2, 0, false, true, true, false, Match{2, 4, 7}},
+		{"Forward on next line", 0, 0, false, true, true, false, Match{2, 0, 3}},
+		{"Forward wraps", 2, 4, false, true, true, true, Match{0, 0, 3}},
+		{"Forward doesn't wrap", 2, 4, false, false, false, false, Match{}},
+		{"Backward on same line", 2, 4, true, true, true, false, Match{2, 0, 3}},
+		{"Backward on previous line", 1, 0, true, true, true, false, Match{0, 0, 3}},
+		{"Backward wraps", 0, 0, true, true, true, true, Match{2, 4, 7}},
+		{"Backward doesn't wrap", 0, 0, true, false, false, false, Match{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m, found, wrapped := b.Find(s, tc.line, tc.pos, tc.backward, tc.wrap)
+			if found != tc.found || wrapped != tc.wrapped || m != tc.match {
+				t.Errorf("Expected %v %v %v, got %v %v %v", tc.match, tc.found, tc.wrapped, m, found, wrapped)
+			}
+		})
+	}
+	t.Run("Only match is the one at the cursor", func(t *testing.T) {
+		b := BuildBuffer("a foo", "b")
+		m, found, wrapped := b.Find(s, 0, 2, false, true)
+		if !found || !wrapped || m != (Match{0, 2, 5}) {
+			t.Errorf("Unexpected result %v %v %v", m, found, wrapped)
+		}
+	})
+}
@@ -0,0 +1,253 @@
+package novi
+
+/*
+ * Buffer contents are kept in a lineStore. The default store is a plain slice
+ * of Lines, which is simple and fast for regular files. Large files are kept
+ * in a rope of line chunks in stead: lines are stored as (utf-8) strings in
+ * chunks of limited size, and a Fenwick tree over the chunk sizes makes it
+ * possible to find a line in O(log n). Inserting/removing lines only affects
+ * a single chunk, so editing near the top of a huge file stays cheap, and
+ * memory usage is about one byte per (ascii) character.
+ */
+
+// StorageType selects how a buffer stores its lines
+type StorageType int
+
+// The available storage types. StorageAuto selects the rope for files
+// larger than RopeThreshold
+const (
+	StorageAuto StorageType = iota
+	StorageSlice
+	StorageRope
+)
+
+// RopeThreshold is the size in bytes above which StorageAuto switches to the rope
+var RopeThreshold = 8 * 1024 * 1024
+
+// lineStore is the interface a line storage engine implements
+type lineStore interface {
+	Len() int
+	Get(i int) *Line
+	Set(i int, l *Line)
+	// Replace replaces the lines [start, end) with lines
+	Replace(start, end int, lines []*Line)
+	// Strings returns all lines as strings
+	Strings() []string
+}
+
+// sliceStore stores lines in a plain slice
+type sliceStore struct {
+	lines []*Line
+}
+
+func newSliceStore(lines []string) *sliceStore {
+	s := &sliceStore{lines: make([]*Line, len(lines))}
+	for i, l := range lines {
+		s.lines[i] = NewLineFromString(l)
+	}
+	return s
+}
+
+func (s *sliceStore) Len() int {
+	return len(s.lines)
+}
+
+func (s *sliceStore) Get(i int) *Line {
+	return s.lines[i]
+}
+
+func (s *sliceStore) Set(i int, l *Line) {
+	s.lines[i] = l
+}
+
+func (s *sliceStore) Replace(start, end int, lines []*Line) {
+	if len(lines) == end-start {
+		copy(s.lines[start:], lines)
+		return
+	}
+	// move the lines after the replaced ones in place, so editing doesn't
+	// allocate a copy of the entire buffer
+	n := len(s.lines)
+	delta := len(lines) - (end - start)
+	if delta > 0 {
+		s.lines = append(s.lines, make([]*Line, delta)...)
+	}
+	copy(s.lines[end+delta:], s.lines[end:n])
+	if delta < 0 {
+		for i := n + delta; i < n; i++ {
+			s.lines[i] = nil
+		}
+		s.lines = s.lines[:n+delta]
+	}
+	copy(s.lines[start:], lines)
+}
+
+func (s *sliceStore) Strings() []string {
+	res := make([]string, len(s.lines))
+	for i, l := range s.lines {
+		res[i] = l.ToString()
+	}
+	return res
+}
+
+// ropeChunkSize is the preferred number of lines in a rope chunk. Chunks are
+// split when they grow beyond twice this size
+const ropeChunkSize = 512
+
+// ropeStore stores lines as strings in chunks
+type ropeStore struct {
+	chunks [][]string
+	sizes  []int // Fenwick tree over chunk sizes, 1-based
+	length int
+}
+
+func newRopeStore(lines []string) *ropeStore {
+	r := &ropeStore{}
+	for len(lines) > 0 {
+		n := ropeChunkSize
+		if n > len(lines) {
+			n = len(lines)
+		}
+		chunk := make([]string, n, n*2)
+		copy(chunk, lines[:n])
+		r.chunks = append(r.chunks, chunk)
+		lines = lines[n:]
+	}
+	r.rebuild()
+	return r
+}
+
+// rebuild rebuilds the Fenwick tree, necessary when chunks are added/removed
+func (r *ropeStore) rebuild() {
+	r.sizes = make([]int, len(r.chunks)+1)
+	r.length = 0
+	for i, c := range r.chunks {
+		r.sizes[i+1] += len(c)
+		if j := (i + 1) + ((i + 1) & -(i + 1)); j <= len(r.chunks) {
+			r.sizes[j] += r.sizes[i+1]
+		}
+		r.length += len(c)
+	}
+}
+
+// grow adjusts the size of chunk ci by delta
+func (r *ropeStore) grow(ci, delta int) {
+	for i := ci + 1; i < len(r.sizes); i += i & -i {
+		r.sizes[i] += delta
+	}
+	r.length += delta
+}
+
+// find returns the chunk containing line i and the offset within that chunk
+func (r *ropeStore) find(i int) (int, int) {
+	pos, rem := 0, i
+	step := 1
+	for step*2 <= len(r.chunks) {
+		step *= 2
+	}
+	for ; step > 0; step /= 2 {
+		if pos+step <= len(r.chunks) && r.sizes[pos+step] <= rem {
+			pos += step
+			rem -= r.sizes[pos]
+		}
+	}
+	return pos, rem
+}
+
+func (r *ropeStore) Len() int {
+	return r.length
+}
+
+func (r *ropeStore) Get(i int) *Line {
+	ci, off := r.find(i)
+	return NewLineFromString(r.chunks[ci][off])
+}
+
+func (r *ropeStore) Set(i int, l *Line) {
+	ci, off := r.find(i)
+	r.chunks[ci][off] = l.ToString()
+}
+
+func (r *ropeStore) Replace(start, end int, lines []*Line) {
+	if len(lines) == end-start {
+		for i, l := range lines {
+			r.Set(start+i, l)
+		}
+		return
+	}
+	r.remove(start, end)
+	r.insert(start, lines)
+}
+
+// remove removes the lines [start, end)
+func (r *ropeStore) remove(start, end int) {
+	for end > start {
+		ci, off := r.find(start)
+		chunk := r.chunks[ci]
+		n := len(chunk) - off
+		if n > end-start {
+			n = end - start
+		}
+		r.chunks[ci] = append(chunk[:off], chunk[off+n:]...)
+		if len(r.chunks[ci]) == 0 {
+			r.chunks = append(r.chunks[:ci], r.chunks[ci+1:]...)
+			r.rebuild()
+		} else {
+			r.grow(ci, -n)
+		}
+		end -= n
+	}
+}
+
+// insert inserts lines before line i
+func (r *ropeStore) insert(i int, lines []*Line) {
+	if len(lines) == 0 {
+		return
+	}
+	strs := make([]string, len(lines))
+	for j, l := range lines {
+		strs[j] = l.ToString()
+	}
+	if len(r.chunks) == 0 {
+		r.chunks = [][]string{nil}
+		r.rebuild()
+	}
+
+	var ci, off int
+	if i >= r.length {
+		ci = len(r.chunks) - 1
+		off = len(r.chunks[ci])
+	} else {
+		ci, off = r.find(i)
+	}
+	chunk := r.chunks[ci]
+	chunk = append(chunk[:off], append(strs, chunk[off:]...)...)
+
+	if len(chunk) <= ropeChunkSize*2 {
+		r.chunks[ci] = chunk
+		r.grow(ci, len(strs))
+		return
+	}
+	// split the chunk into chunks of the preferred size
+	var parts [][]string
+	for len(chunk) > 0 {
+		n := ropeChunkSize
+		if n > len(chunk) {
+			n = len(chunk)
+		}
+		part := make([]string, n, n*2)
+		copy(part, chunk[:n])
+		parts = append(parts, part)
+		chunk = chunk[n:]
+	}
+	r.chunks = append(r.chunks[:ci], append(parts, r.chunks[ci+1:]...)...)
+	r.rebuild()
+}
+
+func (r *ropeStore) Strings() []string {
+	res := make([]string, 0, r.length)
+	for _, c := range r.chunks {
+		res = append(res, c...)
+	}
+	return res
+}
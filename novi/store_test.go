@@ -0,0 +1,124 @@
+package novi
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func buildLines(n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d %s", i, strings.Repeat("x", i%40))
+	}
+	return lines
+}
+
+func AssertBuffersEqual(t *testing.T, a, b *Buffer) {
+	t.Helper()
+
+	if a.Length() != b.Length() {
+		t.Fatalf("Buffer lengths differ: %d and %d", a.Length(), b.Length())
+	}
+	for i := 0; i < a.Length(); i++ {
+		if la, lb := a.GetLine(i).ToString(), b.GetLine(i).ToString(); la != lb {
+			t.Fatalf("Mismatch at line %d\n%s\n%s", i, la, lb)
+		}
+	}
+}
+
+func TestStorage(t *testing.T) {
+	t.Run("Auto selects rope for large content", func(t *testing.T) {
+		old := RopeThreshold
+		defer func() { RopeThreshold = old }()
+		RopeThreshold = 100
+
+		if s := BuildBuffer("small").Storage(); s != StorageSlice {
+			t.Errorf("Expected slice storage for small buffer, got %d", s)
+		}
+		if s := BuildBuffer(buildLines(100)...).Storage(); s != StorageRope {
+			t.Errorf("Expected rope storage for large buffer, got %d", s)
+		}
+	})
+	t.Run("Converting storage preserves content", func(t *testing.T) {
+		b := BuildBuffer(buildLines(3000)...)
+		r := BuildBuffer(buildLines(3000)...).SetStorage(StorageRope)
+
+		if r.Storage() != StorageRope {
+			t.Fatal("Expected rope storage")
+		}
+		AssertBuffersEqual(t, b, r)
+	})
+	t.Run("Rope and slice behave identically", func(t *testing.T) {
+		lines := buildLines(3000)
+		s := NewBuffer().SetStorage(StorageSlice).LoadStrings(lines)
+		r := NewBuffer().SetStorage(StorageRope).LoadStrings(lines)
+		rnd := rand.New(rand.NewSource(42))
+
+		for i := 0; i < 5000; i++ {
+			line := rnd.Intn(s.Length())
+			pos := rnd.Intn(s.GetLine(line).Len() + 1)
+			extra := rnd.Intn(3)
+			for _, b := range []*Buffer{s, r} {
+				c := b.NewCursor(line, pos)
+				switch i % 6 {
+				case 0:
+					b.PutRuneAtCursors(Cursors{c}, 'a')
+				case 1:
+					b.SplitLine(c)
+				case 2:
+					b.RemoveLine(line)
+				case 3:
+					b.JoinLineWithPrevious(line)
+				case 4:
+					b.InsertLine(c, "inserted", i%4 == 0)
+				case 5:
+					end := line + extra
+					if end >= b.Length() {
+						end = b.Length() - 1
+					}
+					b.RemoveBetweenCursors(c, b.NewCursor(end, 0))
+				}
+			}
+		}
+		AssertBuffersEqual(t, s, r)
+
+		// and undo everything
+		for s.Undo(nil) {
+			r.Undo(nil)
+		}
+		AssertBuffersEqual(t, s, r)
+		AssertBufferMatch(t, r, lines...)
+	})
+	t.Run("Remove everything from rope", func(t *testing.T) {
+		b := NewBuffer().SetStorage(StorageRope).LoadStrings(buildLines(2000))
+		b.RemoveBetweenCursors(b.NewCursor(0, 0), b.NewCursor(1999, 100))
+		AssertBufferMatch(t, b, "")
+
+		b.InsertLine(b.NewCursor(0, 0), "new", false)
+		AssertBufferMatch(t, b, "", "new")
+	})
+}
+
+/*
+ * Benchmarks editing near the top of a large buffer. The rope keeps edits
+ * cheap independent of the size of the buffer, e.g.
+ *
+ * go test -bench Storage -benchtime 1000x ./novi/
+ */
+func benchmarkEdits(bm *testing.B, storage StorageType, size int) {
+	b := NewBuffer().SetStorage(storage).LoadStrings(buildLines(size))
+	c := b.NewCursor(10, 3)
+	bm.ResetTimer()
+	for i := 0; i < bm.N; i++ {
+		b.SplitLine(c)
+		b.PutRuneAtCursors(Cursors{c}, 'x')
+		b.JoinLineWithPrevious(c.Line + 1)
+	}
+}
+
+func BenchmarkStorageSlice100k(b *testing.B) { benchmarkEdits(b, StorageSlice, 100000) }
+func BenchmarkStorageSlice4M(b *testing.B)   { benchmarkEdits(b, StorageSlice, 4000000) }
+func BenchmarkStorageRope100k(b *testing.B)  { benchmarkEdits(b, StorageRope, 100000) }
+func BenchmarkStorageRope4M(b *testing.B)    { benchmarkEdits(b, StorageRope, 4000000) }
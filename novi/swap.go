@@ -0,0 +1,467 @@
+package novi
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/*
+ * Crash recovery through swap files. All changes made to a buffer are
+ * journaled and periodically appended to a swap file, either next to the
+ * edited file or in a state directory. The swap file starts with a header
+ * identifying the file, the process that's editing it and the state of the
+ * file the changes apply to (the base). Each following line is a Change in
+ * JSON format.
+ *
+ * When the file is saved, the swap is reset with the saved file as base. When
+ * the journal grows too large (or the buffer was replaced entirely) the swap
+ * is rewritten as a single change that inserts the entire buffer into an
+ * empty one.
+ *
+ * Recovering means loading the base and replaying the changes from the swap.
+ */
+
+// SwapInterval is how often the Core writes pending changes to the swap file
+var SwapInterval = 4 * time.Second
+
+// swapCompact is the number of changes after which the swap is rewritten
+const swapCompact = 10000
+
+// swapSuffix is the extension of swap files
+const swapSuffix = ".novi.swp"
+
+// SwapOptions configure the use of swap files
+type SwapOptions struct {
+	Disabled bool
+	Dir      string // if empty, next to the file and DefaultSwapDir() if that fails
+}
+
+// ErrNoSwap is returned when recovering a file without a swap
+var ErrNoSwap = errors.New("E305: No swap file found")
+
+// swapHeader is the first line of a swap file
+type swapHeader struct {
+	Version int    `json:"novi-swap"`
+	File    string `json:"file"`
+	PID     int    `json:"pid"`
+	Host    string `json:"host"`
+	Base    string `json:"base"` // hash of the file the changes apply to, empty for an empty buffer
+}
+
+// SwapInfo describes an existing swap file
+type SwapInfo struct {
+	Path    string
+	File    string // the file being edited
+	PID     int
+	Host    string
+	Running bool // the process that owns the swap is still running
+	ModTime time.Time
+	Changes int
+
+	header swapHeader
+}
+
+// journal collects the changes made to a buffer so they can be written to a swap file
+type journal struct {
+	changes []Change
+	reset   bool // the entire contents of the buffer were replaced
+}
+
+// BufferChanged records a change. Lines added while loading are part of the
+// file, not changes
+func (j *journal) BufferChanged(b *Buffer, ch *Change) {
+	if ch == nil && b.Loading() {
+		return
+	}
+	if ch == nil {
+		j.changes = nil
+		j.reset = true
+	} else {
+		j.changes = append(j.changes, *ch)
+	}
+}
+
+// take returns and clears the journaled changes
+func (j *journal) take() ([]Change, bool) {
+	changes, reset := j.changes, j.reset
+	j.changes, j.reset = nil, false
+	return changes, reset
+}
+
+// swapFile is the swap file in use by the editor
+type swapFile struct {
+	path        string
+	f           *os.File
+	count       int
+	failed      bool
+	journal     *journal
+	unsubscribe func()
+}
+
+// DefaultSwapDir returns the directory where swap files are stored if they
+// can't be stored next to the file
+func DefaultSwapDir() string {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "novi", "swap")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "state", "novi", "swap")
+	}
+	return filepath.Join(os.TempDir(), "novi-swap")
+}
+
+// SwapName returns the name of the swap file for file. If dir is empty it's
+// stored next to the file, else the full path is encoded in the name
+func SwapName(file, dir string) string {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		abs = file
+	}
+	if dir == "" {
+		d, base := filepath.Split(abs)
+		return filepath.Join(d, "."+base+swapSuffix)
+	}
+	return filepath.Join(dir, strings.Replace(abs, string(filepath.Separator), "%", -1)+swapSuffix)
+}
+
+// swapCandidates returns the places where a swap for file may be found
+func (e *Editor) swapCandidates(file string) []string {
+	if e.SwapOptions.Dir != "" {
+		return []string{SwapName(file, e.SwapOptions.Dir)}
+	}
+	return []string{SwapName(file, ""), SwapName(file, DefaultSwapDir())}
+}
+
+func readSwap(path string) (*SwapInfo, []Change, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	info := &SwapInfo{Path: path}
+	if stat, err := f.Stat(); err == nil {
+		info.ModTime = stat.ModTime()
+	}
+	r := bufio.NewReader(f)
+	line, err := r.ReadString('\n')
+	if err := json.Unmarshal([]byte(line), &info.header); err != nil || info.header.Version != 1 {
+		return nil, nil, fmt.Errorf("%s is not a swap file", path)
+	}
+	info.File = info.header.File
+	info.PID = info.header.PID
+	info.Host = info.header.Host
+	host, _ := os.Hostname()
+	info.Running = info.Host == host && processRunning(info.PID)
+
+	var changes []Change
+	for err == nil {
+		line, err = r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, nil, err
+		}
+		if line == "" {
+			break
+		}
+		var ch Change
+		if json.Unmarshal([]byte(line), &ch) != nil {
+			// most likely a partially written change when crashing
+			log.Printf("Ignoring corrupt change in %s", path)
+			break
+		}
+		changes = append(changes, ch)
+	}
+	info.Changes = len(changes)
+	return info, changes, nil
+}
+
+// ReadSwapInfo reads the header of a swap file
+func ReadSwapInfo(path string) (*SwapInfo, error) {
+	info, _, err := readSwap(path)
+	return info, err
+}
+
+// FindSwapFiles lists all swap files in the given directories
+func FindSwapFiles(dirs ...string) []*SwapInfo {
+	var res []*SwapInfo
+	for _, dir := range dirs {
+		names, err := filepath.Glob(filepath.Join(dir, "*"+swapSuffix))
+		if err != nil {
+			continue
+		}
+		// Glob skips hidden files on some platforms, swaps next to files are hidden
+		hidden, _ := filepath.Glob(filepath.Join(dir, ".*"+swapSuffix))
+		seen := map[string]bool{}
+		for _, name := range append(names, hidden...) {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			if info, err := ReadSwapInfo(name); err == nil {
+				res = append(res, info)
+			}
+		}
+	}
+	return res
+}
+
+// openSwap prepares the swap for the current file after loading it. An
+// existing swap from another process is made available through SwapFound
+func (e *Editor) openSwap() {
+	e.closeSwap()
+	e.swapFound = nil
+	if e.SwapOptions.Disabled || e.filename == "" {
+		return
+	}
+	for _, path := range e.swapCandidates(e.filename) {
+		info, err := ReadSwapInfo(path)
+		if err != nil {
+			continue
+		}
+		host, _ := os.Hostname()
+		if info.PID == os.Getpid() && info.Host == host {
+			// our own, e.g. when reloading
+			os.Remove(path)
+			continue
+		}
+		e.swapFound = info
+		if info.Running {
+			// don't touch the swap of a process that's still editing the file
+			log.Printf("Swap %s in use by process %d, not using a swap", path, info.PID)
+			return
+		}
+	}
+	j := &journal{}
+	e.swap = &swapFile{journal: j, unsubscribe: e.Buffer.Subscribe(j)}
+}
+
+// SwapFound returns the swap file that was found when loading the file, if any
+func (e *Editor) SwapFound() *SwapInfo {
+	return e.swapFound
+}
+
+// IgnoreSwap leaves the swap that was found alone. If it's not in use by
+// another process it may be overwritten by the editor's own swap
+func (e *Editor) IgnoreSwap() {
+	e.swapFound = nil
+}
+
+// DeleteSwap removes the swap that was found
+func (e *Editor) DeleteSwap() error {
+	if e.swapFound == nil {
+		return nil
+	}
+	err := os.Remove(e.swapFound.Path)
+	e.swapFound = nil
+	return err
+}
+
+// FinishLoad waits until a file that's loaded in the background is fully
+// loaded. Batches of other documents that arrive meanwhile are handled too,
+// their errors are kept with those documents
+func (e *Editor) FinishLoad() error {
+	for e.stopLoading != nil {
+		batch := <-e.loaded
+		if err := e.HandleLoadBatch(batch); err != nil && batch.doc == e.Document {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecoverSwap applies the changes from the swap that was found to the buffer
+// as a single undoable change. It returns the number of recovered changes
+func (e *Editor) RecoverSwap() (int, error) {
+	if e.swapFound == nil {
+		return 0, ErrNoSwap
+	}
+	if err := e.FinishLoad(); err != nil {
+		return 0, err
+	}
+	info, changes, err := readSwap(e.swapFound.Path)
+	if err != nil {
+		return 0, err
+	}
+	base := info.header.Base
+	if base != "" && base != hex.EncodeToString(e.disk.hash) {
+		return 0, fmt.Errorf("E308: %s changed since the swap file was written, can't recover", e.filename)
+	}
+
+	b := e.Buffer
+	b.BeginChange(e.Cursors)
+	if base == "" {
+		// the changes apply to an empty buffer
+		b.replace(0, 0, b.Length()-1, b.GetLine(b.Length()-1).Len(), []string{""})
+	}
+	for i, ch := range changes {
+		l, p := ch.RemovedEnd()
+		if l >= b.Length() || strings.Join(b.textBetween(ch.Line, ch.Pos, l, p), "\n") != strings.Join(ch.Removed, "\n") {
+			b.EndChange(e.Cursors)
+			return i, fmt.Errorf("Swap file doesn't match %s, recovered %d of %d changes", e.filename, i, len(changes))
+		}
+		b.replace(ch.Line, ch.Pos, l, p, ch.Inserted)
+	}
+	b.EndChange(e.Cursors)
+	for _, c := range e.Cursors {
+		c.Validate()
+	}
+
+	// the recovered swap is replaced by our own
+	os.Remove(e.swapFound.Path)
+	e.swapFound = nil
+	if e.swap != nil {
+		e.swap.journal.reset = true
+	}
+	return len(changes), nil
+}
+
+// createSwap (re)creates the swap file with the given base and changes
+func (e *Editor) createSwap(base []byte, changes []Change) error {
+	if e.swap.f != nil {
+		e.swap.f.Close()
+		e.swap.f = nil
+	}
+	abs, _ := filepath.Abs(e.filename)
+	host, _ := os.Hostname()
+	header := swapHeader{Version: 1, File: abs, PID: os.Getpid(), Host: host, Base: hex.EncodeToString(base)}
+
+	var lastErr error
+	for _, path := range e.swapCandidates(e.filename) {
+		if e.swapFound != nil && path == e.swapFound.Path {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			lastErr = err
+			continue
+		}
+		f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+"-")
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if err := writeSwap(f, &header, changes); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return err
+		}
+		if err := os.Rename(f.Name(), path); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return err
+		}
+		if e.swap.path != "" && e.swap.path != path {
+			os.Remove(e.swap.path)
+		}
+		e.swap.path = path
+		e.swap.f = f
+		e.swap.count = len(changes)
+		return nil
+	}
+	return lastErr
+}
+
+// writeSwap writes the header (if any) and changes to the swap file
+func writeSwap(f *os.File, header *swapHeader, changes []Change) error {
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	if header != nil {
+		if err := enc.Encode(header); err != nil {
+			return err
+		}
+	}
+	for _, ch := range changes {
+		if err := enc.Encode(ch); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// FlushSwap writes all pending changes of all documents to their swap files
+func (e *Editor) FlushSwap() error {
+	var first error
+	e.each(func() {
+		if err := e.flushSwap(); err != nil && first == nil {
+			first = err
+		}
+	})
+	return first
+}
+
+// flushSwap writes the pending changes of the current document to its swap
+// file. The swap is only created once there are changes
+func (e *Editor) flushSwap() error {
+	if e.swap == nil || e.stopLoading != nil {
+		return nil
+	}
+	changes, reset := e.swap.journal.take()
+	if !reset && len(changes) == 0 {
+		return nil
+	}
+
+	var err error
+	switch {
+	case reset || e.swap.count+len(changes) > swapCompact:
+		// rewrite the swap as the entire buffer inserted into an empty buffer
+		err = e.createSwap(nil, []Change{{Removed: []string{""}, Inserted: e.Buffer.Strings()}})
+	case e.swap.f == nil:
+		err = e.createSwap(e.disk.hash, changes)
+	default:
+		err = writeSwap(e.swap.f, nil, changes)
+		e.swap.count += len(changes)
+	}
+	if err != nil {
+		if !e.swap.failed {
+			e.swap.failed = true
+			return fmt.Errorf("E297: Write error in swap file: %w", err)
+		}
+		return nil
+	}
+	e.swap.failed = false
+	return nil
+}
+
+// resetSwap starts a new swap based on the file as it is on disk, e.g. after saving
+func (e *Editor) resetSwap() {
+	if e.swap == nil {
+		return
+	}
+	e.swap.journal.take()
+	if e.swap.f == nil {
+		return
+	}
+	if err := e.createSwap(e.disk.hash, nil); err != nil {
+		log.Printf("Failed to reset swap: %v", err)
+	}
+}
+
+// CloseSwap removes the swap files of all documents. This is done when the
+// editor is closed normally
+func (e *Editor) CloseSwap() {
+	e.each(e.closeSwap)
+}
+
+// closeSwap removes the swap file of the current document
+func (e *Editor) closeSwap() {
+	if e.swap == nil {
+		return
+	}
+	if e.swap.f != nil {
+		e.swap.f.Close()
+		os.Remove(e.swap.path)
+	}
+	e.swap.unsubscribe()
+	e.swap = nil
+}
@@ -0,0 +1,195 @@
+package novi
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// crash simulates the editor crashing by making its swap look like it
+// belongs to another process
+func crash(t *testing.T, e *Editor, pid int) string {
+	t.Helper()
+
+	if err := e.FlushSwap(); err != nil {
+		t.Fatal(err)
+	}
+	e.swap.f.Close()
+	path := e.swap.path
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected swap file: %v", err)
+	}
+	lines := strings.SplitN(string(data), "\n", 2)
+	var header swapHeader
+	json.Unmarshal([]byte(lines[0]), &header)
+	header.PID = pid
+	h, _ := json.Marshal(header)
+	lines[0] = string(h)
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSwap(t *testing.T) {
+	t.Run("Recover changes", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\nworld\n", 0644)
+		defer cleanup()
+
+		e.Buffer.PutRuneAtCursors(Cursors{e.Buffer.NewCursor(0, 5)}, '!')
+		e.Buffer.SplitLine(e.Buffer.NewCursor(1, 2))
+		path := crash(t, e, -1)
+		if filepath.Dir(path) != filepath.Dir(name) {
+			t.Errorf("Expected swap next to file, got %s", path)
+		}
+
+		r := NewEditor()
+		if err := r.LoadFile(name); err != nil {
+			t.Fatal(err)
+		}
+		swap := r.SwapFound()
+		if swap == nil || swap.Running || swap.Changes != 2 {
+			t.Fatalf("Expected stale swap with 2 changes, got %+v", swap)
+		}
+		if n, err := r.RecoverSwap(); err != nil || n != 2 {
+			t.Fatalf("Recovery failed: %d %v", n, err)
+		}
+		AssertBufferMatch(t, r.Buffer, "hello!", "wo", "rld")
+		AssertBufferModified(t, r.Buffer, true)
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Error("Expected recovered swap to be removed")
+		}
+
+		r.Buffer.Undo(r.Cursors)
+		AssertBufferMatch(t, r.Buffer, "hello", "world")
+	})
+	t.Run("Survives editing another file", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\n", 0644)
+		defer cleanup()
+
+		e.Buffer.AddLine(NewLineFromString("unsaved"))
+		if err := e.FlushSwap(); err != nil {
+			t.Fatal(err)
+		}
+		first := e.Document
+		path := first.swap.path
+		if err := e.Edit(filepath.Join(filepath.Dir(name), "other.txt"), false); err != nil {
+			t.Fatal(err)
+		}
+		if first.swap == nil {
+			t.Fatal("Expected the first document to keep its swap")
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Expected swap of the first document to remain: %v", err)
+		}
+		e.CloseSwap()
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Error("Expected swap to be removed when closing the editor")
+		}
+	})
+	t.Run("Changes after saving", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\n", 0644)
+		defer cleanup()
+
+		e.Buffer.AddLine(NewLineFromString("saved"))
+		e.FlushSwap()
+		if err := e.SaveFile("", false); err != nil {
+			t.Fatal(err)
+		}
+		e.Buffer.AddLine(NewLineFromString("unsaved"))
+		crash(t, e, -1)
+
+		r := NewEditor()
+		r.LoadFile(name)
+		if _, err := r.RecoverSwap(); err != nil {
+			t.Fatal(err)
+		}
+		AssertBufferMatch(t, r.Buffer, "hello", "saved", "unsaved")
+	})
+	t.Run("Replaced buffer is written entirely", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\n", 0644)
+		defer cleanup()
+
+		e.Buffer.LoadStrings([]string{"completely", "different"})
+		crash(t, e, -1)
+		ioutil.WriteFile(name, []byte("changed on disk\n"), 0644)
+
+		r := NewEditor()
+		r.LoadFile(name)
+		if _, err := r.RecoverSwap(); err != nil {
+			t.Fatal(err)
+		}
+		AssertBufferMatch(t, r.Buffer, "completely", "different")
+	})
+	t.Run("File changed since swap was written", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\n", 0644)
+		defer cleanup()
+
+		e.Buffer.AddLine(NewLineFromString("world"))
+		crash(t, e, -1)
+		ioutil.WriteFile(name, []byte("changed on disk\n"), 0644)
+
+		r := NewEditor()
+		r.LoadFile(name)
+		if _, err := r.RecoverSwap(); err == nil {
+			t.Error("Expected recovery to fail")
+		}
+		AssertBufferMatch(t, r.Buffer, "changed on disk")
+	})
+	t.Run("Swap in use by another process", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\n", 0644)
+		defer cleanup()
+
+		e.Buffer.AddLine(NewLineFromString("world"))
+		path := crash(t, e, 1)
+
+		r := NewEditor()
+		r.LoadFile(name)
+		if swap := r.SwapFound(); swap == nil || !swap.Running {
+			t.Fatalf("Expected swap of running process, got %+v", swap)
+		}
+		r.IgnoreSwap()
+		r.Buffer.AddLine(NewLineFromString("mine"))
+		r.FlushSwap()
+		r.CloseSwap()
+		if _, err := os.Stat(path); err != nil {
+			t.Error("Swap of other process should not be touched")
+		}
+	})
+	t.Run("Clean exit removes swap", func(t *testing.T) {
+		e, _, cleanup := setupSave(t, "hello\n", 0644)
+		defer cleanup()
+
+		e.Buffer.AddLine(NewLineFromString("world"))
+		e.FlushSwap()
+		path := e.swap.path
+		if swaps := FindSwapFiles(filepath.Dir(path)); len(swaps) != 1 || swaps[0].Path != path {
+			t.Errorf("Expected to find swap %s, got %v", path, swaps)
+		}
+		e.CloseSwap()
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Error("Expected swap to be removed")
+		}
+	})
+	t.Run("Partially written change is ignored", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\n", 0644)
+		defer cleanup()
+
+		e.Buffer.AddLine(NewLineFromString("world"))
+		path := crash(t, e, -1)
+		f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+		f.WriteString(`{"Line":1,"Pos":`)
+		f.Close()
+
+		r := NewEditor()
+		r.LoadFile(name)
+		if _, err := r.RecoverSwap(); err != nil {
+			t.Fatal(err)
+		}
+		AssertBufferMatch(t, r.Buffer, "hello", "world")
+	})
+}
@@ -0,0 +1,250 @@
+package novi
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+ * Syntax highlighting. A Lexer splits a line into tokens of a TokenType,
+ * which the UI maps to a style using a theme. Tokens can depend on the lines
+ * before (e.g. inside a multi-line comment), so lexing a line starts in the
+ * LexState the previous line ended in.
+ *
+ * The Syntax of a document keeps the tokens and start state of every line.
+ * It listens to changes of the buffer and only lexes the changed lines again,
+ * and the lines after them as long as their start state changes. Lines are
+ * lexed when they're asked for, so a large file is only lexed up to the last
+ * line shown.
+ *
+ * Lexers for the languages below are built in, see the syntax_*.go files.
+ */
+
+// TokenType is the kind of text a token is
+type TokenType int
+
+// The token types. Text is anything that isn't highlighted
+const (
+	TokenText TokenType = iota
+	TokenKeyword
+	TokenTypeName
+	TokenBuiltin
+	TokenConstant
+	TokenString
+	TokenNumber
+	TokenComment
+	TokenOperator
+	TokenKey
+	TokenVariable
+	TokenHeading
+	TokenEmphasis
+	TokenCode
+	TokenLink
+)
+
+// Token is a part of a line of a single type
+type Token struct {
+	Pos, End int // the runes of the token, from Pos up to (not including) End
+	Type     TokenType
+}
+
+// LexState is the state a lexer is in at the start of a line, e.g. inside a
+// multi-line comment. Its meaning is up to the lexer, the zero value "" is
+// the state at the start of a buffer
+type LexState string
+
+// Lexer splits lines into tokens
+type Lexer interface {
+	// Name returns the name of the language, e.g. for :set syntax
+	Name() string
+	// Lex returns the tokens of a line, ordered and not overlapping, and the
+	// state the next line starts in
+	Lex(line []rune, state LexState) ([]Token, LexState)
+}
+
+// lexers are the built in lexers, with the file extensions they're used for
+var lexers = []struct {
+	lexer      Lexer
+	extensions []string
+}{
+	{GoLexer{}, []string{".go"}},
+	{MarkdownLexer{}, []string{".md", ".markdown"}},
+	{JSONLexer{}, []string{".json"}},
+	{YAMLLexer{}, []string{".yaml", ".yml"}},
+	{ShellLexer{}, []string{".sh", ".bash", ".bashrc", ".profile"}},
+}
+
+// LexerByName returns the lexer for a language, nil if there's none
+func LexerByName(name string) Lexer {
+	for _, l := range lexers {
+		if l.lexer.Name() == name {
+			return l.lexer
+		}
+	}
+	return nil
+}
+
+// LexerFor returns the lexer for a file based on its extension, nil if
+// there's none
+func LexerFor(filename string) Lexer {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if ext == "" {
+		// dot files, e.g. .bashrc
+		ext = filepath.Base(filename)
+	}
+	for _, l := range lexers {
+		for _, e := range l.extensions {
+			if e == ext {
+				return l.lexer
+			}
+		}
+	}
+	return nil
+}
+
+// Syntax keeps the tokens of every line of a buffer up to date
+type Syntax struct {
+	Lexer       Lexer
+	buffer      *Buffer
+	unsubscribe func()
+
+	states []LexState // the state every line starts in
+	tokens [][]Token
+	valid  []bool   // if the tokens and the state after the line are up to date
+	dirty  int      // no line before this one is invalid
+	last   LexState // the state after the last line, if it's valid
+}
+
+// NewSyntax starts highlighting a buffer with a lexer
+func NewSyntax(b *Buffer, l Lexer) *Syntax {
+	s := &Syntax{Lexer: l, buffer: b}
+	s.reset()
+	s.unsubscribe = b.Subscribe(s)
+	return s
+}
+
+// Close stops highlighting the buffer
+func (s *Syntax) Close() {
+	s.unsubscribe()
+}
+
+// reset invalidates all lines
+func (s *Syntax) reset() {
+	n := s.buffer.Length()
+	s.states = make([]LexState, n)
+	s.tokens = make([][]Token, n)
+	s.valid = make([]bool, n)
+	s.dirty = 0
+	s.last = ""
+}
+
+// extend adds the lines that were appended to the buffer while loading. The
+// lines that were already lexed stay valid
+func (s *Syntax) extend() {
+	n := len(s.states)
+	added := s.buffer.Length() - n
+	s.states = append(s.states, make([]LexState, added)...)
+	s.tokens = append(s.tokens, make([][]Token, added)...)
+	s.valid = append(s.valid, make([]bool, added)...)
+	if added > 0 && n > 0 {
+		s.states[n] = s.last
+	}
+}
+
+// BufferChanged invalidates the lines that changed. A nil change while the
+// buffer is loading means lines were appended, otherwise it invalidates
+// everything
+func (s *Syntax) BufferChanged(b *Buffer, ch *Change) {
+	if ch == nil {
+		if b.Loading() {
+			s.extend()
+		} else {
+			s.reset()
+		}
+		return
+	}
+	rl, _ := ch.RemovedEnd()
+	il, _ := ch.InsertedEnd()
+	// replace the entries of lines ch.Line up to rl by those of ch.Line up to
+	// il, the changed line keeps the state it starts in
+	added := il - ch.Line
+	states := make([]LexState, added)
+	s.states = append(s.states[:ch.Line+1], append(states, s.states[rl+1:]...)...)
+	s.tokens = append(s.tokens[:ch.Line+1], append(make([][]Token, added), s.tokens[rl+1:]...)...)
+	s.valid = append(s.valid[:ch.Line+1], append(make([]bool, added), s.valid[rl+1:]...)...)
+	for i := ch.Line; i <= il; i++ {
+		s.valid[i] = false
+	}
+	if ch.Line < s.dirty {
+		s.dirty = ch.Line
+	}
+}
+
+// Tokens returns the tokens of a line, lexing it (and the lines before it)
+// if needed
+func (s *Syntax) Tokens(line int) []Token {
+	if line < 0 || line >= len(s.states) {
+		return nil
+	}
+	for i := s.dirty; i <= line; i++ {
+		if s.valid[i] {
+			continue
+		}
+		tokens, next := s.Lexer.Lex(s.buffer.GetLine(i).AllRunes(), s.states[i])
+		s.tokens[i] = tokens
+		s.valid[i] = true
+		if i+1 == len(s.states) {
+			s.last = next
+		} else if s.states[i+1] != next {
+			// the next line starts differently, its tokens may change too
+			s.states[i+1] = next
+			s.valid[i+1] = false
+		}
+	}
+	for s.dirty < len(s.valid) && s.valid[s.dirty] {
+		s.dirty++
+	}
+	return s.tokens[line]
+}
+
+// TokenAt returns the type of the token that contains rune pos, TokenText if
+// there's none
+func TokenAt(tokens []Token, pos int) TokenType {
+	for _, t := range tokens {
+		if pos < t.Pos {
+			break
+		}
+		if pos < t.End {
+			return t.Type
+		}
+	}
+	return TokenText
+}
+
+// SetLexer sets the lexer used to highlight the document, nil disables
+// highlighting
+func (d *Document) SetLexer(l Lexer) {
+	if d.Syntax != nil {
+		d.Syntax.Close()
+		d.Syntax = nil
+	}
+	if l != nil {
+		d.Syntax = NewSyntax(d.Buffer, l)
+	}
+}
+
+// runeOffsets returns the rune index of every byte offset in s, including
+// the offset just past its end
+func runeOffsets(s string) []int {
+	offsets := make([]int, len(s)+1)
+	n := -1
+	for i := 0; i < len(s); i++ {
+		if utf8.RuneStart(s[i]) {
+			n++
+		}
+		offsets[i] = n
+	}
+	offsets[len(s)] = n + 1
+	return offsets
+}
@@ -0,0 +1,121 @@
+package novi
+
+import (
+	"go/scanner"
+	"go/token"
+	"strings"
+)
+
+/*
+ * Go, lexed with go/scanner. Block comments and raw strings can span lines,
+ * the state of a line starting inside one is "comment" or "raw".
+ */
+
+// the identifiers that aren't keywords, but are highlighted
+var (
+	goTypes = map[string]bool{
+		"bool": true, "byte": true, "complex64": true, "complex128": true,
+		"error": true, "float32": true, "float64": true, "int": true,
+		"int8": true, "int16": true, "int32": true, "int64": true,
+		"rune": true, "string": true, "uint": true, "uint8": true,
+		"uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+	}
+	goConstants = map[string]bool{"true": true, "false": true, "nil": true, "iota": true}
+	goBuiltins  = map[string]bool{
+		"append": true, "cap": true, "close": true, "complex": true, "copy": true,
+		"delete": true, "imag": true, "len": true, "make": true, "new": true,
+		"panic": true, "print": true, "println": true, "real": true, "recover": true,
+	}
+)
+
+// GoLexer highlights Go
+type GoLexer struct{}
+
+// Name returns the name of the language
+func (GoLexer) Name() string {
+	return "go"
+}
+
+// Lex returns the tokens of a line of Go
+func (GoLexer) Lex(line []rune, state LexState) ([]Token, LexState) {
+	var tokens []Token
+	start := 0
+	// finish the comment or raw string the line starts in
+	switch state {
+	case "comment", "raw":
+		end := "*/"
+		typ := TokenComment
+		if state == "raw" {
+			end, typ = "`", TokenString
+		}
+		i := strings.Index(string(line), end)
+		if i == -1 {
+			return []Token{{0, len(line), typ}}, state
+		}
+		start = len([]rune(string(line)[:i+len(end)]))
+		tokens = append(tokens, Token{0, start, typ})
+	}
+
+	src := []byte(string(line[start:]))
+	offsets := runeOffsets(string(src))
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	var s scanner.Scanner
+	s.Init(file, src, func(token.Position, string) {}, scanner.ScanComments)
+
+	state = ""
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		offset := file.Offset(pos)
+		if tok == token.SEMICOLON && lit == "\n" {
+			// automatically inserted
+			continue
+		}
+		if lit == "" {
+			lit = tok.String()
+		}
+		typ := TokenText
+		switch {
+		case tok.IsKeyword():
+			typ = TokenKeyword
+		case tok == token.IDENT && goTypes[lit]:
+			typ = TokenTypeName
+		case tok == token.IDENT && goConstants[lit]:
+			typ = TokenConstant
+		case tok == token.IDENT && goBuiltins[lit]:
+			typ = TokenBuiltin
+		case tok == token.INT || tok == token.FLOAT || tok == token.IMAG:
+			typ = TokenNumber
+		case tok == token.CHAR || tok == token.STRING:
+			typ = TokenString
+			if lit[0] == '`' && (len(lit) == 1 || lit[len(lit)-1] != '`') {
+				state = "raw"
+			}
+		case tok == token.COMMENT:
+			typ = TokenComment
+			if strings.HasPrefix(lit, "/*") && (len(lit) < 4 || !strings.HasSuffix(lit, "*/")) {
+				state = "comment"
+			}
+		case tok.IsOperator():
+			switch tok {
+			case token.LPAREN, token.RPAREN, token.LBRACK, token.RBRACK, token.LBRACE,
+				token.RBRACE, token.COMMA, token.SEMICOLON, token.PERIOD, token.COLON:
+				// punctuation isn't highlighted
+			default:
+				typ = TokenOperator
+			}
+		}
+		if typ == TokenText {
+			continue
+		}
+		end := offset + len(lit)
+		if end > len(src) {
+			end = len(src)
+		}
+		tokens = append(tokens, Token{start + offsets[offset], start + offsets[end], typ})
+	}
+	return tokens, state
+}
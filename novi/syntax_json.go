@@ -0,0 +1,71 @@
+package novi
+
+import "unicode"
+
+/*
+ * JSON. Nothing spans lines, so there's no state. Strings followed by a colon
+ * are object keys.
+ */
+
+// JSONLexer highlights JSON
+type JSONLexer struct{}
+
+// Name returns the name of the language
+func (JSONLexer) Name() string {
+	return "json"
+}
+
+// Lex returns the tokens of a line of JSON
+func (JSONLexer) Lex(line []rune, state LexState) ([]Token, LexState) {
+	var tokens []Token
+	for pos := 0; pos < len(line); {
+		r := line[pos]
+		switch {
+		case r == '"':
+			end := pos + 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end < len(line) {
+				end++
+			} else {
+				// unterminated, or ending in a backslash
+				end = len(line)
+			}
+			typ := TokenString
+			next := end
+			for next < len(line) && unicode.IsSpace(line[next]) {
+				next++
+			}
+			if next < len(line) && line[next] == ':' {
+				typ = TokenKey
+			}
+			tokens = append(tokens, Token{pos, end, typ})
+			pos = end
+		case r == '-' || unicode.IsDigit(r):
+			end := pos + 1
+			for end < len(line) && (unicode.IsDigit(line[end]) || line[end] == '.' ||
+				line[end] == 'e' || line[end] == 'E' || line[end] == '+' || line[end] == '-') {
+				end++
+			}
+			tokens = append(tokens, Token{pos, end, TokenNumber})
+			pos = end
+		case unicode.IsLetter(r):
+			end := pos
+			for end < len(line) && unicode.IsLetter(line[end]) {
+				end++
+			}
+			switch string(line[pos:end]) {
+			case "true", "false", "null":
+				tokens = append(tokens, Token{pos, end, TokenConstant})
+			}
+			pos = end
+		default:
+			pos++
+		}
+	}
+	return tokens, ""
+}
@@ -0,0 +1,157 @@
+package novi
+
+import (
+	"strings"
+	"unicode"
+)
+
+/*
+ * Markdown. Fenced code blocks span lines, the state of a line inside one is
+ * the fence that started it (``` or ~~~). Within a line headings, list and
+ * quote markers, code spans, emphasis and links are highlighted.
+ */
+
+// MarkdownLexer highlights Markdown
+type MarkdownLexer struct{}
+
+// Name returns the name of the language
+func (MarkdownLexer) Name() string {
+	return "markdown"
+}
+
+// mdFence returns the fence a (trimmed) line starts with, if any
+func mdFence(s string) string {
+	for _, fence := range []string{"```", "~~~"} {
+		if strings.HasPrefix(s, fence) {
+			return fence
+		}
+	}
+	return ""
+}
+
+// Lex returns the tokens of a line of Markdown
+func (MarkdownLexer) Lex(line []rune, state LexState) ([]Token, LexState) {
+	s := string(line)
+	trimmed := strings.TrimLeft(s, " ")
+	indent := len(line) - len([]rune(trimmed))
+	all := []Token{{0, len(line), TokenCode}}
+
+	if state != "" {
+		if strings.HasPrefix(trimmed, string(state)) && strings.TrimSpace(trimmed[3:]) == "" {
+			state = ""
+		}
+		return all, state
+	}
+	if indent > 3 {
+		// an indented code block (or the continuation of a list item)
+		return nil, ""
+	}
+	if fence := mdFence(trimmed); fence != "" {
+		return all, LexState(fence)
+	}
+	if strings.HasPrefix(trimmed, "#") {
+		level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+		if rest := trimmed[level:]; level <= 6 && (rest == "" || rest[0] == ' ') {
+			return []Token{{0, len(line), TokenHeading}}, ""
+		}
+	}
+	if r := strings.Replace(trimmed, " ", "", -1); len(r) >= 3 && (strings.Trim(r, "-") == "" ||
+		strings.Trim(r, "*") == "" || strings.Trim(r, "_") == "" || strings.Trim(r, "=") == "") {
+		// a rule, or the underline of a heading
+		return []Token{{0, len(line), TokenOperator}}, ""
+	}
+
+	var tokens []Token
+	pos := indent
+	// block quotes and list items
+	for pos < len(line) {
+		switch r := line[pos]; {
+		case r == '>':
+			tokens = append(tokens, Token{pos, pos + 1, TokenOperator})
+			pos++
+		case (r == '-' || r == '*' || r == '+') && pos+1 < len(line) && line[pos+1] == ' ':
+			tokens = append(tokens, Token{pos, pos + 1, TokenOperator})
+			pos++
+		case unicode.IsDigit(r):
+			end := pos
+			for end < len(line) && unicode.IsDigit(line[end]) {
+				end++
+			}
+			if end+1 < len(line) && (line[end] == '.' || line[end] == ')') && line[end+1] == ' ' {
+				tokens = append(tokens, Token{pos, end + 1, TokenOperator})
+				pos = end + 1
+				continue
+			}
+			return append(tokens, mdInline(line, pos)...), ""
+		case r == ' ':
+			pos++
+		default:
+			return append(tokens, mdInline(line, pos)...), ""
+		}
+	}
+	return tokens, ""
+}
+
+// mdInline returns the tokens of the inline markup in line, from pos
+func mdInline(line []rune, pos int) []Token {
+	var tokens []Token
+	// find returns the position of s after from, -1 if it's not there
+	find := func(s string, from int) int {
+		if i := strings.Index(string(line[from:]), s); i != -1 {
+			return from + len([]rune(string(line[from:])[:i]))
+		}
+		return -1
+	}
+	for pos < len(line) {
+		r := line[pos]
+		switch {
+		case r == '\\':
+			pos += 2
+			continue
+		case r == '`':
+			ticks := pos
+			for ticks < len(line) && line[ticks] == '`' {
+				ticks++
+			}
+			if end := find(string(line[pos:ticks]), ticks); end != -1 {
+				end += ticks - pos
+				tokens = append(tokens, Token{pos, end, TokenCode})
+				pos = end
+				continue
+			}
+			pos = ticks
+			continue
+		case r == '*' || r == '_':
+			delim := string(r)
+			if pos+1 < len(line) && line[pos+1] == r {
+				delim += delim
+			}
+			n := len(delim)
+			if pos+n < len(line) && line[pos+n] != ' ' {
+				if end := find(delim, pos+n); end > pos+n {
+					tokens = append(tokens, Token{pos, end + n, TokenEmphasis})
+					pos = end + n
+					continue
+				}
+			}
+			pos += n
+			continue
+		case r == '[':
+			if close := find("](", pos); close != -1 {
+				if end := find(")", close); end != -1 {
+					tokens = append(tokens, Token{pos, end + 1, TokenLink})
+					pos = end + 1
+					continue
+				}
+			}
+		case r == '<':
+			if end := find(">", pos); end != -1 && strings.Contains(string(line[pos:end]), "://") {
+				tokens = append(tokens, Token{pos, end + 1, TokenLink})
+				pos = end + 1
+				continue
+			}
+		}
+		pos++
+	}
+	return tokens
+}
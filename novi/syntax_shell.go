@@ -0,0 +1,200 @@
+package novi
+
+import (
+	"strings"
+	"unicode"
+)
+
+/*
+ * Shell scripts (sh and bash). Quoted strings and here documents span lines,
+ * the state of a line inside a string is its quote and that of a line in a
+ * here document is "heredoc:" (or "heredoc-:" for <<-) followed by the
+ * delimiter. Keywords and builtins are only highlighted where a command
+ * starts.
+ */
+
+// ShellLexer highlights shell scripts
+type ShellLexer struct{}
+
+// Name returns the name of the language
+func (ShellLexer) Name() string {
+	return "sh"
+}
+
+var (
+	shKeywords = map[string]bool{
+		"if": true, "then": true, "else": true, "elif": true, "fi": true,
+		"for": true, "while": true, "until": true, "do": true, "done": true,
+		"case": true, "esac": true, "select": true, "function": true, "time": true,
+		"in": true, "!": true, "{": true, "}": true,
+	}
+	shBuiltins = map[string]bool{
+		"alias": true, "break": true, "cd": true, "continue": true, "declare": true,
+		"echo": true, "eval": true, "exec": true, "exit": true, "export": true,
+		"local": true, "printf": true, "read": true, "readonly": true, "return": true,
+		"set": true, "shift": true, "source": true, "test": true, "trap": true,
+		"unset": true, ".": true, ":": true,
+	}
+)
+
+// shMeta are the characters that end a word
+const shMeta = " \t|&;<>()'\"`$"
+
+// shEndQuote returns the position after the quote that closes a string
+// started before pos, -1 if it's not on the line
+func shEndQuote(line []rune, pos int, quote rune) int {
+	for ; pos < len(line); pos++ {
+		switch line[pos] {
+		case quote:
+			return pos + 1
+		case '\\':
+			if quote == '"' {
+				pos++
+			}
+		}
+	}
+	return -1
+}
+
+// shVariable returns the end of the variable (or parameter expansion) at pos
+func shVariable(line []rune, pos int) int {
+	end := pos + 1
+	if end == len(line) {
+		return end
+	}
+	switch r := line[end]; {
+	case r == '{':
+		if i := strings.IndexRune(string(line[end:]), '}'); i != -1 {
+			return end + len([]rune(string(line[end:])[:i])) + 1
+		}
+		return len(line)
+	case strings.ContainsRune("@*#?$!-0123456789", r):
+		return end + 1
+	}
+	for end < len(line) && (line[end] == '_' || unicode.IsLetter(line[end]) || unicode.IsDigit(line[end])) {
+		end++
+	}
+	return end
+}
+
+// Lex returns the tokens of a line of a shell script
+func (ShellLexer) Lex(line []rune, state LexState) ([]Token, LexState) {
+	var tokens []Token
+	pos := 0
+	switch s := string(state); {
+	case strings.HasPrefix(s, "heredoc"):
+		delim := s[strings.IndexRune(s, ':')+1:]
+		text := string(line)
+		if strings.HasPrefix(s, "heredoc-") {
+			text = strings.TrimLeft(text, "\t")
+		}
+		if text == delim {
+			return []Token{{0, len(line), TokenOperator}}, ""
+		}
+		return []Token{{0, len(line), TokenString}}, state
+	case s == "'" || s == `"`:
+		end := shEndQuote(line, 0, rune(s[0]))
+		if end == -1 {
+			return []Token{{0, len(line), TokenString}}, state
+		}
+		tokens = append(tokens, Token{0, end, TokenString})
+		pos = end
+	}
+
+	var heredoc LexState
+	command := pos == 0 // a command starts at pos, not after a string
+	loop := -1          // the number of words after for, case or select
+	for pos < len(line) {
+		r := line[pos]
+		switch {
+		case r == ' ' || r == '\t':
+			pos++
+		case r == '\\':
+			pos += 2
+			command = false
+		case r == '#' && (pos == 0 || strings.ContainsRune(" \t;|&(", line[pos-1])):
+			return append(tokens, Token{pos, len(line), TokenComment}), heredoc
+		case r == '\'' || r == '"':
+			end := shEndQuote(line, pos+1, r)
+			if end == -1 {
+				return append(tokens, Token{pos, len(line), TokenString}), LexState(r)
+			}
+			tokens = append(tokens, Token{pos, end, TokenString})
+			pos, command = end, false
+			if loop >= 0 {
+				loop++
+			}
+		case r == '$':
+			end := shVariable(line, pos)
+			if end > pos+1 {
+				tokens = append(tokens, Token{pos, end, TokenVariable})
+			}
+			pos, command = end, false
+			if loop >= 0 {
+				loop++
+			}
+		case r == '<' && strings.HasPrefix(string(line[pos:]), "<<") && !strings.HasPrefix(string(line[pos:]), "<<<"):
+			end := pos + 2
+			kind := "heredoc:"
+			if end < len(line) && line[end] == '-' {
+				kind = "heredoc-:"
+				end++
+			}
+			for end < len(line) && line[end] == ' ' {
+				end++
+			}
+			start := end
+			for end < len(line) && !strings.ContainsRune(" \t|&;<>()", line[end]) {
+				end++
+			}
+			if delim := strings.Trim(string(line[start:end]), `'"\`); delim != "" {
+				heredoc = LexState(kind + delim)
+			}
+			tokens = append(tokens, Token{pos, end, TokenOperator})
+			pos = end
+		case strings.ContainsRune("|&;<>()`", r):
+			tokens = append(tokens, Token{pos, pos + 1, TokenOperator})
+			pos++
+			command = r != '<' && r != '>'
+		default:
+			end := pos
+			for end < len(line) && !strings.ContainsRune(shMeta, line[end]) {
+				end++
+			}
+			word := string(line[pos:end])
+			if loop >= 0 {
+				loop++
+			}
+			switch {
+			case word == "in" && loop == 2:
+				tokens = append(tokens, Token{pos, end, TokenKeyword})
+				loop = -1
+			case command && shKeywords[word] && word != "in":
+				tokens = append(tokens, Token{pos, end, TokenKeyword})
+				// a command follows most keywords, but not the name after for
+				command = true
+				switch word {
+				case "for", "case", "select":
+					loop = 0
+					command = false
+				case "function":
+					command = false
+				}
+			case command && shBuiltins[word]:
+				tokens = append(tokens, Token{pos, end, TokenBuiltin})
+				command = false
+			case command && strings.ContainsRune(word, '='):
+				// an assignment, the command may follow
+				eq := strings.IndexRune(word, '=')
+				tokens = append(tokens, Token{pos, pos + len([]rune(word[:eq])), TokenVariable})
+			case strings.Trim(word, "0123456789") == "":
+				tokens = append(tokens, Token{pos, end, TokenNumber})
+				command = false
+			default:
+				command = false
+			}
+			pos = end
+		}
+	}
+	return tokens, heredoc
+}
@@ -0,0 +1,187 @@
+package novi
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var tokenNames = map[TokenType]string{
+	TokenKeyword: "keyword", TokenTypeName: "type", TokenBuiltin: "builtin",
+	TokenConstant: "constant", TokenString: "string", TokenNumber: "number",
+	TokenComment: "comment", TokenOperator: "operator", TokenKey: "key",
+	TokenVariable: "variable", TokenHeading: "heading", TokenEmphasis: "emphasis",
+	TokenCode: "code", TokenLink: "link",
+}
+
+// lexLines lexes lines and describes their tokens as type(text), with the
+// lines separated by |
+func lexLines(l Lexer, lines ...string) string {
+	var desc []string
+	var state LexState
+	for _, line := range lines {
+		var tokens []Token
+		runes := []rune(line)
+		tokens, state = l.Lex(runes, state)
+		for _, t := range tokens {
+			desc = append(desc, fmt.Sprintf("%s(%s)", tokenNames[t.Type], string(runes[t.Pos:t.End])))
+		}
+		desc = append(desc, "|")
+	}
+	return strings.Join(desc[:len(desc)-1], " ")
+}
+
+func TestLexers(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		lexer    Lexer
+		lines    []string
+		expected string
+	}{
+		{"Go", GoLexer{}, []string{`func f(s string) int { return len(s) + 1 // one`},
+			"keyword(func) type(string) type(int) keyword(return) builtin(len) operator(+) number(1) comment(// one)"},
+		{"Go block comment", GoLexer{}, []string{"x := 1 /* a", "b", "c */ nil"},
+			"operator(:=) number(1) comment(/* a) | comment(b) | comment(c */) constant(nil)"},
+		{"Go raw string", GoLexer{}, []string{"s := `a", "b` + \"é\""},
+			"operator(:=) string(`a) | string(b`) operator(+) string(\"é\")"},
+		{"Markdown", MarkdownLexer{}, []string{"# Title", "- some `code` and **bold** [a](b)"},
+			"heading(# Title) | operator(-) code(`code`) emphasis(**bold**) link([a](b))"},
+		{"Markdown fence", MarkdownLexer{}, []string{"```go", "# no heading", "```", "# heading"},
+			"code(```go) | code(# no heading) | code(```) | heading(# heading)"},
+		{"JSON", JSONLexer{}, []string{`{"a": "b", "c": [1.5, true, null]}`},
+			`key("a") string("b") key("c") number(1.5) constant(true) constant(null)`},
+		{"YAML", YAMLLexer{}, []string{"key: value # note", "- n: 12", "  ok: yes", "ref: *anchor"},
+			"key(key) comment(# note) | operator(-) key(n) number(12) | key(ok) constant(yes) | key(ref) variable(*anchor)"},
+		{"YAML block scalar", YAMLLexer{}, []string{"text: |", "  a: 1", "", "  b", "next: 'x'"},
+			"key(text) operator(|) | string(a: 1) | | string(b) | key(next) string('x')"},
+		{"Shell", ShellLexer{}, []string{`for f in *.go; do echo "$f" $HOME; done # x`},
+			`keyword(for) keyword(in) operator(;) keyword(do) builtin(echo) string("$f") variable($HOME) operator(;) keyword(done) comment(# x)`},
+		{"Shell assignment", ShellLexer{}, []string{"X=1 cmd for 2>&1"},
+			"variable(X) number(2) operator(>) operator(&) number(1)"},
+		{"Shell multi-line string", ShellLexer{}, []string{"echo 'a", "b' if"},
+			"builtin(echo) string('a) | string(b')"},
+		{"Shell heredoc", ShellLexer{}, []string{"cat <<-'EOF' | sort", "\tif $x", "\tEOF", "fi"},
+			"operator(<<-'EOF') operator(|) | string(\tif $x) | operator(\tEOF) | keyword(fi)"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if desc := lexLines(tc.lexer, tc.lines...); desc != tc.expected {
+				t.Errorf("Expected %s\ngot      %s", tc.expected, desc)
+			}
+		})
+	}
+}
+
+func TestLexerFor(t *testing.T) {
+	for name, expected := range map[string]string{
+		"main.go": "go", "README.md": "markdown", "a.JSON": "json", "x.yml": "yaml",
+		"/home/u/.bashrc": "sh", "run.sh": "sh",
+	} {
+		if l := LexerFor(name); l == nil || l.Name() != expected {
+			t.Errorf("Expected %s to use %s, got %v", name, expected, l)
+		}
+	}
+	if l := LexerFor("notes.txt"); l != nil {
+		t.Errorf("Expected no lexer for text, got %s", l.Name())
+	}
+}
+
+// countingLexer records the lines it lexes. A line starting with { starts a
+// block that lasts until a line starting with }
+type countingLexer struct {
+	lexed []string
+}
+
+func (l *countingLexer) Name() string {
+	return "counting"
+}
+
+func (l *countingLexer) Lex(line []rune, state LexState) ([]Token, LexState) {
+	l.lexed = append(l.lexed, string(line))
+	switch {
+	case strings.HasPrefix(string(line), "{"):
+		state = "block"
+	case strings.HasPrefix(string(line), "}"):
+		state = ""
+	}
+	if state != "" {
+		return []Token{{0, len(line), TokenComment}}, state
+	}
+	return nil, state
+}
+
+func TestSyntax(t *testing.T) {
+	setup := func() (*Buffer, *Syntax, *countingLexer) {
+		b := NewBuffer()
+		b.LoadStrings([]string{"a", "b", "c", "d", "e"})
+		l := &countingLexer{}
+		s := NewSyntax(b, l)
+		s.Tokens(4)
+		l.lexed = nil
+		return b, s, l
+	}
+	assertLexed := func(t *testing.T, l *countingLexer, expected ...string) {
+		t.Helper()
+		if strings.Join(l.lexed, ",") != strings.Join(expected, ",") {
+			t.Errorf("Expected %v to be lexed, got %v", expected, l.lexed)
+		}
+	}
+
+	t.Run("Lexes up to the line asked for", func(t *testing.T) {
+		b := NewBuffer()
+		b.LoadStrings([]string{"a", "b", "c"})
+		l := &countingLexer{}
+		s := NewSyntax(b, l)
+		s.Tokens(1)
+		assertLexed(t, l, "a", "b")
+	})
+	t.Run("Only changed lines are lexed again", func(t *testing.T) {
+		b, s, l := setup()
+		b.InsertText(b.NewCursor(2, 1), []string{"x"})
+		s.Tokens(4)
+		assertLexed(t, l, "cx")
+	})
+	t.Run("Inserted lines", func(t *testing.T) {
+		b, s, l := setup()
+		b.SplitLine(b.NewCursor(1, 0))
+		s.Tokens(5)
+		assertLexed(t, l, "", "b")
+	})
+	t.Run("Changed state is passed on", func(t *testing.T) {
+		b, s, l := setup()
+		b.InsertText(b.NewCursor(1, 0), []string{"{"})
+		if ty := TokenAt(s.Tokens(4), 0); ty != TokenComment {
+			t.Errorf("Expected the last line in the block, got %d", ty)
+		}
+		assertLexed(t, l, "{b", "c", "d", "e")
+		l.lexed = nil
+		b.InsertText(b.NewCursor(3, 0), []string{"}"})
+		if ty := TokenAt(s.Tokens(4), 0); ty != TokenText {
+			t.Errorf("Expected the last line after the block, got %d", ty)
+		}
+		assertLexed(t, l, "}d", "e")
+	})
+	t.Run("Lines appended while loading", func(t *testing.T) {
+		b := NewBuffer()
+		l := &countingLexer{}
+		s := NewSyntax(b, l)
+		b.startLoad(0)
+		b.appendLoaded(&LoadBatch{Lines: []string{"a", "{b"}})
+		s.Tokens(1)
+		assertLexed(t, l, "a", "{b")
+		l.lexed = nil
+		b.appendLoaded(&LoadBatch{Lines: []string{"c", "}d"}, Done: true})
+		if ty := TokenAt(s.Tokens(3), 0); ty != TokenText {
+			t.Errorf("Expected the last line after the block, got %d", ty)
+		}
+		if ty := TokenAt(s.Tokens(2), 0); ty != TokenComment {
+			t.Errorf("Expected the appended line in the block, got %d", ty)
+		}
+		assertLexed(t, l, "c", "}d")
+	})
+	t.Run("Replacing everything", func(t *testing.T) {
+		b, s, l := setup()
+		b.LoadStrings([]string{"x", "y"})
+		s.Tokens(1)
+		assertLexed(t, l, "x", "y")
+	})
+}
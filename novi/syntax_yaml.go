@@ -0,0 +1,205 @@
+package novi
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+ * YAML. Block scalars (| and >) span the lines that are indented more than
+ * the line that starts them, the state of such a line is "block:" followed by
+ * that indentation. Keys, scalars, comments, anchors, aliases and tags are
+ * highlighted.
+ */
+
+// YAMLLexer highlights YAML
+type YAMLLexer struct{}
+
+// Name returns the name of the language
+func (YAMLLexer) Name() string {
+	return "yaml"
+}
+
+// yamlConstants are the plain scalars that aren't strings
+var yamlConstants = map[string]bool{
+	"true": true, "false": true, "True": true, "False": true, "TRUE": true, "FALSE": true,
+	"yes": true, "no": true, "on": true, "off": true,
+	"null": true, "Null": true, "NULL": true, "~": true,
+}
+
+// Lex returns the tokens of a line of YAML
+func (YAMLLexer) Lex(line []rune, state LexState) ([]Token, LexState) {
+	indent := 0
+	for indent < len(line) && line[indent] == ' ' {
+		indent++
+	}
+	if strings.HasPrefix(string(state), "block:") {
+		parent, _ := strconv.Atoi(string(state)[len("block:"):])
+		if indent == len(line) {
+			return nil, state
+		}
+		if indent > parent {
+			return []Token{{indent, len(line), TokenString}}, state
+		}
+	}
+
+	var tokens []Token
+	pos := indent
+	rest := string(line[pos:])
+	if rest == "---" || rest == "..." || strings.HasPrefix(rest, "--- ") {
+		tokens = append(tokens, Token{pos, pos + 3, TokenOperator})
+		pos += 3
+	}
+	// skip returns the position of the first non-space from pos
+	skip := func(pos int) int {
+		for pos < len(line) && line[pos] == ' ' {
+			pos++
+		}
+		return pos
+	}
+	// sequence entries
+	for pos < len(line) && line[pos] == '-' && (pos+1 == len(line) || line[pos+1] == ' ') {
+		tokens = append(tokens, Token{pos, pos + 1, TokenOperator})
+		pos = skip(pos + 1)
+	}
+	if end := yamlKey(line, pos); end != -1 {
+		tokens = append(tokens, Token{pos, end, TokenKey})
+		pos = skip(end + 1)
+	}
+
+	state = ""
+	flow := 0 // the depth of [] and {}
+	for pos < len(line) {
+		r := line[pos]
+		switch {
+		case r == '#' && (pos == 0 || line[pos-1] == ' '):
+			return append(tokens, Token{pos, len(line), TokenComment}), state
+		case r == '"' || r == '\'':
+			end := pos + 1
+			for end < len(line) && line[end] != r {
+				if r == '"' && line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end < len(line) {
+				end++
+			} else {
+				end = len(line)
+			}
+			typ := TokenString
+			if flow > 0 && end < len(line) && line[end] == ':' {
+				typ = TokenKey
+			}
+			tokens = append(tokens, Token{pos, end, typ})
+			pos = end
+		case r == '[' || r == '{':
+			flow++
+			pos++
+		case r == ']' || r == '}':
+			flow--
+			pos++
+		case r == ',' || r == ' ' || r == ':':
+			pos++
+		case (r == '|' || r == '>') && flow == 0:
+			// a block scalar if only indicators and a comment follow
+			end := pos + 1
+			for end < len(line) && (line[end] == '-' || line[end] == '+' || unicode.IsDigit(line[end])) {
+				end++
+			}
+			if next := skip(end); next == len(line) || line[next] == '#' {
+				tokens = append(tokens, Token{pos, end, TokenOperator})
+				state = LexState("block:" + strconv.Itoa(indent))
+				pos = next
+				continue
+			}
+			return append(tokens, Token{pos, yamlPlainEnd(line, pos, flow), TokenString}), state
+		default:
+			end := yamlPlainEnd(line, pos, flow)
+			if r == '&' || r == '*' || r == '!' {
+				// anchors, aliases and tags are a single word
+				if i := strings.IndexRune(string(line[pos:end]), ' '); i != -1 {
+					end = pos + len([]rune(string(line[pos:end])[:i]))
+				}
+			}
+			if flow > 0 && end < len(line) && line[end] == ':' {
+				tokens = append(tokens, Token{pos, end, TokenKey})
+				pos = end
+				continue
+			}
+			word := string(line[pos:end])
+			switch {
+			case r == '&' || r == '*':
+				tokens = append(tokens, Token{pos, end, TokenVariable})
+			case r == '!':
+				tokens = append(tokens, Token{pos, end, TokenTypeName})
+			case yamlConstants[word]:
+				tokens = append(tokens, Token{pos, end, TokenConstant})
+			case isYAMLNumber(word):
+				tokens = append(tokens, Token{pos, end, TokenNumber})
+			}
+			pos = end
+		}
+	}
+	return tokens, state
+}
+
+// yamlKey returns the end of the key of a mapping entry at pos, -1 if there's
+// none. The key is followed by a colon and a space or the end of the line
+func yamlKey(line []rune, pos int) int {
+	if pos >= len(line) {
+		return -1
+	}
+	end := pos
+	if q := line[pos]; q == '"' || q == '\'' {
+		end++
+		for end < len(line) && line[end] != q {
+			end++
+		}
+		end++
+	} else {
+		if strings.ContainsRune("[{#&*!|>%@`", q) {
+			return -1
+		}
+		for end < len(line) && !(line[end] == ':' && (end+1 == len(line) || line[end+1] == ' ')) {
+			if line[end] == '#' && line[end-1] == ' ' {
+				return -1
+			}
+			end++
+		}
+	}
+	if end >= len(line) || line[end] != ':' || end+1 < len(line) && line[end+1] != ' ' {
+		return -1
+	}
+	return end
+}
+
+// yamlPlainEnd returns the end of a plain scalar starting at pos. Within
+// flow collections it ends at a comma, bracket or colon
+func yamlPlainEnd(line []rune, pos, flow int) int {
+	end := pos
+	for end < len(line) {
+		r := line[end]
+		if r == ' ' && end+1 < len(line) && line[end+1] == '#' {
+			break
+		}
+		if flow > 0 && strings.ContainsRune(",[]{}:", r) {
+			break
+		}
+		end++
+	}
+	for end > pos && line[end-1] == ' ' {
+		end--
+	}
+	return end
+}
+
+// isYAMLNumber returns true if a plain scalar is a number
+func isYAMLNumber(s string) bool {
+	if _, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return true
+	}
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil && s != "" && !strings.ContainsAny(s, "nN") // not NaN or Inf
+}
@@ -0,0 +1,245 @@
+package novi
+
+/*
+ * Undo/redo support. Every modification of a Buffer is expressed as a Change:
+ * some text at a position got replaced by some other text. A Change can
+ * always be inverted by swapping the removed and inserted text, which makes
+ * undo/redo a matter of replaying changes.
+ *
+ * Changes are grouped into steps; a step is what a single undo/redo operates
+ * on, e.g. an entire insert session or a "dd". Emulations define the steps
+ * using BeginChange/EndChange. Changes made outside of a group become a step
+ * of their own.
+ */
+
+// Change describes a single modification of a buffer: starting at Line/Pos
+// the text Removed was replaced by the text Inserted. Text is stored as a
+// slice of lines, so a single newline is represented as []string{"", ""}
+type Change struct {
+	Line     int
+	Pos      int
+	Removed  []string
+	Inserted []string
+}
+
+// Invert returns the change that reverts c
+func (c Change) Invert() Change {
+	return Change{Line: c.Line, Pos: c.Pos, Removed: c.Inserted, Inserted: c.Removed}
+}
+
+// emptyText returns true if text doesn't contain anything, not even a newline
+func emptyText(text []string) bool {
+	return len(text) == 0 || (len(text) == 1 && text[0] == "")
+}
+
+// textEnd returns the position just after text when it starts at line, pos
+func textEnd(line, pos int, text []string) (int, int) {
+	if len(text) <= 1 {
+		if len(text) == 0 {
+			return line, pos
+		}
+		return line, pos + len([]rune(text[0]))
+	}
+	return line + len(text) - 1, len([]rune(text[len(text)-1]))
+}
+
+// RemovedEnd returns the (exclusive) end position of the removed text
+func (c Change) RemovedEnd() (int, int) {
+	return textEnd(c.Line, c.Pos, c.Removed)
+}
+
+// InsertedEnd returns the (exclusive) end position of the inserted text
+func (c Change) InsertedEnd() (int, int) {
+	return textEnd(c.Line, c.Pos, c.Inserted)
+}
+
+// undoStep is a group of changes that are undone/redone as a whole, including
+// the cursor positions before and after the changes
+type undoStep struct {
+	changes []Change
+	before  []Cursor
+	after   []Cursor
+	seq     int
+}
+
+// History keeps track of the undo and redo steps of a buffer
+type History struct {
+	undo    []*undoStep
+	redo    []*undoStep
+	current *undoStep
+	depth   int
+	seq     int
+	saved   int
+}
+
+func copyCursors(cs Cursors) []Cursor {
+	res := make([]Cursor, len(cs))
+	for i, c := range cs {
+		res[i] = *c
+	}
+	return res
+}
+
+// begin starts a new group (if not already in one)
+func (h *History) begin(cs Cursors) {
+	if h.depth == 0 {
+		h.current = &undoStep{before: copyCursors(cs)}
+	}
+	h.depth++
+}
+
+// end closes the current group, storing it if it contains any changes
+func (h *History) end(cs Cursors) {
+	if h.depth == 0 {
+		return
+	}
+	h.depth--
+	if h.depth == 0 {
+		h.current.after = copyCursors(cs)
+		h.push(h.current)
+		h.current = nil
+	}
+}
+
+// flush forcefully closes any open group
+func (h *History) flush() {
+	if h.current != nil {
+		h.push(h.current)
+	}
+	h.current = nil
+	h.depth = 0
+}
+
+func (h *History) push(step *undoStep) {
+	if len(step.changes) == 0 {
+		return
+	}
+	h.seq++
+	step.seq = h.seq
+	h.undo = append(h.undo, step)
+	h.redo = nil
+}
+
+// record adds a change to the current group, or stores it as a step by itself
+func (h *History) record(ch Change) {
+	if h.current == nil {
+		h.push(&undoStep{changes: []Change{ch}})
+		return
+	}
+	// Merge simple consecutive insertions (typing) into a single change
+	if n := len(h.current.changes); n > 0 {
+		last := &h.current.changes[n-1]
+		if emptyText(last.Removed) && emptyText(ch.Removed) &&
+			len(last.Inserted) == 1 && len(ch.Inserted) == 1 {
+			if l, p := last.InsertedEnd(); l == ch.Line && p == ch.Pos {
+				last.Inserted = []string{last.Inserted[0] + ch.Inserted[0]}
+				return
+			}
+		}
+	}
+	h.current.changes = append(h.current.changes, ch)
+}
+
+// top returns the sequence number of the most recent undo step
+func (h *History) top() int {
+	if len(h.undo) == 0 {
+		return 0
+	}
+	return h.undo[len(h.undo)-1].seq
+}
+
+// restoreCursors restores the positions saved in a step on the given cursors.
+// If no positions were saved, the first cursor is moved to line, pos
+func restoreCursors(cs Cursors, saved []Cursor, line, pos int) {
+	if len(saved) == 0 {
+		if len(cs) > 0 {
+			cs[0].Line, cs[0].Pos = line, pos
+		}
+		return
+	}
+	for i, c := range cs {
+		if i < len(saved) {
+			c.Line, c.Pos = saved[i].Line, saved[i].Pos
+		}
+	}
+}
+
+// BeginChange starts a group of changes that will be undone as a single step.
+// Calls can be nested, the group is only closed by the outermost EndChange
+func (b *Buffer) BeginChange(cs Cursors) {
+	b.history.begin(cs)
+}
+
+// EndChange ends a group of changes started with BeginChange
+func (b *Buffer) EndChange(cs Cursors) {
+	b.history.end(cs)
+}
+
+// CanUndo returns true if there is anything to undo
+func (b *Buffer) CanUndo() bool {
+	return len(b.history.undo) > 0 || (b.history.current != nil && len(b.history.current.changes) > 0)
+}
+
+// CanRedo returns true if there is anything to redo
+func (b *Buffer) CanRedo() bool {
+	return len(b.history.redo) > 0
+}
+
+// Undo reverts the last step, restoring the cursors to their positions
+// before the step. Any open group is closed first. Returns false if there
+// was nothing to undo
+func (b *Buffer) Undo(cs Cursors) bool {
+	h := &b.history
+	h.flush()
+	if len(h.undo) == 0 {
+		return false
+	}
+	step := h.undo[len(h.undo)-1]
+	h.undo = h.undo[:len(h.undo)-1]
+
+	for i := len(step.changes) - 1; i >= 0; i-- {
+		b.replay(step.changes[i].Invert())
+	}
+	h.redo = append(h.redo, step)
+
+	first := step.changes[0]
+	restoreCursors(cs, step.before, first.Line, first.Pos)
+	b.Modified = h.top() != h.saved || b.reformatted
+	return true
+}
+
+// Redo re-applies the last undone step. Returns false if there was nothing
+// to redo
+func (b *Buffer) Redo(cs Cursors) bool {
+	h := &b.history
+	h.flush()
+	if len(h.redo) == 0 {
+		return false
+	}
+	step := h.redo[len(h.redo)-1]
+	h.redo = h.redo[:len(h.redo)-1]
+
+	for _, ch := range step.changes {
+		b.replay(ch)
+	}
+	h.undo = append(h.undo, step)
+
+	last := step.changes[len(step.changes)-1]
+	l, p := last.InsertedEnd()
+	restoreCursors(cs, step.after, l, p)
+	b.Modified = h.top() != h.saved || b.reformatted
+	return true
+}
+
+// MarkSaved marks the current state of the buffer as saved/unmodified
+func (b *Buffer) MarkSaved() {
+	b.history.flush()
+	b.history.saved = b.history.top()
+	b.reformatted = false
+	b.Modified = false
+}
+
+// ResetHistory discards all undo/redo information
+func (b *Buffer) ResetHistory() {
+	b.history = History{}
+}
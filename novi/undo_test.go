@@ -0,0 +1,145 @@
+package novi
+
+import "testing"
+
+func TestUndoPrimitives(t *testing.T) {
+	makeBuf := func() *Buffer {
+		return BuildBuffer("Line 0 7890", "Line 1 7890", "Line 2 7890")
+	}
+	original := []string{"Line 0 7890", "Line 1 7890", "Line 2 7890"}
+
+	t.Run("Undo/Redo PutRuneAtCursors", func(t *testing.T) {
+		b := makeBuf()
+		c := b.NewCursor(1, 4)
+		b.PutRuneAtCursors(Cursors{c}, '!')
+		AssertBufferMatch(t, b, "Line 0 7890", "Line! 1 7890", "Line 2 7890")
+
+		b.Undo(Cursors{c})
+		AssertBufferMatch(t, b, original...)
+		AssertBufferModified(t, b, false)
+		AssertCursor(t, c, 1, 4)
+
+		b.Redo(Cursors{c})
+		AssertBufferMatch(t, b, "Line 0 7890", "Line! 1 7890", "Line 2 7890")
+		AssertBufferModified(t, b, true)
+	})
+	t.Run("Undo SplitLine", func(t *testing.T) {
+		b := makeBuf()
+		b.SplitLine(b.NewCursor(0, 4))
+		AssertBufferMatch(t, b, "Line", " 0 7890", "Line 1 7890", "Line 2 7890")
+		b.Undo(nil)
+		AssertBufferMatch(t, b, original...)
+	})
+	t.Run("Undo RemoveLine", func(t *testing.T) {
+		b := makeBuf()
+		b.RemoveLine(2)
+		b.RemoveLine(0)
+		AssertBufferMatch(t, b, "Line 1 7890")
+		b.Undo(nil)
+		b.Undo(nil)
+		AssertBufferMatch(t, b, original...)
+	})
+	t.Run("Undo RemoveLine on single line", func(t *testing.T) {
+		b := BuildBuffer("single")
+		b.RemoveLine(0)
+		AssertBufferMatch(t, b, "")
+		b.Undo(nil)
+		AssertBufferMatch(t, b, "single")
+	})
+	t.Run("Undo InsertLine", func(t *testing.T) {
+		b := makeBuf()
+		b.InsertLine(b.NewCursor(0, 0), "before", true)
+		b.InsertLine(b.NewCursor(3, 0), "after", false)
+		AssertBufferMatch(t, b, "before", "Line 0 7890", "Line 1 7890", "Line 2 7890", "after")
+		b.Undo(nil)
+		b.Undo(nil)
+		AssertBufferMatch(t, b, original...)
+	})
+	t.Run("Undo JoinLineWithPrevious", func(t *testing.T) {
+		b := makeBuf()
+		b.JoinLineWithPrevious(1)
+		AssertBufferMatch(t, b, "Line 0 7890Line 1 7890", "Line 2 7890")
+		b.Undo(nil)
+		AssertBufferMatch(t, b, original...)
+	})
+	t.Run("Undo RemoveBetweenCursors", func(t *testing.T) {
+		b := makeBuf()
+		b.RemoveBetweenCursors(b.NewCursor(0, 3), b.NewCursor(2, 3))
+		AssertBufferMatch(t, b, "Lin 2 7890")
+		b.Undo(nil)
+		AssertBufferMatch(t, b, original...)
+	})
+}
+
+func TestUndoGrouping(t *testing.T) {
+	t.Run("Group is undone as a whole", func(t *testing.T) {
+		b := BuildBuffer("hello")
+		c := b.NewCursor(0, 5)
+		cs := Cursors{c}
+
+		b.BeginChange(cs)
+		for _, r := range " world" {
+			b.PutRuneAtCursors(cs, r)
+			c.Pos++
+		}
+		b.SplitLine(c)
+		c.Line, c.Pos = 1, 0
+		b.EndChange(cs)
+		AssertBufferMatch(t, b, "hello world", "")
+
+		if !b.Undo(cs) {
+			t.Fatal("Expected Undo to succeed")
+		}
+		AssertBufferMatch(t, b, "hello")
+		AssertCursor(t, c, 0, 5)
+		if b.Undo(cs) {
+			t.Error("Expected nothing more to undo")
+		}
+
+		b.Redo(cs)
+		AssertBufferMatch(t, b, "hello world", "")
+		AssertCursor(t, c, 1, 0)
+	})
+	t.Run("Nested groups", func(t *testing.T) {
+		b := BuildBuffer("abc")
+		c := b.NewCursor(0, 0)
+		cs := Cursors{c}
+
+		b.BeginChange(cs)
+		b.PutRuneAtCursors(cs, '1')
+		b.BeginChange(cs)
+		b.PutRuneAtCursors(cs, '2')
+		b.EndChange(cs)
+		b.PutRuneAtCursors(cs, '3')
+		b.EndChange(cs)
+		AssertBufferMatch(t, b, "321abc")
+
+		b.Undo(cs)
+		AssertBufferMatch(t, b, "abc")
+	})
+	t.Run("New change clears redo", func(t *testing.T) {
+		b := BuildBuffer("abc")
+		c := b.NewCursor(0, 0)
+		b.PutRuneAtCursors(Cursors{c}, '1')
+		b.Undo(nil)
+		b.PutRuneAtCursors(Cursors{c}, '2')
+
+		if b.CanRedo() {
+			t.Error("Expected redo history to be cleared")
+		}
+		AssertBufferMatch(t, b, "2abc")
+	})
+	t.Run("Undo to saved state clears modified", func(t *testing.T) {
+		b := BuildBuffer("abc")
+		c := b.NewCursor(0, 0)
+		b.PutRuneAtCursors(Cursors{c}, '1')
+		b.MarkSaved()
+		b.PutRuneAtCursors(Cursors{c}, '2')
+		AssertBufferModified(t, b, true)
+
+		b.Undo(nil)
+		AssertBufferModified(t, b, false)
+		b.Undo(nil)
+		AssertBufferModified(t, b, true)
+	})
+}
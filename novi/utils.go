@@ -47,19 +47,27 @@ func RecoverFromPanic(cleanup func()) {
 	}
 }
 
+// CopyFile copies src to dst, preserving the file mode
 func CopyFile(src, dst string) error {
 	sourceFile, err := os.Open(src)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer sourceFile.Close()
 
-	newFile, err := os.Create(dst)
+	info, err := sourceFile.Stat()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	defer newFile.Close()
 
-	_, err = io.Copy(newFile, sourceFile)
-	return err
+	newFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(newFile, sourceFile); err != nil {
+		newFile.Close()
+		return err
+	}
+	return newFile.Close()
 }
@@ -0,0 +1,209 @@
+package novi
+
+/*
+ * Every document has a viewport: the part of the buffer that's shown. It's
+ * kept with the document, so switching back to a document shows it the way
+ * it was left.
+ *
+ * The UI sets the size of the viewport when rendering and makes sure the
+ * primary cursor is visible, scrolling as little as possible but keeping
+ * ScrollOff lines (SideScrollOff columns) around the cursor. Emulations can
+ * scroll the viewport themselves, they should then move the cursor into view
+ * using CursorToView, or rendering scrolls it right back.
+ *
+ * When lines wrap the viewport doesn't scroll horizontally and Line is the
+ * first line shown, which may take several screen rows. A line with more rows
+ * than fit is shown without its first Skip rows, so the cursor stays visible
+ * (like vim's skipcol).
+ */
+
+// Viewport is the part of a buffer that's visible
+type Viewport struct {
+	Line, Col     int // the first line and screen column shown
+	Skip          int // the rows of Line that aren't shown when lines wrap
+	Width, Height int // the size of the text area, as last rendered
+}
+
+// ViewOptions configure how lines are shown (see display.go) and how the
+// viewport follows the cursor
+type ViewOptions struct {
+	TabStop       int // the width of a tab, DefaultTabStop if 0
+	ScrollOff     int // the minimal number of lines kept above and below the cursor
+	SideScrollOff int // the minimal number of columns kept left and right of the cursor
+
+	Wrap      bool   // show long lines on several rows (see wrap.go)
+	LineBreak bool   // wrap at blanks rather than at the last column that fits
+	ShowBreak string // shown at the start of rows that continue a line
+}
+
+// Rows returns the number of lines the viewport can show, at least 1
+func (v *Viewport) Rows() int {
+	if v.Height < 1 {
+		return 1
+	}
+	return v.Height
+}
+
+// scrollOff limits an offset to what fits in size, so the cursor can still
+// move between the margins
+func scrollOff(off, size int) int {
+	if max := (size - 1) / 2; off > max {
+		return max
+	}
+	return off
+}
+
+// follow adjusts start so pos is visible in a range of size with off
+// positions around it
+func follow(start, pos, size, off int) int {
+	off = scrollOff(off, size)
+	if pos-off < start {
+		start = pos - off
+	}
+	if pos+off > start+size-1 {
+		start = pos + off - size + 1
+	}
+	if start < 0 {
+		start = 0
+	}
+	return start
+}
+
+// VisibleLines returns the first and last line of the current document that
+// are shown
+func (e *Editor) VisibleLines() (int, int) {
+	v := &e.Viewport
+	last := v.Line + v.Rows() - 1
+	if e.ViewOptions.Wrap {
+		// the lines that fit entirely, but at least the first
+		last = v.Line
+		rows := e.lineRows(v.Line) - v.Skip
+		for last+1 < e.Buffer.Length() {
+			if rows += e.lineRows(last + 1); rows > v.Rows() {
+				break
+			}
+			last++
+		}
+	}
+	if l := e.Buffer.Length() - 1; last > l {
+		last = l
+	}
+	return v.Line, last
+}
+
+// UpdateViewport sets the size of the viewport and scrolls it so the
+// primary cursor is visible
+func (e *Editor) UpdateViewport(width, height int) {
+	v := &e.Viewport
+	v.Width, v.Height = width, height
+	if max := e.Buffer.Length() - 1; v.Line > max {
+		v.Line = max
+	}
+	c := e.Cursors[0]
+	if e.ViewOptions.Wrap && v.Width > 0 {
+		v.Col = 0
+		e.followWrapped(c)
+		return
+	}
+	v.Skip = 0
+	v.Line = follow(v.Line, c.Line, v.Rows(), e.ViewOptions.ScrollOff)
+	if v.Width > 0 {
+		start, end := e.ViewOptions.Span(e.Buffer.GetLine(c.Line), c.Pos)
+		v.Col = follow(v.Col, start, v.Width, e.ViewOptions.SideScrollOff)
+		if end > v.Col+v.Width {
+			// a wide character is shown entirely
+			v.Col = end - v.Width
+		}
+	}
+}
+
+// lineRows returns the number of screen rows a line takes in the viewport
+func (e *Editor) lineRows(line int) int {
+	return len(e.ScreenRows(line))
+}
+
+// followWrapped scrolls the viewport so the line of a cursor, and ScrollOff
+// lines around it, are visible when lines wrap
+func (e *Editor) followWrapped(c *Cursor) {
+	v := &e.Viewport
+	off := scrollOff(e.ViewOptions.ScrollOff, v.Rows())
+	if top := c.Line - off; top < v.Line {
+		v.Line = top
+	}
+	if v.Line < 0 {
+		v.Line = 0
+	}
+	last := c.Line + off
+	if max := e.Buffer.Length() - 1; last > max {
+		last = max
+	}
+	// the rows needed to show everything from the first line shown
+	rows := 0
+	for line := v.Line; line <= last; line++ {
+		rows += e.lineRows(line)
+	}
+	// the cursor may be just past the end of a full row
+	row, _ := e.ViewOptions.ScreenPos(e.Buffer.GetLine(c.Line), c.Pos, v.Width)
+	if row == e.lineRows(c.Line) {
+		rows++
+	}
+	for v.Line < c.Line && rows > v.Rows() {
+		rows -= e.lineRows(v.Line)
+		v.Line++
+	}
+
+	// the line of the cursor may not fit by itself, then rows are skipped as
+	// little as possible to show the cursor
+	skip := v.Skip
+	v.Skip = 0
+	total := e.lineRows(c.Line)
+	if row == total {
+		total++
+	}
+	if v.Line != c.Line || total <= v.Rows() {
+		return
+	}
+	if skip > row {
+		skip = row
+	}
+	if row >= skip+v.Rows() {
+		skip = row - v.Rows() + 1
+	}
+	if skip > total-v.Rows() {
+		skip = total - v.Rows()
+	}
+	v.Skip = skip
+}
+
+// ScrollTo makes line the first line shown, limited to the buffer
+func (e *Editor) ScrollTo(line int) {
+	if max := e.Buffer.Length() - 1; line > max {
+		line = max
+	}
+	if line < 0 {
+		line = 0
+	}
+	e.Viewport.Line, e.Viewport.Skip = line, 0
+}
+
+// CursorToView moves a cursor to the nearest line inside the viewport,
+// outside of the ScrollOff margins. It returns false if it was visible already
+func (e *Editor) CursorToView(c *Cursor) bool {
+	first, last := e.VisibleLines()
+	off := scrollOff(e.ViewOptions.ScrollOff, e.Viewport.Rows())
+	if first > 0 {
+		first += off
+	}
+	if last < e.Buffer.Length()-1 {
+		last -= off
+	}
+	switch {
+	case c.Line < first:
+		c.Line = first
+	case c.Line > last && last >= first:
+		c.Line = last
+	default:
+		return false
+	}
+	return true
+}
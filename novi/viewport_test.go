@@ -0,0 +1,110 @@
+package novi
+
+import (
+	"strconv"
+	"testing"
+)
+
+// setupViewport creates an editor with lines numbered lines and a viewport
+// of height lines
+func setupViewport(lines, height int) *Editor {
+	var text []string
+	for i := 1; i <= lines; i++ {
+		text = append(text, strconv.Itoa(i))
+	}
+	e := NewEditor()
+	e.Buffer.LoadStrings(text)
+	e.UpdateViewport(80, height)
+	return e
+}
+
+func assertVisible(t *testing.T, e *Editor, first, last int) {
+	t.Helper()
+	if f, l := e.VisibleLines(); f != first || l != last {
+		t.Errorf("Expected lines %d-%d to be visible, got %d-%d", first, last, f, l)
+	}
+}
+
+func TestViewport(t *testing.T) {
+	t.Run("Follows the cursor down", func(t *testing.T) {
+		e := setupViewport(50, 10)
+		e.Cursors[0].Line = 15
+		e.UpdateViewport(80, 10)
+		assertVisible(t, e, 6, 15)
+	})
+	t.Run("Stays put while the cursor is visible", func(t *testing.T) {
+		e := setupViewport(50, 10)
+		e.ScrollTo(20)
+		e.Cursors[0].Line = 25
+		e.UpdateViewport(80, 10)
+		assertVisible(t, e, 20, 29)
+	})
+	t.Run("Follows the cursor up", func(t *testing.T) {
+		e := setupViewport(50, 10)
+		e.ScrollTo(20)
+		e.Cursors[0].Line = 5
+		e.UpdateViewport(80, 10)
+		assertVisible(t, e, 5, 14)
+	})
+	t.Run("Scrolloff", func(t *testing.T) {
+		e := setupViewport(50, 10)
+		e.ViewOptions.ScrollOff = 3
+		e.Cursors[0].Line = 7
+		e.UpdateViewport(80, 10)
+		assertVisible(t, e, 1, 10)
+	})
+	t.Run("Scrolloff larger than the screen centers", func(t *testing.T) {
+		e := setupViewport(50, 10)
+		e.ViewOptions.ScrollOff = 99
+		e.Cursors[0].Line = 20
+		e.UpdateViewport(80, 10)
+		assertVisible(t, e, 15, 24)
+	})
+	t.Run("Sidescrolloff", func(t *testing.T) {
+		e := setupViewport(1, 10)
+		e.Buffer.LoadStrings([]string{"0123456789012345678901234567890123456789"})
+		e.ViewOptions.SideScrollOff = 5
+		e.Cursors[0].Pos = 20
+		e.UpdateViewport(20, 10)
+		if e.Viewport.Col != 6 {
+			t.Errorf("Expected column 6 to be the first, got %d", e.Viewport.Col)
+		}
+	})
+	t.Run("Short buffer", func(t *testing.T) {
+		e := setupViewport(3, 10)
+		assertVisible(t, e, 0, 2)
+	})
+	t.Run("Cursor to view", func(t *testing.T) {
+		e := setupViewport(50, 10)
+		e.ViewOptions.ScrollOff = 2
+		e.ScrollTo(20)
+		c := e.Cursors[0]
+		if !e.CursorToView(c) || c.Line != 22 {
+			t.Errorf("Expected the cursor to move to line 22, got %d", c.Line)
+		}
+		c.Line = 40
+		if !e.CursorToView(c) || c.Line != 27 {
+			t.Errorf("Expected the cursor to move to line 27, got %d", c.Line)
+		}
+		if e.CursorToView(c) {
+			t.Errorf("Didn't expect a visible cursor to move")
+		}
+	})
+	t.Run("Kept per document", func(t *testing.T) {
+		e, names, cleanup := setupBuffers(t, "one\n", "two\n")
+		defer cleanup()
+		e.Viewport.Line = 5
+		if err := e.Edit(names[1], false); err != nil {
+			t.Fatal(err)
+		}
+		if e.Viewport.Line != 0 {
+			t.Errorf("Expected a new document to start at the top, got %d", e.Viewport.Line)
+		}
+		if err := e.SwitchTo(1); err != nil {
+			t.Fatal(err)
+		}
+		if e.Viewport.Line != 5 {
+			t.Errorf("Expected the viewport to be kept, got %d", e.Viewport.Line)
+		}
+	})
+}
@@ -0,0 +1,206 @@
+package novi
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"time"
+)
+
+/*
+ * Detecting changes to the file on disk. When a file is loaded or saved its
+ * modification time, size and a hash of its contents are recorded. The Core
+ * polls the files of all documents (CheckDocument) and asks what to do when
+ * one changes.
+ *
+ * Two states are kept: the state the buffer is based on (used to refuse
+ * overwriting a changed file) and the last state the user was told about
+ * (so a change is only reported once).
+ */
+
+// WatchInterval is how often the Core checks the file for changes
+var WatchInterval = 2 * time.Second
+
+// FileChange describes how the file on disk changed
+type FileChange int
+
+// The possible outcomes of CheckFile
+const (
+	FileUnchanged FileChange = iota
+	FileModified
+	FileRemoved
+)
+
+// fileState describes the file on disk at some point in time
+type fileState struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+	hash    []byte
+}
+
+// sameStat returns true if the stat information of both states is identical
+func (s fileState) sameStat(o fileState) bool {
+	return s.exists == o.exists && s.size == o.size && s.modTime.Equal(o.modTime)
+}
+
+func statFile(name string) (fileState, error) {
+	info, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		return fileState{}, nil
+	} else if err != nil {
+		return fileState{}, err
+	}
+	return fileState{exists: true, modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+func hashFile(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// changedSince returns the current state of the file and if its contents
+// differ from ref. The contents are only hashed if the stat information changed
+func changedSince(ref fileState, name string) (fileState, bool, error) {
+	cur, err := statFile(name)
+	if err != nil {
+		return cur, false, err
+	}
+	if cur.sameStat(ref) {
+		cur.hash = ref.hash
+		return cur, false, nil
+	}
+	if !cur.exists || !ref.exists {
+		return cur, true, nil
+	}
+	if cur.hash, err = hashFile(name); err != nil {
+		return cur, false, err
+	}
+	return cur, cur.size != ref.size || !bytes.Equal(cur.hash, ref.hash), nil
+}
+
+// recordFile records the state of the file the buffer is now based on
+func (e *Editor) recordFile(name string, h hash.Hash) {
+	state, err := statFile(name)
+	if err != nil {
+		log.Printf("Can't stat %s: %v", name, err)
+	}
+	if h != nil {
+		state.hash = h.Sum(nil)
+	}
+	e.disk = state
+	e.seen = state
+}
+
+// CheckFile checks if the file on disk changed since it was loaded or saved, or
+// since the last change was reported. A change is only reported once
+func (e *Editor) CheckFile() FileChange {
+	if e.filename == "" || e.stopLoading != nil {
+		return FileUnchanged
+	}
+	cur, changed, err := changedSince(e.seen, e.filename)
+	if err != nil {
+		log.Printf("Can't check %s: %v", e.filename, err)
+		return FileUnchanged
+	}
+	e.seen = cur
+	if !changed {
+		return FileUnchanged
+	}
+	if !cur.exists {
+		return FileRemoved
+	}
+	return FileModified
+}
+
+// FileChanged returns true if the file on disk differs from the file the
+// buffer was loaded from or last saved to
+func (e *Editor) FileChanged() bool {
+	if e.filename == "" {
+		return false
+	}
+	_, changed, err := changedSince(e.disk, e.filename)
+	if err != nil {
+		log.Printf("Can't check %s: %v", e.filename, err)
+	}
+	return changed
+}
+
+// KeepFile ignores the current changes on disk, the buffer stays as it is.
+// Saving it will require force
+func (e *Editor) KeepFile() {
+	if cur, _, err := changedSince(e.seen, e.filename); err == nil {
+		e.seen = cur
+	}
+}
+
+// CheckDocument checks the file of any document for changes, like CheckFile.
+// A document whose file isn't loaded yet never changed
+func (e *Editor) CheckDocument(d *Document) FileChange {
+	if !d.loaded {
+		return FileUnchanged
+	}
+	change := FileUnchanged
+	e.with(d, func() { change = e.CheckFile() })
+	return change
+}
+
+// ReloadFile reloads the file from disk, discarding any changes. Cursors
+// stay where they are, as far as possible
+func (e *Editor) ReloadFile() error {
+	positions := make([][2]int, len(e.Cursors))
+	for i, c := range e.Cursors {
+		positions[i] = [2]int{c.Line, c.Pos}
+	}
+	// loaded completely, so the cursors aren't clamped to a partial buffer
+	err := e.LoadFile(e.filename)
+	for i, c := range e.Cursors {
+		c.Line, c.Pos = positions[i][0], positions[i][1]
+		c.Validate()
+	}
+	return err
+}
+
+// DiffFile returns the differences between the file on disk and the buffer
+func (e *Editor) DiffFile() ([]DiffLine, error) {
+	f, err := os.Open(e.filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	disk := NewBuffer()
+	if err := disk.LoadFile(f); err != nil {
+		return nil, fmt.Errorf("Could not read %s: %w", e.filename, err)
+	}
+	return Diff(disk.Strings(), e.Buffer.Strings()), nil
+}
+
+// DiffDocument adds a document with the differences between the file on disk
+// and the buffer in unified diff format
+func (e *Editor) DiffDocument() (*Document, error) {
+	diff, err := e.DiffFile()
+	if err != nil {
+		return nil, err
+	}
+	lines := UnifiedDiff(e.filename, e.filename+" (buffer)", diff, 3)
+	if lines == nil {
+		return nil, errors.New("No differences")
+	}
+	d := e.newDocument()
+	d.Buffer.LoadStrings(lines)
+	return d, nil
+}
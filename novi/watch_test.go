@@ -0,0 +1,209 @@
+package novi
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// changeFile writes new content to name, making sure the mtime changes
+func changeFile(t *testing.T, name, content string) {
+	t.Helper()
+
+	if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(name, later, later)
+}
+
+// nullUI is a UI that does nothing, for testing the Core
+type nullUI struct {
+	errors []string
+}
+
+func (u *nullUI) Finish()                              {}
+func (u *nullUI) Loop(chan Event)                      {}
+func (u *nullUI) Render()                              {}
+func (u *nullUI) GetDimension() (int, int)             { return 80, 25 }
+func (u *nullUI) AskInput(string) InputSource          { return 1 }
+func (u *nullUI) CloseInput(InputSource)               {}
+func (u *nullUI) UpdateInput(InputSource, string, int) {}
+func (u *nullUI) SetStatus(string)                     {}
+func (u *nullUI) SetError(msg string)                  { u.errors = append(u.errors, msg) }
+
+func TestCheckFile(t *testing.T) {
+	t.Run("Unchanged file", func(t *testing.T) {
+		e, _, cleanup := setupSave(t, "hello\n", 0644)
+		defer cleanup()
+
+		if change := e.CheckFile(); change != FileUnchanged {
+			t.Errorf("Expected no change, got %d", change)
+		}
+	})
+	t.Run("Change is reported once", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\n", 0644)
+		defer cleanup()
+
+		changeFile(t, name, "changed\n")
+		if change := e.CheckFile(); change != FileModified {
+			t.Errorf("Expected modification, got %d", change)
+		}
+		if change := e.CheckFile(); change != FileUnchanged {
+			t.Errorf("Expected change to be reported once, got %d", change)
+		}
+		if !e.FileChanged() {
+			t.Error("Expected file to still differ from buffer")
+		}
+	})
+	t.Run("Touching a file is not a change", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\n", 0644)
+		defer cleanup()
+
+		changeFile(t, name, "hello\n")
+		if change := e.CheckFile(); change != FileUnchanged {
+			t.Errorf("Expected no change, got %d", change)
+		}
+		if e.FileChanged() {
+			t.Error("Expected file to be the same")
+		}
+	})
+	t.Run("Removed file", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\n", 0644)
+		defer cleanup()
+
+		os.Remove(name)
+		if change := e.CheckFile(); change != FileRemoved {
+			t.Errorf("Expected removal, got %d", change)
+		}
+		if err := e.SaveFile("", false); err != nil {
+			t.Errorf("Expected removed file to be saved, got %v", err)
+		}
+		AssertFileContent(t, name, "hello\n")
+	})
+	t.Run("Changes after saving", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\n", 0644)
+		defer cleanup()
+
+		e.Buffer.AddLine(NewLineFromString("world"))
+		if err := e.SaveFile("", false); err != nil {
+			t.Fatal(err)
+		}
+		if change := e.CheckFile(); change != FileUnchanged {
+			t.Errorf("Own save should not be a change, got %d", change)
+		}
+		changeFile(t, name, "changed\n")
+		if change := e.CheckFile(); change != FileModified {
+			t.Errorf("Expected modification, got %d", change)
+		}
+	})
+}
+
+func TestSaveChangedFile(t *testing.T) {
+	e, name, cleanup := setupSave(t, "hello\n", 0644)
+	defer cleanup()
+
+	changeFile(t, name, "changed\n")
+	e.Buffer.AddLine(NewLineFromString("world"))
+
+	if err := e.SaveFile("", false); !errors.Is(err, ErrSaveFileChanged) {
+		t.Errorf("Expected ErrSaveFileChanged, got %v", err)
+	}
+	AssertFileContent(t, name, "changed\n")
+
+	if err := e.SaveFile("", true); err != nil {
+		t.Fatal(err)
+	}
+	AssertFileContent(t, name, "hello\nworld\n")
+}
+
+func TestFileChangedPrompt(t *testing.T) {
+	t.Run("Reload", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\nworld\n", 0644)
+		defer cleanup()
+		c := NewCore(e, &nullUI{}, nil)
+
+		e.SetCursor(1, 3)
+		changeFile(t, name, "changed\ncontent\nhere\n")
+		e.CheckFile()
+		if done, _ := c.fileChangedPrompt(&FileChangedEvent{Name: name}).handle(&CharacterEvent{Rune: 'r'}); !done {
+			t.Error("Expected prompt to close")
+		}
+		AssertBufferMatch(t, e.Buffer, "changed", "content", "here")
+		AssertBufferModified(t, e.Buffer, false)
+		AssertCursor(t, e.Cursors[0], 1, 3)
+	})
+	t.Run("Keep", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\n", 0644)
+		defer cleanup()
+		c := NewCore(e, &nullUI{}, nil)
+
+		changeFile(t, name, "changed\n")
+		if done, _ := c.fileChangedPrompt(&FileChangedEvent{Name: name}).handle(&KeyEvent{Key: KeyEscape}); !done {
+			t.Error("Expected prompt to close")
+		}
+		AssertBufferMatch(t, e.Buffer, "hello")
+		if change := e.CheckFile(); change != FileUnchanged {
+			t.Errorf("Kept change should not be reported again, got %d", change)
+		}
+	})
+	t.Run("Diff", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\nworld\n", 0644)
+		defer cleanup()
+		c := NewCore(e, &nullUI{}, nil)
+		original := e.Document
+
+		changeFile(t, name, "hello\nthere\nworld\n")
+		p := c.fileChangedPrompt(&FileChangedEvent{Name: name, Number: original.Number()})
+		done, text := p.handle(&CharacterEvent{Rune: 'd'})
+		if done {
+			t.Error("Expected prompt to stay open")
+		}
+		if text != "diff shown in buffer 2" {
+			t.Errorf("Unexpected prompt text %q", text)
+		}
+		AssertBufferMatch(t, e.Buffer, "--- "+name, "+++ "+name+" (buffer)", "@@ -1,3 +1,2 @@", " hello", "-there", " world")
+
+		if done, _ := p.handle(&CharacterEvent{Rune: 'k'}); !done {
+			t.Error("Expected prompt to close")
+		}
+		if e.Document != original || len(e.Documents()) != 1 {
+			t.Errorf("Expected the diff to be closed, got %v", e.ListDocuments())
+		}
+	})
+	t.Run("Other document", func(t *testing.T) {
+		e, name, cleanup := setupSave(t, "hello\n", 0644)
+		defer cleanup()
+		c := NewCore(e, &nullUI{}, nil)
+		original := e.Document
+		e.Document = e.newDocument()
+
+		changeFile(t, name, "changed\n")
+		if change := e.CheckDocument(original); change != FileModified {
+			t.Errorf("Expected FileModified, got %d", change)
+		}
+		p := c.fileChangedPrompt(&FileChangedEvent{Name: name, Number: original.Number()})
+		if done, _ := p.handle(&CharacterEvent{Rune: 'r'}); !done {
+			t.Error("Expected prompt to close")
+		}
+		AssertBufferMatch(t, original.Buffer, "changed")
+		if e.Document == original {
+			t.Error("Reloading should not change the current document")
+		}
+	})
+}
+
+func TestReloadFile(t *testing.T) {
+	lines := buildLines(loadBatchLines + 10)
+	e, _, cleanup := setupSave(t, strings.Join(lines, "\n")+"\n", 0644)
+	defer cleanup()
+
+	e.SetCursor(loadBatchLines+5, 2)
+	if err := e.ReloadFile(); err != nil {
+		t.Fatal(err)
+	}
+	AssertCursor(t, e.Cursors[0], loadBatchLines+5, 2)
+}
@@ -0,0 +1,157 @@
+package novi
+
+import "github.com/mattn/go-runewidth"
+
+/*
+ * With Wrap set, lines longer than the width of the viewport continue on the
+ * next screen rows instead of scrolling horizontally. With LineBreak rows end
+ * after the last blank that fits, so words aren't split (unless a word is
+ * longer than a row). ShowBreak is shown at the start of every row that
+ * continues a line.
+ *
+ * The viewport starts at the first row of a line, unless that line has more
+ * rows than fit: then it skips the rows it needs to show the cursor (see
+ * viewport.go).
+ */
+
+// ScreenRow is the part of a line that's shown on a single screen row
+type ScreenRow struct {
+	Pos, End int // the runes shown, from Pos up to (not including) End
+	Col      int // the screen column of the line the row starts at
+	Indent   int // the columns taken by ShowBreak before the text
+}
+
+// showBreakWidth returns the width of ShowBreak on a row of width columns,
+// 0 if it doesn't leave room for any text
+func (o ViewOptions) showBreakWidth(width int) int {
+	w := runewidth.StringWidth(o.ShowBreak)
+	if w >= width {
+		return 0
+	}
+	return w
+}
+
+// isBlank returns true for the cells a line can be broken after
+func isBlank(c Cell) bool {
+	return c.Runes[0] == ' ' || c.Runes[0] == '\t'
+}
+
+// WrapRows returns the screen rows a line is shown on when it's width
+// columns wide. Without Wrap that's always a single row
+func (o ViewOptions) WrapRows(l *Line, width int) []ScreenRow {
+	if !o.Wrap || width <= 0 {
+		return []ScreenRow{{Pos: 0, End: l.Len()}}
+	}
+	indent := o.showBreakWidth(width)
+	cells := o.Cells(l)
+	rows := []ScreenRow{}
+	row := ScreenRow{}
+	start, brk := 0, 0 // the first cell on the row, the cell after its last blank
+	for i := 0; i < len(cells); i++ {
+		c := cells[i]
+		// the first cell on a row is always shown, even if it doesn't fit
+		if i > start && c.Col+c.Width-row.Col+row.Indent > width {
+			if o.LineBreak && brk > start {
+				i = brk
+			}
+			row.End = cells[i].Pos
+			rows = append(rows, row)
+			row = ScreenRow{Pos: cells[i].Pos, Col: cells[i].Col, Indent: indent}
+			start, brk = i, 0
+			c = cells[i]
+		}
+		if isBlank(c) {
+			brk = i + 1
+		}
+	}
+	row.End = l.Len()
+	return append(rows, row)
+}
+
+// RowOf returns the index of the row rune pos is shown on. A position past
+// the end of the line is on the last row
+func RowOf(rows []ScreenRow, pos int) int {
+	for i, row := range rows {
+		if pos < row.End {
+			return i
+		}
+	}
+	return len(rows) - 1
+}
+
+// ScreenPos returns the row of a line rune pos is shown on and its column on
+// that row, when the line is shown width columns wide. A position just past
+// the end of a full row is shown at the start of the next
+func (o ViewOptions) ScreenPos(l *Line, pos, width int) (int, int) {
+	rows := o.WrapRows(l, width)
+	i := RowOf(rows, pos)
+	x := o.Column(l, pos) - rows[i].Col + rows[i].Indent
+	if o.Wrap && width > 0 && x >= width && pos >= l.Len() {
+		return i + 1, o.showBreakWidth(width)
+	}
+	return i, x
+}
+
+// RowPos returns the position of the rune shown at column x of a row, or the
+// first rune of a cell that covers it. Columns past the end of the row return
+// its last rune, or the end of the line on its last row
+func (o ViewOptions) RowPos(l *Line, row ScreenRow, x int) int {
+	col := row.Col + x - row.Indent
+	if col < row.Col {
+		col = row.Col
+	}
+	pos := o.PosAt(l, col)
+	if pos >= row.End && row.End < l.Len() {
+		return o.PosAt(l, o.Column(l, row.End)-1)
+	}
+	return pos
+}
+
+// ScreenRows returns the screen rows a line of the current document is shown
+// on in the viewport. Without Wrap it's a single row starting at the first
+// column shown
+func (e *Editor) ScreenRows(line int) []ScreenRow {
+	rows := e.ViewOptions.WrapRows(e.Buffer.GetLine(line), e.Viewport.Width)
+	if !e.ViewOptions.Wrap {
+		rows[0].Col = e.Viewport.Col
+	}
+	return rows
+}
+
+// MoveScreenRows returns the position n screen rows down (up if n is
+// negative) from pos on line, at the same column on the screen. It returns
+// false if it can't move at all
+func (e *Editor) MoveScreenRows(line, pos, n int) (int, int, bool) {
+	rows := e.ScreenRows(line)
+	i := RowOf(rows, pos)
+	l := e.Buffer.GetLine(line)
+	x := e.ViewOptions.Column(l, pos) - rows[i].Col + rows[i].Indent
+	moved := false
+	for ; n > 0; n-- {
+		if i < len(rows)-1 {
+			i++
+		} else if line < e.Buffer.Length()-1 {
+			line++
+			rows, i = e.ScreenRows(line), 0
+		} else {
+			break
+		}
+		moved = true
+	}
+	for ; n < 0; n++ {
+		if i > 0 {
+			i--
+		} else if line > 0 {
+			line--
+			rows = e.ScreenRows(line)
+			i = len(rows) - 1
+		} else {
+			break
+		}
+		moved = true
+	}
+	if !moved {
+		return 0, 0, false
+	}
+	return line, e.ViewOptions.RowPos(e.Buffer.GetLine(line), rows[i], x), true
+}
@@ -0,0 +1,114 @@
+package novi
+
+import (
+	"strings"
+	"testing"
+)
+
+func assertRows(t *testing.T, rows []ScreenRow, expected ...ScreenRow) {
+	t.Helper()
+	if len(rows) != len(expected) {
+		t.Fatalf("Expected %d rows, got %d: %v", len(expected), len(rows), rows)
+	}
+	for i, row := range rows {
+		if row != expected[i] {
+			t.Errorf("Expected row %d to be %v, got %v", i, expected[i], row)
+		}
+	}
+}
+
+func TestWrapRows(t *testing.T) {
+	t.Run("No wrap", func(t *testing.T) {
+		rows := ViewOptions{}.WrapRows(NewLineFromString("hello world"), 4)
+		assertRows(t, rows, ScreenRow{0, 11, 0, 0})
+	})
+	t.Run("Wrap", func(t *testing.T) {
+		rows := ViewOptions{Wrap: true}.WrapRows(NewLineFromString("hello world"), 4)
+		assertRows(t, rows, ScreenRow{0, 4, 0, 0}, ScreenRow{4, 8, 4, 0}, ScreenRow{8, 11, 8, 0})
+	})
+	t.Run("Empty line", func(t *testing.T) {
+		rows := ViewOptions{Wrap: true}.WrapRows(NewLineFromString(""), 4)
+		assertRows(t, rows, ScreenRow{0, 0, 0, 0})
+	})
+	t.Run("Linebreak", func(t *testing.T) {
+		opts := ViewOptions{Wrap: true, LineBreak: true}
+		rows := opts.WrapRows(NewLineFromString("aa bb cc dddddddd"), 7)
+		assertRows(t, rows, ScreenRow{0, 6, 0, 0}, ScreenRow{6, 9, 6, 0}, ScreenRow{9, 16, 9, 0}, ScreenRow{16, 17, 16, 0})
+	})
+	t.Run("Showbreak", func(t *testing.T) {
+		opts := ViewOptions{Wrap: true, ShowBreak: "> "}
+		rows := opts.WrapRows(NewLineFromString("abcdefghij"), 5)
+		assertRows(t, rows, ScreenRow{0, 5, 0, 0}, ScreenRow{5, 8, 5, 2}, ScreenRow{8, 10, 8, 2})
+	})
+	t.Run("Wide characters don't split", func(t *testing.T) {
+		rows := ViewOptions{Wrap: true}.WrapRows(NewLineFromString("a日本"), 4)
+		assertRows(t, rows, ScreenRow{0, 2, 0, 0}, ScreenRow{2, 3, 3, 0})
+	})
+}
+
+func TestScreenPos(t *testing.T) {
+	opts := ViewOptions{Wrap: true, ShowBreak: ">"}
+	l := NewLineFromString("abcdefgh")
+	for _, tc := range []struct {
+		pos, row, x int
+	}{
+		{0, 0, 0}, {3, 0, 3}, {4, 1, 1}, {7, 2, 1}, {8, 2, 2},
+	} {
+		if row, x := opts.ScreenPos(l, tc.pos, 4); row != tc.row || x != tc.x {
+			t.Errorf("Expected pos %d at %d,%d, got %d,%d", tc.pos, tc.row, tc.x, row, x)
+		}
+	}
+	// the end of a full row is at the start of the next
+	if row, x := opts.ScreenPos(NewLineFromString("abcdefg"), 7, 4); row != 2 || x != 1 {
+		t.Errorf("Expected the end at 2,1, got %d,%d", row, x)
+	}
+}
+
+func TestWrappedViewport(t *testing.T) {
+	e := NewEditor()
+	e.Buffer.LoadStrings([]string{"0123456789", "0123456789", "0123456789", "a", "b"})
+	e.ViewOptions.Wrap = true
+	e.UpdateViewport(4, 6)
+	assertVisible(t, e, 0, 1)
+
+	e.Cursors[0].Line = 3
+	e.UpdateViewport(4, 6)
+	assertVisible(t, e, 2, 4)
+
+	if line, pos, ok := e.MoveScreenRows(3, 0, -2); !ok || line != 2 || pos != 4 {
+		t.Errorf("Expected to move to 2,4, got %d,%d (%v)", line, pos, ok)
+	}
+	if _, _, ok := e.MoveScreenRows(4, 0, 1); ok {
+		t.Error("Expected not to move down from the last row")
+	}
+}
+
+func TestSkippedRows(t *testing.T) {
+	e := NewEditor()
+	e.Buffer.LoadStrings([]string{"a", strings.Repeat("0123456789", 5), "b"})
+	e.ViewOptions.Wrap = true
+	c := e.Cursors[0]
+	assertSkip := func(line, skip int) {
+		t.Helper()
+		e.UpdateViewport(4, 3)
+		if e.Viewport.Line != line || e.Viewport.Skip != skip {
+			t.Errorf("Expected line %d skipping %d rows, got %d skipping %d",
+				line, skip, e.Viewport.Line, e.Viewport.Skip)
+		}
+	}
+	c.Line, c.Pos = 1, 30
+	assertSkip(1, 5)
+	assertVisible(t, e, 1, 1)
+
+	c.Pos = 22
+	assertSkip(1, 5)
+	c.Pos = 12
+	assertSkip(1, 3)
+	c.Pos = 49
+	assertSkip(1, 10)
+
+	c.Line, c.Pos = 2, 0
+	assertSkip(2, 0)
+	c.Line = 0
+	assertSkip(0, 0)
+}
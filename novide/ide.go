@@ -34,6 +34,11 @@ func BuildEditor(app *tview.Application, fullpath string, editor *novi.Editor, c
 	c := novi.NewCore(editor, ui, emu)
 
 	go func() {
+		// a panic in a tab brings down the ide, save what we can
+		defer novi.RecoverFromPanic(func() {
+			app.Stop()
+			editor.FlushSwap()
+		})
 		c.Loop()
 		ch <- &CloseTabEvent{FullPath: fullpath}
 	}()
@@ -81,7 +86,10 @@ func Run() {
 				case *OpenFileEvent:
 					log.Printf("Opening tab for %s", e.Filename)
 					editor := novi.NewEditor()
-					editor.LoadFile(e.FullPath)
+					if err := editor.LoadFileAsync(e.FullPath); err != nil {
+						fmt.Fprintln(debug, err.Error())
+						return
+					}
 					editor.SetCursor(0, 0)
 
 					// pass a more generic tab id in stead of full path?
@@ -96,7 +104,10 @@ func Run() {
 							os.Create(p)
 							// DUP!
 							editor := novi.NewEditor()
-							editor.LoadFile(p)
+							if err := editor.LoadFileAsync(p); err != nil {
+								fmt.Fprintln(debug, err.Error())
+								return
+							}
 							editor.SetCursor(0, 0)
 
 							// pass a more generic tab id in stead of full path?
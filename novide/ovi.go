@@ -26,6 +26,7 @@ type Ovi struct {
 	InputPos   int
 	statusMsg  string
 	errorMsg   string
+	Theme      termui.Theme
 }
 
 func NewOviPrimitive(e *novi.Editor) tview.Primitive {
@@ -44,7 +45,8 @@ func NewOviPrimitive(e *novi.Editor) tview.Primitive {
 		statusArea: statusArea,
 		Source:     MainSource,
 		c:          nil,
-		InputPos:   -1}
+		InputPos:   -1,
+		Theme:      termui.DefaultTheme}
 
 	editArea.SetDrawFunc(o.TviewRender)
 	editArea.SetInputCapture(o.HandleInput)
@@ -58,6 +60,7 @@ func (o *Ovi) SetChan(c chan novi.Event) {
 
 func (o *Ovi) TviewRender(screen tcell.Screen, xx, yy, width, height int) (int, int, int, int) {
 	ui := termui.NewTCellUI(screen, xx, yy, width, height)
+	ui.Theme = o.Theme
 	ui.RenderTCell(o.Editor)
 	if o.Source == CommandSource {
 		x, y, _, _ := o.statusArea.GetInnerRect()
@@ -9,8 +9,9 @@ import (
 
 // OviWrapper wraps the OviPrimitive into something that we can pass to the novi.Core
 type OviWrapper struct {
-	prim *Ovi
-	app  *tview.Application
+	prim   *Ovi
+	app    *tview.Application
+	prompt string
 }
 
 // NewWrapper wraps an Ovi primitive
@@ -35,9 +36,10 @@ func (o *OviWrapper) GetDimension() (int, int) {
 }
 
 // AskInput will instruct the UI to ask for additional, "inline" input
-func (o *OviWrapper) AskInput(string) novi.InputSource {
+func (o *OviWrapper) AskInput(prompt string) novi.InputSource {
 	// handle keys from status
 	o.prim.Source = CommandSource
+	o.prompt = prompt
 
 	o.UpdateInput(CommandSource, "", 0)
 	return CommandSource
@@ -50,7 +52,7 @@ func (o *OviWrapper) CloseInput(novi.InputSource) {
 
 // UpdateInput is called to update the inline input
 func (o *OviWrapper) UpdateInput(source novi.InputSource, s string, pos int) {
-	o.prim.UpdateInput(":"+s, pos+1)
+	o.prim.UpdateInput(o.prompt+s, len(o.prompt)+pos)
 }
 
 // SetStatus sets the status of the editor
@@ -3,6 +3,7 @@ package termui
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
 	"time"
 
@@ -170,23 +171,25 @@ func (t *TermUI) Render() {
 type TCellUI struct {
 	baseX, baseY, width, height int
 	screen                      tcell.Screen
+
+	Theme Theme // the styles of highlighted syntax
 }
 
 // NewTCellUI creates a new instance
 func NewTCellUI(screen tcell.Screen, baseX, baseY, width, height int) *TCellUI {
-	return &TCellUI{baseX, baseY, width, height, screen}
+	return &TCellUI{baseX, baseY, width, height, screen, DefaultTheme}
 }
 
-// RenderTCellGutter renders the numbering (and more) gutter
-func (t *TCellUI) RenderTCellGutter(start, end int, guttersize int) {
+// RenderTCellGutter renders the numbering (and more) gutter. numbers has the
+// line number for every screen row, 0 for rows that don't start a line
+func (t *TCellUI) RenderTCellGutter(numbers []int, guttersize int) {
 	// drawGutter should decide size, return it,
 	// should perhaps check if numbering is enabled
 
 	for y := 0; y < t.height; y++ {
 		l := ""
-		lineno := y + start
-		if lineno < end {
-			l = strconv.Itoa(start + y + 1)
+		if y < len(numbers) && numbers[y] > 0 {
+			l = strconv.Itoa(numbers[y])
 		}
 		for len(l) < guttersize-1 {
 			l = " " + l
@@ -203,48 +206,97 @@ func (t *TCellUI) RenderTCell(editor *novi.Editor) {
 
 	editWidth, editHeight := t.width-guttersize, t.height
 
-	primaryCursor := editor.Cursors[0]
-
-	ViewportX, ViewportY := 0, 0
-
-	if primaryCursor.Pos > ViewportX+editWidth-1 {
-		ViewportX = primaryCursor.Pos - (editWidth - 1)
-	}
-	if primaryCursor.Pos < ViewportX {
-		ViewportX = primaryCursor.Pos
-	}
-
-	if primaryCursor.Line > ViewportY+editHeight-1 {
-		ViewportY = primaryCursor.Line - (editHeight - 1)
-	}
-	if primaryCursor.Line < ViewportY {
-		ViewportY = primaryCursor.Line
-	}
+	editor.UpdateViewport(editWidth, editHeight)
+	ViewportY := editor.Viewport.Line
 
 	/*
 	 * Print the text within the current viewports, padding lines with `fillRune`
-	 * to clear any remainders. THe latter is relevant when scrolling, for example
+	 * to clear any remainders. THe latter is relevant when scrolling, for example.
+	 * A line is shown on several rows when wrapping. Syntax is styled using the
+	 * theme, search matches and the selection override that
 	 */
 	inverse := tcell.StyleDefault.Foreground(tcell.ColorBlack).Background(tcell.ColorWhite)
+	highlight := tcell.StyleDefault.Foreground(tcell.ColorBlack).Background(tcell.ColorYellow)
+	nonText := tcell.StyleDefault.Foreground(tcell.ColorBlue)
+	opts := editor.ViewOptions
+	var numbers []int
 	y := 0
-	for _, line := range editor.Buffer.GetLines(ViewportY, ViewportY+editHeight) {
-		x := 0
-		for _, rune := range line.GetRunes(ViewportX, ViewportX+editWidth) {
-			style := tcell.StyleDefault
-			if editor.Selection.InSelection(y, x) {
-				style = inverse
-			}
-			t.screen.SetContent(t.baseX+x+guttersize, t.baseY+y, rune, nil, style)
-			x++
+	for lineno := ViewportY; lineno < editor.Buffer.Length() && y < editHeight; lineno++ {
+		line := editor.Buffer.GetLine(lineno)
+		var matches []novi.Match
+		if editor.Highlight != nil {
+			matches = editor.Highlight.MatchesOn(editor.Buffer, lineno)
 		}
-		for x < editWidth {
-			t.screen.SetContent(t.baseX+x+guttersize, t.baseY+y, ' ', nil, tcell.StyleDefault)
-			x++
+		var tokens []novi.Token
+		if editor.Syntax != nil {
+			tokens = editor.Syntax.Tokens(lineno)
+		}
+		cells := opts.Cells(line)
+		m := 0 // the first match that doesn't end before the current cell
+		for i, row := range editor.ScreenRows(lineno) {
+			if y >= editHeight {
+				break
+			}
+			if lineno == ViewportY && i < editor.Viewport.Skip {
+				continue
+			}
+			if i == 0 {
+				numbers = append(numbers, lineno+1)
+			} else {
+				numbers = append(numbers, 0)
+			}
+			x := 0
+			for _, r := range opts.ShowBreak {
+				if x < row.Indent {
+					t.screen.SetContent(t.baseX+x+guttersize, t.baseY+y, r, nil, nonText)
+					x++
+				}
+			}
+			first := sort.Search(len(cells), func(i int) bool {
+				return cells[i].Pos >= row.Pos && cells[i].Col+cells[i].Width > row.Col
+			})
+			for _, cell := range cells[first:] {
+				if cell.Pos >= row.End || cell.Col-row.Col+row.Indent >= editWidth {
+					break
+				}
+				style := t.Theme.Style(novi.TokenAt(tokens, cell.Pos))
+				for m < len(matches) && matches[m].End <= cell.Pos {
+					m++
+				}
+				if m < len(matches) && cell.Pos >= matches[m].Pos {
+					style = highlight
+				}
+				if editor.Selection.InSelection(lineno, cell.Pos, cell.Col) {
+					style = inverse
+				}
+				x = cell.Col - row.Col + row.Indent
+				text := cell.Text()
+				switch {
+				case x < row.Indent || x+cell.Width > editWidth:
+					// partly out of view, which only tabs and wide characters can be
+					for i := 0; i < cell.Width; i++ {
+						if x+i >= row.Indent && x+i < editWidth {
+							t.screen.SetContent(t.baseX+x+i+guttersize, t.baseY+y, ' ', nil, style)
+						}
+					}
+				case cell.Expanded():
+					for i, r := range text {
+						t.screen.SetContent(t.baseX+x+i+guttersize, t.baseY+y, r, nil, style)
+					}
+				default:
+					t.screen.SetContent(t.baseX+x+guttersize, t.baseY+y, text[0], text[1:], style)
+				}
+				x += cell.Width
+			}
+			for x < editWidth {
+				t.screen.SetContent(t.baseX+x+guttersize, t.baseY+y, ' ', nil, tcell.StyleDefault)
+				x++
+			}
+			y++
 		}
-		y++
 	}
 
-	t.RenderTCellGutter(ViewportY, ViewportY+y, guttersize)
+	t.RenderTCellGutter(numbers, guttersize)
 
 	for y < editHeight {
 		for x := 0; x < editWidth; x++ {
@@ -255,12 +307,28 @@ func (t *TCellUI) RenderTCell(editor *novi.Editor) {
 	// To make the cursor blink, show/hide it?
 	for _, cursor := range editor.Cursors {
 		if cursor.Line != -1 {
-			t.screen.ShowCursor(t.baseX+cursor.Pos-ViewportX+guttersize, t.baseY+cursor.Line-ViewportY)
+			t.screen.ShowCursor(t.cursorPos(editor, cursor, guttersize))
 		}
 		// else probably show at (0,0)
 	}
 }
 
+// cursorPos returns the screen position of a cursor
+func (t *TCellUI) cursorPos(editor *novi.Editor, cursor *novi.Cursor, guttersize int) (int, int) {
+	opts := editor.ViewOptions
+	line := editor.Buffer.GetLine(cursor.Line)
+	if !opts.Wrap {
+		col := opts.Column(line, cursor.Pos)
+		return t.baseX + col - editor.Viewport.Col + guttersize, t.baseY + cursor.Line - editor.Viewport.Line
+	}
+	y := -editor.Viewport.Skip
+	for l := editor.Viewport.Line; l < cursor.Line; l++ {
+		y += len(editor.ScreenRows(l))
+	}
+	row, x := opts.ScreenPos(line, cursor.Pos, editor.Viewport.Width)
+	return t.baseX + x + guttersize, t.baseY + y + row
+}
+
 // TCellNoviUI contains Novi specific functionalitie (notably: statusbar, input)
 type TCellNoviUI struct {
 	*TCellUI
@@ -268,7 +336,7 @@ type TCellNoviUI struct {
 
 // NewTCellNoviUI creates a new instance
 func NewTCellNoviUI(screen tcell.Screen, baseX, baseY, width, height int) *TCellNoviUI {
-	return &TCellNoviUI{&TCellUI{baseX, baseY, width, height, screen}}
+	return &TCellNoviUI{NewTCellUI(screen, baseX, baseY, width, height)}
 }
 
 // RenderTCellInput renders the bar in input mode/state
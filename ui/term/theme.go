@@ -0,0 +1,36 @@
+package termui
+
+import (
+	"github.com/gdamore/tcell"
+	"github.com/iivvoo/novi/novi"
+)
+
+// Theme maps the token types of syntax highlighting to styles
+type Theme map[novi.TokenType]tcell.Style
+
+// DefaultTheme is the theme used unless another one is set
+var DefaultTheme = Theme{
+	novi.TokenKeyword:  tcell.StyleDefault.Foreground(tcell.ColorYellow),
+	novi.TokenTypeName: tcell.StyleDefault.Foreground(tcell.ColorGreen),
+	novi.TokenBuiltin:  tcell.StyleDefault.Foreground(tcell.ColorAqua),
+	novi.TokenConstant: tcell.StyleDefault.Foreground(tcell.ColorFuchsia),
+	novi.TokenString:   tcell.StyleDefault.Foreground(tcell.ColorRed),
+	novi.TokenNumber:   tcell.StyleDefault.Foreground(tcell.ColorFuchsia),
+	novi.TokenComment:  tcell.StyleDefault.Foreground(tcell.ColorTeal),
+	novi.TokenOperator: tcell.StyleDefault.Foreground(tcell.ColorOlive),
+	novi.TokenKey:      tcell.StyleDefault.Foreground(tcell.ColorAqua),
+	novi.TokenVariable: tcell.StyleDefault.Foreground(tcell.ColorAqua),
+	novi.TokenHeading:  tcell.StyleDefault.Foreground(tcell.ColorFuchsia).Bold(true),
+	novi.TokenEmphasis: tcell.StyleDefault.Bold(true),
+	novi.TokenCode:     tcell.StyleDefault.Foreground(tcell.ColorRed),
+	novi.TokenLink:     tcell.StyleDefault.Foreground(tcell.ColorBlue).Underline(true),
+}
+
+// Style returns the style of a token type, the default style for text and
+// types the theme doesn't have
+func (t Theme) Style(typ novi.TokenType) tcell.Style {
+	if style, ok := t[typ]; ok {
+		return style
+	}
+	return tcell.StyleDefault
+}